@@ -15,6 +15,9 @@ type Config struct {
 	JWT      JWTConfig     `yaml:"jwt"`
 	CORS     CORSConfig    `yaml:"cors"`
 	Log      LogConfig     `yaml:"log"`
+	Device   DeviceConfig  `yaml:"device"`
+	Alert    AlertConfig   `yaml:"alert"`
+	Security SecurityConfig `yaml:"security"`
 }
 
 // ServerConfig 服务器配置
@@ -40,6 +43,14 @@ type JWTConfig struct {
 	Issuer string       `yaml:"issuer"`
 }
 
+// SecurityConfig 安全配置
+type SecurityConfig struct {
+	// EncryptionKey 加密存储设备密钥等敏感数据的密钥，与JWT密钥分开，轮换JWT密钥不影响已加密的数据
+	//
+	// 为空时使用JWT密钥，兼容之前用JWT密钥加密的数据；此时轮换JWT密钥前需先将本项设置为原JWT密钥。
+	EncryptionKey string `yaml:"encryption_key"`
+}
+
 // CORSConfig CORS配置
 type CORSConfig struct {
 	AllowedOrigins     []string `yaml:"allowed_origins"`
@@ -59,6 +70,38 @@ type LogConfig struct {
 	Compress   bool   `yaml:"compress"`
 }
 
+// DeviceConfig 设备接入配置
+type DeviceConfig struct {
+	RegisterRateLimit       int           `yaml:"register_rate_limit"`       // 每个IP每分钟允许的自注册请求数，0表示不限制
+	SignatureMaxSkew        time.Duration `yaml:"signature_max_skew"`        // 签名请求允许的最大时间偏差
+	CredentialRotationGrace time.Duration `yaml:"credential_rotation_grace"` // 凭证轮换后旧凭证的保留时间
+	ClientCertHeader        string        `yaml:"client_cert_header"`        // 反向代理传递客户端证书指纹的请求头，为空时仅信任直连TLS证书
+	UnblockCheckInterval    time.Duration `yaml:"unblock_check_interval"`    // 检查临时封禁到期的间隔
+	MaintenanceInterval     time.Duration `yaml:"maintenance_interval"`      // 检查维护窗口开始和结束的间隔
+	CommandDefaultTTL       time.Duration `yaml:"command_default_ttl"`       // 远程命令未指定有效期时的默认值
+	CommandMaxTTL           time.Duration `yaml:"command_max_ttl"`           // 远程命令允许的最长有效期
+	CommandLongPollTimeout  time.Duration `yaml:"command_long_poll_timeout"` // 设备长轮询拉取命令的最长等待时间
+	MonitorInterval         time.Duration `yaml:"monitor_interval"`          // 设备监控检查离线设备和空闲会话的间隔
+	HeartbeatTimeoutFactor  float64       `yaml:"heartbeat_timeout_factor"`  // 超过心跳间隔的多少倍未收到心跳视为离线
+	OfflineThreshold        time.Duration `yaml:"offline_threshold"`         // 从未上报心跳的设备超过该时间未活动视为离线
+	AbnormalCheckInterval   time.Duration `yaml:"abnormal_check_interval"`   // 异常行为检查的间隔
+	UsageRollupInterval     time.Duration `yaml:"usage_rollup_interval"`     // 重新计算当天和本周使用统计的间隔
+	DuplicateCheckInterval  time.Duration `yaml:"duplicate_check_interval"`  // 重复设备检测的间隔
+	DuplicateScoreThreshold float64       `yaml:"duplicate_score_threshold"` // 相似度达到该值（0-1）的设备对列为疑似重复
+	LogMaxBodySize          int64         `yaml:"log_max_body_size"`         // 日志上报请求体（压缩后）的最大字节数
+	LogMaxDecodedSize       int64         `yaml:"log_max_decoded_size"`      // 日志上报请求体解压后的最大字节数
+	LogMaxBatchSize         int           `yaml:"log_max_batch_size"`        // 单次上报的最大日志和活动条数
+}
+
+// AlertConfig 告警规则配置
+type AlertConfig struct {
+	RuleInterval              time.Duration `yaml:"rule_interval"`               // 定时评估告警规则的间隔
+	NotificationTimeout       time.Duration `yaml:"notification_timeout"`        // 单次发送通知的超时时间
+	NotificationMaxAttempts   int           `yaml:"notification_max_attempts"`   // 通知最多发送次数，包括首次发送
+	NotificationRetryBackoff  time.Duration `yaml:"notification_retry_backoff"`  // 首次重试的等待时间，之后每次加倍
+	NotificationRetryInterval time.Duration `yaml:"notification_retry_interval"` // 检查待重试通知的间隔
+}
+
 // GlobalConfig 全局配置实例
 var GlobalConfig Config
 
@@ -113,6 +156,33 @@ func setDefaultConfig() {
 			MaxAge:     28,
 			Compress:   true,
 		},
+		Device: DeviceConfig{
+			RegisterRateLimit:       10,
+			SignatureMaxSkew:        5 * time.Minute,
+			CredentialRotationGrace: 10 * time.Minute,
+			UnblockCheckInterval:    time.Minute,
+			MaintenanceInterval:     time.Minute,
+			CommandDefaultTTL:       24 * time.Hour,
+			CommandMaxTTL:           7 * 24 * time.Hour,
+			CommandLongPollTimeout:  30 * time.Second,
+			MonitorInterval:         time.Minute,
+			HeartbeatTimeoutFactor:  2,
+			OfflineThreshold:        30 * time.Minute,
+			AbnormalCheckInterval:   5 * time.Minute,
+			UsageRollupInterval:     10 * time.Minute,
+			DuplicateCheckInterval:  time.Hour,
+			DuplicateScoreThreshold: 0.5,
+			LogMaxBodySize:          1 << 20,
+			LogMaxDecodedSize:       8 << 20,
+			LogMaxBatchSize:         500,
+		},
+		Alert: AlertConfig{
+			RuleInterval:              time.Minute,
+			NotificationTimeout:       10 * time.Second,
+			NotificationMaxAttempts:   5,
+			NotificationRetryBackoff:  30 * time.Second,
+			NotificationRetryInterval: 15 * time.Second,
+		},
 	}
 }
 
@@ -208,6 +278,11 @@ func loadFromEnv() {
 		GlobalConfig.JWT.Issuer = issuer
 	}
 
+	// 安全配置
+	if key := os.Getenv("ENCRYPTION_KEY"); key != "" {
+		GlobalConfig.Security.EncryptionKey = key
+	}
+
 	// 服务器配置
 	if host := os.Getenv("SERVER_HOST"); host != "" {
 		GlobalConfig.Server.Host = host
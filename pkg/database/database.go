@@ -136,6 +136,32 @@ func autoMigrate() error {
         &model.DeviceLocation{},
         &model.AbnormalBehavior{},
         &model.BlacklistRule{},
+        &model.DeviceCredential{},
+        &model.DeviceBlockHistory{},
+        &model.DeviceStatusHistory{},
+        &model.DeviceLog{},
+        &model.DeviceActivity{},
+        &model.DeviceMaintenance{},
+        &model.Alert{},
+        &model.AlertRule{},
+        &model.AnomalyBaseline{},
+        &model.NotificationChannel{},
+        &model.NotificationDelivery{},
+        &model.DeviceConfig{},
+        &model.DeviceConfigHistory{},
+        &model.DeviceConfigState{},
+        &model.DeviceGroup{},
+        &model.DevicePolicy{},
+        &model.DeviceTag{},
+        &model.DeviceDuplicate{},
+        &model.DeviceCommand{},
+        &model.UsageRecord{},
+        &model.DeviceUsageRollup{},
+        &model.GroupUsageRollup{},
+        &model.OperationLog{},
+        &model.BulkOperation{},
+        &model.BulkOperationResult{},
+        &model.MetadataSchema{},
     ); err != nil {
         return fmt.Errorf("迁移其他模型失败: %v", err)
     }
@@ -3,8 +3,10 @@ package handler
 import (
 	"LVerity/pkg/model"
 	"LVerity/pkg/service"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -27,7 +29,7 @@ func CreateAlert(c *gin.Context) {
 
 	alert, err := service.CreateAlert(req.DeviceID, req.Type, req.Level, req.Message, req.Metadata)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		c.JSON(alertErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
@@ -48,7 +50,7 @@ func GetAlert(c *gin.Context) {
 	alertID := c.Param("id")
 	alert, err := service.GetAlert(alertID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "告警不存在"})
+		c.JSON(alertErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
@@ -61,12 +63,12 @@ func GetAlert(c *gin.Context) {
 // @Tags 告警管理
 // @Accept json
 // @Produce json
-// @Param deviceId path string true "设备ID"
+// @Param id path string true "设备ID"
 // @Success 200 {array} model.Alert
 // @Failure 400 {object} ErrorResponse
-// @Router /api/v1/devices/{deviceId}/alerts [get]
+// @Router /api/v1/devices/{id}/alerts [get]
 func GetAlertsByDevice(c *gin.Context) {
-	deviceID := c.Param("deviceId")
+	deviceID := c.Param("id")
 	alerts, err := service.GetAlertsByDevice(deviceID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
@@ -86,6 +88,7 @@ func GetAlertsByDevice(c *gin.Context) {
 // @Param status body UpdateAlertStatusRequest true "新状态"
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Router /api/v1/alerts/{id}/status [put]
 func UpdateAlertStatus(c *gin.Context) {
 	alertID := c.Param("id")
@@ -96,32 +99,55 @@ func UpdateAlertStatus(c *gin.Context) {
 	}
 
 	if err := service.UpdateAlertStatus(alertID, req.Status); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		c.JSON(alertErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, SuccessResponse{Message: "告警状态已更新"})
 }
 
-// GetAlertsByStatus 获取指定状态的告警
-// @Summary 获取指定状态的告警列表
-// @Description 获取系统中指定状态的所有告警
+// ListAlerts 获取告警列表
+// @Summary 获取告警列表
+// @Description 按设备、状态、级别、规则和创建时间过滤告警，按创建时间倒序分页返回
 // @Tags 告警管理
 // @Accept json
 // @Produce json
-// @Param status query string true "告警状态"
-// @Success 200 {array} model.Alert
+// @Param device_id query string false "设备ID"
+// @Param status query string false "告警状态"
+// @Param level query string false "告警级别"
+// @Param rule_id query string false "产生告警的规则ID"
+// @Param from query string false "开始时间（RFC3339）"
+// @Param to query string false "结束时间（RFC3339）"
+// @Param page query int false "页码"
+// @Param pageSize query int false "每页数量"
+// @Success 200 {object} AlertListResponse
 // @Failure 400 {object} ErrorResponse
 // @Router /api/v1/alerts [get]
-func GetAlertsByStatus(c *gin.Context) {
-	status := model.AlertStatus(c.Query("status"))
-	alerts, err := service.GetAlertsByStatus(status)
-	if err != nil {
+func ListAlerts(c *gin.Context) {
+	filter := service.AlertFilter{
+		DeviceID: c.Query("device_id"),
+		Status:   model.AlertStatus(c.Query("status")),
+		Level:    model.AlertLevel(c.Query("level")),
+		RuleID:   c.Query("rule_id"),
+	}
+	var err error
+	if filter.StartTime, err = parseTimeQuery(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if filter.EndTime, err = parseTimeQuery(c, "to"); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, alerts)
+	page, pageSize := parsePagination(c)
+	alerts, total, err := service.ListAlerts(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, AlertListResponse{List: alerts, Total: total})
 }
 
 // GetAlertsByTimeRange 获取时间范围内的告警
@@ -184,6 +210,70 @@ func GetAlertCount(c *gin.Context) {
 	c.JSON(http.StatusOK, AlertCountResponse{Count: count})
 }
 
+// ListAlertActions 获取告警上规则动作的执行记录
+// @Summary 获取告警动作记录
+// @Description 获取产生告警的规则动作的执行记录，包括执行状态和撤销情况
+// @Tags 告警管理
+// @Produce json
+// @Param id path string true "告警ID"
+// @Success 200 {array} model.AlertActionRecord
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/alerts/{id}/actions [get]
+func ListAlertActions(c *gin.Context) {
+	records, err := service.ListAlertActions(c.Param("id"))
+	if err != nil {
+		c.JSON(alertErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+	if records == nil {
+		records = []model.AlertActionRecord{}
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+// RevertAlertAction 撤销告警上已执行的规则动作
+// @Summary 撤销告警动作
+// @Description 撤销规则动作对设备的修改，已撤销的动作重复撤销时直接返回告警
+// @Tags 告警管理
+// @Produce json
+// @Param id path string true "告警ID"
+// @Param index path int true "动作序号"
+// @Success 200 {object} model.Alert
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/alerts/{id}/actions/{index}/revert [post]
+func RevertAlertAction(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "无效的动作序号"})
+		return
+	}
+
+	alert, err := service.RevertAlertAction(c.Param("id"), index, c.GetString("userID"))
+	if err != nil {
+		c.JSON(alertErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// alertErrorStatus 将告警服务的错误映射为HTTP状态码
+func alertErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAlertNotFound), errors.Is(err, service.ErrAlertActionNotFound),
+		errors.Is(err, service.ErrDeviceNotFound), errors.Is(err, service.ErrCommandNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrAlertSuppressed), errors.Is(err, service.ErrAlertActionNotReversible),
+		errors.Is(err, service.ErrAlertActionConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 // Request and Response types
 
 type CreateAlertRequest struct {
@@ -198,6 +288,11 @@ type UpdateAlertStatusRequest struct {
 	Status model.AlertStatus `json:"status" binding:"required"`
 }
 
+type AlertListResponse struct {
+	List  []model.Alert `json:"list"`
+	Total int64         `json:"total"`
+}
+
 type AlertCountResponse struct {
 	Count int64 `json:"count"`
 }
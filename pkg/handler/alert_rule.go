@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/repository"
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAlertRules 获取告警规则列表，可按type、device_id和enabled过滤
+func ListAlertRules(c *gin.Context) {
+	filter := repository.AlertRuleFilter{
+		Type:     model.AlertRuleType(c.Query("type")),
+		DeviceID: c.Query("device_id"),
+	}
+	if value := c.Query("enabled"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":       false,
+				"error_message": "invalid enabled",
+			})
+			return
+		}
+		filter.Enabled = &enabled
+	}
+
+	page, pageSize := parsePagination(c)
+	rules, total, err := service.ListAlertRules(filter, page, pageSize)
+	if err != nil {
+		c.JSON(alertRuleErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  rules,
+			"total": total,
+		},
+	})
+}
+
+// CreateAlertRule 创建告警规则，conditions和actions按规则类型校验
+func CreateAlertRule(c *gin.Context) {
+	var input service.AlertRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	rule, err := service.CreateAlertRule(input)
+	if err != nil {
+		c.JSON(alertRuleErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// GetAlertRule 获取告警规则
+func GetAlertRule(c *gin.Context) {
+	rule, err := service.GetAlertRule(c.Param("id"))
+	if err != nil {
+		c.JSON(alertRuleErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// UpdateAlertRule 替换告警规则，enabled为空时保持不变
+func UpdateAlertRule(c *gin.Context) {
+	var input service.AlertRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	rule, err := service.UpdateAlertRule(c.Param("id"), input)
+	if err != nil {
+		c.JSON(alertRuleErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// DeleteAlertRule 删除告警规则，已产生的告警保留
+func DeleteAlertRule(c *gin.Context) {
+	if err := service.DeleteAlertRule(c.Param("id")); err != nil {
+		c.JSON(alertRuleErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// DryRunAlertRule 用历史数据试运行已保存或未保存的规则，返回规则会产生的告警
+func DryRunAlertRule(c *gin.Context) {
+	var req service.AlertRuleDryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	result, err := service.DryRunAlertRule(req)
+	if err != nil {
+		c.JSON(alertRuleErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// alertRuleErrorStatus 将告警规则服务的错误映射为HTTP状态码
+func alertRuleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAlertRuleNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidAlertRule), errors.Is(err, service.ErrInvalidDryRun):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"LVerity/pkg/database"
 	"LVerity/pkg/model"
 	"LVerity/pkg/service"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -36,6 +39,8 @@ type ExportLogsRequest struct {
 	EndTime   time.Time          `json:"end_time"`
 	DeviceID  string             `json:"device_id"`
 	LogTypes  []string           `json:"log_types"`
+	Levels    []model.LogLevel   `json:"levels"`
+	Source    string             `json:"source"`
 	Format    model.ExportFormat `json:"format"`
 }
 
@@ -56,16 +61,152 @@ func RegisterDevice(c *gin.Context) {
 	c.JSON(http.StatusOK, device)
 }
 
+// BlockDeviceRequest 封禁设备请求，duration_hours和until均为空时永久封禁
+type BlockDeviceRequest struct {
+	Reason        string     `json:"reason"`
+	DurationHours float64    `json:"duration_hours"`
+	Until         *time.Time `json:"until"`
+}
+
 // BlockDevice 封禁设备
 func BlockDevice(c *gin.Context) {
 	deviceID := c.Param("id")
 
-	if err := service.BlockDevice(deviceID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req BlockDeviceRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	device, err := service.BlockDeviceWithOptions(deviceID, service.BlockOptions{
+		Reason:   req.Reason,
+		Duration: time.Duration(req.DurationHours * float64(time.Hour)),
+		Until:    req.Until,
+		Operator: c.GetString("userID"),
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Device blocked successfully",
+		"unblock_time": device.UnblockTime,
+	})
+}
+
+// UnblockDeviceRequest 解封设备请求
+type UnblockDeviceRequest struct {
+	Reason string `json:"reason"`
+}
+
+// UnblockDevice 解封设备
+func UnblockDevice(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req UnblockDeviceRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := service.UnblockDeviceWithReason(deviceID, c.GetString("userID"), req.Reason); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device unblocked successfully"})
+}
+
+// GetDeviceBlockHistory 获取设备封禁/解封历史
+func GetDeviceBlockHistory(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	history, err := service.GetDeviceBlockHistory(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetDeviceStatusHistory 获取设备状态变更历史，支持start_time/end_time（RFC3339）过滤
+func GetDeviceStatusHistory(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	startTime, err := parseTimeQuery(c, "start_time")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	endTime, err := parseTimeQuery(c, "end_time")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	history, total, err := service.GetDeviceStatusHistory(deviceID, startTime, endTime, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Device blocked successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  history,
+			"total": total,
+		},
+	})
+}
+
+// parseTimeQuery 解析RFC3339格式的时间查询参数，参数为空时返回nil
+func parseTimeQuery(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return &t, nil
+}
+
+// parsePagination 解析page/pageSize查询参数
+func parsePagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+	return page, pageSize
 }
 
 // UpdateDeviceHeartbeat 更新设备心跳
@@ -106,7 +247,7 @@ func UpdateDeviceInfo(c *gin.Context) {
 		return
 	}
 
-	if err := service.UpdateDeviceInfo(deviceID, req.Updates); err != nil {
+	if err := service.UpdateDeviceInfo(deviceID, req.Updates, c.GetString("userID")); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -148,7 +289,7 @@ func ListDevices(c *gin.Context) {
 	page := c.DefaultQuery("page", "1")
 	pageSize := c.DefaultQuery("pageSize", "10")
 
-	devices, total, err := service.ListDevices(page, pageSize)
+	devices, total, err := service.ListDevices(page, pageSize, splitQuery(c.Query("status"))...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success":       false,
@@ -204,9 +345,9 @@ func UpdateDevice(c *gin.Context) {
 		return
 	}
 
-	err := service.UpdateDevice(deviceID, req.Updates)
+	err := service.UpdateDevice(deviceID, req.Updates, c.GetString("userID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(metadataErrorStatus(err), gin.H{
 			"success":       false,
 			"error_message": err.Error(),
 		})
@@ -265,33 +406,100 @@ func ExportDeviceLogs(c *gin.Context) {
 		EndTime:   req.EndTime,
 		DeviceID:  req.DeviceID,
 		Format:    req.Format,
+		LogTypes:  req.LogTypes,
+		Levels:    req.Levels,
+		Source:    req.Source,
 	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 }
 
-// GetDeviceUsage 获取设备使用情况
-func GetDeviceUsage(c *gin.Context) {
-	deviceID := c.Param("id")
-	device, err := service.GetDevice(deviceID)
+// GetDeviceLogs 查询设备日志，type和level支持逗号分隔的多个值
+func GetDeviceLogs(c *gin.Context) {
+	filter := service.DeviceLogFilter{
+		DeviceID: c.Param("id"),
+		Types:    splitQuery(c.Query("type")),
+		Source:   c.Query("source"),
+	}
+	for _, level := range splitQuery(c.Query("level")) {
+		filter.Levels = append(filter.Levels, model.LogLevel(level))
+	}
+
+	var err error
+	if filter.StartTime, err = parseTimeQuery(c, "start_time"); err == nil {
+		filter.EndTime, err = parseTimeQuery(c, "end_time")
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
 		return
 	}
 
-	if device.UsageStats == nil {
-		device.UsageStats = &model.UsageStats{}
+	page, pageSize := parsePagination(c)
+	logs, total, err := service.QueryDeviceLogs(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
 	}
 
-	usage := gin.H{
-		"device_id":        device.ID,
-		"avg_usage_time":   device.UsageStats.AverageUsageTime,
-		"peak_usage_time":  device.UsageStats.PeakUsageTime,
-		"last_active_date": device.UsageStats.LastActiveDate,
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  logs,
+			"total": total,
+		},
+	})
+}
+
+// GetDeviceActivities 查询设备活动
+func GetDeviceActivities(c *gin.Context) {
+	startTime, err := parseTimeQuery(c, "start_time")
+	var endTime *time.Time
+	if err == nil {
+		endTime, err = parseTimeQuery(c, "end_time")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
 	}
 
-	c.JSON(http.StatusOK, usage)
+	page, pageSize := parsePagination(c)
+	activities, total, err := service.QueryDeviceActivities(c.Param("id"), c.Query("type"), startTime, endTime, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  activities,
+			"total": total,
+		},
+	})
+}
+
+// splitQuery 拆分逗号分隔的查询参数，忽略空值
+func splitQuery(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
 }
 
 // GetOnlineDevices 获取在线设备列表
@@ -307,34 +515,6 @@ func GetOnlineDevices(c *gin.Context) {
 	c.JSON(http.StatusOK, devices)
 }
 
-// GetDeviceUsageReport 获取设备使用报告
-func GetDeviceUsageReport(c *gin.Context) {
-	deviceID := c.Param("id")
-	device, err := service.GetDevice(deviceID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if device.UsageStats == nil {
-		device.UsageStats = &model.UsageStats{}
-	}
-
-	report := gin.H{
-		"device_id":        device.ID,
-		"name":             device.Name,
-		"status":           device.Status,
-		"avg_usage_time":   device.UsageStats.AverageUsageTime,
-		"peak_usage_time":  device.UsageStats.PeakUsageTime,
-		"last_active_date": device.UsageStats.LastActiveDate,
-		"alert_count":      device.AlertCount,
-		"last_alert_time":  device.LastAlertTime,
-		"risk_level":       device.RiskLevel,
-	}
-
-	c.JSON(http.StatusOK, report)
-}
-
 // GetDeviceInfo 获取设备详细信息
 func GetDeviceInfo(c *gin.Context) {
 	deviceID := c.Param("id")
@@ -348,7 +528,7 @@ func GetDeviceInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, device)
 }
 
-// UpdateDeviceMetadata 更新设备元数据
+// UpdateDeviceMetadata 替换设备元数据
 func UpdateDeviceMetadata(c *gin.Context) {
 	deviceID := c.Param("id")
 	var metadata map[string]interface{}
@@ -359,7 +539,7 @@ func UpdateDeviceMetadata(c *gin.Context) {
 	}
 
 	if err := service.UpdateDeviceMetadata(deviceID, metadata); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(metadataErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
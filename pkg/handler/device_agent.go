@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AgentRegisterRequest 客户端自注册请求
+type AgentRegisterRequest struct {
+	LicenseCode  string              `json:"license_code" binding:"required"`
+	Name         string              `json:"name" binding:"required"`
+	Type         string              `json:"type"`
+	DiskID       string              `json:"disk_id" binding:"required"`
+	BIOS         string              `json:"bios" binding:"required"`
+	Motherboard  string              `json:"motherboard" binding:"required"`
+	NetworkCards []map[string]string `json:"network_cards"`
+	DisplayCard  string              `json:"display_card"`
+	Resolution   string              `json:"resolution"`
+	Timezone     string              `json:"timezone"`
+	Language     string              `json:"language"`
+}
+
+// AgentRegister 客户端自注册设备并激活授权码
+func AgentRegister(c *gin.Context) {
+	var req AgentRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	registration, err := service.SelfRegisterDevice(req.LicenseCode, &service.DeviceProfile{
+		Name:                  req.Name,
+		Type:                  req.Type,
+		DiskID:                req.DiskID,
+		BIOS:                  req.BIOS,
+		Motherboard:           req.Motherboard,
+		NetworkCards:          req.NetworkCards,
+		DisplayCard:           req.DisplayCard,
+		Resolution:            req.Resolution,
+		Timezone:              req.Timezone,
+		Language:              req.Language,
+		ClientIP:              c.ClientIP(),
+		AuthenticatedDeviceID: c.GetString("deviceID"),
+	})
+	if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"device_id":      registration.Device.ID,
+			"created":        registration.Created,
+			"credential_id":  registration.CredentialID,
+			"secret":         registration.Secret,
+			"heartbeat_rate": registration.Device.HeartbeatRate,
+			"license": gin.H{
+				"code":        registration.License.Code,
+				"type":        registration.License.Type,
+				"status":      registration.License.Status,
+				"expire_time": registration.License.ExpireTime,
+				"features":    registration.License.Features,
+			},
+		},
+	})
+}
+
+// agentErrorStatus 将客户端接口的业务错误映射为HTTP状态码
+func agentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDeviceBlacklisted), errors.Is(err, service.ErrDeviceBlocked):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidLicenseCode), errors.Is(err, service.ErrReregisterUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrLicenseUnavailable), errors.Is(err, service.ErrLicenseExpired):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// AgentHeartbeatRequest 心跳请求，请求体可为空
+type AgentHeartbeatRequest struct {
+	ConfigETag string `json:"config_etag"` // 设备当前使用的配置版本标识
+}
+
+// AgentConfigAckRequest 设备确认配置请求
+type AgentConfigAckRequest struct {
+	ETag    string                      `json:"etag" binding:"required"`
+	Status  model.DeviceConfigAckStatus `json:"status"`
+	Message string                      `json:"message"`
+}
+
+// AgentHeartbeat 设备上报心跳
+//
+// 响应中包含当前生效配置的config_etag，与请求中的config_etag不一致时同时返回完整配置；
+// 有待执行的远程命令时通过commands下发。
+func AgentHeartbeat(c *gin.Context) {
+	deviceID := c.GetString("deviceID")
+
+	var req AgentHeartbeatRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":       false,
+				"error_message": err.Error(),
+			})
+			return
+		}
+	}
+
+	device, err := service.RecordAgentHeartbeat(deviceID, c.ClientIP())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrDeviceBlacklisted) || errors.Is(err, service.ErrCountryNotAllowed) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	effective, err := service.GetEffectiveDeviceConfig(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	data := gin.H{
+		"status":         device.Status,
+		"heartbeat_rate": device.HeartbeatRate,
+		"server_time":    time.Now().Unix(),
+		"config_etag":    effective.ETag,
+	}
+	if req.ConfigETag != effective.ETag {
+		data["config"] = effective.Config
+	}
+
+	commands, err := service.PullDeviceCommands(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	if len(commands) > 0 {
+		data["commands"] = commands
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// AgentCommandResultRequest 设备上报命令执行结果请求
+type AgentCommandResultRequest struct {
+	Status  model.DeviceCommandStatus `json:"status" binding:"required"`
+	Result  json.RawMessage           `json:"result"`
+	Message string                    `json:"message"`
+}
+
+// AgentPullCommands 设备拉取待执行的远程命令
+//
+// wait参数为长轮询等待秒数，没有命令时最多等待该时间，上限为device.command_long_poll_timeout。
+func AgentPullCommands(c *gin.Context) {
+	wait := time.Duration(0)
+	if value := c.Query("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":       false,
+				"error_message": "invalid wait",
+			})
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if max := config.GetConfig().Device.CommandLongPollTimeout; wait > max {
+			wait = max
+		}
+	}
+
+	commands, err := service.WaitDeviceCommands(c.Request.Context(), c.GetString("deviceID"), wait)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	if commands == nil {
+		commands = []model.DeviceCommand{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    commands,
+	})
+}
+
+// AgentReportCommandResult 设备上报命令执行结果
+func AgentReportCommandResult(c *gin.Context) {
+	var req AgentCommandResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	command, err := service.ReportDeviceCommandResult(c.GetString("deviceID"), c.Param("id"), req.Status, req.Result, req.Message)
+	if err != nil {
+		c.JSON(commandErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    command,
+	})
+}
+
+// AgentGetConfig 设备拉取当前生效的配置，支持If-None-Match
+func AgentGetConfig(c *gin.Context) {
+	effective, err := service.GetEffectiveDeviceConfig(c.GetString("deviceID"))
+	if err != nil {
+		c.JSON(deviceConfigErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	etag := `"` + effective.ETag + `"`
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match == etag || match == effective.ETag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    effective,
+	})
+}
+
+// AgentAckConfig 设备确认已应用（或应用失败）的配置版本
+func AgentAckConfig(c *gin.Context) {
+	var req AgentConfigAckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	state, err := service.AcknowledgeDeviceConfig(c.GetString("deviceID"), req.ETag, req.Status, req.Message)
+	if err != nil {
+		c.JSON(deviceConfigErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    state,
+	})
+}
+
+// AgentRotateCredential 设备轮换当前使用的密钥凭证
+func AgentRotateCredential(c *gin.Context) {
+	deviceID := c.GetString("deviceID")
+	credentialID := c.GetString("credentialID")
+
+	credential, secret, err := service.RotateDeviceCredential(deviceID, credentialID)
+	if err != nil {
+		c.JSON(credentialErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"credential_id": credential.ID,
+			"secret":        secret,
+		},
+	})
+}
+
+// AgentSubmitLogs 设备批量上报日志和活动
+//
+// 请求体可使用gzip压缩（Content-Encoding: gzip），解压后的大小受device.log_max_decoded_size限制。
+func AgentSubmitLogs(c *gin.Context) {
+	deviceID := c.GetString("deviceID")
+
+	var reader io.Reader = c.Request.Body
+	if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":       false,
+				"error_message": "invalid gzip body",
+			})
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	maxDecoded := config.GetConfig().Device.LogMaxDecodedSize
+	body, err := io.ReadAll(io.LimitReader(reader, maxDecoded+1))
+	if err != nil {
+		// 未声明长度的请求体在读取时才超出device.log_max_body_size
+		status := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	if int64(len(body)) > maxDecoded {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success":       false,
+			"error_message": "decoded body too large",
+		})
+		return
+	}
+
+	var batch service.DeviceLogBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	logCount, activityCount, err := service.IngestDeviceLogs(deviceID, c.ClientIP(), &batch)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrLogBatchTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, service.ErrLogBatchEmpty), errors.Is(err, service.ErrInvalidLogLevel):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"logs":       logCount,
+			"activities": activityCount,
+		},
+	})
+}
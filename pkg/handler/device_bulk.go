@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BulkDeviceOperation 对设备ID列表或搜索条件选中的设备执行批量操作
+//
+// async为true时在后台执行并返回202，否则执行完成后返回每个设备的结果。
+func BulkDeviceOperation(c *gin.Context) {
+	var req service.BulkOperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	report, err := service.StartBulkOperation(req, service.BulkActor{
+		UserID:   c.GetString("userID"),
+		Username: c.GetString("username"),
+		IP:       c.ClientIP(),
+	})
+	if err != nil {
+		c.JSON(bulkErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	status := http.StatusOK
+	if req.Async {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// ListBulkOperations 分页获取批量操作
+func ListBulkOperations(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+	operations, total, err := service.ListBulkOperations(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  operations,
+			"total": total,
+		},
+	})
+}
+
+// GetBulkOperation 获取批量操作进度和分页的设备结果，failed=true时只返回失败的设备
+func GetBulkOperation(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+	report, err := service.GetBulkOperation(c.Param("operation_id"), c.Query("failed") == "true", page, pageSize)
+	if err != nil {
+		c.JSON(bulkErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// bulkErrorStatus 将批量操作业务错误映射为HTTP状态码
+func bulkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrBulkOperationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidBulkOperation), errors.Is(err, service.ErrGroupNotFound):
+		return http.StatusBadRequest
+	default:
+		return searchErrorStatus(err)
+	}
+}
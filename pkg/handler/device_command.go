@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDeviceCommandRequest 创建远程命令请求
+type CreateDeviceCommandRequest struct {
+	Type       model.DeviceCommandType `json:"type" binding:"required"`
+	Payload    json.RawMessage         `json:"payload"`
+	TTLSeconds int                     `json:"ttl_seconds"` // 为0时使用默认有效期
+}
+
+// CreateDeviceCommand 为设备创建远程命令
+func CreateDeviceCommand(c *gin.Context) {
+	var req CreateDeviceCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	command, err := service.EnqueueDeviceCommand(c.Param("id"), req.toService(), c.GetString("userID"))
+	if err != nil {
+		c.JSON(commandErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    command,
+	})
+}
+
+// CreateGroupCommand 为分组内的所有设备创建远程命令
+func CreateGroupCommand(c *gin.Context) {
+	var req CreateDeviceCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	commands, err := service.EnqueueGroupCommand(c.Param("id"), req.toService(), c.GetString("userID"))
+	if err != nil {
+		c.JSON(commandErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  commands,
+			"total": len(commands),
+		},
+	})
+}
+
+// ListDeviceCommands 查询设备的远程命令
+func ListDeviceCommands(c *gin.Context) {
+	listCommands(c, service.DeviceCommandFilter{DeviceID: c.Param("id")})
+}
+
+// ListGroupCommands 查询分组内设备的远程命令
+func ListGroupCommands(c *gin.Context) {
+	listCommands(c, service.DeviceCommandFilter{GroupID: c.Param("id")})
+}
+
+// GetDeviceCommand 获取远程命令详情
+func GetDeviceCommand(c *gin.Context) {
+	command, err := service.GetDeviceCommand(c.Param("command_id"))
+	if err != nil {
+		c.JSON(commandErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    command,
+	})
+}
+
+// CancelDeviceCommand 取消尚未完成的远程命令
+func CancelDeviceCommand(c *gin.Context) {
+	command, err := service.CancelDeviceCommand(c.Param("command_id"))
+	if err != nil {
+		c.JSON(commandErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    command,
+	})
+}
+
+// listCommands 分页查询命令，并返回按状态统计的数量
+func listCommands(c *gin.Context, filter service.DeviceCommandFilter) {
+	for _, t := range splitQuery(c.Query("type")) {
+		filter.Types = append(filter.Types, model.DeviceCommandType(t))
+	}
+	for _, s := range splitQuery(c.Query("status")) {
+		filter.Status = append(filter.Status, model.DeviceCommandStatus(s))
+	}
+
+	page, pageSize := parsePagination(c)
+	commands, total, err := service.ListDeviceCommands(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	summary, err := service.CountDeviceCommandsByStatus(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":    commands,
+			"total":   total,
+			"summary": summary,
+		},
+	})
+}
+
+// toService 转换为服务层参数
+func (r *CreateDeviceCommandRequest) toService() service.DeviceCommandRequest {
+	return service.DeviceCommandRequest{
+		Type:    r.Type,
+		Payload: r.Payload,
+		TTL:     time.Duration(r.TTLSeconds) * time.Second,
+	}
+}
+
+// commandErrorStatus 将远程命令业务错误映射为HTTP状态码
+func commandErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCommandNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrCommandFinished), errors.Is(err, service.ErrCommandNotDelivered):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidCommand):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateDeviceConfigRequest 设置期望配置请求
+type UpdateDeviceConfigRequest struct {
+	Config model.DeviceConfigSpec `json:"config"`
+	Reason string                 `json:"reason"`
+}
+
+// RollbackDeviceConfigRequest 回滚配置请求
+type RollbackDeviceConfigRequest struct {
+	Version int    `json:"version" binding:"required,min=1"`
+	Reason  string `json:"reason"`
+}
+
+// GetDeviceConfig 获取设备的期望配置、实际生效配置和最近一次确认结果
+func GetDeviceConfig(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	desired, err := service.GetDeviceConfig(model.DeviceConfigTargetDevice, deviceID)
+	if err != nil {
+		c.JSON(deviceConfigErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	effective, err := service.GetEffectiveDeviceConfig(deviceID)
+	if err != nil {
+		c.JSON(deviceConfigErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	state, err := service.GetDeviceConfigState(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"desired":   desired,
+			"effective": effective,
+			"state":     state,
+			"in_sync":   state != nil && state.Status == model.DeviceConfigAckApplied && state.ETag == effective.ETag,
+		},
+	})
+}
+
+// UpdateDeviceConfig 设置设备的期望配置
+func UpdateDeviceConfig(c *gin.Context) {
+	updateConfig(c, model.DeviceConfigTargetDevice)
+}
+
+// GetDeviceConfigHistory 获取设备配置变更历史
+func GetDeviceConfigHistory(c *gin.Context) {
+	getConfigHistory(c, model.DeviceConfigTargetDevice)
+}
+
+// RollbackDeviceConfig 将设备配置回滚到指定版本
+func RollbackDeviceConfig(c *gin.Context) {
+	rollbackConfig(c, model.DeviceConfigTargetDevice)
+}
+
+// GetGroupConfig 获取分组的期望配置
+func GetGroupConfig(c *gin.Context) {
+	desired, err := service.GetDeviceConfig(model.DeviceConfigTargetGroup, c.Param("id"))
+	if err != nil {
+		c.JSON(deviceConfigErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    desired,
+	})
+}
+
+// UpdateGroupConfig 设置分组的期望配置
+func UpdateGroupConfig(c *gin.Context) {
+	updateConfig(c, model.DeviceConfigTargetGroup)
+}
+
+// GetGroupConfigHistory 获取分组配置变更历史
+func GetGroupConfigHistory(c *gin.Context) {
+	getConfigHistory(c, model.DeviceConfigTargetGroup)
+}
+
+// RollbackGroupConfig 将分组配置回滚到指定版本
+func RollbackGroupConfig(c *gin.Context) {
+	rollbackConfig(c, model.DeviceConfigTargetGroup)
+}
+
+// updateConfig 设置设备或分组的期望配置
+func updateConfig(c *gin.Context, target model.DeviceConfigTarget) {
+	var req UpdateDeviceConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	cfg, err := service.SetDeviceConfig(target, c.Param("id"), req.Config, c.GetString("userID"), req.Reason)
+	if err != nil {
+		c.JSON(deviceConfigErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    cfg,
+	})
+}
+
+// getConfigHistory 分页获取设备或分组的配置变更历史
+func getConfigHistory(c *gin.Context, target model.DeviceConfigTarget) {
+	page, pageSize := parsePagination(c)
+	history, total, err := service.GetDeviceConfigHistory(target, c.Param("id"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  history,
+			"total": total,
+		},
+	})
+}
+
+// rollbackConfig 将设备或分组的配置回滚到指定版本
+func rollbackConfig(c *gin.Context, target model.DeviceConfigTarget) {
+	var req RollbackDeviceConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	cfg, err := service.RollbackDeviceConfig(target, c.Param("id"), req.Version, c.GetString("userID"), req.Reason)
+	if err != nil {
+		c.JSON(deviceConfigErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    cfg,
+	})
+}
+
+// deviceConfigErrorStatus 将配置业务错误映射为HTTP状态码
+func deviceConfigErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConfigTargetNotFound), errors.Is(err, service.ErrConfigVersionNotFound),
+		errors.Is(err, service.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidDeviceConfig):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDeviceCredentialRequest 创建设备凭证请求
+type CreateDeviceCredentialRequest struct {
+	Type        model.DeviceCredentialType `json:"type" binding:"required"`
+	Fingerprint string                     `json:"fingerprint"`
+}
+
+// ListDeviceCredentials 获取设备凭证列表
+func ListDeviceCredentials(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	credentials, err := service.ListDeviceCredentials(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    credentials,
+	})
+}
+
+// CreateDeviceCredential 为设备签发密钥或登记客户端证书
+func CreateDeviceCredential(c *gin.Context) {
+	deviceID := c.Param("id")
+	var req CreateDeviceCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	switch req.Type {
+	case model.DeviceCredentialTypeSecret:
+		if _, err := service.GetDevice(deviceID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success":       false,
+				"error_message": err.Error(),
+			})
+			return
+		}
+
+		credential, secret, err := service.IssueDeviceCredential(deviceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success":       false,
+				"error_message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"credential": credential,
+				"secret":     secret,
+			},
+		})
+	case model.DeviceCredentialTypeCertificate:
+		credential, err := service.RegisterDeviceCertificate(deviceID, req.Fingerprint)
+		if err != nil {
+			c.JSON(credentialErrorStatus(err), gin.H{
+				"success":       false,
+				"error_message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"credential": credential,
+			},
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": "unsupported credential type",
+		})
+	}
+}
+
+// RotateDeviceCredential 轮换设备密钥凭证
+func RotateDeviceCredential(c *gin.Context) {
+	deviceID := c.Param("id")
+	credentialID := c.Param("credential_id")
+
+	credential, secret, err := service.RotateDeviceCredential(deviceID, credentialID)
+	if err != nil {
+		c.JSON(credentialErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"credential": credential,
+			"secret":     secret,
+		},
+	})
+}
+
+// RevokeDeviceCredential 吊销设备凭证
+func RevokeDeviceCredential(c *gin.Context) {
+	deviceID := c.Param("id")
+	credentialID := c.Param("credential_id")
+
+	if err := service.RevokeDeviceCredential(deviceID, credentialID, c.GetString("userID")); err != nil {
+		c.JSON(credentialErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Device credential revoked successfully",
+		},
+	})
+}
+
+// credentialErrorStatus 将凭证相关错误映射为HTTP状态码
+func credentialErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCredentialNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrCredentialUnusable), errors.Is(err, service.ErrUnsupportedOperation):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidFingerprint):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
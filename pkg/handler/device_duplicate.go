@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MergeDevicesRequest 合并重复设备请求
+type MergeDevicesRequest struct {
+	DeviceIDs []string `json:"device_ids" binding:"required"`
+}
+
+// ListDuplicateDevices 获取待审核的疑似重复设备，按组返回
+func ListDuplicateDevices(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+	clusters, total, err := service.ListDuplicateClusters(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  clusters,
+			"total": total,
+		},
+	})
+}
+
+// DetectDuplicateDevices 立即执行一次重复设备检测
+func DetectDuplicateDevices(c *gin.Context) {
+	result, err := service.DetectDuplicateDevices()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// DismissDuplicateDevice 将设备对标记为不是重复设备
+func DismissDuplicateDevice(c *gin.Context) {
+	candidate, err := service.DismissDuplicate(c.Param("duplicate_id"), c.GetString("userID"))
+	if err != nil {
+		c.JSON(duplicateErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    candidate,
+	})
+}
+
+// MergeDevices 将请求中的设备合并到路径中的设备
+func MergeDevices(c *gin.Context) {
+	var req MergeDevicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	result, err := service.MergeDevices(c.Param("id"), req.DeviceIDs, c.GetString("userID"))
+	if err != nil {
+		c.JSON(duplicateErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// duplicateErrorStatus 将重复设备业务错误映射为HTTP状态码
+func duplicateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDuplicateNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidMerge):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
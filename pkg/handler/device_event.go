@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"LVerity/pkg/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventKeepAliveInterval 事件流保活注释的发送间隔，防止代理断开空闲连接
+const eventKeepAliveInterval = 15 * time.Second
+
+// StreamDeviceEvents 通过Server-Sent Events推送设备实时事件
+//
+// 支持device_id、group_id、types过滤（逗号分隔），断线重连时根据Last-Event-ID补发错过的事件。
+func StreamDeviceEvents(c *gin.Context) {
+	filter := service.DeviceEventFilter{
+		DeviceIDs: splitQuery(c.Query("device_id")),
+		GroupIDs:  splitQuery(c.Query("group_id")),
+		Types:     splitQuery(c.Query("types")),
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var since uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":       false,
+				"error_message": "invalid Last-Event-ID",
+			})
+			return
+		}
+		since = id
+	}
+
+	sub, err := service.DeviceEvents.Subscribe(filter, since)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	defer service.DeviceEvents.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				// 订阅因消费过慢被关闭，客户端会携带Last-Event-ID重连
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssignDeviceRequest 分配单个设备到分组请求
+type AssignDeviceRequest struct {
+	DeviceID string `json:"device_id" binding:"required"`
+	GroupID  string `json:"group_id" binding:"required"`
+}
+
+// AssignGroupDevicesRequest 批量分配设备请求
+type AssignGroupDevicesRequest struct {
+	DeviceIDs []string `json:"device_ids" binding:"required"`
+}
+
+// ListGroups 获取分组列表，tree=true时返回分组树
+func ListGroups(c *gin.Context) {
+	groups, err := service.ListGroups(c.Query("tree") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  groups,
+			"total": len(groups),
+		},
+	})
+}
+
+// CreateGroup 创建分组，parent_id为空时创建顶级分组
+func CreateGroup(c *gin.Context) {
+	var req service.GroupInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	group, err := service.CreateGroup(req, c.GetString("userID"))
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
+
+// GetGroup 获取分组详情，包含直接子分组
+func GetGroup(c *gin.Context) {
+	group, err := service.GetGroup(c.Param("id"))
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
+
+// UpdateGroup 更新分组，修改parent_id可移动分组
+func UpdateGroup(c *gin.Context) {
+	var req service.GroupInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	group, err := service.UpdateGroup(c.Param("id"), req)
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
+
+// DeleteGroup 删除分组，组内设备移至上级分组
+func DeleteGroup(c *gin.Context) {
+	if err := service.DeleteGroup(c.Param("id")); err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// AssignDevice 分配单个设备到分组
+func AssignDevice(c *gin.Context) {
+	var req AssignDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	if _, err := service.AssignDevicesToGroup(req.GroupID, []string{req.DeviceID}); err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// AssignGroupDevices 批量将设备移入分组
+func AssignGroupDevices(c *gin.Context) {
+	var req AssignGroupDevicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	updated, err := service.AssignDevicesToGroup(c.Param("id"), req.DeviceIDs)
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"updated": updated,
+		},
+	})
+}
+
+// GetDevicesByGroup 获取分组内设备，recursive=true时包含下级分组的设备
+func GetDevicesByGroup(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+	devices, total, err := service.GetGroupDevices(c.Param("id"), c.Query("recursive") == "true", page, pageSize)
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  devices,
+			"total": total,
+		},
+	})
+}
+
+// GetGroupPolicy 获取分组自身设置的策略
+func GetGroupPolicy(c *gin.Context) {
+	getPolicy(c, model.DevicePolicyTargetGroup)
+}
+
+// UpdateGroupPolicy 设置分组策略
+func UpdateGroupPolicy(c *gin.Context) {
+	updatePolicy(c, model.DevicePolicyTargetGroup)
+}
+
+// DeleteGroupPolicy 删除分组策略
+func DeleteGroupPolicy(c *gin.Context) {
+	deletePolicy(c, model.DevicePolicyTargetGroup)
+}
+
+// GetDevicePolicy 获取设备自身设置的策略（覆盖分组策略的部分）
+func GetDevicePolicy(c *gin.Context) {
+	getPolicy(c, model.DevicePolicyTargetDevice)
+}
+
+// UpdateDevicePolicy 设置设备策略
+func UpdateDevicePolicy(c *gin.Context) {
+	updatePolicy(c, model.DevicePolicyTargetDevice)
+}
+
+// DeleteDevicePolicy 删除设备策略，之后完全继承分组策略
+func DeleteDevicePolicy(c *gin.Context) {
+	deletePolicy(c, model.DevicePolicyTargetDevice)
+}
+
+// GetEffectiveDevicePolicy 获取设备实际生效的策略及各字段来源
+func GetEffectiveDevicePolicy(c *gin.Context) {
+	policy, err := service.GetEffectiveDevicePolicy(c.Param("id"))
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// getPolicy 获取分组或设备的策略
+func getPolicy(c *gin.Context, target model.DevicePolicyTarget) {
+	policy, err := service.GetDevicePolicy(target, c.Param("id"))
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// updatePolicy 设置分组或设备的策略
+func updatePolicy(c *gin.Context, target model.DevicePolicyTarget) {
+	var spec model.DevicePolicySpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	policy, err := service.SetDevicePolicy(target, c.Param("id"), spec, c.GetString("userID"))
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// deletePolicy 删除分组或设备的策略
+func deletePolicy(c *gin.Context, target model.DevicePolicyTarget) {
+	if err := service.DeleteDevicePolicy(target, c.Param("id")); err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// groupErrorStatus 将分组和策略业务错误映射为HTTP状态码
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrGroupNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidGroup), errors.Is(err, service.ErrInvalidDevicePolicy):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -6,123 +6,200 @@ import (
 	"LVerity/pkg/service"
 	"LVerity/pkg/utils"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// 设备分组相关处理器
+// 黑名单管理相关处理器
 
-type CreateGroupRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
+type CreateRuleRequest struct {
+	Type        string     `json:"type" binding:"required"`
+	Pattern     string     `json:"pattern" binding:"required"`
+	Description string     `json:"description"`
+	Action      string     `json:"action"`
+	BlockDevice bool       `json:"block_device"`
+	ExpiresAt   *time.Time `json:"expires_at"`
 }
 
-func CreateGroup(c *gin.Context) {
-	var req CreateGroupRequest
+func CreateRule(c *gin.Context) {
+	var req CreateRuleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 从上下文获取当前用户
-	userID := c.GetString("user_id")
+	userID := c.GetString("userID")
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	group := &model.DeviceGroup{
-		ID:          utils.GenerateUUID(),
-		Name:        req.Name,
+	rule := &model.BlacklistRule{
+		Type:        req.Type,
+		Pattern:     req.Pattern,
 		Description: req.Description,
+		Action:      req.Action,
+		BlockDevice: req.BlockDevice,
+		ExpiresAt:   req.ExpiresAt,
 		CreatedBy:   userID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
 	}
 
-	if err := database.GetDB().Create(group).Error; err != nil {
+	if err := service.CreateBlacklistRule(rule); err != nil {
+		c.JSON(blacklistErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func ListRules(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+	rules, total, err := service.ListBlacklistRules(c.Query("type"), c.Query("action"), page, pageSize)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, group)
+	c.JSON(http.StatusOK, gin.H{
+		"list":  rules,
+		"total": total,
+	})
 }
 
-type AssignDeviceRequest struct {
-	DeviceID string `json:"device_id" binding:"required"`
-	GroupID  string `json:"group_id" binding:"required"`
+type UpdateRuleRequest struct {
+	Type           *string    `json:"type"`
+	Pattern        *string    `json:"pattern"`
+	Description    *string    `json:"description"`
+	Action         *string    `json:"action"`
+	BlockDevice    *bool      `json:"block_device"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	ClearExpiresAt bool       `json:"clear_expires_at"` // 为true时规则改为永久有效
 }
 
-func AssignDevice(c *gin.Context) {
-	var req AssignDeviceRequest
+func UpdateRule(c *gin.Context) {
+	var req UpdateRuleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := service.AssignDeviceToGroup(req.DeviceID, req.GroupID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	rule, err := service.GetBlacklistRule(c.Param("id"))
+	if err != nil {
+		c.JSON(blacklistErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "device assigned to group successfully"})
-}
+	if req.Type != nil {
+		rule.Type = *req.Type
+	}
+	if req.Pattern != nil {
+		rule.Pattern = *req.Pattern
+	}
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	if req.Action != nil {
+		rule.Action = *req.Action
+	}
+	if req.BlockDevice != nil {
+		rule.BlockDevice = *req.BlockDevice
+	}
+	if req.ExpiresAt != nil {
+		rule.ExpiresAt = req.ExpiresAt
+	}
+	if req.ClearExpiresAt {
+		rule.ExpiresAt = nil
+	}
 
-func GetDevicesByGroup(c *gin.Context) {
-	groupID := c.Param("group_id")
-	if groupID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "group_id is required"})
+	if err := service.UpdateBlacklistRule(rule); err != nil {
+		c.JSON(blacklistErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	var devices []model.Device
-	if err := database.GetDB().Where("group_id = ?", groupID).Find(&devices).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	c.JSON(http.StatusOK, rule)
+}
+
+func DeleteRule(c *gin.Context) {
+	if err := service.DeleteBlacklistRule(c.Param("id")); err != nil {
+		c.JSON(blacklistErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, devices)
+	c.JSON(http.StatusOK, gin.H{"message": "Blacklist rule deleted successfully"})
 }
 
-// 黑名单管理相关处理器
-
-type CreateRuleRequest struct {
-	Type        string `json:"type" binding:"required"`
-	Pattern     string `json:"pattern" binding:"required"`
-	Description string `json:"description"`
+// TestRuleMatchRequest 规则匹配测试请求，提供device_id时使用已登记设备的硬件和授权信息
+type TestRuleMatchRequest struct {
+	RuleID      string `json:"rule_id"`
+	DeviceID    string `json:"device_id"`
+	DiskID      string `json:"disk_id"`
+	BIOS        string `json:"bios"`
+	Motherboard string `json:"motherboard"`
+	MAC         string `json:"mac"`
+	IP          string `json:"ip"`
+	Country     string `json:"country"`
+	LicenseCode string `json:"license_code"`
+	Customer    string `json:"customer"`
 }
 
-func CreateRule(c *gin.Context) {
-	var req CreateRuleRequest
+func TestRuleMatch(c *gin.Context) {
+	var req TestRuleMatchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	userID := c.GetString("user_id")
-	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
+	var subject *service.BlacklistSubject
+	if req.DeviceID != "" {
+		device, err := service.GetDevice(req.DeviceID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			return
+		}
+		subject = service.NewBlacklistSubject(device, req.IP)
+	} else {
+		device := &model.Device{
+			DiskID:      req.DiskID,
+			BIOS:        req.BIOS,
+			Motherboard: req.Motherboard,
+		}
+		if req.MAC != "" {
+			device.NetworkCards, _ = service.FormatNetworkCards([]map[string]string{{"mac": req.MAC}})
+		}
+		subject = &service.BlacklistSubject{Device: device, IP: req.IP}
 	}
-
-	rule := &model.BlacklistRule{
-		ID:          utils.GenerateUUID(),
-		Type:        req.Type,
-		Pattern:     req.Pattern,
-		Description: req.Description,
-		CreatedBy:   userID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	if req.LicenseCode != "" {
+		subject.LicenseCode = req.LicenseCode
+	}
+	if req.Customer != "" {
+		subject.Customer = req.Customer
+	}
+	if req.Country != "" {
+		subject.Location = &model.Location{Country: req.Country, CountryCode: req.Country}
 	}
 
-	if err := database.GetDB().Create(rule).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	result, err := service.TestBlacklistRules(subject, req.RuleID)
+	if err != nil {
+		c.JSON(blacklistErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, rule)
+	c.JSON(http.StatusOK, result)
+}
+
+// blacklistErrorStatus 将黑名单规则相关错误映射为HTTP状态码
+func blacklistErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrBlacklistRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidBlacklistRule):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 // 异常行为记录相关处理器
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"LVerity/pkg/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceTagsRequest 设置或追加设备标签请求
+type DeviceTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SearchDevices 按条件搜索设备，使用cursor游标分页
+func SearchDevices(c *gin.Context) {
+	query, err := parseDeviceSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	result, err := service.SearchDevices(*query)
+	if err != nil {
+		c.JSON(searchErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// parseDeviceSearchQuery 解析搜索参数，多值参数使用逗号分隔
+func parseDeviceSearchQuery(c *gin.Context) (*service.DeviceSearchQuery, error) {
+	query := &service.DeviceSearchQuery{
+		Text:             c.Query("q"),
+		Name:             c.Query("name"),
+		Types:            splitQuery(c.Query("type")),
+		Statuses:         splitQuery(c.Query("status")),
+		DiskID:           c.Query("disk_id"),
+		BIOS:             c.Query("bios"),
+		Motherboard:      c.Query("motherboard"),
+		GroupID:          c.Query("group_id"),
+		IncludeSubgroups: c.Query("include_subgroups") == "true",
+		Tags:             splitQuery(c.Query("tag")),
+		Customer:         c.Query("customer"),
+		LicenseCode:      c.Query("license_code"),
+		MetadataKeys:     splitQuery(c.Query("metadata_key")),
+		Metadata:         parseMetadataQuery(c),
+		Sort:             c.Query("sort"),
+		Cursor:           c.Query("cursor"),
+	}
+
+	var err error
+	if query.RiskMin, err = parseFloatQuery(c, "risk_min"); err != nil {
+		return nil, err
+	}
+	if query.RiskMax, err = parseFloatQuery(c, "risk_max"); err != nil {
+		return nil, err
+	}
+	if query.LastSeenFrom, err = parseTimeQuery(c, "last_seen_from"); err != nil {
+		return nil, err
+	}
+	if query.LastSeenTo, err = parseTimeQuery(c, "last_seen_to"); err != nil {
+		return nil, err
+	}
+	if value := c.Query("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid limit: %v", err)
+		}
+	}
+	return query, nil
+}
+
+// parseFloatQuery 解析可选的浮点数查询参数
+func parseFloatQuery(c *gin.Context, key string) (*float64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return &f, nil
+}
+
+// ListDeviceTags 获取所有标签及使用该标签的设备数
+func ListDeviceTags(c *gin.Context) {
+	tags, err := service.ListTags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  tags,
+			"total": len(tags),
+		},
+	})
+}
+
+// GetDeviceTags 获取设备标签
+func GetDeviceTags(c *gin.Context) {
+	tags, err := service.GetDeviceTags(c.Param("id"))
+	if err != nil {
+		c.JSON(searchErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tags,
+	})
+}
+
+// SetDeviceTags 替换设备的全部标签
+func SetDeviceTags(c *gin.Context) {
+	updateDeviceTags(c, service.SetDeviceTags)
+}
+
+// AddDeviceTags 为设备追加标签
+func AddDeviceTags(c *gin.Context) {
+	updateDeviceTags(c, service.AddDeviceTags)
+}
+
+// RemoveDeviceTag 删除设备的一个标签
+func RemoveDeviceTag(c *gin.Context) {
+	if err := service.RemoveDeviceTag(c.Param("id"), c.Param("tag")); err != nil {
+		c.JSON(searchErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// updateDeviceTags 设置或追加设备标签，返回更新后的全部标签
+func updateDeviceTags(c *gin.Context, update func(deviceID string, tags []string, operator string) ([]string, error)) {
+	var req DeviceTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	tags, err := update(c.Param("id"), req.Tags, c.GetString("userID"))
+	if err != nil {
+		c.JSON(searchErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tags,
+	})
+}
+
+// searchErrorStatus 将搜索和标签业务错误映射为HTTP状态码
+func searchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound), errors.Is(err, service.ErrGroupNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidSearch), errors.Is(err, service.ErrInvalidTag):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxDeviceImportSize = 10 << 20
+
+// ImportDevices 导入设备
+//
+// 文件通过multipart表单的file字段或请求体上传；format为csv或json，未指定时按文件扩展名或Content-Type判断；
+// mode为skip（默认）或update；dry_run=true时只校验不写入。
+func ImportDevices(c *gin.Context) {
+	var src io.Reader
+	format := model.ExportFormat(strings.ToLower(c.Query("format")))
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > maxDeviceImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"success":       false,
+				"error_message": fmt.Sprintf("import file must be at most %d bytes", maxDeviceImportSize),
+			})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success":       false,
+				"error_message": err.Error(),
+			})
+			return
+		}
+		defer f.Close()
+		src = f
+		if format == "" {
+			format = model.ExportFormat(strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), "."))
+		}
+	} else {
+		src = http.MaxBytesReader(c.Writer, c.Request.Body, maxDeviceImportSize)
+		if format == "" && strings.Contains(c.ContentType(), "json") {
+			format = model.ExportFormatJSON
+		}
+	}
+	if format == "" {
+		format = model.ExportFormatCSV
+	}
+
+	result, err := service.ImportDevices(src, service.DeviceImportOptions{
+		Format:   format,
+		Mode:     service.DeviceImportMode(c.Query("mode")),
+		DryRun:   c.Query("dry_run") == "true",
+		Operator: c.GetString("userID"),
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, service.ErrInvalidImport):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ExportDevices 导出设备，format为csv（默认）或json，columns为逗号分隔的列名，过滤参数与设备搜索相同
+func ExportDevices(c *gin.Context) {
+	query, err := parseDeviceSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	format := model.ExportFormat(c.DefaultQuery("format", string(model.ExportFormatCSV)))
+
+	export, err := service.PrepareDeviceExport(service.DeviceExportOptions{
+		Format:  format,
+		Columns: splitQuery(c.Query("columns")),
+		Query:   *query,
+	})
+	if err != nil {
+		status := searchErrorStatus(err)
+		if errors.Is(err, service.ErrInvalidExport) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	fileName := fmt.Sprintf("devices_%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	c.Header("Content-Type", format.ContentType())
+	c.Status(http.StatusOK)
+
+	// 响应已开始写出，出错时只能中断输出
+	if err := export.Write(c.Writer); err != nil {
+		log.Printf("Failed to export devices: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	usageDateLayout   = "2006-01-02"
+	defaultUsageRange = 30 // 未指定from时默认统计最近的天数
+)
+
+// GetDeviceUsage 获取设备在时间范围内的使用统计和按天（或按周）汇总
+func GetDeviceUsage(c *gin.Context) {
+	from, to, err := parseUsageRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	period := model.UsagePeriod(c.DefaultQuery("period", string(model.UsagePeriodDay)))
+
+	deviceID := c.Param("id")
+	stats, err := service.GetDeviceUsageStats(deviceID, from, to)
+	if err != nil {
+		c.JSON(usageErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	rollups, err := service.GetDeviceUsageRollups(deviceID, period, from, to)
+	if err != nil {
+		c.JSON(usageErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"device_id": deviceID,
+			"from":      from,
+			"to":        to,
+			"period":    period,
+			"stats":     stats,
+			"list":      rollups,
+		},
+	})
+}
+
+// GetDeviceUsageReport 获取设备在时间范围内的使用报告，包含会话明细
+func GetDeviceUsageReport(c *gin.Context) {
+	from, to, err := parseUsageRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	report, err := service.GetDeviceUsageReport(c.Param("id"), from, to)
+	if err != nil {
+		c.JSON(usageErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// GetGroupUsage 获取分组的使用汇总，包括总时长、会话数、活跃设备数和并发峰值
+func GetGroupUsage(c *gin.Context) {
+	from, to, err := parseUsageRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+	period := model.UsagePeriod(c.DefaultQuery("period", string(model.UsagePeriodDay)))
+
+	rollups, err := service.GetGroupUsageRollups(splitQuery(c.Query("group_id")), period, from, to)
+	if err != nil {
+		c.JSON(usageErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"from":   from,
+			"to":     to,
+			"period": period,
+			"list":   rollups,
+			"total":  len(rollups),
+		},
+	})
+}
+
+// RebuildUsageRollups 根据会话记录重新计算时间范围内的使用汇总
+func RebuildUsageRollups(c *gin.Context) {
+	from, to, err := parseUsageRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	periods, err := service.RebuildUsageRollups(from, to)
+	if err != nil {
+		c.JSON(usageErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"from":    from,
+			"to":      to,
+			"periods": periods,
+		},
+	})
+}
+
+// parseUsageRange 解析from/to查询参数，格式为YYYY-MM-DD（包含当天）或RFC3339
+//
+// 返回的范围为[from, to)，未指定时默认为包含今天在内的最近30天。
+func parseUsageRange(c *gin.Context) (time.Time, time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	to := today.AddDate(0, 0, 1)
+	if value := c.Query("to"); value != "" {
+		t, err := parseUsageTime(value, true)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %v", err)
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -defaultUsageRange)
+	if value := c.Query("from"); value != "" {
+		t, err := parseUsageTime(value, false)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %v", err)
+		}
+		from = t
+	}
+	return from, to, nil
+}
+
+// parseUsageTime 解析日期或时间，end为true时日期表示当天结束
+func parseUsageTime(value string, end bool) (time.Time, error) {
+	if day, err := time.ParseInLocation(usageDateLayout, value, time.Local); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// usageErrorStatus 将使用统计业务错误映射为HTTP状态码
+func usageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidUsageQuery):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"LVerity/pkg/model"
 	"LVerity/pkg/service"
 	"encoding/csv"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -137,7 +138,11 @@ func ActivateLicense(c *gin.Context) {
 	}
 
 	if err := service.ActivateLicense(req.Code, req.DeviceID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrDeviceBlacklisted) || errors.Is(err, service.ErrDeviceBlocked) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -463,7 +468,7 @@ func UpdateLicenseMetadata(c *gin.Context) {
 	}
 
 	if err := service.UpdateLicenseMetadata(req.LicenseID, req.Metadata); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(metadataErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -496,7 +501,7 @@ func ListLicenses(c *gin.Context) {
     status := c.DefaultQuery("status", "")
     groupID := c.DefaultQuery("group_id", "")
     
-    licenses, total, err := service.ListLicenses(page, pageSize, status, groupID)
+    licenses, total, err := service.ListLicenses(page, pageSize, status, groupID, parseMetadataQuery(c))
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{
             "success": false,
@@ -578,9 +583,9 @@ func GetLicense(c *gin.Context) {
     })
 }
 
-// UpdateLicense 更新授权码
+// UpdateLicense 替换授权码元数据，路径参数可以是授权码ID或授权码
 func UpdateLicense(c *gin.Context) {
-    code := c.Param("code")
+    code := c.Param("id")
     var req UpdateLicenseMetadataRequest
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{
@@ -592,7 +597,7 @@ func UpdateLicense(c *gin.Context) {
     
     err := service.UpdateLicenseMetadata(code, req.Metadata)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
+        c.JSON(metadataErrorStatus(err), gin.H{
             "success": false,
             "error_message": err.Error(),
         })
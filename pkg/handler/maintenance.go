@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMaintenance 查询维护窗口列表
+func ListMaintenance(c *gin.Context) {
+	filter, ok := bindMaintenanceFilter(c)
+	if !ok {
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	windows, total, err := service.ListMaintenance(filter, page, pageSize)
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  windows,
+			"total": total,
+		},
+	})
+}
+
+// GetMaintenanceCalendar 按天获取维护日历，start_time和end_time必填
+func GetMaintenanceCalendar(c *gin.Context) {
+	filter, ok := bindMaintenanceFilter(c)
+	if !ok {
+		return
+	}
+	if filter.StartTime == nil || filter.EndTime == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": "start_time and end_time are required",
+		})
+		return
+	}
+
+	days, err := service.GetMaintenanceCalendar(filter, *filter.StartTime, *filter.EndTime)
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    days,
+	})
+}
+
+// GetMaintenance 获取维护窗口详情
+func GetMaintenance(c *gin.Context) {
+	window, err := service.GetMaintenance(c.Param("id"))
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    window,
+	})
+}
+
+// CreateMaintenance 创建维护窗口
+func CreateMaintenance(c *gin.Context) {
+	var req service.MaintenanceInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	window, err := service.CreateMaintenance(req, c.GetString("userID"))
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    window,
+	})
+}
+
+// UpdateMaintenance 更新维护窗口
+func UpdateMaintenance(c *gin.Context) {
+	var req service.MaintenanceInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	window, err := service.UpdateMaintenance(c.Param("id"), req, c.GetString("userID"))
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    window,
+	})
+}
+
+// CancelMaintenance 取消维护窗口
+func CancelMaintenance(c *gin.Context) {
+	window, err := service.CancelMaintenance(c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    window,
+	})
+}
+
+// CompleteMaintenance 提前结束维护窗口
+func CompleteMaintenance(c *gin.Context) {
+	window, err := service.CompleteMaintenance(c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		c.JSON(maintenanceErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    window,
+	})
+}
+
+// bindMaintenanceFilter 解析维护窗口查询参数，解析失败时已写入响应
+func bindMaintenanceFilter(c *gin.Context) (service.MaintenanceFilter, bool) {
+	filter := service.MaintenanceFilter{
+		DeviceID: c.Query("device_id"),
+		GroupID:  c.Query("group_id"),
+	}
+	for _, status := range splitQuery(c.Query("status")) {
+		filter.Status = append(filter.Status, model.MaintenanceStatus(status))
+	}
+
+	var err error
+	var startTime, endTime *time.Time
+	if startTime, err = parseTimeQuery(c, "start_time"); err == nil {
+		endTime, err = parseTimeQuery(c, "end_time")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return filter, false
+	}
+	filter.StartTime, filter.EndTime = startTime, endTime
+	return filter, true
+}
+
+// maintenanceErrorStatus 将维护窗口业务错误映射为HTTP状态码
+func maintenanceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrMaintenanceNotFound), errors.Is(err, service.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrMaintenanceFinished):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidMaintenance):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
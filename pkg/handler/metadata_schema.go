@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxMetadataPatchSize = 1 << 20
+
+// ListMetadataSchemas 获取元数据结构定义，可按target过滤
+func ListMetadataSchemas(c *gin.Context) {
+	schemas, err := service.ListMetadataSchemas(model.MetadataTarget(c.Query("target")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schemas,
+	})
+}
+
+// CreateMetadataSchema 创建元数据结构定义
+func CreateMetadataSchema(c *gin.Context) {
+	var input service.MetadataSchemaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	schema, err := service.CreateMetadataSchema(input, c.GetString("userID"))
+	if err != nil {
+		c.JSON(metadataErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schema,
+	})
+}
+
+// GetMetadataSchema 获取元数据结构定义
+func GetMetadataSchema(c *gin.Context) {
+	schema, err := service.GetMetadataSchema(c.Param("id"))
+	if err != nil {
+		c.JSON(metadataErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schema,
+	})
+}
+
+// UpdateMetadataSchema 替换元数据结构定义
+func UpdateMetadataSchema(c *gin.Context) {
+	var input service.MetadataSchemaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	schema, err := service.UpdateMetadataSchema(c.Param("id"), input, c.GetString("userID"))
+	if err != nil {
+		c.JSON(metadataErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schema,
+	})
+}
+
+// DeleteMetadataSchema 删除元数据结构定义
+func DeleteMetadataSchema(c *gin.Context) {
+	if err := service.DeleteMetadataSchema(c.Param("id")); err != nil {
+		c.JSON(metadataErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// PatchDeviceMetadata 按JSON Merge Patch修改设备元数据，值为null的字段被删除
+func PatchDeviceMetadata(c *gin.Context) {
+	patch, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMetadataPatchSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	metadata, err := service.PatchDeviceMetadata(c.Param("id"), patch)
+	if err != nil {
+		c.JSON(metadataErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    metadata,
+	})
+}
+
+// PatchLicenseMetadata 按JSON Merge Patch修改授权码元数据，路径参数可以是授权码ID或授权码
+func PatchLicenseMetadata(c *gin.Context) {
+	patch, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMetadataPatchSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	metadata, err := service.PatchLicenseMetadata(c.Param("id"), patch)
+	if err != nil {
+		c.JSON(metadataErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    metadata,
+	})
+}
+
+// parseMetadataQuery 解析 metadata.<字段>=<值> 形式的元数据过滤参数
+func parseMetadataQuery(c *gin.Context) map[string]string {
+	filters := make(map[string]string)
+	for name, values := range c.Request.URL.Query() {
+		if key := strings.TrimPrefix(name, "metadata."); key != name && key != "" && len(values) > 0 {
+			filters[key] = values[0]
+		}
+	}
+	return filters
+}
+
+// metadataErrorStatus 将元数据业务错误映射为HTTP状态码
+func metadataErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrMetadataSchemaNotFound), errors.Is(err, service.ErrDeviceNotFound),
+		errors.Is(err, service.ErrLicenseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrMetadataSchemaExists):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidMetadataSchema), errors.Is(err, service.ErrInvalidMetadata):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
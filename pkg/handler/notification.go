@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListNotificationChannels 获取通知渠道列表
+func ListNotificationChannels(c *gin.Context) {
+	channels, err := service.ListNotificationChannels()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    channels,
+	})
+}
+
+// CreateNotificationChannel 创建通知渠道
+func CreateNotificationChannel(c *gin.Context) {
+	var input service.NotificationChannelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	channel, err := service.CreateNotificationChannel(input, c.GetString("userID"))
+	if err != nil {
+		c.JSON(notificationErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    channel,
+	})
+}
+
+// GetNotificationChannel 获取通知渠道，密码和密钥以掩码返回
+func GetNotificationChannel(c *gin.Context) {
+	channel, err := service.GetNotificationChannel(c.Param("id"))
+	if err != nil {
+		c.JSON(notificationErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    channel,
+	})
+}
+
+// UpdateNotificationChannel 替换通知渠道，密码和密钥为掩码时保持不变
+func UpdateNotificationChannel(c *gin.Context) {
+	var input service.NotificationChannelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	channel, err := service.UpdateNotificationChannel(c.Param("id"), input)
+	if err != nil {
+		c.JSON(notificationErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    channel,
+	})
+}
+
+// DeleteNotificationChannel 删除通知渠道
+func DeleteNotificationChannel(c *gin.Context) {
+	if err := service.DeleteNotificationChannel(c.Param("id")); err != nil {
+		c.JSON(notificationErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// TestNotificationChannelRequest 测试通知的参数
+type TestNotificationChannelRequest struct {
+	Level model.AlertLevel `json:"level"` // 模拟告警的级别，默认info
+}
+
+// TestNotificationChannel 立即发送一条测试通知，返回发送记录
+func TestNotificationChannel(c *gin.Context) {
+	var req TestNotificationChannelRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":       false,
+				"error_message": err.Error(),
+			})
+			return
+		}
+	}
+
+	delivery, err := service.TestNotificationChannel(c.Param("id"), req.Level)
+	if err != nil {
+		c.JSON(notificationErrorStatus(err), gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": delivery.Status == model.NotificationDeliverySent,
+		"data":    delivery,
+	})
+}
+
+// ListNotificationDeliveries 获取通知发送记录，可按channel_id、alert_id、rule_id和status过滤
+func ListNotificationDeliveries(c *gin.Context) {
+	filter := service.NotificationDeliveryFilter{
+		ChannelID: c.Query("channel_id"),
+		AlertID:   c.Query("alert_id"),
+		RuleID:    c.Query("rule_id"),
+		Status:    model.NotificationDeliveryStatus(c.Query("status")),
+	}
+
+	page, pageSize := parsePagination(c)
+	deliveries, total, err := service.ListNotificationDeliveries(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":       false,
+			"error_message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"list":  deliveries,
+			"total": total,
+		},
+	})
+}
+
+// notificationErrorStatus 将通知服务的错误映射为HTTP状态码
+func notificationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotificationChannelNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrNotificationChannelExists), errors.Is(err, service.ErrNotificationChannelInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidNotificationChannel):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -2,12 +2,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"LVerity/pkg/config"
 	"LVerity/pkg/database"
 	"LVerity/pkg/router"
+	"LVerity/pkg/scheduler"
 	"LVerity/pkg/service"
+	"LVerity/pkg/utils"
 )
 
 func main() {
@@ -16,6 +26,14 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// 初始化加密密钥（用于设备凭证等敏感数据）
+	encryptionKey := config.GetConfig().Security.EncryptionKey
+	if encryptionKey == "" {
+		log.Printf("Warning: security.encryption_key is not set, falling back to the JWT secret")
+		encryptionKey = config.GetConfig().JWT.Secret
+	}
+	utils.InitEncryptionKey(encryptionKey)
+
 	// 初始化数据库
 	dbConfig := config.GetConfig().Database
 	if err := database.InitDB(&dbConfig); err != nil {
@@ -32,6 +50,36 @@ func main() {
 		log.Printf("Warning: Failed to initialize admin user: %v", err)
 	}
 
+	// 服务重启前未执行完的批量操作标记为失败
+	if err := service.FailInterruptedBulkOperations(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// 启动临时封禁到期解封任务
+	scheduler.StartUnblockScheduler(config.GetConfig().Device.UnblockCheckInterval)
+
+	// 启动维护窗口任务
+	scheduler.StartMaintenanceScheduler(config.GetConfig().Device.MaintenanceInterval)
+
+	// 启动远程命令过期任务
+	scheduler.StartCommandExpiryScheduler()
+
+	// 启动使用统计任务
+	scheduler.StartUsageRollupScheduler(config.GetConfig().Device.UsageRollupInterval)
+
+	// 启动重复设备检测任务
+	scheduler.StartDuplicateDetectionScheduler(config.GetConfig().Device.DuplicateCheckInterval)
+
+	// 启动告警规则定时评估任务
+	scheduler.StartAlertRuleScheduler(config.GetConfig().Alert.RuleInterval)
+
+	// 启动通知重试任务
+	scheduler.StartNotificationRetryScheduler(config.GetConfig().Alert.NotificationRetryInterval)
+
+	// 启动设备监控
+	monitor := service.GetDeviceMonitor()
+	monitor.Start()
+
 	// 创建路由
 	r := router.SetupRouter()
 
@@ -41,9 +89,32 @@ func main() {
 		port = 8080
 	}
 	addr := fmt.Sprintf("%s:%d", config.GetConfig().Server.Host, port)
-	log.Printf("Server is running on %s", addr)
+	// 关闭时取消所有请求的上下文，事件流和长轮询随之结束，不必等到Shutdown超时
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(cancelRequests)
+	go func() {
+		log.Printf("Server is running on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// 收到退出信号后停止接收请求，并等待设备监控结束
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Printf("Shutting down server...")
 
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
 	}
+	monitor.Stop()
+	log.Printf("Server stopped")
 }
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimit 限制请求体大小的中间件，需放在读取请求体的中间件之前
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"success":       false,
+				"error_message": "请求体过大",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 设备认证请求头
+const (
+	HeaderDeviceID     = "X-Device-ID"
+	HeaderCredentialID = "X-Credential-ID"
+	HeaderTimestamp    = "X-Timestamp"
+	HeaderNonce        = "X-Nonce"
+	HeaderSignature    = "X-Signature"
+)
+
+// DeviceAuth 设备认证中间件
+//
+// 优先使用客户端证书指纹认证；未提供证书时要求请求携带HMAC签名、时间戳和随机数。
+func DeviceAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.GetHeader(HeaderDeviceID)
+		if deviceID == "" {
+			abortDeviceAuth(c, http.StatusUnauthorized, "未提供设备标识")
+			return
+		}
+		if authenticateDevice(c, deviceID) {
+			c.Next()
+		}
+	}
+}
+
+// OptionalDeviceAuth 请求携带设备标识时按DeviceAuth认证，未携带时直接放行
+//
+// 用于设备自注册：新设备没有凭证，已注册的设备重新注册时需证明持有该设备的凭证。
+func OptionalDeviceAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.GetHeader(HeaderDeviceID)
+		if deviceID == "" || authenticateDevice(c, deviceID) {
+			c.Next()
+		}
+	}
+}
+
+// authenticateDevice 认证设备并将设备信息存储到上下文，失败时终止请求并返回false
+func authenticateDevice(c *gin.Context, deviceID string) bool {
+	var credential *model.DeviceCredential
+	var err error
+
+	if fingerprint := clientCertFingerprint(c); fingerprint != "" {
+		credential, err = service.AuthenticateDeviceCertificate(deviceID, fingerprint)
+	} else {
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					abortDeviceAuth(c, http.StatusRequestEntityTooLarge, "请求体过大")
+				} else {
+					abortDeviceAuth(c, http.StatusBadRequest, "读取请求体失败")
+				}
+				return false
+			}
+			// 重新设置请求体，供后续处理器读取
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+
+		credential, err = service.AuthenticateDeviceRequest(&service.DeviceSignedRequest{
+			DeviceID:     deviceID,
+			CredentialID: c.GetHeader(HeaderCredentialID),
+			Timestamp:    c.GetHeader(HeaderTimestamp),
+			Nonce:        c.GetHeader(HeaderNonce),
+			Signature:    c.GetHeader(HeaderSignature),
+			Method:       c.Request.Method,
+			URI:          c.Request.URL.RequestURI(),
+			Body:         body,
+		})
+	}
+
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceBlocked) {
+			abortDeviceAuth(c, http.StatusForbidden, err.Error())
+		} else {
+			abortDeviceAuth(c, http.StatusUnauthorized, err.Error())
+		}
+		return false
+	}
+
+	// 将设备信息存储到上下文
+	c.Set("deviceID", credential.DeviceID)
+	c.Set("credentialID", credential.ID)
+	return true
+}
+
+// clientCertFingerprint 获取客户端证书指纹
+func clientCertFingerprint(c *gin.Context) string {
+	if c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0 {
+		return service.CertificateFingerprint(c.Request.TLS.PeerCertificates[0].Raw)
+	}
+
+	// 仅在显式配置时信任反向代理传递的证书指纹
+	if header := config.GetConfig().Device.ClientCertHeader; header != "" {
+		return c.GetHeader(header)
+	}
+
+	return ""
+}
+
+// abortDeviceAuth 终止设备认证失败的请求
+func abortDeviceAuth(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"success":       false,
+		"error_message": message,
+	})
+	c.Abort()
+}
@@ -6,18 +6,65 @@ import (
 	"github.com/gin-gonic/gin"
 	"io"
 	"log"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// redactedValue 日志中敏感内容的掩码
+const redactedValue = "******"
+
+// LoggerConfig 请求日志配置
+type LoggerConfig struct {
+	// SkipBodyPaths 不记录请求体和响应体的路由，以/结尾时匹配该前缀下的所有路由
+	//
+	// 用于事件流、长轮询和流式导出：记录响应体需要把整个响应缓存在内存中，直到请求结束。
+	SkipBodyPaths []string
+	// RedactQuery 日志中替换为掩码的查询参数，如通过查询参数传递的令牌
+	RedactQuery []string
+}
+
+// skipBody 检查路由是否不记录请求体和响应体
+func (cfg *LoggerConfig) skipBody(path string) bool {
+	for _, skip := range cfg.SkipBodyPaths {
+		if path == skip || (strings.HasSuffix(skip, "/") && strings.HasPrefix(path, skip)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactQuery 返回替换敏感参数后的查询参数
+func (cfg *LoggerConfig) redactQuery(query url.Values) url.Values {
+	for _, key := range cfg.RedactQuery {
+		if _, ok := query[key]; ok {
+			query.Set(key, redactedValue)
+		}
+	}
+	return query
+}
+
 // Logger 中间件，用于记录请求日志
 func Logger() gin.HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{})
+}
+
+// LoggerWithConfig 按配置记录请求日志
+func LoggerWithConfig(cfg LoggerConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 开始时间
 		start := time.Now()
 
+		// 路由在中间件执行前已匹配，未匹配时使用请求路径
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		skipBody := cfg.skipBody(path)
+
 		// 获取请求体
 		var requestBody []byte
-		if c.Request.Body != nil {
+		if c.Request.Body != nil && !skipBody {
 			requestBody, _ = io.ReadAll(c.Request.Body)
 			// 重新设置请求体，因为读取后 body 会被清空
 			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
@@ -25,7 +72,9 @@ func Logger() gin.HandlerFunc {
 
 		// 获取响应体
 		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = blw
+		if !skipBody {
+			c.Writer = blw
+		}
 
 		// 处理请求
 		c.Next()
@@ -37,10 +86,13 @@ func Logger() gin.HandlerFunc {
 
 		// 请求信息
 		method := c.Request.Method
-		uri := c.Request.RequestURI
 		status := c.Writer.Status()
 		clientIP := c.ClientIP()
-		queryParams := c.Request.URL.Query()
+		queryParams := cfg.redactQuery(c.Request.URL.Query())
+		uri := c.Request.URL.Path
+		if len(queryParams) > 0 {
+			uri += "?" + queryParams.Encode()
+		}
 
 		// 构建日志数据
 		logData := map[string]interface{}{
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// QueryToken 将查询参数中的令牌转为Authorization请求头，需放在JWTAuth之前
+//
+// 浏览器的EventSource无法设置请求头，仅用于事件流等此类接口；请求已带Authorization时不做处理。
+func QueryToken(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query(param); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateWindow 单个客户端在当前窗口内的请求计数
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimit 按客户端IP限流的中间件，每个窗口内最多允许limit次请求
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		clients = make(map[string]*rateWindow)
+		lastGC  = time.Now()
+	)
+
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		key := c.ClientIP()
+
+		mu.Lock()
+		// 定期清理过期窗口，避免内存持续增长
+		if now.Sub(lastGC) > window {
+			for k, w := range clients {
+				if now.Sub(w.start) > window {
+					delete(clients, k)
+				}
+			}
+			lastGC = now
+		}
+
+		w, ok := clients[key]
+		if !ok || now.Sub(w.start) > window {
+			w = &rateWindow{start: now}
+			clients[key] = w
+		}
+		w.count++
+		exceeded := w.count > limit
+		retryAfter := w.start.Add(window).Sub(now)
+		mu.Unlock()
+
+		if exceeded {
+			c.Header("Retry-After", formatSeconds(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success":       false,
+				"error_message": "请求过于频繁，请稍后再试",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// formatSeconds 将时长格式化为向上取整的秒数
+func formatSeconds(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"LVerity/pkg/common"
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -45,3 +46,203 @@ func (r *AlertRule) BeforeUpdate(tx *gorm.DB) error {
 	r.UpdatedAt = time.Now()
 	return nil
 }
+
+// AlertRuleTrigger 规则产生告警的公共设置，各类型规则的条件中均可使用
+type AlertRuleTrigger struct {
+	Level    AlertLevel `json:"level,omitempty"`    // 告警级别，默认warning
+	Cooldown int        `json:"cooldown,omitempty"` // 同一设备两次告警的最小间隔（秒）；规则的告警未关闭时不会重复告警
+}
+
+// AlertMetric 阈值规则可使用的设备指标
+type AlertMetric string
+
+const (
+	AlertMetricRiskLevel             AlertMetric = "risk_level"              // 设备风险等级（0-1）
+	AlertMetricAlertCount            AlertMetric = "alert_count"             // 窗口内的告警数，未指定窗口时为未关闭的告警数
+	AlertMetricHeartbeatGap          AlertMetric = "heartbeat_gap"           // 距最后一次心跳的秒数，从未上报心跳的设备不评估
+	AlertMetricAbnormalBehaviorCount AlertMetric = "abnormal_behavior_count" // 窗口内的异常行为数
+	AlertMetricLicenseUsagePercent   AlertMetric = "license_usage_percent"   // 绑定授权的使用次数占使用上限的百分比，取最大值
+)
+
+// IsValid 检查指标是否有效
+func (m AlertMetric) IsValid() bool {
+	switch m {
+	case AlertMetricRiskLevel, AlertMetricAlertCount, AlertMetricHeartbeatGap,
+		AlertMetricAbnormalBehaviorCount, AlertMetricLicenseUsagePercent:
+		return true
+	default:
+		return false
+	}
+}
+
+// ThresholdConditions 阈值规则的条件，保存在AlertRule.Conditions中
+type ThresholdConditions struct {
+	AlertRuleTrigger
+	Metric       AlertMetric `json:"metric"`
+	Operator     string      `json:"operator"`                // >、>=、<、<=、==、!=
+	Value        float64     `json:"value"`                   // 阈值
+	Window       int         `json:"window,omitempty"`        // 统计窗口（秒），用于alert_count和abnormal_behavior_count
+	BehaviorType string      `json:"behavior_type,omitempty"` // 只统计该类型的异常行为
+}
+
+// PatternEventSource 模式规则匹配的事件来源
+type PatternEventSource string
+
+const (
+	PatternEventLog      PatternEventSource = "log"      // 设备日志（DeviceLog）
+	PatternEventBehavior PatternEventSource = "behavior" // 异常行为（AbnormalBehavior）
+)
+
+// IsValid 检查事件来源是否有效
+func (s PatternEventSource) IsValid() bool {
+	return s == PatternEventLog || s == PatternEventBehavior
+}
+
+// PatternStep 模式规则中的一步，匹配Count个满足条件的事件后进入下一步
+type PatternStep struct {
+	Source  PatternEventSource `json:"source"`
+	Type    string             `json:"type,omitempty"`    // 日志类型或异常行为类型
+	Level   string             `json:"level,omitempty"`   // 日志级别或异常行为级别
+	Message string             `json:"message,omitempty"` // 正则表达式，匹配日志内容或异常行为描述
+	Count   int                `json:"count,omitempty"`   // 需要匹配的事件数，默认1
+}
+
+// PatternConditions 模式规则的条件，保存在AlertRule.Conditions中
+//
+// Steps按顺序匹配，所有匹配的事件须在Window秒内。只有一步时相当于窗口内的计数规则。
+type PatternConditions struct {
+	AlertRuleTrigger
+	Window int           `json:"window"` // 滑动窗口（秒）
+	Steps  []PatternStep `json:"steps"`
+}
+
+// AnomalyMetric 异常规则可使用的设备指标
+type AnomalyMetric string
+
+const (
+	AnomalyMetricHeartbeatInterval AnomalyMetric = "heartbeat_interval" // 同一会话内相邻两次心跳的间隔（秒），每次心跳采样
+	AnomalyMetricSessionLength     AnomalyMetric = "session_length"     // 会话时长（秒），会话结束时采样
+	AnomalyMetricActivationCount   AnomalyMetric = "activation_count"   // 每天的授权激活次数
+	AnomalyMetricLocationChanges   AnomalyMetric = "location_changes"   // 每天日志中出现的不同位置数减一
+)
+
+// IsValid 检查指标是否有效
+func (m AnomalyMetric) IsValid() bool {
+	switch m {
+	case AnomalyMetricHeartbeatInterval, AnomalyMetricSessionLength,
+		AnomalyMetricActivationCount, AnomalyMetricLocationChanges:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsDaily 检查指标是否按天统计
+func (m AnomalyMetric) IsDaily() bool {
+	return m == AnomalyMetricActivationCount || m == AnomalyMetricLocationChanges
+}
+
+// 异常检测方法
+const (
+	AnomalyMethodZScore     = "zscore"
+	AnomalyMethodPercentile = "percentile"
+)
+
+// 异常方向
+const (
+	AnomalyDirectionHigh = "high" // 高于基线
+	AnomalyDirectionLow  = "low"  // 低于基线
+	AnomalyDirectionBoth = "both"
+)
+
+// AnomalyConditions 异常规则的条件，保存在AlertRule.Conditions中
+type AnomalyConditions struct {
+	AlertRuleTrigger
+	Metric     AnomalyMetric `json:"metric"`
+	Baseline   BaselineScope `json:"baseline,omitempty"`    // 与设备自身（device）或所在分组（group）的基线比较，默认device
+	Method     string        `json:"method,omitempty"`      // zscore或percentile，默认zscore
+	Threshold  float64       `json:"threshold,omitempty"`   // zscore为标准差倍数，默认3；percentile为百分位（50-100），默认99
+	Direction  string        `json:"direction,omitempty"`   // high、low或both，默认both
+	MinSamples int           `json:"min_samples,omitempty"` // 基线至少需要的样本数，默认20
+	Warmup     int           `json:"warmup,omitempty"`      // 基线开始学习后的预热时间（秒），预热期内不告警
+}
+
+// AlertRuleAction 告警规则的动作，AlertRule.Actions为动作的JSON数组，其它字段由动作类型决定
+type AlertRuleAction struct {
+	Type string `json:"type"`
+}
+
+// 告警规则动作类型
+const (
+	AlertActionNotify         = "notify"          // 通过通知渠道发送告警
+	AlertActionBlock          = "block"           // 封禁设备
+	AlertActionDisableLicense = "disable_license" // 禁用设备绑定的授权
+	AlertActionRaiseRisk      = "raise_risk"      // 提高设备风险等级
+	AlertActionCommand        = "command"         // 向设备下发远程命令
+	AlertActionQuarantine     = "quarantine"      // 将设备移入隔离分组
+)
+
+// NotifyAction 通过指定渠道发送规则产生的告警
+type NotifyAction struct {
+	AlertRuleAction
+	Channels []string   `json:"channels"`            // 通知渠道ID
+	MinLevel AlertLevel `json:"min_level,omitempty"` // 只发送不低于该级别的告警，渠道的min_level同样生效
+	Subject  string     `json:"subject,omitempty"`   // 覆盖渠道的标题模板
+	Template string     `json:"template,omitempty"`  // 覆盖渠道的正文模板
+}
+
+// BlockAction 封禁触发告警的设备，设备已被封禁时跳过
+type BlockAction struct {
+	AlertRuleAction
+	Reason   string `json:"reason,omitempty"`   // 封禁原因，为空时使用规则名称
+	Duration int    `json:"duration,omitempty"` // 封禁时长（秒），为0时永久封禁
+}
+
+// DisableLicenseAction 禁用设备绑定的所有有效授权
+type DisableLicenseAction struct {
+	AlertRuleAction
+}
+
+// RaiseRiskAction 将设备风险等级提高到RiskLevel，已不低于该值时跳过
+type RaiseRiskAction struct {
+	AlertRuleAction
+	RiskLevel float64 `json:"risk_level"` // 0-1
+}
+
+// CommandAction 向设备下发远程命令，设备已有同类型未完成的命令时跳过
+type CommandAction struct {
+	AlertRuleAction
+	Command DeviceCommandType `json:"command"`
+	Payload json.RawMessage   `json:"payload,omitempty"`
+	TTL     int               `json:"ttl,omitempty"` // 有效期（秒），为0时使用device.command_default_ttl
+}
+
+// QuarantineAction 将设备移入隔离分组，设备已在该分组时跳过
+type QuarantineAction struct {
+	AlertRuleAction
+	GroupID string `json:"group_id"`
+}
+
+// AlertActionStatus 规则动作在告警上的执行状态
+type AlertActionStatus string
+
+const (
+	AlertActionApplied  AlertActionStatus = "applied"  // 已执行
+	AlertActionSkipped  AlertActionStatus = "skipped"  // 设备已处于目标状态，未做修改
+	AlertActionFailed   AlertActionStatus = "failed"   // 执行失败
+	AlertActionReverted AlertActionStatus = "reverted" // 已撤销
+)
+
+// AlertActionRecord 规则动作的执行记录，保存在告警元数据的actions字段
+type AlertActionRecord struct {
+	Index         int               `json:"index"` // 动作在规则actions中的序号，从0开始
+	Type          string            `json:"type"`
+	Status        AlertActionStatus `json:"status"`
+	Message       string            `json:"message,omitempty"`
+	State         json.RawMessage   `json:"state,omitempty"` // 撤销动作所需的原状态
+	Reversible    bool              `json:"reversible"`
+	AppliedAt     time.Time         `json:"applied_at"`
+	RevertedAt    *time.Time        `json:"reverted_at,omitempty"`
+	RevertedBy    string            `json:"reverted_by,omitempty"`
+	RevertMessage string            `json:"revert_message,omitempty"`
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// BaselineScope 基线的统计范围
+type BaselineScope string
+
+const (
+	BaselineScopeDevice BaselineScope = "device" // 单个设备
+	BaselineScopeGroup  BaselineScope = "group"  // 设备分组内的所有设备
+)
+
+// IsValid 检查统计范围是否有效
+func (s BaselineScope) IsValid() bool {
+	return s == BaselineScopeDevice || s == BaselineScopeGroup
+}
+
+// AnomalyBaseline 异常规则使用的指标基线，保留最近的样本用于计算均值、标准差和百分位
+type AnomalyBaseline struct {
+	ID         string        `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Metric     AnomalyMetric `gorm:"type:varchar(50);not null;uniqueIndex:idx_anomaly_baseline" json:"metric"`
+	Scope      BaselineScope `gorm:"type:varchar(20);not null;uniqueIndex:idx_anomaly_baseline" json:"scope"`
+	ScopeID    string        `gorm:"type:varchar(191);not null;uniqueIndex:idx_anomaly_baseline" json:"scope_id"` // 设备ID或分组ID
+	Count      int64         `json:"count"`                                                                       // 累计学习的样本数
+	Mean       float64       `json:"mean"`
+	StdDev     float64       `json:"std_dev"`
+	Samples    []float64     `gorm:"-" json:"samples,omitempty"`
+	SamplesStr string        `gorm:"column:samples;type:text" json:"-"`             // 存储Samples的JSON字符串
+	LastPeriod string        `gorm:"type:varchar(20)" json:"last_period,omitempty"` // 最近学习的日期，用于按天统计的指标
+	StartedAt  time.Time     `json:"started_at"`                                    // 第一个样本的时间
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AnomalyBaseline) TableName() string {
+	return "anomaly_baselines"
+}
@@ -54,36 +54,106 @@ type Device struct {
 	LastHeartbeat   *time.Time     `gorm:"column:last_heartbeat" json:"last_heartbeat"`
 	LastSeen        *time.Time     `gorm:"column:last_seen" json:"last_seen"`
 	UsageStats      *UsageStats    `gorm:"-" json:"usage_stats,omitempty"`
+	Tags            []string       `gorm:"-" json:"tags,omitempty"`
 	Metadata        string         `gorm:"column:metadata;type:text" json:"metadata"`
 	CreatedAt       time.Time      `gorm:"type:timestamp" json:"created_at"`
 	UpdatedAt       time.Time      `gorm:"type:timestamp" json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
-// DeviceGroup 设备组
+// DeviceGroup 设备组，ParentID为空时为顶级分组
 type DeviceGroup struct {
 	ID          string         `gorm:"primaryKey;type:varchar(191)" json:"id"`
+	ParentID    string         `gorm:"type:varchar(191);index" json:"parent_id"`
 	Name        string         `gorm:"type:varchar(191);not null" json:"name"`
 	Description string         `gorm:"type:text" json:"description"`
 	Devices     []Device       `gorm:"foreignKey:GroupID" json:"devices,omitempty"`
+	Children    []DeviceGroup  `gorm:"-" json:"children,omitempty"`
+	DeviceCount int64          `gorm:"-" json:"device_count"`
 	CreatedAt   time.Time      `gorm:"type:timestamp;not null" json:"created_at"`
 	UpdatedAt   time.Time      `gorm:"type:timestamp;not null" json:"updated_at"`
 	CreatedBy   string         `gorm:"type:varchar(191)" json:"created_by"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// BlacklistRuleType 黑名单规则类型常量
+const (
+	BlacklistRuleTypeDiskID      = "disk_id"      // 硬盘序列号
+	BlacklistRuleTypeBIOS        = "bios"         // BIOS信息
+	BlacklistRuleTypeMotherboard = "motherboard"  // 主板信息
+	BlacklistRuleTypeIP          = "ip"           // 客户端IP
+	BlacklistRuleTypeCIDR        = "cidr"         // 客户端IP网段
+	BlacklistRuleTypeMAC         = "mac"          // 网卡MAC地址
+	BlacklistRuleTypeCountry     = "country"      // 客户端所在国家
+	BlacklistRuleTypeLicenseCode = "license_code" // 授权码
+	BlacklistRuleTypeCustomer    = "customer"     // 客户（授权组）
+)
+
+// BlacklistRuleAction 黑名单规则动作常量
+const (
+	BlacklistRuleActionDeny  = "deny"  // 拒绝
+	BlacklistRuleActionAllow = "allow" // 放行，优先于拒绝规则
+)
+
 // BlacklistRule 黑名单规则
 type BlacklistRule struct {
 	ID          string         `gorm:"primaryKey;type:varchar(191)" json:"id"`
 	Type        string         `gorm:"type:varchar(50);not null" json:"type"`
 	Pattern     string         `gorm:"type:varchar(191);not null" json:"pattern"`
 	Description string         `gorm:"type:text" json:"description"`
+	Action      string         `gorm:"type:varchar(20);not null;default:'deny'" json:"action"`
+	BlockDevice bool           `gorm:"default:false" json:"block_device"` // 命中时是否同时封禁设备
+	ExpiresAt   *time.Time     `gorm:"index" json:"expires_at"`           // 过期时间，为空表示永久有效
 	CreatedAt   time.Time      `gorm:"type:timestamp;not null" json:"created_at"`
 	UpdatedAt   time.Time      `gorm:"type:timestamp;not null" json:"updated_at"`
 	CreatedBy   string         `gorm:"type:varchar(191)" json:"created_by"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// IsAllow 是否为放行规则
+func (r *BlacklistRule) IsAllow() bool {
+	return r.Action == BlacklistRuleActionAllow
+}
+
+// IsActive 规则在指定时间是否有效
+func (r *BlacklistRule) IsActive(now time.Time) bool {
+	return r.ExpiresAt == nil || now.Before(*r.ExpiresAt)
+}
+
+// DeviceStatusHistory 设备状态变更记录
+type DeviceStatusHistory struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	DeviceID   string    `gorm:"type:varchar(191);not null;index" json:"device_id"`
+	OldStatus  string    `gorm:"type:varchar(20);index" json:"old_status"`
+	NewStatus  string    `gorm:"type:varchar(20);not null;index" json:"new_status"`
+	Reason     string    `gorm:"type:text" json:"reason"`
+	Metadata   string    `gorm:"type:text" json:"metadata"`
+	CreateTime time.Time `gorm:"column:create_time;not null;index" json:"create_time"`
+	CreatedBy  string    `gorm:"type:varchar(191)" json:"created_by"`
+}
+
+// TableName 指定表名，与迁移脚本 003_device_monitoring.sql 保持一致
+func (DeviceStatusHistory) TableName() string {
+	return "device_status_history"
+}
+
+// DeviceBlockAction 设备封禁记录动作常量
+const (
+	DeviceBlockActionBlock   = "block"   // 封禁
+	DeviceBlockActionUnblock = "unblock" // 解封
+)
+
+// DeviceBlockHistory 设备封禁/解封记录
+type DeviceBlockHistory struct {
+	ID          string     `gorm:"primaryKey;type:varchar(191)" json:"id"`
+	DeviceID    string     `gorm:"type:varchar(191);not null;index" json:"device_id"`
+	Action      string     `gorm:"type:varchar(20);not null" json:"action"`
+	Reason      string     `gorm:"type:text" json:"reason"`
+	Operator    string     `gorm:"type:varchar(191)" json:"operator"`       // 操作人用户ID，系统操作时为system、scheduler等
+	UnblockTime *time.Time `gorm:"column:unblock_time" json:"unblock_time"` // 封禁时计划的解封时间，为空表示永久封禁
+	CreatedAt   time.Time  `gorm:"type:timestamp;not null;index" json:"created_at"`
+}
+
 // AbnormalBehavior 异常行为记录
 type AbnormalBehavior struct {
 	ID          string         `gorm:"primaryKey;type:varchar(191)" json:"id"`
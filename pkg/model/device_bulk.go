@@ -0,0 +1,73 @@
+package model
+
+import "time"
+
+// BulkAction 批量操作类型
+type BulkAction string
+
+const (
+	BulkActionBlock            BulkAction = "block"              // 封禁
+	BulkActionUnblock          BulkAction = "unblock"            // 解封
+	BulkActionMoveGroup        BulkAction = "move_group"         // 移动到分组
+	BulkActionSetHeartbeatRate BulkAction = "set_heartbeat_rate" // 通过配置下发修改心跳间隔
+	BulkActionDelete           BulkAction = "delete"             // 删除
+)
+
+// IsValid 检查操作类型是否有效
+func (a BulkAction) IsValid() bool {
+	switch a {
+	case BulkActionBlock, BulkActionUnblock, BulkActionMoveGroup, BulkActionSetHeartbeatRate, BulkActionDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// BulkOperationStatus 批量操作状态
+type BulkOperationStatus string
+
+const (
+	BulkOperationPending   BulkOperationStatus = "pending"   // 等待后台执行
+	BulkOperationRunning   BulkOperationStatus = "running"   // 执行中
+	BulkOperationCompleted BulkOperationStatus = "completed" // 已执行完所有设备（部分设备可能失败）
+	BulkOperationFailed    BulkOperationStatus = "failed"    // 执行中断
+)
+
+// BulkOperation 设备批量操作
+type BulkOperation struct {
+	ID         string              `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Action     BulkAction          `gorm:"type:varchar(30);not null" json:"action"`
+	Params     string              `gorm:"type:text" json:"params"` // 操作参数的JSON
+	Filter     string              `gorm:"type:text" json:"filter"` // 按条件选择设备时的搜索条件JSON
+	Status     BulkOperationStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	Total      int                 `json:"total"`
+	Succeeded  int                 `json:"succeeded"`
+	Failed     int                 `json:"failed"`
+	Skipped    int                 `gorm:"not null;default:0" json:"skipped"` // 无需修改而跳过的设备数
+	Error      string              `gorm:"type:text" json:"error,omitempty"`
+	CreatedBy  string              `gorm:"type:varchar(191)" json:"created_by"`
+	CreatedAt  time.Time           `gorm:"not null;index" json:"created_at"`
+	StartedAt  *time.Time          `json:"started_at,omitempty"`
+	FinishedAt *time.Time          `json:"finished_at,omitempty"`
+}
+
+// TableName 指定表名
+func (BulkOperation) TableName() string {
+	return "device_bulk_operations"
+}
+
+// BulkOperationResult 批量操作中单个设备的执行结果
+type BulkOperationResult struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	OperationID string    `gorm:"type:varchar(36);not null;index" json:"operation_id"`
+	DeviceID    string    `gorm:"type:varchar(191);not null" json:"device_id"`
+	Success     bool      `json:"success"`
+	Skipped     bool      `gorm:"not null;default:false" json:"skipped,omitempty"` // 设备已处于目标状态，未做修改
+	Error       string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (BulkOperationResult) TableName() string {
+	return "device_bulk_operation_results"
+}
@@ -0,0 +1,69 @@
+package model
+
+import "time"
+
+// DeviceCommandType 远程命令类型
+type DeviceCommandType string
+
+const (
+	DeviceCommandReverifyLicense DeviceCommandType = "reverify_license" // 重新校验授权
+	DeviceCommandUploadLogs      DeviceCommandType = "upload_logs"      // 上传日志
+	DeviceCommandDeactivate      DeviceCommandType = "deactivate"       // 注销授权
+	DeviceCommandLock            DeviceCommandType = "lock"             // 锁定客户端
+	DeviceCommandUnlock          DeviceCommandType = "unlock"           // 解锁客户端
+)
+
+// IsValid 检查命令类型是否有效
+func (t DeviceCommandType) IsValid() bool {
+	switch t {
+	case DeviceCommandReverifyLicense, DeviceCommandUploadLogs, DeviceCommandDeactivate,
+		DeviceCommandLock, DeviceCommandUnlock:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeviceCommandStatus 远程命令状态
+type DeviceCommandStatus string
+
+const (
+	DeviceCommandPending   DeviceCommandStatus = "pending"   // 等待设备拉取
+	DeviceCommandDelivered DeviceCommandStatus = "delivered" // 已下发，等待执行结果
+	DeviceCommandSucceeded DeviceCommandStatus = "succeeded" // 执行成功
+	DeviceCommandFailed    DeviceCommandStatus = "failed"    // 执行失败
+	DeviceCommandExpired   DeviceCommandStatus = "expired"   // 超过有效期未完成
+	DeviceCommandCancelled DeviceCommandStatus = "cancelled" // 已取消
+)
+
+// IsFinal 是否为终态
+func (s DeviceCommandStatus) IsFinal() bool {
+	switch s {
+	case DeviceCommandSucceeded, DeviceCommandFailed, DeviceCommandExpired, DeviceCommandCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeviceCommand 下发给设备的远程命令
+type DeviceCommand struct {
+	ID           string              `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	DeviceID     string              `gorm:"type:varchar(191);not null;index" json:"device_id"`
+	Type         DeviceCommandType   `gorm:"type:varchar(50);not null;index" json:"type"`
+	Payload      string              `gorm:"type:text" json:"payload"` // 命令参数JSON
+	Status       DeviceCommandStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	Result       string              `gorm:"type:text" json:"result"` // 设备上报的执行结果JSON
+	ErrorMessage string              `gorm:"type:text" json:"error_message"`
+	ExpiresAt    time.Time           `gorm:"not null;index" json:"expires_at"`
+	DeliveredAt  *time.Time          `json:"delivered_at"`
+	CompletedAt  *time.Time          `json:"completed_at"`
+	CreateTime   time.Time           `gorm:"column:create_time;not null;index" json:"create_time"`
+	CreatedBy    string              `gorm:"type:varchar(191)" json:"created_by"`
+	UpdateTime   time.Time           `gorm:"column:update_time;not null" json:"update_time"`
+}
+
+// TableName 指定表名
+func (DeviceCommand) TableName() string {
+	return "device_commands"
+}
@@ -0,0 +1,79 @@
+package model
+
+import "time"
+
+// DeviceConfigTarget 配置作用对象类型
+type DeviceConfigTarget string
+
+const (
+	DeviceConfigTargetDevice DeviceConfigTarget = "device" // 单个设备
+	DeviceConfigTargetGroup  DeviceConfigTarget = "group"  // 设备分组
+)
+
+// DeviceConfigAckStatus 设备应用配置的结果
+type DeviceConfigAckStatus string
+
+const (
+	DeviceConfigAckApplied DeviceConfigAckStatus = "applied" // 已应用
+	DeviceConfigAckFailed  DeviceConfigAckStatus = "failed"  // 应用失败
+)
+
+// DeviceConfigSpec 下发给设备的配置内容，字段为空时继承上一级配置
+type DeviceConfigSpec struct {
+	HeartbeatRate *int            `json:"heartbeat_rate,omitempty"` // 心跳间隔（秒）
+	LogLevel      string          `json:"log_level,omitempty"`      // 客户端日志级别
+	FeatureFlags  map[string]bool `json:"feature_flags,omitempty"`  // 功能开关
+}
+
+// DeviceConfig 设备或分组的期望配置
+type DeviceConfig struct {
+	ID         string             `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	TargetType DeviceConfigTarget `gorm:"type:varchar(20);not null;uniqueIndex:idx_device_config_target" json:"target_type"`
+	TargetID   string             `gorm:"type:varchar(191);not null;uniqueIndex:idx_device_config_target" json:"target_id"`
+	Version    int                `gorm:"not null" json:"version"`          // 每次变更递增
+	Config     string             `gorm:"type:text;not null" json:"config"` // DeviceConfigSpec的JSON
+	UpdateTime time.Time          `gorm:"column:update_time;not null" json:"update_time"`
+	UpdatedBy  string             `gorm:"type:varchar(191)" json:"updated_by"`
+}
+
+// TableName 指定表名
+func (DeviceConfig) TableName() string {
+	return "device_configs"
+}
+
+// DeviceConfigHistory 配置变更历史
+//
+// ConfigType为作用对象类型，DeviceID为作用对象ID（分组配置时为分组ID）。
+type DeviceConfigHistory struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	DeviceID   string    `gorm:"type:varchar(191);not null;index" json:"device_id"`
+	ConfigType string    `gorm:"type:varchar(50);not null;index" json:"config_type"`
+	Version    int       `gorm:"not null;index" json:"version"`
+	OldValue   string    `gorm:"type:text" json:"old_value"`
+	NewValue   string    `gorm:"type:text;not null" json:"new_value"`
+	Diff       string    `gorm:"type:text" json:"diff"` // 变更字段的JSON，格式为 {字段: {old, new}}
+	Reason     string    `gorm:"type:text" json:"reason"`
+	Metadata   string    `gorm:"type:text" json:"metadata"`
+	CreateTime time.Time `gorm:"column:create_time;not null;index" json:"create_time"`
+	CreatedBy  string    `gorm:"type:varchar(191)" json:"created_by"`
+}
+
+// TableName 指定表名，与迁移脚本 003_device_monitoring.sql 保持一致
+func (DeviceConfigHistory) TableName() string {
+	return "device_config_history"
+}
+
+// DeviceConfigState 设备最近一次确认的配置
+type DeviceConfigState struct {
+	DeviceID   string                `gorm:"primaryKey;type:varchar(191)" json:"device_id"`
+	ETag       string                `gorm:"column:etag;type:varchar(64)" json:"etag"`
+	Status     DeviceConfigAckStatus `gorm:"type:varchar(20)" json:"status"`
+	Message    string                `gorm:"type:text" json:"message"`
+	AckTime    time.Time             `gorm:"column:ack_time" json:"ack_time"`
+	UpdateTime time.Time             `gorm:"column:update_time" json:"update_time"`
+}
+
+// TableName 指定表名
+func (DeviceConfigState) TableName() string {
+	return "device_config_states"
+}
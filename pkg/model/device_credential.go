@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+)
+
+// DeviceCredentialType 设备凭证类型
+type DeviceCredentialType string
+
+const (
+	DeviceCredentialTypeSecret      DeviceCredentialType = "secret"      // 服务端签发的密钥
+	DeviceCredentialTypeCertificate DeviceCredentialType = "certificate" // 客户端证书指纹
+)
+
+// DeviceCredentialStatus 设备凭证状态
+type DeviceCredentialStatus string
+
+const (
+	DeviceCredentialStatusActive  DeviceCredentialStatus = "active"  // 有效
+	DeviceCredentialStatusRevoked DeviceCredentialStatus = "revoked" // 已吊销
+)
+
+// DeviceCredential 设备凭证
+type DeviceCredential struct {
+	ID          string                 `gorm:"primaryKey;type:varchar(191)" json:"id"`
+	DeviceID    string                 `gorm:"type:varchar(191);not null;index" json:"device_id"`
+	Type        DeviceCredentialType   `gorm:"type:varchar(20);not null" json:"type"`
+	Secret      string                 `gorm:"type:text" json:"-"`                         // AES加密后的密钥
+	Fingerprint string                 `gorm:"type:varchar(191);index" json:"fingerprint"` // 证书SHA-256指纹（十六进制小写）
+	Status      DeviceCredentialStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	ExpiresAt   *time.Time             `json:"expires_at"` // 轮换后旧凭证的失效时间
+	LastUsedAt  *time.Time             `json:"last_used_at"`
+	RevokedAt   *time.Time             `json:"revoked_at"`
+	RevokedBy   string                 `gorm:"type:varchar(191)" json:"revoked_by"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// IsUsable 检查凭证当前是否可用于认证
+func (c *DeviceCredential) IsUsable(now time.Time) bool {
+	if c.Status != DeviceCredentialStatusActive {
+		return false
+	}
+	return c.ExpiresAt == nil || now.Before(*c.ExpiresAt)
+}
+
+// TableName 指定表名
+func (DeviceCredential) TableName() string {
+	return "device_credentials"
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// DuplicateStatus 重复设备候选状态
+type DuplicateStatus string
+
+const (
+	DuplicateStatusPending   DuplicateStatus = "pending"   // 待审核
+	DuplicateStatusMerged    DuplicateStatus = "merged"    // 已合并
+	DuplicateStatusDismissed DuplicateStatus = "dismissed" // 已确认不是重复设备，之后不再检出
+)
+
+// DeviceDuplicate 疑似重复的设备对，DeviceID按字典序小于DuplicateID
+type DeviceDuplicate struct {
+	ID          string          `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	DeviceID    string          `gorm:"type:varchar(191);not null;uniqueIndex:idx_device_duplicate_pair" json:"device_id"`
+	DuplicateID string          `gorm:"type:varchar(191);not null;uniqueIndex:idx_device_duplicate_pair;index" json:"duplicate_id"`
+	Score       float64         `gorm:"not null" json:"score"`    // 相似度（0-1）
+	Reasons     string          `gorm:"type:text" json:"reasons"` // 命中的相似项，逗号分隔
+	Status      DuplicateStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	MergedInto  string          `gorm:"type:varchar(191)" json:"merged_into,omitempty"` // 合并后保留的设备
+	DetectedAt  time.Time       `gorm:"not null" json:"detected_at"`
+	ReviewedAt  *time.Time      `json:"reviewed_at,omitempty"`
+	ReviewedBy  string          `gorm:"type:varchar(191)" json:"reviewed_by,omitempty"`
+}
+
+// TableName 指定表名
+func (DeviceDuplicate) TableName() string {
+	return "device_duplicates"
+}
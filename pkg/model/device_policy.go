@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// DevicePolicyTarget 策略作用对象类型
+type DevicePolicyTarget string
+
+const (
+	DevicePolicyTargetDevice DevicePolicyTarget = "device" // 单个设备，覆盖分组策略
+	DevicePolicyTargetGroup  DevicePolicyTarget = "group"  // 设备分组，子分组和设备继承
+)
+
+// DevicePolicySpec 设备策略，字段为空时继承上级分组
+type DevicePolicySpec struct {
+	HeartbeatRate       *int            `json:"heartbeat_rate,omitempty"`         // 心跳间隔（秒），配置推送未指定时使用
+	AllowedCountries    []string        `json:"allowed_countries,omitempty"`      // 允许接入的国家名称或ISO代码
+	AlertRules          map[string]bool `json:"alert_rules,omitempty"`            // 按告警标题开关告警，false时不产生该告警
+	AutoBlockRiskLevel  *float64        `json:"auto_block_risk_level,omitempty"`  // 风险等级（0-1）达到该值时自动封禁
+	AutoBlockAlertCount *int            `json:"auto_block_alert_count,omitempty"` // 未处理告警数达到该值时自动封禁
+}
+
+// DevicePolicy 分组或设备的策略
+type DevicePolicy struct {
+	ID         string             `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	TargetType DevicePolicyTarget `gorm:"type:varchar(20);not null;uniqueIndex:idx_device_policy_target" json:"target_type"`
+	TargetID   string             `gorm:"type:varchar(191);not null;uniqueIndex:idx_device_policy_target" json:"target_id"`
+	Policy     string             `gorm:"type:text;not null" json:"policy"` // DevicePolicySpec的JSON
+	UpdateTime time.Time          `gorm:"column:update_time;not null" json:"update_time"`
+	UpdatedBy  string             `gorm:"type:varchar(191)" json:"updated_by"`
+}
+
+// TableName 指定表名
+func (DevicePolicy) TableName() string {
+	return "device_policies"
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// DeviceTag 设备标签，一个设备可以有多个标签
+type DeviceTag struct {
+	DeviceID  string    `gorm:"primaryKey;type:varchar(191)" json:"device_id"`
+	Tag       string    `gorm:"primaryKey;type:varchar(64);index" json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `gorm:"type:varchar(191)" json:"created_by"`
+}
+
+// TableName 指定表名
+func (DeviceTag) TableName() string {
+	return "device_tags"
+}
@@ -43,4 +43,7 @@ type LogExportOptions struct {
 	EndTime   time.Time    `json:"end_time"`
 	DeviceID  string      `json:"device_id"`
 	Format    ExportFormat `json:"format"`
+	LogTypes  []string     `json:"log_types"` // 日志类型过滤，为空时不过滤
+	Levels    []LogLevel   `json:"levels"`    // 日志级别过滤，为空时不过滤
+	Source    string       `json:"source"`    // 日志来源过滤，为空时不过滤
 }
@@ -38,12 +38,34 @@ type SystemLog struct {
 
 // DeviceLog 设备日志
 type DeviceLog struct {
-	ID             string    `json:"id" gorm:"primaryKey"`
-	DeviceID       string    `json:"device_id" gorm:"index"`
-	Type           string    `json:"type"`            // 日志类型
-	Level          LogLevel  `json:"level"`           // 日志级别
-	Message        string    `json:"message"`         // 日志内容
-	Source         string    `json:"source"`          // 日志来源
-	Timestamp      time.Time `json:"timestamp"`       // 时间戳
-	AdditionalInfo string    `json:"additional_info"` // 附加信息
+	ID             string    `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	DeviceID       string    `json:"device_id" gorm:"type:varchar(191);index;index:idx_device_logs_device_received,priority:1"`
+	Type           string    `json:"type" gorm:"type:varchar(50);index"`    // 日志类型
+	Level          LogLevel  `json:"level" gorm:"type:varchar(20);index"`   // 日志级别
+	Message        string    `json:"message" gorm:"type:text"`              // 日志内容
+	Source         string    `json:"source" gorm:"type:varchar(100);index"` // 日志来源
+	Timestamp      time.Time `json:"timestamp" gorm:"index"`                // 时间戳
+	AdditionalInfo string    `json:"additional_info" gorm:"type:text"`      // 附加信息
+	IP             string    `json:"ip" gorm:"type:varchar(45)"`            // 上报时的客户端IP
+	Country        string    `json:"country" gorm:"type:varchar(100)"`      // 根据IP解析的国家
+	City           string    `json:"city" gorm:"type:varchar(100)"`         // 根据IP解析的城市
+	// 服务端接收时间，与设备ID组成联合索引，用于获取设备最近一条日志
+	ReceivedAt time.Time `json:"received_at" gorm:"index:idx_device_logs_device_received,priority:2"`
+}
+
+// DeviceActivity 设备活动记录
+type DeviceActivity struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	DeviceID    string    `json:"device_id" gorm:"type:varchar(191);not null;index"`
+	Type        string    `json:"type" gorm:"type:varchar(50);not null;index"`
+	Description string    `json:"description" gorm:"type:text"`
+	Metadata    string    `json:"metadata" gorm:"type:text"`
+	IPAddress   string    `json:"ip_address" gorm:"column:ip_address;type:varchar(45);index"`
+	Location    string    `json:"location" gorm:"type:varchar(255)"`
+	CreateTime  time.Time `json:"create_time" gorm:"column:create_time;not null;index"`
+}
+
+// TableName 指定表名，与迁移脚本 003_device_monitoring.sql 保持一致
+func (DeviceActivity) TableName() string {
+	return "device_activities"
 }
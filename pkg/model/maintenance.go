@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// DeviceStatusMaintenance 维护中的设备状态
+const DeviceStatusMaintenance = "maintenance"
+
+// MaintenanceStatus 维护窗口状态
+type MaintenanceStatus string
+
+const (
+	MaintenanceStatusScheduled  MaintenanceStatus = "scheduled"   // 已计划
+	MaintenanceStatusInProgress MaintenanceStatus = "in_progress" // 进行中
+	MaintenanceStatusCompleted  MaintenanceStatus = "completed"   // 已完成
+	MaintenanceStatusCancelled  MaintenanceStatus = "cancelled"   // 已取消
+)
+
+// DeviceMaintenance 设备维护窗口，作用于单个设备或整个设备分组
+type DeviceMaintenance struct {
+	ID          string            `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	DeviceID    string            `gorm:"type:varchar(191);index" json:"device_id"`
+	GroupID     string            `gorm:"type:varchar(191);index" json:"group_id"`
+	Type        string            `gorm:"type:varchar(50);not null;index" json:"type"`
+	Status      MaintenanceStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	Description string            `gorm:"type:text" json:"description"`
+	ScheduledAt time.Time         `gorm:"not null;index" json:"scheduled_at"` // 窗口开始时间
+	EndAt       time.Time         `gorm:"not null;index" json:"end_at"`       // 窗口结束时间
+	StartedAt   *time.Time        `json:"started_at"`
+	CompletedAt *time.Time        `gorm:"index" json:"completed_at"`
+	Metadata    string            `gorm:"type:text" json:"metadata"`
+	Notes       string            `gorm:"type:text" json:"notes"`
+	CreateTime  time.Time         `gorm:"column:create_time;not null" json:"create_time"`
+	CreatedBy   string            `gorm:"type:varchar(191)" json:"created_by"`
+	UpdateTime  time.Time         `gorm:"column:update_time;not null" json:"update_time"`
+	UpdatedBy   string            `gorm:"type:varchar(191)" json:"updated_by"`
+}
+
+// TableName 指定表名，与迁移脚本 003_device_monitoring.sql 保持一致
+func (DeviceMaintenance) TableName() string {
+	return "device_maintenance"
+}
+
+// IsFinished 维护窗口是否已结束（完成或取消）
+func (m *DeviceMaintenance) IsFinished() bool {
+	return m.Status == MaintenanceStatusCompleted || m.Status == MaintenanceStatusCancelled
+}
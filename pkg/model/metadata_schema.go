@@ -0,0 +1,69 @@
+package model
+
+import "time"
+
+// MetadataTarget 元数据所属对象
+type MetadataTarget string
+
+const (
+	MetadataTargetDevice  MetadataTarget = "device"  // 设备元数据，按设备类型区分
+	MetadataTargetLicense MetadataTarget = "license" // 授权码元数据，按授权类型区分
+)
+
+// IsValid 检查元数据对象是否有效
+func (t MetadataTarget) IsValid() bool {
+	return t == MetadataTargetDevice || t == MetadataTargetLicense
+}
+
+// MetadataFieldType 元数据字段类型
+type MetadataFieldType string
+
+const (
+	MetadataFieldString  MetadataFieldType = "string"
+	MetadataFieldNumber  MetadataFieldType = "number"
+	MetadataFieldInteger MetadataFieldType = "integer"
+	MetadataFieldBoolean MetadataFieldType = "boolean"
+	MetadataFieldObject  MetadataFieldType = "object"
+	MetadataFieldArray   MetadataFieldType = "array"
+)
+
+// IsValid 检查字段类型是否有效
+func (t MetadataFieldType) IsValid() bool {
+	switch t {
+	case MetadataFieldString, MetadataFieldNumber, MetadataFieldInteger, MetadataFieldBoolean, MetadataFieldObject, MetadataFieldArray:
+		return true
+	default:
+		return false
+	}
+}
+
+// MetadataField 元数据顶层字段定义
+type MetadataField struct {
+	Name        string            `json:"name"`
+	Type        MetadataFieldType `json:"type"`
+	Required    bool              `json:"required,omitempty"`
+	Enum        []interface{}     `json:"enum,omitempty"` // 可选值，仅用于string、number和integer字段
+	Description string            `json:"description,omitempty"`
+}
+
+// MetadataSchema 元数据结构定义
+//
+// Scope为设备类型或授权类型，为空时作为该对象的默认定义，没有对应类型的定义时使用。
+type MetadataSchema struct {
+	ID              string          `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Target          MetadataTarget  `gorm:"type:varchar(20);not null;uniqueIndex:idx_metadata_schema_scope" json:"target"`
+	Scope           string          `gorm:"type:varchar(100);not null;uniqueIndex:idx_metadata_schema_scope" json:"scope"`
+	Fields          []MetadataField `gorm:"-" json:"fields"`
+	FieldsStr       string          `gorm:"column:fields;type:text" json:"-"` // 存储Fields的JSON字符串
+	AllowAdditional bool            `json:"allow_additional"`                 // 是否允许未定义的字段
+	Description     string          `gorm:"type:text" json:"description"`
+	CreatedBy       string          `gorm:"type:varchar(191)" json:"created_by"`
+	UpdatedBy       string          `gorm:"type:varchar(191)" json:"updated_by"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (MetadataSchema) TableName() string {
+	return "metadata_schemas"
+}
@@ -0,0 +1,101 @@
+package model
+
+import "time"
+
+// NotificationChannelType 通知渠道类型
+type NotificationChannelType string
+
+const (
+	NotificationChannelEmail    NotificationChannelType = "email"    // SMTP邮件
+	NotificationChannelWebhook  NotificationChannelType = "webhook"  // 通用HTTP回调，可带HMAC签名
+	NotificationChannelSlack    NotificationChannelType = "slack"    // Slack incoming webhook
+	NotificationChannelDingTalk NotificationChannelType = "dingtalk" // 钉钉群机器人
+	NotificationChannelWeCom    NotificationChannelType = "wecom"    // 企业微信群机器人
+)
+
+// IsValid 检查渠道类型是否有效
+func (t NotificationChannelType) IsValid() bool {
+	switch t {
+	case NotificationChannelEmail, NotificationChannelWebhook, NotificationChannelSlack,
+		NotificationChannelDingTalk, NotificationChannelWeCom:
+		return true
+	default:
+		return false
+	}
+}
+
+// NotificationChannelConfig 通知渠道的连接参数，按渠道类型使用其中的字段
+type NotificationChannelConfig struct {
+	// email
+	Host     string   `json:"host,omitempty"`
+	Port     int      `json:"port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	TLS      string   `json:"tls,omitempty"` // starttls（默认，服务器支持时使用）、tls（隐式TLS）或none
+
+	// webhook、slack、dingtalk、wecom
+	URL     string            `json:"url,omitempty"`
+	Secret  string            `json:"secret,omitempty"`  // webhook的HMAC签名密钥，dingtalk的加签密钥
+	Headers map[string]string `json:"headers,omitempty"` // webhook附加的请求头
+}
+
+// NotificationChannel 告警通知渠道
+//
+// AllAlerts为true的渠道接收所有不低于MinLevel的告警，否则只接收告警规则notify动作指定的告警。
+type NotificationChannel struct {
+	ID        string                    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Name      string                    `gorm:"type:varchar(100);not null;uniqueIndex" json:"name"`
+	Type      NotificationChannelType   `gorm:"type:varchar(20);not null" json:"type"`
+	Config    NotificationChannelConfig `gorm:"-" json:"config"`
+	ConfigStr string                    `gorm:"column:config;type:text" json:"-"`  // 存储Config的JSON字符串
+	MinLevel  AlertLevel                `gorm:"type:varchar(20)" json:"min_level"` // 为空时发送所有级别
+	AllAlerts bool                      `json:"all_alerts"`
+	Subject   string                    `gorm:"type:text" json:"subject"`  // 标题模板，为空时使用默认模板
+	Template  string                    `gorm:"type:text" json:"template"` // 正文模板，为空时使用默认模板
+	Enabled   bool                      `gorm:"index" json:"enabled"`
+	CreatedBy string                    `gorm:"type:varchar(191)" json:"created_by"`
+	CreatedAt time.Time                 `json:"created_at"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (NotificationChannel) TableName() string {
+	return "notification_channels"
+}
+
+// NotificationDeliveryStatus 通知发送状态
+type NotificationDeliveryStatus string
+
+const (
+	NotificationDeliveryPending NotificationDeliveryStatus = "pending" // 等待发送或重试
+	NotificationDeliverySent    NotificationDeliveryStatus = "sent"    // 已发送
+	NotificationDeliveryFailed  NotificationDeliveryStatus = "failed"  // 重试次数用尽
+)
+
+// NotificationDelivery 通知发送记录，消息在创建时渲染，重试时发送相同的内容
+type NotificationDelivery struct {
+	ID            string                     `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	ChannelID     string                     `gorm:"type:varchar(36);not null;index" json:"channel_id"`
+	ChannelType   NotificationChannelType    `gorm:"type:varchar(20)" json:"channel_type"`
+	AlertID       string                     `gorm:"type:varchar(191);index" json:"alert_id"` // 测试发送时为空
+	RuleID        string                     `gorm:"type:varchar(191);index" json:"rule_id"`  // 由告警规则notify动作产生时的规则ID
+	Test          bool                       `json:"test"`
+	Level         AlertLevel                 `gorm:"type:varchar(20)" json:"level"`
+	Subject       string                     `gorm:"type:text" json:"subject"`
+	Message       string                     `gorm:"type:text" json:"message"`
+	Status        NotificationDeliveryStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	Attempts      int                        `json:"attempts"`
+	ResponseCode  int                        `json:"response_code"` // 最近一次发送的HTTP状态码或SMTP应答码
+	LastError     string                     `gorm:"type:text" json:"last_error"`
+	NextAttemptAt *time.Time                 `gorm:"index" json:"next_attempt_at"`
+	SentAt        *time.Time                 `json:"sent_at"`
+	CreatedAt     time.Time                  `gorm:"index" json:"created_at"`
+	UpdatedAt     time.Time                  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (NotificationDelivery) TableName() string {
+	return "notification_deliveries"
+}
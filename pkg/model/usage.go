@@ -4,17 +4,20 @@ import (
 	"time"
 )
 
-// UsageRecord 使用记录
+// UsageRecord 使用记录，即一次设备会话
+//
+// 会话在首次心跳时创建，之后每次心跳延长EndTime；超过心跳超时未收到心跳或设备离线时结束。
 type UsageRecord struct {
-	ID         string    `gorm:"primaryKey" json:"id"`
-	DeviceID   string    `gorm:"index" json:"device_id"`
-	StartTime  time.Time `json:"start_time"`
-	EndTime    time.Time `json:"end_time"`
-	Duration   int64     `json:"duration"` // 持续时间（秒）
-	SessionID  string    `json:"session_id"`
-	IP         string    `json:"ip"`
-	UserAgent  string    `json:"user_agent"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	DeviceID  string    `gorm:"type:varchar(191);index" json:"device_id"`
+	StartTime time.Time `gorm:"index" json:"start_time"`
+	EndTime   time.Time `gorm:"index" json:"end_time"` // 进行中的会话为最近一次心跳时间
+	Duration  int64     `json:"duration"`              // 持续时间（秒）
+	SessionID string    `gorm:"type:varchar(36)" json:"session_id"`
+	IP        string    `gorm:"type:varchar(45)" json:"ip"`
+	UserAgent string    `gorm:"type:varchar(255)" json:"user_agent"`
+	Active    bool      `gorm:"index" json:"active"` // 会话是否进行中
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // UsageReport 使用报告
@@ -27,6 +30,59 @@ type UsageReport struct {
 	Records      []UsageRecord `json:"records"`
 }
 
+// UsagePeriod 使用统计周期
+type UsagePeriod string
+
+const (
+	UsagePeriodDay  UsagePeriod = "day"  // 按天统计
+	UsagePeriodWeek UsagePeriod = "week" // 按周统计，周一为一周开始
+)
+
+// IsValid 检查统计周期是否有效
+func (p UsagePeriod) IsValid() bool {
+	return p == UsagePeriodDay || p == UsagePeriodWeek
+}
+
+// DeviceUsageRollup 设备在一个统计周期内的使用汇总
+//
+// 跨周期的会话按落在周期内的时长计入TotalTime，会话数按开始时间计入所在周期。
+type DeviceUsageRollup struct {
+	ID             uint        `gorm:"primaryKey" json:"id"`
+	DeviceID       string      `gorm:"type:varchar(191);uniqueIndex:idx_device_usage_period" json:"device_id"`
+	GroupID        string      `gorm:"type:varchar(191);index" json:"group_id"`
+	Period         UsagePeriod `gorm:"type:varchar(10);uniqueIndex:idx_device_usage_period" json:"period"`
+	PeriodStart    time.Time   `gorm:"uniqueIndex:idx_device_usage_period" json:"period_start"`
+	TotalTime      int64       `json:"total_time"`      // 使用时长（秒）
+	SessionCount   int         `json:"session_count"`   // 周期内开始的会话数
+	LongestSession int64       `json:"longest_session"` // 周期内最长的会话时长（秒）
+	LastActive     time.Time   `json:"last_active"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DeviceUsageRollup) TableName() string {
+	return "device_usage_rollups"
+}
+
+// GroupUsageRollup 设备分组在一个统计周期内的使用汇总，未分组设备的GroupID为空
+type GroupUsageRollup struct {
+	ID              uint        `gorm:"primaryKey" json:"id"`
+	GroupID         string      `gorm:"type:varchar(191);uniqueIndex:idx_group_usage_period" json:"group_id"`
+	Period          UsagePeriod `gorm:"type:varchar(10);uniqueIndex:idx_group_usage_period" json:"period"`
+	PeriodStart     time.Time   `gorm:"uniqueIndex:idx_group_usage_period" json:"period_start"`
+	TotalTime       int64       `json:"total_time"`       // 分组内设备使用时长之和（秒）
+	SessionCount    int         `json:"session_count"`    // 周期内开始的会话数
+	ActiveDevices   int         `json:"active_devices"`   // 活跃设备数，按天为DAU，按周为WAU
+	PeakConcurrency int         `json:"peak_concurrency"` // 同时在线设备数峰值
+	PeakAt          *time.Time  `json:"peak_at"`          // 首次达到峰值的时间
+	UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (GroupUsageRollup) TableName() string {
+	return "group_usage_rollups"
+}
+
 // LogExportFormat 日志导出格式
 type LogExportFormat string
 
@@ -48,18 +48,34 @@ func (r *AlertRuleRepository) Delete(id string) error {
 	return database.GetDB().Delete(&model.AlertRule{}, "id = ?", id).Error
 }
 
+// AlertRuleFilter 告警规则列表的过滤条件，字段为空时不过滤
+type AlertRuleFilter struct {
+	Type     model.AlertRuleType
+	DeviceID string
+	Enabled  *bool
+}
+
 // List 获取告警规则列表
-func (r *AlertRuleRepository) List(page, pageSize int) ([]model.AlertRule, int64, error) {
+func (r *AlertRuleRepository) List(filter AlertRuleFilter, page, pageSize int) ([]model.AlertRule, int64, error) {
 	var rules []model.AlertRule
 	var total int64
 
 	tx := database.GetDB().Model(&model.AlertRule{})
+	if filter.Type != "" {
+		tx = tx.Where("type = ?", filter.Type)
+	}
+	if filter.DeviceID != "" {
+		tx = tx.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.Enabled != nil {
+		tx = tx.Where("enabled = ?", *filter.Enabled)
+	}
 	err := tx.Count(&total).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
-	err = tx.Offset((page - 1) * pageSize).Limit(pageSize).Find(&rules).Error
+	err = tx.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rules).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -1,8 +1,11 @@
 package router
 
 import (
+	"LVerity/pkg/config"
 	"LVerity/pkg/handler"
 	"LVerity/pkg/middleware"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,7 +15,21 @@ func SetupRouter() *gin.Engine {
 
 	// 使用中间件
 	r.Use(middleware.CORS())
-	r.Use(middleware.Logger())
+	r.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		// 事件流和长轮询的响应在客户端断开前不会结束，不能缓存响应体；
+		// 设备接口和凭证接口的请求或响应中有授权码和明文密钥，不能写入日志；
+		// 导入导出的文件可能很大，流式读写，不能整个缓存在内存中
+		SkipBodyPaths: []string{
+			"/api/events/stream",
+			"/agent/",
+			"/api/devices/:id/credentials",
+			"/api/devices/:id/credentials/",
+			"/api/devices/import",
+			"/api/devices/export",
+			"/api/devices/logs/export",
+		},
+		RedactQuery: []string{"access_token"},
+	}))
 
 	// 健康检查
 	r.GET("/health", handler.HealthCheck)
@@ -25,6 +42,26 @@ func SetupRouter() *gin.Engine {
 		public.POST("/refresh", middleware.JWTAuth(), handler.RefreshToken)  // 刷新令牌
 	}
 
+	// 客户端（设备代理）路由组
+	agent := r.Group("/agent")
+	{
+		registerLimit := config.GetConfig().Device.RegisterRateLimit
+		agent.POST("/register", middleware.RateLimit(registerLimit, time.Minute), middleware.OptionalDeviceAuth(), handler.AgentRegister) // 设备自注册并激活授权，已注册设备需签名
+
+		// 需要设备凭证认证的接口
+		authed := agent.Group("")
+		authed.Use(middleware.BodyLimit(config.GetConfig().Device.LogMaxBodySize), middleware.DeviceAuth())
+		{
+			authed.POST("/heartbeat", handler.AgentHeartbeat)                   // 上报心跳
+			authed.POST("/credentials/rotate", handler.AgentRotateCredential) // 轮换设备密钥
+			authed.POST("/logs", handler.AgentSubmitLogs)                       // 批量上报日志和活动
+			authed.GET("/config", handler.AgentGetConfig)                       // 拉取生效配置
+			authed.POST("/config/ack", handler.AgentAckConfig)                  // 确认已应用的配置
+			authed.GET("/commands", handler.AgentPullCommands)                  // 拉取远程命令，支持长轮询
+			authed.POST("/commands/:id/result", handler.AgentReportCommandResult) // 上报命令执行结果
+		}
+	}
+
 	// 用户相关路由组
 	user := r.Group("/user")
 	user.Use(middleware.JWTAuth())
@@ -41,6 +78,9 @@ func SetupRouter() *gin.Engine {
 		users.GET("", handler.ListUsers)
 	}
 
+	// 设备实时事件流，EventSource无法设置请求头，允许通过access_token参数传递令牌
+	r.GET("/api/events/stream", middleware.QueryToken("access_token"), middleware.JWTAuth(), handler.StreamDeviceEvents)
+
 	// 需要认证的API路由组
 	api := r.Group("/api")
 	api.Use(middleware.JWTAuth())
@@ -51,6 +91,7 @@ func SetupRouter() *gin.Engine {
 		api.GET("/licenses/:id", handler.GetLicense)
 		api.PUT("/licenses/:id", handler.UpdateLicense)
 		api.DELETE("/licenses/:id", handler.DeleteLicense)
+		api.PATCH("/licenses/:id/metadata", handler.PatchLicenseMetadata) // 按JSON Merge Patch修改元数据
 		api.GET("/licenses/stats", handler.GetLicenseStats)
 
 		// 设备管理路由
@@ -58,18 +99,57 @@ func SetupRouter() *gin.Engine {
 		{
 			// 基本设备管理
 			devices.GET("", handler.ListDevices)                     // 获取设备列表
+			devices.GET("/search", handler.SearchDevices)            // 按条件搜索设备（游标分页）
+			devices.GET("/tags", handler.ListDeviceTags)             // 获取所有标签及设备数
+			devices.POST("/import", handler.ImportDevices)           // 批量导入设备（CSV/JSON，支持dry_run）
+			devices.GET("/export", handler.ExportDevices)            // 流式导出设备（CSV/JSON）
+			devices.POST("/bulk", handler.BulkDeviceOperation)       // 批量操作设备（封禁/解封/移动分组/心跳间隔/删除）
+			devices.GET("/bulk", handler.ListBulkOperations)         // 批量操作记录
+			devices.GET("/bulk/:operation_id", handler.GetBulkOperation) // 批量操作进度和设备结果
 			devices.POST("", handler.CreateDevice)                   // 创建设备
 			devices.GET("/:id", handler.GetDevice)                   // 获取设备详情
 			devices.PUT("/:id", handler.UpdateDevice)                // 更新设备
 			devices.DELETE("/:id", handler.DeleteDevice)             // 删除设备
 			devices.GET("/:id/status", handler.GetDeviceStatus)      // 获取设备状态
 			devices.POST("/:id/block", handler.BlockDevice)          // 封禁设备
+			devices.POST("/:id/unblock", handler.UnblockDevice)      // 解封设备
+			devices.GET("/:id/block-history", handler.GetDeviceBlockHistory) // 封禁/解封历史
+			devices.GET("/:id/status-history", handler.GetDeviceStatusHistory) // 状态变更历史
+			devices.GET("/:id/logs", handler.GetDeviceLogs)             // 查询设备日志
+			devices.GET("/:id/activities", handler.GetDeviceActivities) // 查询设备活动
+			devices.POST("/logs/export", handler.ExportDeviceLogs)      // 导出设备日志
 			devices.POST("/:id/heartbeat", handler.UpdateDeviceHeartbeat) // 更新心跳
+			devices.GET("/:id/config", handler.GetDeviceConfig)                 // 获取设备配置
+			devices.PUT("/:id/config", handler.UpdateDeviceConfig)              // 设置设备配置
+			devices.GET("/:id/config/history", handler.GetDeviceConfigHistory)  // 配置变更历史
+			devices.POST("/:id/config/rollback", handler.RollbackDeviceConfig)  // 回滚设备配置
+			devices.GET("/:id/policy", handler.GetDevicePolicy)                 // 获取设备策略
+			devices.PUT("/:id/policy", handler.UpdateDevicePolicy)              // 设置设备策略（覆盖分组策略）
+			devices.DELETE("/:id/policy", handler.DeleteDevicePolicy)           // 删除设备策略
+			devices.GET("/:id/effective-policy", handler.GetEffectiveDevicePolicy) // 设备实际生效的策略
+			devices.GET("/:id/commands", handler.ListDeviceCommands)            // 查询设备远程命令
+			devices.POST("/:id/commands", handler.CreateDeviceCommand)          // 下发远程命令
+			devices.GET("/commands/:command_id", handler.GetDeviceCommand)      // 获取命令详情
+			devices.POST("/commands/:command_id/cancel", handler.CancelDeviceCommand) // 取消命令
 			
 			// 设备分组管理
+			devices.GET("/groups", handler.ListGroups)               // 获取分组列表（tree=true返回分组树）
 			devices.POST("/groups", handler.CreateGroup)             // 创建分组
 			devices.POST("/groups/assign", handler.AssignDevice)     // 分配设备到分组
+			devices.GET("/groups/:id", handler.GetGroup)             // 获取分组详情
+			devices.PUT("/groups/:id", handler.UpdateGroup)          // 更新或移动分组
+			devices.DELETE("/groups/:id", handler.DeleteGroup)       // 删除分组
 			devices.GET("/groups/:id/devices", handler.GetDevicesByGroup) // 获取分组内设备
+			devices.POST("/groups/:id/devices", handler.AssignGroupDevices) // 批量分配设备到分组
+			devices.GET("/groups/:id/policy", handler.GetGroupPolicy)       // 获取分组策略
+			devices.PUT("/groups/:id/policy", handler.UpdateGroupPolicy)    // 设置分组策略
+			devices.DELETE("/groups/:id/policy", handler.DeleteGroupPolicy) // 删除分组策略
+			devices.GET("/groups/:id/config", handler.GetGroupConfig)                 // 获取分组配置
+			devices.PUT("/groups/:id/config", handler.UpdateGroupConfig)              // 设置分组配置
+			devices.GET("/groups/:id/config/history", handler.GetGroupConfigHistory)  // 分组配置变更历史
+			devices.POST("/groups/:id/config/rollback", handler.RollbackGroupConfig)  // 回滚分组配置
+			devices.GET("/groups/:id/commands", handler.ListGroupCommands)            // 查询分组远程命令
+			devices.POST("/groups/:id/commands", handler.CreateGroupCommand)          // 向分组下发远程命令
 
 			// 异常行为记录
 			devices.GET("/:id/abnormal-behaviors", handler.GetDeviceAbnormalBehaviors) // 获取异常行为
@@ -80,7 +160,104 @@ func SetupRouter() *gin.Engine {
 			devices.GET("/:id/usage", handler.GetDeviceUsage)        // 获取使用情况
 			devices.GET("/:id/usage-report", handler.GetDeviceUsageReport) // 获取使用报告
 			devices.GET("/:id/info", handler.GetDeviceInfo)          // 获取详细信息
-			devices.PUT("/:id/metadata", handler.UpdateDeviceMetadata) // 更新元数据
+			devices.PUT("/:id/metadata", handler.UpdateDeviceMetadata) // 替换元数据
+			devices.PATCH("/:id/metadata", handler.PatchDeviceMetadata) // 按JSON Merge Patch修改元数据
+
+			// 设备标签
+			devices.GET("/:id/tags", handler.GetDeviceTags)               // 获取设备标签
+			devices.PUT("/:id/tags", handler.SetDeviceTags)               // 替换设备标签
+			devices.POST("/:id/tags", handler.AddDeviceTags)              // 追加设备标签
+			devices.DELETE("/:id/tags/:tag", handler.RemoveDeviceTag)     // 删除设备标签
+
+			// 重复设备
+			devices.GET("/duplicates", handler.ListDuplicateDevices)                              // 待审核的疑似重复设备
+			devices.POST("/duplicates/detect", handler.DetectDuplicateDevices)                    // 立即检测重复设备
+			devices.POST("/duplicates/:duplicate_id/dismiss", handler.DismissDuplicateDevice)     // 标记为不是重复设备
+			devices.POST("/:id/merge", handler.MergeDevices)                                      // 合并重复设备到该设备
+
+			// 设备凭证管理
+			devices.GET("/:id/credentials", handler.ListDeviceCredentials)                                // 获取凭证列表
+			devices.POST("/:id/credentials", handler.CreateDeviceCredential)                              // 签发密钥或登记证书
+			devices.POST("/:id/credentials/:credential_id/rotate", handler.RotateDeviceCredential)       // 轮换密钥
+			devices.DELETE("/:id/credentials/:credential_id", handler.RevokeDeviceCredential)            // 吊销凭证
+
+			// 设备告警
+			devices.GET("/:id/alerts", handler.GetAlertsByDevice) // 获取设备告警
+		}
+
+		// 告警管理
+		alerts := api.Group("/alerts")
+		{
+			alerts.GET("", handler.ListAlerts)                                   // 获取告警列表
+			alerts.POST("", handler.CreateAlert)                                 // 创建告警
+			alerts.GET("/count", handler.GetAlertCount)                          // 获取告警数量
+			alerts.GET("/timerange", handler.GetAlertsByTimeRange)               // 获取时间范围内的告警
+			alerts.GET("/:id", handler.GetAlert)                                 // 获取告警详情
+			alerts.PUT("/:id/status", handler.UpdateAlertStatus)                 // 更新告警状态
+			alerts.GET("/:id/actions", handler.ListAlertActions)                 // 获取告警动作记录
+			alerts.POST("/:id/actions/:index/revert", handler.RevertAlertAction) // 撤销告警动作
+		}
+
+		// 告警规则管理
+		alertRules := api.Group("/alert-rules")
+		{
+			alertRules.GET("", handler.ListAlertRules)          // 获取规则列表
+			alertRules.POST("", handler.CreateAlertRule)        // 创建规则
+			alertRules.POST("/dry-run", handler.DryRunAlertRule) // 用历史数据试运行规则
+			alertRules.GET("/:id", handler.GetAlertRule)        // 获取规则
+			alertRules.PUT("/:id", handler.UpdateAlertRule)     // 更新规则
+			alertRules.DELETE("/:id", handler.DeleteAlertRule)  // 删除规则
+		}
+
+		// 告警通知渠道
+		channels := api.Group("/notification-channels")
+		{
+			channels.GET("", handler.ListNotificationChannels)              // 获取渠道列表
+			channels.POST("", handler.CreateNotificationChannel)            // 创建渠道
+			channels.GET("/:id", handler.GetNotificationChannel)            // 获取渠道
+			channels.PUT("/:id", handler.UpdateNotificationChannel)         // 更新渠道
+			channels.DELETE("/:id", handler.DeleteNotificationChannel)      // 删除渠道
+			channels.POST("/:id/test", handler.TestNotificationChannel)     // 发送测试通知
+		}
+		api.GET("/notification-deliveries", handler.ListNotificationDeliveries) // 通知发送记录
+
+		// 元数据结构定义
+		schemas := api.Group("/metadata-schemas")
+		{
+			schemas.GET("", handler.ListMetadataSchemas)         // 获取结构定义列表
+			schemas.POST("", handler.CreateMetadataSchema)       // 创建结构定义
+			schemas.GET("/:id", handler.GetMetadataSchema)       // 获取结构定义
+			schemas.PUT("/:id", handler.UpdateMetadataSchema)    // 更新结构定义
+			schemas.DELETE("/:id", handler.DeleteMetadataSchema) // 删除结构定义
+		}
+
+		// 维护窗口管理
+		maintenance := api.Group("/maintenance")
+		{
+			maintenance.GET("", handler.ListMaintenance)                    // 获取维护窗口列表
+			maintenance.POST("", handler.CreateMaintenance)                 // 创建维护窗口
+			maintenance.GET("/calendar", handler.GetMaintenanceCalendar)    // 按天查看维护日历
+			maintenance.GET("/:id", handler.GetMaintenance)                 // 获取维护窗口详情
+			maintenance.PUT("/:id", handler.UpdateMaintenance)              // 更新维护窗口
+			maintenance.DELETE("/:id", handler.CancelMaintenance)           // 取消维护窗口
+			maintenance.POST("/:id/complete", handler.CompleteMaintenance) // 提前结束维护
+		}
+
+		// 使用统计
+		usage := api.Group("/usage")
+		{
+			usage.GET("/groups", handler.GetGroupUsage)          // 分组使用汇总
+			usage.POST("/rebuild", handler.RebuildUsageRollups)  // 重新计算使用汇总
+		}
+
+		// 黑名单规则管理
+		rules := api.Group("/blacklist/rules")
+		{
+			rules.GET("", handler.ListRules)            // 获取规则列表
+			rules.POST("", handler.CreateRule)          // 创建规则
+			rules.PUT("/:id", handler.UpdateRule)       // 更新规则
+			rules.DELETE("/:id", handler.DeleteRule)    // 删除规则
+			rules.POST("/test", handler.TestRuleMatch)  // 测试规则匹配
 		}
 	}
 
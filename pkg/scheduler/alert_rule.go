@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"LVerity/pkg/service"
+	"log"
+	"time"
+)
+
+// StartAlertRuleScheduler 启动告警规则定时评估任务，补充事件触发之外的评估，并每天学习按天统计的异常基线
+func StartAlertRuleScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		// 最近完成按天基线学习的日期，每天只需成功执行一次
+		var learnedDay string
+		for now := range ticker.C {
+			fired, err := service.EvaluateThresholdRules()
+			if err != nil {
+				log.Printf("Error evaluating threshold alert rules: %v", err)
+			}
+			if fired > 0 {
+				log.Printf("Threshold alert rules fired %d alerts", fired)
+			}
+
+			if day := now.Format("2006-01-02"); day != learnedDay {
+				fired, err := service.LearnDailyAnomalyBaselines(now)
+				if err != nil {
+					log.Printf("Error learning daily anomaly baselines: %v", err)
+				} else {
+					learnedDay = day
+				}
+				if fired > 0 {
+					log.Printf("Anomaly alert rules fired %d alerts", fired)
+				}
+			}
+		}
+	}()
+}
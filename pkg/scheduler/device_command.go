@@ -0,0 +1,25 @@
+package scheduler
+
+import (
+	"LVerity/pkg/service"
+	"log"
+	"time"
+)
+
+// StartCommandExpiryScheduler 启动远程命令过期检查任务
+func StartCommandExpiryScheduler() {
+	// 每分钟将超过有效期的命令标记为过期
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		for range ticker.C {
+			expired, err := service.ExpireDeviceCommands()
+			if err != nil {
+				log.Printf("Error expiring device commands: %v", err)
+				continue
+			}
+			if expired > 0 {
+				log.Printf("Expired %d device commands", expired)
+			}
+		}
+	}()
+}
@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"LVerity/pkg/service"
+	"log"
+	"time"
+)
+
+// StartDuplicateDetectionScheduler 启动重复设备检测任务，定期刷新待审核的疑似重复设备
+func StartDuplicateDetectionScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			result, err := service.DetectDuplicateDevices()
+			if err != nil {
+				log.Printf("Error detecting duplicate devices: %v", err)
+				continue
+			}
+			if result.Candidates > 0 {
+				log.Printf("Found %d duplicate device candidates among %d devices", result.Candidates, result.Devices)
+			}
+		}
+	}()
+}
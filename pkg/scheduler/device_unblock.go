@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"LVerity/pkg/service"
+	"log"
+	"time"
+)
+
+// StartUnblockScheduler 启动临时封禁到期自动解封任务
+func StartUnblockScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			released, err := service.ReleaseExpiredBlocks()
+			if err != nil {
+				log.Printf("Error releasing expired device blocks: %v", err)
+				continue
+			}
+			if released > 0 {
+				log.Printf("Released %d expired device blocks", released)
+			}
+		}
+	}()
+}
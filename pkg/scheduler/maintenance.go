@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"LVerity/pkg/service"
+	"log"
+	"time"
+)
+
+// StartMaintenanceScheduler 启动维护窗口任务，按计划开始和结束设备维护
+func StartMaintenanceScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			started, finished, err := service.ProcessMaintenanceWindows()
+			if err != nil {
+				log.Printf("Error processing maintenance windows: %v", err)
+				continue
+			}
+			if started > 0 || finished > 0 {
+				log.Printf("Maintenance windows: %d started, %d finished", started, finished)
+			}
+		}
+	}()
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"LVerity/pkg/service"
+	"log"
+	"time"
+)
+
+// StartNotificationRetryScheduler 启动通知重试任务，按退避时间重新发送失败的通知
+func StartNotificationRetryScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			sent, err := service.RetryNotificationDeliveries()
+			if err != nil {
+				log.Printf("Error retrying notifications: %v", err)
+			}
+			if sent > 0 {
+				log.Printf("Retried %d notifications successfully", sent)
+			}
+		}
+	}()
+}
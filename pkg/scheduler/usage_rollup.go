@@ -0,0 +1,23 @@
+package scheduler
+
+import (
+	"LVerity/pkg/service"
+	"log"
+	"time"
+)
+
+// StartUsageRollupScheduler 启动使用统计任务，定期重新计算当天和本周（以及上一天和上一周）的使用汇总
+func StartUsageRollupScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			if err := service.RefreshUsageRollups(time.Now()); err != nil {
+				log.Printf("Error refreshing usage rollups: %v", err)
+			}
+		}
+	}()
+}
@@ -4,11 +4,44 @@ import (
 	"LVerity/pkg/database"
 	"LVerity/pkg/model"
 	"LVerity/pkg/utils"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// 系统生成的告警标题
+const (
+	AlertTitleDeviceOffline   = "device_offline"   // 设备离线
+	AlertTitleHeartbeatMissed = "heartbeat_missed" // 心跳丢失
 )
 
+var (
+	// ErrAlertSuppressed 告警在维护期间被抑制
+	ErrAlertSuppressed    = errors.New("alert suppressed during maintenance")
+	ErrAlertNotFound      = errors.New("alert not found")
+	ErrInvalidAlertStatus = errors.New("invalid alert status")
+)
+
+// AlertFilter 告警列表的过滤条件，字段为空时不过滤
+type AlertFilter struct {
+	DeviceID  string
+	Status    model.AlertStatus
+	Level     model.AlertLevel
+	RuleID    string // 只返回该告警规则产生的告警
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// maintenanceSuppressedAlerts 设备维护期间不产生的告警
+var maintenanceSuppressedAlerts = map[string]bool{
+	AlertTitleDeviceOffline:   true,
+	AlertTitleHeartbeatMissed: true,
+}
+
 // AlertHandler 告警处理函数类型
 type AlertHandler func(alert *model.Alert) error
 
@@ -57,6 +90,20 @@ func CreateAlert(deviceID string, title string, level model.AlertLevel, descript
 		return nil, fmt.Errorf("failed to get device: %v", err)
 	}
 
+	// 维护期间的离线、心跳告警属于预期情况，不产生告警
+	if maintenanceSuppressedAlerts[title] && IsDeviceInMaintenance(deviceID) {
+		return nil, ErrAlertSuppressed
+	}
+
+	// 分组或设备策略关闭的告警
+	policy, err := GetEffectiveDevicePolicy(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.AlertEnabled(title) {
+		return nil, ErrAlertSuppressed
+	}
+
 	// 创建告警记录
 	alert := &model.Alert{
 		ID:          utils.GenerateUUID(),
@@ -82,6 +129,22 @@ func CreateAlert(deviceID string, title string, level model.AlertLevel, descript
 		return nil, fmt.Errorf("failed to update device alert info: %v", err)
 	}
 
+	DeviceEvents.Publish(DeviceEvent{
+		Type:     DeviceEventAlert,
+		DeviceID: deviceID,
+		GroupID:  device.GroupID,
+		Status:   device.Status,
+		Data: map[string]interface{}{
+			"alert_id": alert.ID,
+			"title":    alert.Title,
+			"level":    alert.Level,
+		},
+	})
+
+	applyAutoBlockPolicy(device, device.RiskLevel)
+	triggerThresholdRules(deviceID, model.AlertMetricAlertCount)
+	notifyAlert(alert, device)
+
 	return alert, nil
 }
 
@@ -89,11 +152,48 @@ func CreateAlert(deviceID string, title string, level model.AlertLevel, descript
 func GetAlert(alertID string) (*model.Alert, error) {
 	var alert model.Alert
 	if err := database.GetDB().Where("id = ?", alertID).First(&alert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAlertNotFound
+		}
 		return nil, fmt.Errorf("failed to get alert: %v", err)
 	}
 	return &alert, nil
 }
 
+// ListAlerts 按条件分页获取告警，按创建时间倒序
+func ListAlerts(filter AlertFilter, page, pageSize int) ([]model.Alert, int64, error) {
+	query := database.GetDB().Model(&model.Alert{})
+	if filter.DeviceID != "" {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Level != "" {
+		query = query.Where("level = ?", filter.Level)
+	}
+	if filter.RuleID != "" {
+		encoded, _ := json.Marshal(filter.RuleID)
+		query = query.Where("metadata LIKE ? ESCAPE '!'", likePattern(`"rule_id":`+string(encoded)))
+	}
+	if filter.StartTime != nil {
+		query = query.Where("created_at >= ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		query = query.Where("created_at <= ?", *filter.EndTime)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count alerts: %v", err)
+	}
+	var alerts []model.Alert
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&alerts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get alerts: %v", err)
+	}
+	return alerts, total, nil
+}
+
 // GetAlerts 获取告警记录
 func GetAlerts(deviceID string, startTime, endTime time.Time) ([]model.Alert, error) {
 	query := database.GetDB().Where("created_at BETWEEN ? AND ?", startTime, endTime)
@@ -128,13 +228,24 @@ func GetAlertsByStatus(status model.AlertStatus) ([]model.Alert, error) {
 
 // UpdateAlertStatus 更新告警状态
 func UpdateAlertStatus(alertID string, status model.AlertStatus) error {
+	switch status {
+	case model.AlertStatusOpen, model.AlertStatusClosed, model.AlertStatusResolved:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidAlertStatus, status)
+	}
 	alert, err := GetAlert(alertID)
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
 	alert.Status = status
-	alert.UpdatedAt = time.Now()
+	alert.UpdatedAt = now
+	if status == model.AlertStatusOpen {
+		alert.ResolvedAt = nil
+	} else if alert.ResolvedAt == nil {
+		alert.ResolvedAt = &now
+	}
 
 	if err := database.GetDB().Save(alert).Error; err != nil {
 		return fmt.Errorf("failed to update alert status: %v", err)
@@ -216,9 +327,9 @@ func GetResolvedAlerts() ([]model.Alert, error) {
 
 // CheckAlertRules 检查告警规则
 func CheckAlertRules(device *model.Device) error {
-	// 获取设备的所有规则
+	// 获取设备的所有启用规则
 	var rules []model.AlertRule
-	if err := database.GetDB().Where("device_id = ? OR device_id = ''", device.ID).Find(&rules).Error; err != nil {
+	if err := database.GetDB().Where("enabled = ? AND (device_id = ? OR device_id = '')", true, device.ID).Find(&rules).Error; err != nil {
 		return fmt.Errorf("failed to get alert rules: %v", err)
 	}
 
@@ -246,21 +357,3 @@ func CheckAlertRules(device *model.Device) error {
 
 	return nil
 }
-
-// 检查阈值规则
-func checkThresholdRule(device *model.Device, rule *model.AlertRule) error {
-	// TODO: 实现阈值规则检查
-	return nil
-}
-
-// 检查模式规则
-func checkPatternRule(device *model.Device, rule *model.AlertRule) error {
-	// TODO: 实现模式规则检查
-	return nil
-}
-
-// 检查异常规则
-func checkAnomalyRule(device *model.Device, rule *model.AlertRule) error {
-	// TODO: 实现异常规则检查
-	return nil
-}
@@ -0,0 +1,606 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlertActionNotFound      = errors.New("alert action not found")
+	ErrAlertActionNotReversible = errors.New("alert action is not reversible")
+	// ErrAlertActionConflict 动作执行后设备状态已被其它操作修改，撤销会覆盖这些修改
+	ErrAlertActionConflict = errors.New("alert action conflicts with later changes")
+)
+
+// finalLicenseStatuses 不会被disable_license动作修改的授权状态
+var finalLicenseStatuses = []model.LicenseStatus{
+	model.LicenseStatusDisabled,
+	model.LicenseStatusRevoked,
+	model.LicenseStatusExpired,
+	model.LicenseStatusTransferred,
+}
+
+func init() {
+	alertActionTypes[model.AlertActionBlock] = alertActionType{
+		validate: validateBlockAction,
+		run:      runBlockAction,
+		revert:   revertBlockAction,
+	}
+	alertActionTypes[model.AlertActionDisableLicense] = alertActionType{
+		validate: validateDisableLicenseAction,
+		run:      runDisableLicenseAction,
+		revert:   revertDisableLicenseAction,
+	}
+	alertActionTypes[model.AlertActionRaiseRisk] = alertActionType{
+		validate: validateRaiseRiskAction,
+		run:      runRaiseRiskAction,
+		revert:   revertRaiseRiskAction,
+	}
+	alertActionTypes[model.AlertActionCommand] = alertActionType{
+		validate: validateCommandAction,
+		run:      runCommandAction,
+		revert:   revertCommandAction,
+	}
+	alertActionTypes[model.AlertActionQuarantine] = alertActionType{
+		validate: validateQuarantineAction,
+		check:    checkQuarantineAction,
+		run:      runQuarantineAction,
+		revert:   revertQuarantineAction,
+	}
+}
+
+// alertActionMu 串行化告警元数据中动作记录的读写
+var alertActionMu sync.Mutex
+
+// revertingAlertActions 正在撤销的动作，键为告警ID/序号，避免同一动作被并发撤销
+var revertingAlertActions sync.Map
+
+// ListAlertActions 获取告警上规则动作的执行记录
+func ListAlertActions(alertID string) ([]model.AlertActionRecord, error) {
+	alert, err := GetAlert(alertID)
+	if err != nil {
+		return nil, err
+	}
+	return alertActionRecords(alert)
+}
+
+// RevertAlertAction 撤销告警上已执行的动作，返回更新后的告警
+//
+// 已撤销的动作直接返回；跳过或失败的动作没有修改设备状态，不能撤销。
+func RevertAlertAction(alertID string, index int, operator string) (*model.Alert, error) {
+	key := fmt.Sprintf("%s/%d", alertID, index)
+	if _, busy := revertingAlertActions.LoadOrStore(key, true); busy {
+		return nil, fmt.Errorf("%w: the action is being reverted", ErrAlertActionConflict)
+	}
+	defer revertingAlertActions.Delete(key)
+
+	alert, err := GetAlert(alertID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := alertActionRecords(alert)
+	if err != nil {
+		return nil, err
+	}
+	record := findAlertActionRecord(records, index)
+	if record == nil {
+		return nil, ErrAlertActionNotFound
+	}
+	if record.Status == model.AlertActionReverted {
+		return alert, nil
+	}
+	actionType, ok := alertActionTypes[record.Type]
+	if record.Status != model.AlertActionApplied || !record.Reversible || !ok || actionType.revert == nil {
+		return nil, fmt.Errorf("%w: action %d (%s) is %s", ErrAlertActionNotReversible, index, record.Type, record.Status)
+	}
+
+	message, err := actionType.revert(alert, record, operator)
+	if err != nil {
+		return nil, err
+	}
+
+	alertActionMu.Lock()
+	defer alertActionMu.Unlock()
+	alert, err = GetAlert(alertID)
+	if err != nil {
+		return nil, err
+	}
+	if records, err = alertActionRecords(alert); err != nil {
+		return nil, err
+	}
+	if record = findAlertActionRecord(records, index); record == nil {
+		return nil, ErrAlertActionNotFound
+	}
+	now := time.Now()
+	record.Status = model.AlertActionReverted
+	record.RevertedAt = &now
+	record.RevertedBy = operator
+	record.RevertMessage = message
+	if err := writeAlertActionRecords(alert, records); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// findAlertActionRecord 按序号查找动作记录
+func findAlertActionRecord(records []model.AlertActionRecord, index int) *model.AlertActionRecord {
+	for i := range records {
+		if records[i].Index == index {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// alertActionRecords 解析告警元数据中的动作记录
+func alertActionRecords(alert *model.Alert) ([]model.AlertActionRecord, error) {
+	if alert.Metadata == "" {
+		return nil, nil
+	}
+	var metadata struct {
+		Actions []model.AlertActionRecord `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(alert.Metadata), &metadata); err != nil {
+		return nil, fmt.Errorf("invalid alert metadata: %v", err)
+	}
+	return metadata.Actions, nil
+}
+
+// saveAlertActionRecords 将规则动作的执行记录写入告警元数据
+func saveAlertActionRecords(alertID string, records []model.AlertActionRecord) error {
+	alertActionMu.Lock()
+	defer alertActionMu.Unlock()
+
+	alert, err := GetAlert(alertID)
+	if err != nil {
+		return err
+	}
+	return writeAlertActionRecords(alert, records)
+}
+
+// writeAlertActionRecords 替换告警元数据的actions字段，保留其它字段，调用方持有alertActionMu
+func writeAlertActionRecords(alert *model.Alert, records []model.AlertActionRecord) error {
+	metadata := map[string]json.RawMessage{}
+	if alert.Metadata != "" {
+		if err := json.Unmarshal([]byte(alert.Metadata), &metadata); err != nil {
+			return fmt.Errorf("invalid alert metadata: %v", err)
+		}
+	}
+	actions, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert actions: %v", err)
+	}
+	metadata["actions"] = actions
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert metadata: %v", err)
+	}
+
+	now := time.Now()
+	if err := database.GetDB().Model(&model.Alert{}).Where("id = ?", alert.ID).
+		Updates(map[string]interface{}{
+			"metadata":   string(data),
+			"updated_at": now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update alert metadata: %v", err)
+	}
+	alert.Metadata = string(data)
+	alert.UpdatedAt = now
+	return nil
+}
+
+// decodeActionState 解析动作记录中保存的原状态
+func decodeActionState(record *model.AlertActionRecord, state interface{}) error {
+	if err := json.Unmarshal(record.State, state); err != nil {
+		return fmt.Errorf("%w: invalid action state: %v", ErrAlertActionNotReversible, err)
+	}
+	return nil
+}
+
+// actionDevice 重新读取动作的目标设备，动作根据设备的当前状态决定是否跳过
+func actionDevice(deviceID string) (*model.Device, error) {
+	device, err := GetDevice(deviceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %v", err)
+	}
+	return device, nil
+}
+
+// blockActionState block动作的原状态
+type blockActionState struct {
+	BlockTime *time.Time `json:"block_time"` // 动作封禁设备的时间，用于判断之后是否被重新封禁
+}
+
+// validateBlockAction 校验block动作
+func validateBlockAction(ruleType model.AlertRuleType, raw json.RawMessage) error {
+	var action model.BlockAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+	if action.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	return nil
+}
+
+// runBlockAction 封禁设备，设备已被封禁时跳过
+func runBlockAction(rule *model.AlertRule, device *model.Device, alert *model.Alert, raw json.RawMessage) (*alertActionOutcome, error) {
+	var action model.BlockAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return nil, err
+	}
+	current, err := actionDevice(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status == model.DeviceStatusBlocked {
+		return &alertActionOutcome{skipped: true, message: "device is already blocked"}, nil
+	}
+
+	reason := action.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("告警规则自动封禁: %s", rule.Name)
+	}
+	blocked, err := BlockDeviceWithOptions(device.ID, BlockOptions{
+		Reason:   reason,
+		Duration: time.Duration(action.Duration) * time.Second,
+		Operator: BlockOperatorAlertRule,
+	})
+	if err != nil {
+		return nil, err
+	}
+	message := "device blocked permanently"
+	if blocked.UnblockTime != nil {
+		message = fmt.Sprintf("device blocked until %s", blocked.UnblockTime.Format(time.RFC3339))
+	}
+	return &alertActionOutcome{message: message, state: blockActionState{BlockTime: blocked.BlockTime}}, nil
+}
+
+// revertBlockAction 解除动作产生的封禁，设备已被解封时直接完成
+func revertBlockAction(alert *model.Alert, record *model.AlertActionRecord, operator string) (string, error) {
+	var state blockActionState
+	if err := decodeActionState(record, &state); err != nil {
+		return "", err
+	}
+	device, err := actionDevice(alert.DeviceID)
+	if err != nil {
+		return "", err
+	}
+	// 在锁定的设备行上检查封禁时间，动作之后重新封禁的设备不解封
+	conflict := false
+	unblocked, err := unblockDeviceIf(device.ID, operator, fmt.Sprintf("撤销告警%s的自动封禁", alert.ID), func(locked *model.Device) bool {
+		conflict = locked.BlockTime == nil || state.BlockTime == nil ||
+			!locked.BlockTime.Truncate(time.Second).Equal(state.BlockTime.Truncate(time.Second))
+		return !conflict
+	})
+	if err != nil {
+		return "", err
+	}
+	if conflict {
+		return "", fmt.Errorf("%w: device was blocked again after the action", ErrAlertActionConflict)
+	}
+	if !unblocked {
+		return "device is no longer blocked", nil
+	}
+	return "device unblocked", nil
+}
+
+// disabledLicense disable_license动作禁用的授权及其原状态
+type disabledLicense struct {
+	ID     string              `json:"id"`
+	Code   string              `json:"code"`
+	Status model.LicenseStatus `json:"status"`
+}
+
+// disableLicenseActionState disable_license动作的原状态
+type disableLicenseActionState struct {
+	Licenses []disabledLicense `json:"licenses"`
+}
+
+// validateDisableLicenseAction 校验disable_license动作，该动作没有参数
+func validateDisableLicenseAction(ruleType model.AlertRuleType, raw json.RawMessage) error {
+	var action model.DisableLicenseAction
+	return json.Unmarshal(raw, &action)
+}
+
+// runDisableLicenseAction 禁用设备绑定的有效授权，没有有效授权时跳过
+func runDisableLicenseAction(rule *model.AlertRule, device *model.Device, alert *model.Alert, raw json.RawMessage) (*alertActionOutcome, error) {
+	var licenses []model.License
+	if err := database.GetDB().
+		Where("device_id = ? AND deleted = ? AND status NOT IN ?", device.ID, false, finalLicenseStatuses).
+		Find(&licenses).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device licenses: %v", err)
+	}
+	if len(licenses) == 0 {
+		return &alertActionOutcome{skipped: true, message: "device has no enabled licenses"}, nil
+	}
+
+	var state disableLicenseActionState
+	for _, license := range licenses {
+		if err := DisableLicense(license.Code); err != nil {
+			if len(state.Licenses) == 0 {
+				return nil, err
+			}
+			// 部分授权已被禁用，记录下来以便撤销
+			return &alertActionOutcome{
+				message: fmt.Sprintf("disabled %d of %d licenses: %v", len(state.Licenses), len(licenses), err),
+				state:   state,
+			}, nil
+		}
+		state.Licenses = append(state.Licenses, disabledLicense{ID: license.ID, Code: license.Code, Status: license.Status})
+	}
+	return &alertActionOutcome{message: fmt.Sprintf("disabled %d licenses", len(state.Licenses)), state: state}, nil
+}
+
+// revertDisableLicenseAction 将仍处于禁用状态的授权恢复为原状态，已被其它操作修改的授权保持不变
+func revertDisableLicenseAction(alert *model.Alert, record *model.AlertActionRecord, operator string) (string, error) {
+	var state disableLicenseActionState
+	if err := decodeActionState(record, &state); err != nil {
+		return "", err
+	}
+
+	var restored int64
+	for _, license := range state.Licenses {
+		res := database.GetDB().Model(&model.License{}).
+			Where("id = ? AND status = ?", license.ID, model.LicenseStatusDisabled).
+			Updates(map[string]interface{}{
+				"status":     license.Status,
+				"updated_at": time.Now(),
+				"updated_by": operator,
+			})
+		if res.Error != nil {
+			return "", fmt.Errorf("failed to restore license %s: %v", license.Code, res.Error)
+		}
+		restored += res.RowsAffected
+	}
+	return fmt.Sprintf("restored %d of %d licenses", restored, len(state.Licenses)), nil
+}
+
+// raiseRiskActionState raise_risk动作的原状态
+type raiseRiskActionState struct {
+	Previous  float64 `json:"previous"`
+	RiskLevel float64 `json:"risk_level"`
+}
+
+// validateRaiseRiskAction 校验raise_risk动作
+func validateRaiseRiskAction(ruleType model.AlertRuleType, raw json.RawMessage) error {
+	var action model.RaiseRiskAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+	if action.RiskLevel <= 0 || action.RiskLevel > 1 {
+		return fmt.Errorf("risk_level must be greater than 0 and at most 1")
+	}
+	return nil
+}
+
+// runRaiseRiskAction 提高设备风险等级，只升不降
+func runRaiseRiskAction(rule *model.AlertRule, device *model.Device, alert *model.Alert, raw json.RawMessage) (*alertActionOutcome, error) {
+	var action model.RaiseRiskAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return nil, err
+	}
+	current, err := actionDevice(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current.RiskLevel >= action.RiskLevel {
+		return &alertActionOutcome{skipped: true, message: fmt.Sprintf("risk level is already %.2f", current.RiskLevel)}, nil
+	}
+	if err := UpdateDeviceRiskLevel(device.ID, action.RiskLevel); err != nil {
+		return nil, fmt.Errorf("failed to update risk level: %v", err)
+	}
+	return &alertActionOutcome{
+		message: fmt.Sprintf("risk level raised from %.2f to %.2f", current.RiskLevel, action.RiskLevel),
+		state:   raiseRiskActionState{Previous: current.RiskLevel, RiskLevel: action.RiskLevel},
+	}, nil
+}
+
+// revertRaiseRiskAction 恢复原风险等级，风险等级已被其它操作修改时冲突
+func revertRaiseRiskAction(alert *model.Alert, record *model.AlertActionRecord, operator string) (string, error) {
+	var state raiseRiskActionState
+	if err := decodeActionState(record, &state); err != nil {
+		return "", err
+	}
+	device, err := actionDevice(alert.DeviceID)
+	if err != nil {
+		return "", err
+	}
+	if math.Abs(device.RiskLevel-state.RiskLevel) > 1e-9 {
+		return "", fmt.Errorf("%w: risk level changed to %.2f after the action", ErrAlertActionConflict, device.RiskLevel)
+	}
+	if err := UpdateDeviceRiskLevel(device.ID, state.Previous); err != nil {
+		return "", fmt.Errorf("failed to update risk level: %v", err)
+	}
+	return fmt.Sprintf("risk level restored to %.2f", state.Previous), nil
+}
+
+// commandActionState command动作的原状态
+type commandActionState struct {
+	CommandID string `json:"command_id"`
+}
+
+// validateCommandAction 校验command动作
+func validateCommandAction(ruleType model.AlertRuleType, raw json.RawMessage) error {
+	var action model.CommandAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+	if !action.Command.IsValid() {
+		return fmt.Errorf("unsupported command %q", action.Command)
+	}
+	if action.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	if len(action.Payload) > 0 && strings.TrimSpace(string(action.Payload)) != "null" {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(action.Payload, &payload); err != nil {
+			return fmt.Errorf("payload must be a JSON object")
+		}
+	}
+	return nil
+}
+
+// runCommandAction 向设备下发远程命令，设备已有同类型未完成的命令时跳过
+func runCommandAction(rule *model.AlertRule, device *model.Device, alert *model.Alert, raw json.RawMessage) (*alertActionOutcome, error) {
+	var action model.CommandAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return nil, err
+	}
+	var pending int64
+	if err := database.GetDB().Model(&model.DeviceCommand{}).
+		Where("device_id = ? AND type = ? AND status IN ?", device.ID, action.Command,
+			[]model.DeviceCommandStatus{model.DeviceCommandPending, model.DeviceCommandDelivered}).
+		Count(&pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to check pending commands: %v", err)
+	}
+	if pending > 0 {
+		return &alertActionOutcome{skipped: true, message: fmt.Sprintf("a %s command is already pending", action.Command)}, nil
+	}
+
+	command, err := EnqueueDeviceCommand(device.ID, DeviceCommandRequest{
+		Type:    action.Command,
+		Payload: action.Payload,
+		TTL:     time.Duration(action.TTL) * time.Second,
+	}, BlockOperatorAlertRule)
+	if err != nil {
+		return nil, err
+	}
+	return &alertActionOutcome{
+		message: fmt.Sprintf("%s command %s queued", command.Type, command.ID),
+		state:   commandActionState{CommandID: command.ID},
+	}, nil
+}
+
+// revertCommandAction 取消未完成的命令，已成功执行的lock命令通过下发unlock命令撤销
+func revertCommandAction(alert *model.Alert, record *model.AlertActionRecord, operator string) (string, error) {
+	var state commandActionState
+	if err := decodeActionState(record, &state); err != nil {
+		return "", err
+	}
+	command, err := GetDeviceCommand(state.CommandID)
+	if err != nil {
+		return "", err
+	}
+	if !command.Status.IsFinal() {
+		if _, err := CancelDeviceCommand(command.ID); err == nil {
+			return "command cancelled", nil
+		} else if !errors.Is(err, ErrCommandFinished) {
+			return "", err
+		}
+		// 取消前命令已完成
+		if command, err = GetDeviceCommand(state.CommandID); err != nil {
+			return "", err
+		}
+	}
+
+	if command.Status != model.DeviceCommandSucceeded {
+		return fmt.Sprintf("command already %s, nothing to revert", command.Status), nil
+	}
+	if command.Type != model.DeviceCommandLock {
+		return "", fmt.Errorf("%w: %s command already succeeded", ErrAlertActionNotReversible, command.Type)
+	}
+	unlock, err := EnqueueDeviceCommand(command.DeviceID, DeviceCommandRequest{Type: model.DeviceCommandUnlock}, operator)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("unlock command %s queued", unlock.ID), nil
+}
+
+// quarantineActionState quarantine动作的原状态
+type quarantineActionState struct {
+	PreviousGroupID string `json:"previous_group_id"`
+	GroupID         string `json:"group_id"`
+}
+
+// validateQuarantineAction 校验quarantine动作
+func validateQuarantineAction(ruleType model.AlertRuleType, raw json.RawMessage) error {
+	var action model.QuarantineAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+	if strings.TrimSpace(action.GroupID) == "" {
+		return fmt.Errorf("group_id is required")
+	}
+	return nil
+}
+
+// checkQuarantineAction 检查隔离分组是否存在
+func checkQuarantineAction(raw json.RawMessage) error {
+	var action model.QuarantineAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+	if _, err := findGroup(strings.TrimSpace(action.GroupID)); err != nil {
+		if errors.Is(err, ErrGroupNotFound) {
+			return fmt.Errorf("%w: quarantine group %s not found", ErrInvalidAlertRule, action.GroupID)
+		}
+		return err
+	}
+	return nil
+}
+
+// runQuarantineAction 将设备移入隔离分组，设备已在该分组时跳过
+func runQuarantineAction(rule *model.AlertRule, device *model.Device, alert *model.Alert, raw json.RawMessage) (*alertActionOutcome, error) {
+	var action model.QuarantineAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return nil, err
+	}
+	groupID := strings.TrimSpace(action.GroupID)
+	current, err := actionDevice(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current.GroupID == groupID {
+		return &alertActionOutcome{skipped: true, message: "device is already in the quarantine group"}, nil
+	}
+	if _, err := AssignDevicesToGroup(groupID, []string{device.ID}); err != nil {
+		return nil, err
+	}
+	return &alertActionOutcome{
+		message: fmt.Sprintf("device moved to group %s", groupID),
+		state:   quarantineActionState{PreviousGroupID: current.GroupID, GroupID: groupID},
+	}, nil
+}
+
+// revertQuarantineAction 将设备移回原分组，原分组已删除时移出隔离分组
+func revertQuarantineAction(alert *model.Alert, record *model.AlertActionRecord, operator string) (string, error) {
+	var state quarantineActionState
+	if err := decodeActionState(record, &state); err != nil {
+		return "", err
+	}
+	device, err := actionDevice(alert.DeviceID)
+	if err != nil {
+		return "", err
+	}
+	if device.GroupID != state.GroupID {
+		return "", fmt.Errorf("%w: device was moved to another group after the action", ErrAlertActionConflict)
+	}
+
+	_, err = AssignDevicesToGroup(state.PreviousGroupID, []string{device.ID})
+	if errors.Is(err, ErrGroupNotFound) {
+		if _, err := AssignDevicesToGroup("", []string{device.ID}); err != nil {
+			return "", err
+		}
+		return "previous group no longer exists, device removed from the quarantine group", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if state.PreviousGroupID == "" {
+		return "device removed from the quarantine group", nil
+	}
+	return fmt.Sprintf("device moved back to group %s", state.PreviousGroupID), nil
+}
@@ -0,0 +1,496 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxBaselineSamples       = 500 // 基线保留的最近样本数
+	defaultAnomalyZScore     = 3
+	defaultAnomalyPercentile = 99
+	defaultAnomalyMinSamples = 20
+	baselinePeriodLayout     = "2006-01-02"
+)
+
+// baselineMu 串行化基线的读取和更新，分组基线会被多台设备同时更新
+var baselineMu sync.Mutex
+
+// ParseAnomalyConditions 解析并校验异常规则的条件，未设置的字段使用默认值
+func ParseAnomalyConditions(conditions string) (*model.AnomalyConditions, error) {
+	var cond model.AnomalyConditions
+	if err := json.Unmarshal([]byte(conditions), &cond); err != nil {
+		return nil, fmt.Errorf("%w: conditions must be a JSON object: %v", ErrInvalidAlertRule, err)
+	}
+	if !cond.Metric.IsValid() {
+		return nil, fmt.Errorf("%w: unsupported metric %q", ErrInvalidAlertRule, cond.Metric)
+	}
+	if cond.Baseline == "" {
+		cond.Baseline = model.BaselineScopeDevice
+	}
+	if !cond.Baseline.IsValid() {
+		return nil, fmt.Errorf("%w: unsupported baseline %q", ErrInvalidAlertRule, cond.Baseline)
+	}
+	if cond.Direction == "" {
+		cond.Direction = model.AnomalyDirectionBoth
+	}
+	switch cond.Direction {
+	case model.AnomalyDirectionHigh, model.AnomalyDirectionLow, model.AnomalyDirectionBoth:
+	default:
+		return nil, fmt.Errorf("%w: unsupported direction %q", ErrInvalidAlertRule, cond.Direction)
+	}
+
+	switch cond.Method {
+	case "", model.AnomalyMethodZScore:
+		cond.Method = model.AnomalyMethodZScore
+		if cond.Threshold == 0 {
+			cond.Threshold = defaultAnomalyZScore
+		}
+		if cond.Threshold < 0 {
+			return nil, fmt.Errorf("%w: threshold must be positive", ErrInvalidAlertRule)
+		}
+	case model.AnomalyMethodPercentile:
+		if cond.Threshold == 0 {
+			cond.Threshold = defaultAnomalyPercentile
+		}
+		if cond.Threshold <= 50 || cond.Threshold >= 100 {
+			return nil, fmt.Errorf("%w: percentile threshold must be between 50 and 100", ErrInvalidAlertRule)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported method %q", ErrInvalidAlertRule, cond.Method)
+	}
+
+	if cond.MinSamples == 0 {
+		cond.MinSamples = defaultAnomalyMinSamples
+	}
+	if cond.MinSamples < 2 || cond.MinSamples > maxBaselineSamples {
+		return nil, fmt.Errorf("%w: min_samples must be between 2 and %d", ErrInvalidAlertRule, maxBaselineSamples)
+	}
+	if cond.Warmup < 0 {
+		return nil, fmt.Errorf("%w: warmup must not be negative", ErrInvalidAlertRule)
+	}
+	if err := validateAlertTrigger(cond.AlertRuleTrigger); err != nil {
+		return nil, err
+	}
+	return &cond, nil
+}
+
+// anomalyRule 已解析条件的异常规则
+type anomalyRule struct {
+	rule *model.AlertRule
+	cond *model.AnomalyConditions
+}
+
+// loadAnomalyRules 获取使用指定指标的全部启用异常规则，条件无效的规则被跳过
+func loadAnomalyRules(metric model.AnomalyMetric) ([]anomalyRule, error) {
+	rules, err := loadEnabledAlertRules(model.AlertRuleTypeAnomaly)
+	if err != nil {
+		return nil, err
+	}
+	var result []anomalyRule
+	for i := range rules {
+		cond, err := ParseAnomalyConditions(rules[i].Conditions)
+		if err != nil || cond.Metric != metric {
+			continue
+		}
+		result = append(result, anomalyRule{rule: &rules[i], cond: cond})
+	}
+	return result, nil
+}
+
+// baselineScopeID 获取设备在指定范围的基线ID，未分组的设备没有分组基线
+func baselineScopeID(device *model.Device, scope model.BaselineScope) string {
+	if scope == model.BaselineScopeGroup {
+		return device.GroupID
+	}
+	return device.ID
+}
+
+// GetAnomalyBaseline 获取指标基线，没有时返回nil
+func GetAnomalyBaseline(metric model.AnomalyMetric, scope model.BaselineScope, scopeID string) (*model.AnomalyBaseline, error) {
+	return getAnomalyBaseline(database.GetDB(), metric, scope, scopeID)
+}
+
+// getAnomalyBaseline 获取指标基线并解析样本，没有时返回nil
+func getAnomalyBaseline(db *gorm.DB, metric model.AnomalyMetric, scope model.BaselineScope, scopeID string) (*model.AnomalyBaseline, error) {
+	var baseline model.AnomalyBaseline
+	err := db.Where("metric = ? AND scope = ? AND scope_id = ?", metric, scope, scopeID).First(&baseline).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anomaly baseline: %v", err)
+	}
+	if baseline.SamplesStr != "" {
+		if err := json.Unmarshal([]byte(baseline.SamplesStr), &baseline.Samples); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal baseline samples: %v", err)
+		}
+	}
+	return &baseline, nil
+}
+
+// learnAnomalyBaseline 将样本加入基线，只保留最近的样本并重新计算均值和标准差
+func learnAnomalyBaseline(tx *gorm.DB, metric model.AnomalyMetric, scope model.BaselineScope, scopeID string, value float64, period string, now time.Time) error {
+	baseline, err := getAnomalyBaseline(tx, metric, scope, scopeID)
+	if err != nil {
+		return err
+	}
+	if baseline == nil {
+		baseline = &model.AnomalyBaseline{
+			ID:        utils.GenerateUUID(),
+			Metric:    metric,
+			Scope:     scope,
+			ScopeID:   scopeID,
+			StartedAt: now,
+		}
+	}
+
+	addBaselineSample(baseline, value)
+	data, err := json.Marshal(baseline.Samples)
+	if err != nil {
+		return fmt.Errorf("failed to marshal baseline samples: %v", err)
+	}
+	baseline.SamplesStr = string(data)
+	if period != "" {
+		baseline.LastPeriod = period
+	}
+	baseline.UpdatedAt = now
+
+	if err := tx.Save(baseline).Error; err != nil {
+		return fmt.Errorf("failed to save anomaly baseline: %v", err)
+	}
+	return nil
+}
+
+// addBaselineSample 将样本加入基线，只保留最近的样本并重新计算均值和标准差
+func addBaselineSample(baseline *model.AnomalyBaseline, value float64) {
+	baseline.Samples = append(baseline.Samples, value)
+	if len(baseline.Samples) > maxBaselineSamples {
+		baseline.Samples = baseline.Samples[len(baseline.Samples)-maxBaselineSamples:]
+	}
+	baseline.Count++
+	baseline.Mean, baseline.StdDev = meanStdDev(baseline.Samples)
+}
+
+// meanStdDev 计算样本的均值和总体标准差
+func meanStdDev(samples []float64) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range samples {
+		sum += v
+	}
+	mean := sum / float64(len(samples))
+	var variance float64
+	for _, v := range samples {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(samples)))
+}
+
+// samplePercentile 按线性插值计算样本的百分位数
+func samplePercentile(samples []float64, p float64) float64 {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// baselineReady 检查基线是否已完成预热
+func baselineReady(baseline *model.AnomalyBaseline, cond *model.AnomalyConditions, now time.Time) bool {
+	return baseline != nil && len(baseline.Samples) >= cond.MinSamples &&
+		now.Sub(baseline.StartedAt) >= time.Duration(cond.Warmup)*time.Second
+}
+
+// detectAnomaly 将数值与基线比较，偏离超过阈值时返回告警元数据
+func detectAnomaly(cond *model.AnomalyConditions, baseline *model.AnomalyBaseline, value float64) (map[string]interface{}, bool) {
+	high := cond.Direction != model.AnomalyDirectionLow
+	low := cond.Direction != model.AnomalyDirectionHigh
+	details := map[string]interface{}{
+		"metric":    cond.Metric,
+		"value":     value,
+		"baseline":  cond.Baseline,
+		"scope_id":  baseline.ScopeID,
+		"method":    cond.Method,
+		"threshold": cond.Threshold,
+		"mean":      baseline.Mean,
+		"std_dev":   baseline.StdDev,
+		"samples":   len(baseline.Samples),
+	}
+
+	if cond.Method == model.AnomalyMethodPercentile {
+		upper := samplePercentile(baseline.Samples, cond.Threshold)
+		lower := samplePercentile(baseline.Samples, 100-cond.Threshold)
+		details["upper"] = upper
+		details["lower"] = lower
+		return details, (high && value > upper) || (low && value < lower)
+	}
+
+	// 基线没有波动时，任何不同的值都视为偏离
+	var z float64
+	switch {
+	case baseline.StdDev > 0:
+		z = (value - baseline.Mean) / baseline.StdDev
+	case value > baseline.Mean:
+		z = math.Inf(1)
+	case value < baseline.Mean:
+		z = math.Inf(-1)
+	}
+	if !math.IsInf(z, 0) {
+		details["z_score"] = z
+	}
+	return details, (high && z >= cond.Threshold) || (low && z <= -cond.Threshold)
+}
+
+// evaluateAnomalyRule 将设备的数值与规则使用的基线比较，偏离时返回创建的告警
+func evaluateAnomalyRule(device *model.Device, ar anomalyRule, value float64, now time.Time) (*model.Alert, error) {
+	scopeID := baselineScopeID(device, ar.cond.Baseline)
+	if scopeID == "" {
+		return nil, nil
+	}
+	baseline, err := GetAnomalyBaseline(ar.cond.Metric, ar.cond.Baseline, scopeID)
+	if err != nil || !baselineReady(baseline, ar.cond, now) {
+		return nil, err
+	}
+	details, anomalous := detectAnomaly(ar.cond, baseline, value)
+	if !anomalous {
+		return nil, nil
+	}
+
+	return fireRuleAlert(ar.rule, device, ar.cond.AlertRuleTrigger, anomalyDescription(ar.cond, baseline, value), details)
+}
+
+// anomalyDescription 生成异常规则告警的描述
+func anomalyDescription(cond *model.AnomalyConditions, baseline *model.AnomalyBaseline, value float64) string {
+	return fmt.Sprintf("%s is %s, outside the %s baseline (mean %s, std dev %s)",
+		cond.Metric, formatMetricValue(value), cond.Baseline,
+		formatMetricValue(math.Round(baseline.Mean*100)/100), formatMetricValue(math.Round(baseline.StdDev*100)/100))
+}
+
+// observeAnomalyMetric 用使用该指标的规则评估设备新的指标值，然后将其加入设备和分组的基线
+//
+// period为按天统计指标的日期，其它指标为空。返回产生的告警数。
+func observeAnomalyMetric(device *model.Device, rules []anomalyRule, metric model.AnomalyMetric, value float64, period string, now time.Time) (int, error) {
+	fired := 0
+	for _, ar := range rules {
+		if ar.rule.DeviceID != "" && ar.rule.DeviceID != device.ID {
+			continue
+		}
+		alert, err := evaluateAnomalyRule(device, ar, value, now)
+		if err != nil {
+			return fired, err
+		}
+		if alert != nil {
+			fired++
+		}
+	}
+
+	baselineMu.Lock()
+	defer baselineMu.Unlock()
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := learnAnomalyBaseline(tx, metric, model.BaselineScopeDevice, device.ID, value, period, now); err != nil {
+			return err
+		}
+		if device.GroupID == "" {
+			return nil
+		}
+		return learnAnomalyBaseline(tx, metric, model.BaselineScopeGroup, device.GroupID, value, period, now)
+	})
+	return fired, err
+}
+
+// triggerAnomalyObservation 在后台评估并学习设备的指标值，只学习被启用的异常规则使用的指标
+func triggerAnomalyObservation(deviceID string, metric model.AnomalyMetric, value float64) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Anomaly rule evaluation for device %s panicked: %v", deviceID, r)
+			}
+		}()
+		if err := observeDeviceAnomalyMetric(deviceID, metric, value); err != nil {
+			log.Printf("Error evaluating anomaly rules for device %s: %v", deviceID, err)
+		}
+	}()
+}
+
+// observeDeviceAnomalyMetric 评估并学习设备的指标值
+func observeDeviceAnomalyMetric(deviceID string, metric model.AnomalyMetric, value float64) error {
+	rules, err := loadAnomalyRules(metric)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %v", err)
+	}
+	_, err = observeAnomalyMetric(device, rules, metric, value, "", time.Now())
+	return err
+}
+
+// LearnDailyAnomalyBaselines 统计前一天按天统计的指标，评估异常规则并学习基线，返回产生的告警数
+//
+// 统计当天有过活动的设备，没有事件的设备样本为0。已学习过该日期的设备会被跳过，可以重复调用。
+func LearnDailyAnomalyBaselines(now time.Time) (int, error) {
+	dayEnd := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dayStart := dayEnd.AddDate(0, 0, -1)
+	period := dayStart.Format(baselinePeriodLayout)
+
+	fired := 0
+	for _, metric := range []model.AnomalyMetric{model.AnomalyMetricActivationCount, model.AnomalyMetricLocationChanges} {
+		rules, err := loadAnomalyRules(metric)
+		if err != nil {
+			return fired, err
+		}
+		if len(rules) == 0 {
+			continue
+		}
+
+		values, err := dailyAnomalyValues(metric, dayStart, dayEnd)
+		if err != nil {
+			return fired, err
+		}
+		learned, err := learnedBaselineDevices(metric, period)
+		if err != nil {
+			return fired, err
+		}
+
+		var devices []model.Device
+		err = database.GetDB().Where("last_seen >= ? OR id IN ?", dayStart, mapKeys(values)).
+			FindInBatches(&devices, 200, func(tx *gorm.DB, batch int) error {
+				for i := range devices {
+					if learned[devices[i].ID] {
+						continue
+					}
+					n, err := observeAnomalyMetric(&devices[i], rules, metric, values[devices[i].ID], period, now)
+					fired += n
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+		if err != nil {
+			return fired, err
+		}
+	}
+	return fired, nil
+}
+
+// dailyAnomalyValues 统计一天内各设备的指标值，只包含有事件的设备
+func dailyAnomalyValues(metric model.AnomalyMetric, from, to time.Time) (map[string]float64, error) {
+	values := make(map[string]float64)
+	db := database.GetDB()
+
+	switch metric {
+	case model.AnomalyMetricActivationCount:
+		var rows []struct {
+			DeviceID string
+			Count    int64
+		}
+		if err := db.Model(&model.LicenseUsage{}).Select("device_id, COUNT(*) AS count").
+			Where("device_id <> '' AND created_at >= ? AND created_at < ?", from, to).
+			Group("device_id").Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to count activations: %v", err)
+		}
+		for _, row := range rows {
+			values[row.DeviceID] = float64(row.Count)
+		}
+
+	case model.AnomalyMetricLocationChanges:
+		var rows []struct {
+			DeviceID string
+			Country  string
+			City     string
+		}
+		if err := db.Model(&model.DeviceLog{}).Select("DISTINCT device_id, country, city").
+			Where("country <> '' AND received_at >= ? AND received_at < ?", from, to).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to count location changes: %v", err)
+		}
+		for _, row := range rows {
+			values[row.DeviceID]++
+		}
+		for id := range values {
+			values[id]--
+		}
+	}
+	return values, nil
+}
+
+// learnedBaselineDevices 获取已学习过该日期的设备
+func learnedBaselineDevices(metric model.AnomalyMetric, period string) (map[string]bool, error) {
+	var ids []string
+	if err := database.GetDB().Model(&model.AnomalyBaseline{}).
+		Where("metric = ? AND scope = ? AND last_period = ?", metric, model.BaselineScopeDevice, period).
+		Pluck("scope_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to get anomaly baselines: %v", err)
+	}
+	learned := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		learned[id] = true
+	}
+	return learned, nil
+}
+
+// mapKeys 返回map的所有键
+func mapKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// currentAnomalyValue 获取设备指标的当前值：距上次心跳的时间、进行中会话的时长或当天截至目前的次数
+func currentAnomalyValue(device *model.Device, metric model.AnomalyMetric, now time.Time) (float64, bool, error) {
+	switch metric {
+	case model.AnomalyMetricHeartbeatInterval:
+		if device.LastHeartbeat == nil {
+			return 0, false, nil
+		}
+		return math.Floor(now.Sub(*device.LastHeartbeat).Seconds()), true, nil
+
+	case model.AnomalyMetricSessionLength:
+		session, err := GetActiveDeviceSession(device.ID)
+		if err != nil || session == nil {
+			return 0, false, err
+		}
+		return float64(session.Duration), true, nil
+	}
+
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	values, err := dailyAnomalyValues(metric, dayStart, now)
+	if err != nil {
+		return 0, false, err
+	}
+	return values[device.ID], true, nil
+}
+
+// checkAnomalyRule 评估异常规则，设备指标的当前值偏离基线时创建告警
+func checkAnomalyRule(device *model.Device, rule *model.AlertRule) error {
+	cond, err := ParseAnomalyConditions(rule.Conditions)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	value, ok, err := currentAnomalyValue(device, cond.Metric, now)
+	if err != nil || !ok {
+		return err
+	}
+	_, err = evaluateAnomalyRule(device, anomalyRule{rule: rule, cond: cond}, value, now)
+	return err
+}
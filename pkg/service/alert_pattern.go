@@ -0,0 +1,330 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxPatternSteps        = 10
+	maxPatternCount        = 1000
+	maxPatternWindow       = 7 * 24 * 3600 // 秒
+	maxPatternEvents       = 1000          // 每次评估每种来源最多加载的事件数
+	maxPatternAlertEvents  = 50            // 告警中附带的最多事件数
+	maxPatternEventMessage = 256           // 告警中附带的事件内容的最大长度
+)
+
+// PatternEvent 模式规则匹配的事件，告警元数据的events字段中保存匹配到的事件
+type PatternEvent struct {
+	Source  model.PatternEventSource `json:"source"`
+	ID      string                   `json:"id"`
+	Type    string                   `json:"type"`
+	Level   string                   `json:"level"`
+	Message string                   `json:"message"`
+	Time    time.Time                `json:"time"`
+	Step    int                      `json:"step"` // 匹配的步骤序号，从0开始
+}
+
+// patternRule 已解析条件并编译正则的模式规则
+type patternRule struct {
+	rule     *model.AlertRule
+	cond     *model.PatternConditions
+	messages []*regexp.Regexp // 与Steps一一对应，未设置message时为nil
+}
+
+// ParsePatternConditions 解析并校验模式规则的条件
+func ParsePatternConditions(conditions string) (*model.PatternConditions, error) {
+	cond, _, err := parsePatternConditions(conditions)
+	return cond, err
+}
+
+// parsePatternConditions 解析条件并编译各步骤的正则表达式
+func parsePatternConditions(conditions string) (*model.PatternConditions, []*regexp.Regexp, error) {
+	var cond model.PatternConditions
+	if err := json.Unmarshal([]byte(conditions), &cond); err != nil {
+		return nil, nil, fmt.Errorf("%w: conditions must be a JSON object: %v", ErrInvalidAlertRule, err)
+	}
+	if cond.Window <= 0 || cond.Window > maxPatternWindow {
+		return nil, nil, fmt.Errorf("%w: window must be between 1 and %d seconds", ErrInvalidAlertRule, maxPatternWindow)
+	}
+	if len(cond.Steps) == 0 || len(cond.Steps) > maxPatternSteps {
+		return nil, nil, fmt.Errorf("%w: between 1 and %d steps are required", ErrInvalidAlertRule, maxPatternSteps)
+	}
+	if err := validateAlertTrigger(cond.AlertRuleTrigger); err != nil {
+		return nil, nil, err
+	}
+
+	messages := make([]*regexp.Regexp, len(cond.Steps))
+	for i := range cond.Steps {
+		step := &cond.Steps[i]
+		if !step.Source.IsValid() {
+			return nil, nil, fmt.Errorf("%w: step %d has unsupported source %q", ErrInvalidAlertRule, i+1, step.Source)
+		}
+		if step.Count == 0 {
+			step.Count = 1
+		}
+		if step.Count < 0 || step.Count > maxPatternCount {
+			return nil, nil, fmt.Errorf("%w: step %d count must be between 1 and %d", ErrInvalidAlertRule, i+1, maxPatternCount)
+		}
+		if step.Message != "" {
+			re, err := regexp.Compile(step.Message)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: step %d message: %v", ErrInvalidAlertRule, i+1, err)
+			}
+			messages[i] = re
+		}
+	}
+	return &cond, messages, nil
+}
+
+// compilePatternRule 解析规则的条件
+func compilePatternRule(rule *model.AlertRule) (*patternRule, error) {
+	cond, messages, err := parsePatternConditions(rule.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	return &patternRule{rule: rule, cond: cond, messages: messages}, nil
+}
+
+// uses 检查规则是否匹配该来源的事件
+func (p *patternRule) uses(source model.PatternEventSource) bool {
+	for _, step := range p.cond.Steps {
+		if step.Source == source {
+			return true
+		}
+	}
+	return false
+}
+
+// stepMatches 检查事件是否满足第i步的条件
+func (p *patternRule) stepMatches(i int, event *PatternEvent) bool {
+	step := p.cond.Steps[i]
+	if step.Source != event.Source {
+		return false
+	}
+	if step.Type != "" && step.Type != event.Type {
+		return false
+	}
+	if step.Level != "" && !strings.EqualFold(step.Level, event.Level) {
+		return false
+	}
+	return p.messages[i] == nil || p.messages[i].MatchString(event.Message)
+}
+
+// match 在按时间排序的事件中查找满足全部步骤且跨度不超过窗口的事件序列，没有匹配时返回nil
+func (p *patternRule) match(events []PatternEvent) []PatternEvent {
+	return p.matchRange(events, p.stepIndexes(events), 0, len(events))
+}
+
+// stepIndexes 返回满足每一步条件的事件序号，每个事件对每一步只判断一次
+func (p *patternRule) stepIndexes(events []PatternEvent) [][]int {
+	indexes := make([][]int, len(p.cond.Steps))
+	for i := range events {
+		for step := range p.cond.Steps {
+			if p.stepMatches(step, &events[i]) {
+				indexes[step] = append(indexes[step], i)
+			}
+		}
+	}
+	return indexes
+}
+
+// matchRange 在events[lo:hi]中匹配模式，indexes为stepIndexes的结果
+//
+// 依次以满足第一步的事件为起点，按顺序贪心匹配各步骤。起点越晚，各步骤完成的位置也越晚，
+// 因此每一步只需维护一个单调前进的位置，整体为线性扫描。
+func (p *patternRule) matchRange(events []PatternEvent, indexes [][]int, lo, hi int) []PatternEvent {
+	window := time.Duration(p.cond.Window) * time.Second
+	steps := p.cond.Steps
+	pos := make([]int, len(steps))  // 每一步下一个可用事件在indexes[step]中的位置
+	from := make([]int, len(steps)) // 当前起点下每一步匹配的第一个事件在indexes[step]中的位置
+	for step := range steps {
+		pos[step] = sort.SearchInts(indexes[step], lo)
+	}
+
+	for first := pos[0]; first < len(indexes[0]) && indexes[0][first] < hi; first++ {
+		pos[0] = first
+		end := -1
+		for step := range steps {
+			list := indexes[step]
+			for pos[step] < len(list) && list[pos[step]] <= end {
+				pos[step]++
+			}
+			last := pos[step] + steps[step].Count - 1
+			if last >= len(list) || list[last] >= hi {
+				// 之后的起点也无法完成这一步
+				return nil
+			}
+			from[step] = pos[step]
+			end = list[last]
+		}
+		if events[end].Time.After(events[indexes[0][first]].Time.Add(window)) {
+			continue
+		}
+
+		var matched []PatternEvent
+		for step := range steps {
+			for _, i := range indexes[step][from[step] : from[step]+steps[step].Count] {
+				event := events[i]
+				event.Step = step
+				matched = append(matched, event)
+			}
+		}
+		return matched
+	}
+	return nil
+}
+
+// loadPatternEvents 加载窗口内、上次告警之后的设备事件，按时间排序
+//
+// 已经产生过告警的事件不再参与匹配，避免同一组事件在告警关闭后再次告警。
+func (p *patternRule) loadPatternEvents(deviceID string, now time.Time) ([]PatternEvent, error) {
+	last, err := lastRuleAlertTime(p.rule.ID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	since := now.Add(-time.Duration(p.cond.Window) * time.Second)
+	return p.queryEvents(deviceID, since, now.Add(maxLogFutureSkew), last, maxPatternEvents)
+}
+
+// queryEvents 查询时间范围内的设备事件，按时间排序，超出limit时保留最近的事件
+//
+// consumed不为空时只返回之后收到的事件。
+func (p *patternRule) queryEvents(deviceID string, from, to time.Time, consumed *time.Time, limit int) ([]PatternEvent, error) {
+	db := database.GetDB()
+	var events []PatternEvent
+	if p.uses(model.PatternEventLog) {
+		query := db.Where("device_id = ? AND timestamp >= ? AND timestamp <= ?", deviceID, from, to)
+		if consumed != nil {
+			query = query.Where("received_at > ?", *consumed)
+		}
+		var logs []model.DeviceLog
+		if err := query.Order("timestamp DESC").Limit(limit).Find(&logs).Error; err != nil {
+			return nil, fmt.Errorf("failed to get device logs: %v", err)
+		}
+		for _, l := range logs {
+			events = append(events, PatternEvent{
+				Source:  model.PatternEventLog,
+				ID:      l.ID,
+				Type:    l.Type,
+				Level:   string(l.Level),
+				Message: l.Message,
+				Time:    l.Timestamp,
+			})
+		}
+	}
+	if p.uses(model.PatternEventBehavior) {
+		query := db.Where("device_id = ? AND created_at >= ? AND created_at <= ?", deviceID, from, to)
+		if consumed != nil {
+			query = query.Where("created_at > ?", *consumed)
+		}
+		var behaviors []model.AbnormalBehavior
+		if err := query.Order("created_at DESC").Limit(limit).Find(&behaviors).Error; err != nil {
+			return nil, fmt.Errorf("failed to get abnormal behaviors: %v", err)
+		}
+		for _, b := range behaviors {
+			events = append(events, PatternEvent{
+				Source:  model.PatternEventBehavior,
+				ID:      b.ID,
+				Type:    b.Type,
+				Level:   b.Level,
+				Message: b.Description,
+				Time:    b.CreatedAt,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events, nil
+}
+
+// evaluate 匹配设备事件，匹配成功时返回创建的告警
+func (p *patternRule) evaluate(device *model.Device, now time.Time) (*model.Alert, error) {
+	events, err := p.loadPatternEvents(device.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	matched := p.match(events)
+	if matched == nil {
+		return nil, nil
+	}
+
+	description, details := p.alertDetails(matched)
+	return fireRuleAlert(p.rule, device, p.cond.AlertRuleTrigger, description, details)
+}
+
+// alertDetails 生成模式规则告警的描述和元数据，附带最近的匹配事件
+func (p *patternRule) alertDetails(matched []PatternEvent) (string, map[string]interface{}) {
+	attached := append([]PatternEvent(nil), matched...)
+	if len(attached) > maxPatternAlertEvents {
+		attached = attached[len(attached)-maxPatternAlertEvents:]
+	}
+	for i := range attached {
+		attached[i].Message = truncateString(attached[i].Message, maxPatternEventMessage)
+	}
+	description := fmt.Sprintf("%d events matched the pattern within %ds", len(matched), p.cond.Window)
+	return description, map[string]interface{}{
+		"window":        p.cond.Window,
+		"matched_count": len(matched),
+		"first_event":   matched[0].Time,
+		"last_event":    matched[len(matched)-1].Time,
+		"events":        attached,
+	}
+}
+
+// checkPatternRule 评估模式规则，设备事件满足模式时创建告警
+func checkPatternRule(device *model.Device, rule *model.AlertRule) error {
+	p, err := compilePatternRule(rule)
+	if err != nil {
+		return err
+	}
+	_, err = p.evaluate(device, time.Now())
+	return err
+}
+
+// triggerPatternRules 设备产生新事件后在后台评估使用该来源的模式规则
+func triggerPatternRules(deviceID string, source model.PatternEventSource) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Pattern rule evaluation for device %s panicked: %v", deviceID, r)
+			}
+		}()
+		if err := evaluateDevicePatternRules(deviceID, source); err != nil {
+			log.Printf("Error evaluating pattern rules for device %s: %v", deviceID, err)
+		}
+	}()
+}
+
+// evaluateDevicePatternRules 评估设备上使用指定来源的模式规则
+func evaluateDevicePatternRules(deviceID string, source model.PatternEventSource) error {
+	rules, err := loadAlertRules(deviceID, model.AlertRuleTypePattern)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %v", err)
+	}
+
+	now := time.Now()
+	for i := range rules {
+		p, err := compilePatternRule(&rules[i])
+		if err != nil || !p.uses(source) {
+			continue
+		}
+		if _, err := p.evaluate(device, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/repository"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAlertRule  = errors.New("invalid alert rule")
+	ErrAlertRuleNotFound = errors.New("alert rule not found")
+)
+
+// alertActionType 告警规则动作类型的实现，raw为单个动作的JSON
+type alertActionType struct {
+	validate func(ruleType model.AlertRuleType, raw json.RawMessage) error // 校验参数
+	check    func(raw json.RawMessage) error                               // 保存规则时检查引用的对象是否存在，可为空
+	run      func(rule *model.AlertRule, device *model.Device, alert *model.Alert, raw json.RawMessage) (*alertActionOutcome, error)
+	revert   func(alert *model.Alert, record *model.AlertActionRecord, operator string) (string, error) // 撤销已执行的动作，为空时动作不可撤销
+}
+
+// alertActionOutcome 动作的执行结果
+type alertActionOutcome struct {
+	skipped bool // 设备已处于目标状态，未做修改
+	message string
+	state   interface{} // 撤销动作所需的原状态
+}
+
+// alertActionTypes 已注册的动作类型，各动作在init中注册
+var alertActionTypes = map[string]alertActionType{}
+
+// alertRules 告警规则仓库
+var alertRules = repository.NewAlertRuleRepository()
+
+// AlertRuleInput 创建或更新告警规则的参数
+type AlertRuleInput struct {
+	Name        string              `json:"name"`
+	Type        model.AlertRuleType `json:"type"`
+	DeviceID    string              `json:"device_id"` // 为空时适用于所有设备
+	Conditions  json.RawMessage     `json:"conditions"`
+	Actions     json.RawMessage     `json:"actions"`
+	Description string              `json:"description"`
+	Enabled     *bool               `json:"enabled"` // 创建时默认启用，更新时为空则保持不变
+}
+
+// apply 将参数写入规则，conditions和actions可以是JSON对象、数组或包含JSON的字符串
+func (in *AlertRuleInput) apply(rule *model.AlertRule) error {
+	conditions, err := rawJSONText(in.Conditions)
+	if err != nil {
+		return fmt.Errorf("%w: conditions: %v", ErrInvalidAlertRule, err)
+	}
+	actions, err := rawJSONText(in.Actions)
+	if err != nil {
+		return fmt.Errorf("%w: actions: %v", ErrInvalidAlertRule, err)
+	}
+	rule.Name = strings.TrimSpace(in.Name)
+	rule.Type = in.Type
+	rule.DeviceID = strings.TrimSpace(in.DeviceID)
+	rule.Conditions = conditions
+	rule.Actions = actions
+	rule.Description = in.Description
+	if in.Enabled != nil {
+		rule.Enabled = *in.Enabled
+	}
+	return nil
+}
+
+// rawJSONText 将请求中的JSON转为紧凑的字符串保存，JSON字符串按其内容处理
+func rawJSONText(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return "", err
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			return "", nil
+		}
+		raw = json.RawMessage(text)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ValidateAlertRule 按规则类型校验规则的条件和动作
+func ValidateAlertRule(rule *model.AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAlertRule)
+	}
+	if len(rule.Name) > 191 {
+		return fmt.Errorf("%w: name must be at most 191 characters", ErrInvalidAlertRule)
+	}
+	if rule.Conditions == "" {
+		return fmt.Errorf("%w: conditions are required", ErrInvalidAlertRule)
+	}
+
+	var err error
+	switch rule.Type {
+	case model.AlertRuleTypeThreshold:
+		_, err = ParseThresholdConditions(rule.Conditions)
+	case model.AlertRuleTypePattern:
+		_, err = ParsePatternConditions(rule.Conditions)
+	case model.AlertRuleTypeAnomaly:
+		_, err = ParseAnomalyConditions(rule.Conditions)
+	default:
+		return fmt.Errorf("%w: unsupported type %q", ErrInvalidAlertRule, rule.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = parseAlertRuleActions(rule.Type, rule.Actions)
+	return err
+}
+
+// alertRuleAction 解析后的单个动作
+type alertRuleAction struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+// parseAlertRuleActions 解析并校验规则的动作，actions为空时没有动作
+func parseAlertRuleActions(ruleType model.AlertRuleType, actions string) ([]alertRuleAction, error) {
+	if actions == "" {
+		return nil, nil
+	}
+	var raws []json.RawMessage
+	if err := json.Unmarshal([]byte(actions), &raws); err != nil {
+		return nil, fmt.Errorf("%w: actions must be a JSON array: %v", ErrInvalidAlertRule, err)
+	}
+
+	result := make([]alertRuleAction, 0, len(raws))
+	for i, raw := range raws {
+		var action model.AlertRuleAction
+		if err := json.Unmarshal(raw, &action); err != nil {
+			return nil, fmt.Errorf("%w: action %d must be a JSON object: %v", ErrInvalidAlertRule, i+1, err)
+		}
+		actionType, ok := alertActionTypes[action.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: action %d has unsupported type %q", ErrInvalidAlertRule, i+1, action.Type)
+		}
+		if err := actionType.validate(ruleType, raw); err != nil {
+			return nil, fmt.Errorf("%w: action %d: %v", ErrInvalidAlertRule, i+1, err)
+		}
+		result = append(result, alertRuleAction{Type: action.Type, Raw: raw})
+	}
+	return result, nil
+}
+
+// CreateAlertRule 校验并创建告警规则
+func CreateAlertRule(input AlertRuleInput) (*model.AlertRule, error) {
+	rule := &model.AlertRule{Enabled: true}
+	if err := input.apply(rule); err != nil {
+		return nil, err
+	}
+	if err := checkAlertRule(rule); err != nil {
+		return nil, err
+	}
+
+	if err := alertRules.Create(rule); err != nil {
+		return nil, fmt.Errorf("failed to create alert rule: %v", err)
+	}
+	// enabled列有默认值，创建时不会写入false
+	if !rule.Enabled {
+		if err := alertRules.Update(rule); err != nil {
+			return nil, fmt.Errorf("failed to create alert rule: %v", err)
+		}
+	}
+	return rule, nil
+}
+
+// UpdateAlertRule 校验并替换告警规则
+func UpdateAlertRule(id string, input AlertRuleInput) (*model.AlertRule, error) {
+	rule, err := GetAlertRule(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.apply(rule); err != nil {
+		return nil, err
+	}
+	if err := checkAlertRule(rule); err != nil {
+		return nil, err
+	}
+
+	if err := alertRules.Update(rule); err != nil {
+		return nil, fmt.Errorf("failed to update alert rule: %v", err)
+	}
+	return rule, nil
+}
+
+// checkAlertRule 校验规则，并检查绑定的设备和动作引用的对象是否存在
+func checkAlertRule(rule *model.AlertRule) error {
+	if err := ValidateAlertRule(rule); err != nil {
+		return err
+	}
+	if rule.DeviceID != "" {
+		if _, err := GetDevice(rule.DeviceID); err != nil {
+			return ErrDeviceNotFound
+		}
+	}
+
+	actions, err := parseAlertRuleActions(rule.Type, rule.Actions)
+	if err != nil {
+		return err
+	}
+	for _, action := range actions {
+		check := alertActionTypes[action.Type].check
+		if check == nil {
+			continue
+		}
+		if err := check(action.Raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAlertRule 删除告警规则，已产生的告警保留
+func DeleteAlertRule(id string) error {
+	if _, err := GetAlertRule(id); err != nil {
+		return err
+	}
+	if err := alertRules.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete alert rule: %v", err)
+	}
+	return nil
+}
+
+// GetAlertRule 获取告警规则
+func GetAlertRule(id string) (*model.AlertRule, error) {
+	rule, err := alertRules.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAlertRuleNotFound
+		}
+		return nil, fmt.Errorf("failed to get alert rule: %v", err)
+	}
+	return rule, nil
+}
+
+// ListAlertRules 分页获取告警规则
+func ListAlertRules(filter repository.AlertRuleFilter, page, pageSize int) ([]model.AlertRule, int64, error) {
+	rules, total, err := alertRules.List(filter, page, pageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list alert rules: %v", err)
+	}
+	return rules, total, nil
+}
+
+// ruleAlertMu 串行化规则告警的去重检查和创建，避免同一规则对同一设备重复告警
+var ruleAlertMu sync.Mutex
+
+// loadAlertRules 获取适用于设备的启用规则，deviceID为空时只返回全局规则
+func loadAlertRules(deviceID string, ruleType model.AlertRuleType) ([]model.AlertRule, error) {
+	var rules []model.AlertRule
+	if err := database.GetDB().
+		Where("enabled = ? AND type = ? AND (device_id = ? OR device_id = '')", true, ruleType, deviceID).
+		Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to get alert rules: %v", err)
+	}
+	return rules, nil
+}
+
+// loadEnabledAlertRules 获取指定类型的全部启用规则
+func loadEnabledAlertRules(ruleType model.AlertRuleType) ([]model.AlertRule, error) {
+	var rules []model.AlertRule
+	if err := database.GetDB().Where("enabled = ? AND type = ?", true, ruleType).Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to get alert rules: %v", err)
+	}
+	return rules, nil
+}
+
+// forEachRuleDevice 对规则适用的每台设备调用fn，全局规则分批遍历所有设备
+func forEachRuleDevice(rule *model.AlertRule, fn func(device *model.Device) error) error {
+	if rule.DeviceID != "" {
+		device, err := GetDevice(rule.DeviceID)
+		if err != nil {
+			// 规则绑定的设备已删除
+			return nil
+		}
+		return fn(device)
+	}
+
+	var devices []model.Device
+	return database.GetDB().Model(&model.Device{}).FindInBatches(&devices, 200, func(tx *gorm.DB, batch int) error {
+		for i := range devices {
+			if err := fn(&devices[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// fireRuleAlert 为规则创建告警并执行规则的动作，元数据中记录规则ID和details
+//
+// 规则在该设备上已有未关闭的告警，或距上次告警未超过冷却时间时不重复告警，返回nil。
+func fireRuleAlert(rule *model.AlertRule, device *model.Device, trigger model.AlertRuleTrigger, description string, details map[string]interface{}) (*model.Alert, error) {
+	alert, err := createRuleAlert(rule, device, trigger, description, details)
+	if err != nil || alert == nil {
+		return nil, err
+	}
+	runAlertRuleActions(rule, device, alert)
+	return alert, nil
+}
+
+// createRuleAlert 去重后创建规则告警
+func createRuleAlert(rule *model.AlertRule, device *model.Device, trigger model.AlertRuleTrigger, description string, details map[string]interface{}) (*model.Alert, error) {
+	ruleAlertMu.Lock()
+	defer ruleAlertMu.Unlock()
+
+	active, err := ruleAlertActive(rule.ID, device.ID, time.Duration(trigger.Cooldown)*time.Second)
+	if err != nil || active {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{
+		"rule_id":   rule.ID,
+		"rule_name": rule.Name,
+		"rule_type": rule.Type,
+	}
+	for key, value := range details {
+		metadata[key] = value
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal alert metadata: %v", err)
+	}
+
+	alert, err := CreateAlert(device.ID, rule.Name, alertTriggerLevel(trigger), description, string(data))
+	if errors.Is(err, ErrAlertSuppressed) {
+		return nil, nil
+	}
+	return alert, err
+}
+
+// runAlertRuleActions 按顺序执行规则的动作并将执行记录写入告警元数据，单个动作失败不影响告警和其它动作
+func runAlertRuleActions(rule *model.AlertRule, device *model.Device, alert *model.Alert) {
+	actions, err := parseAlertRuleActions(rule.Type, rule.Actions)
+	if err != nil {
+		log.Printf("Skipping actions of alert rule %s: %v", rule.ID, err)
+		return
+	}
+	if len(actions) == 0 {
+		return
+	}
+
+	records := make([]model.AlertActionRecord, 0, len(actions))
+	for i, action := range actions {
+		actionType := alertActionTypes[action.Type]
+		record := model.AlertActionRecord{Index: i, Type: action.Type, AppliedAt: time.Now()}
+		outcome, err := actionType.run(rule, device, alert, action.Raw)
+		if err != nil {
+			log.Printf("Error running action %d (%s) of alert rule %s for alert %s: %v", i+1, action.Type, rule.ID, alert.ID, err)
+			record.Status = model.AlertActionFailed
+			record.Message = err.Error()
+			records = append(records, record)
+			continue
+		}
+		if outcome == nil {
+			outcome = &alertActionOutcome{}
+		}
+		record.Message = outcome.message
+		if outcome.skipped {
+			record.Status = model.AlertActionSkipped
+		} else {
+			record.Status = model.AlertActionApplied
+			record.Reversible = actionType.revert != nil
+		}
+		if outcome.state != nil {
+			state, err := json.Marshal(outcome.state)
+			if err != nil {
+				log.Printf("Error encoding state of action %d (%s) for alert %s: %v", i+1, action.Type, alert.ID, err)
+				record.Reversible = false
+			}
+			record.State = state
+		}
+		records = append(records, record)
+	}
+
+	if err := saveAlertActionRecords(alert.ID, records); err != nil {
+		log.Printf("Error saving action records for alert %s: %v", alert.ID, err)
+	}
+}
+
+// alertTriggerLevel 规则告警的级别，默认warning
+func alertTriggerLevel(trigger model.AlertRuleTrigger) model.AlertLevel {
+	if trigger.Level == "" {
+		return model.AlertLevelWarning
+	}
+	return trigger.Level
+}
+
+// ruleAlertQuery 查询规则在设备上产生的告警
+func ruleAlertQuery(ruleID, deviceID string) *gorm.DB {
+	encoded, _ := json.Marshal(ruleID)
+	return database.GetDB().Model(&model.Alert{}).
+		Where("device_id = ? AND metadata LIKE ? ESCAPE '!'", deviceID, likePattern(`"rule_id":`+string(encoded)))
+}
+
+// ruleAlertActive 检查规则在设备上是否有未关闭的告警，或在冷却时间内产生过告警
+func ruleAlertActive(ruleID, deviceID string, cooldown time.Duration) (bool, error) {
+	query := ruleAlertQuery(ruleID, deviceID)
+	if cooldown > 0 {
+		query = query.Where("status = ? OR created_at >= ?", model.AlertStatusOpen, time.Now().Add(-cooldown))
+	} else {
+		query = query.Where("status = ?", model.AlertStatusOpen)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check rule alerts: %v", err)
+	}
+	return count > 0, nil
+}
+
+// lastRuleAlertTime 获取规则在设备上最近一次告警的时间，没有告警时返回nil
+func lastRuleAlertTime(ruleID, deviceID string) (*time.Time, error) {
+	var alerts []model.Alert
+	if err := ruleAlertQuery(ruleID, deviceID).Select("created_at").
+		Order("created_at DESC").Limit(1).Find(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get rule alerts: %v", err)
+	}
+	if len(alerts) == 0 {
+		return nil, nil
+	}
+	return &alerts[0].CreatedAt, nil
+}
+
+// validateAlertTrigger 校验告警级别和冷却时间
+func validateAlertTrigger(trigger model.AlertRuleTrigger) error {
+	if trigger.Level != "" && !trigger.Level.IsValid() {
+		return fmt.Errorf("%w: unsupported level %q", ErrInvalidAlertRule, trigger.Level)
+	}
+	if trigger.Cooldown < 0 {
+		return fmt.Errorf("%w: cooldown must not be negative", ErrInvalidAlertRule)
+	}
+	return nil
+}
@@ -0,0 +1,525 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	defaultDryRunRange    = 24 * time.Hour
+	maxDryRunRange        = 31 * 24 * time.Hour
+	defaultDryRunStep     = 5 * time.Minute
+	minDryRunStep         = time.Minute
+	maxDryRunPoints       = 10000  // 阈值规则每台设备的最多评估次数
+	maxDryRunDevices      = 1000   // 最多评估的设备数
+	maxDryRunEvents       = 20000  // 每台设备最多加载的事件数
+	maxDryRunSamples      = 100000 // 异常规则最多回放的样本数
+	maxDryRunAlerts       = 1000   // 结果中最多返回的告警数
+	anomalyDryRunLookback = 30 * 24 * time.Hour
+)
+
+// ErrInvalidDryRun 规则试运行的参数无效
+var ErrInvalidDryRun = errors.New("invalid dry run")
+
+// AlertRuleDryRunRequest 规则试运行参数，rule_id和rule二选一
+type AlertRuleDryRunRequest struct {
+	RuleID    string          `json:"rule_id"`    // 已保存的规则
+	Rule      *AlertRuleInput `json:"rule"`       // 未保存的规则
+	DeviceIDs []string        `json:"device_ids"` // 为空时使用规则绑定的设备或所有设备
+	From      *time.Time      `json:"from"`       // 默认to之前24小时
+	To        *time.Time      `json:"to"`         // 默认当前时间
+	Step      int             `json:"step"`       // 阈值规则的评估间隔（秒），默认300
+}
+
+// AlertRuleDryRunAlert 试运行中规则会产生的告警
+type AlertRuleDryRunAlert struct {
+	DeviceID    string                 `json:"device_id"`
+	Time        time.Time              `json:"time"`
+	Level       model.AlertLevel       `json:"level"`
+	Description string                 `json:"description"`
+	Details     map[string]interface{} `json:"details"`
+}
+
+// AlertRuleDryRunResult 规则试运行结果
+type AlertRuleDryRunResult struct {
+	Rule         *model.AlertRule       `json:"rule"`
+	From         time.Time              `json:"from"`
+	To           time.Time              `json:"to"`
+	Devices      int                    `json:"devices"`       // 评估的设备数
+	Fired        int                    `json:"fired"`         // 会产生的告警数
+	FiredDevices int                    `json:"fired_devices"` // 会产生告警的设备数
+	Alerts       []AlertRuleDryRunAlert `json:"alerts"`
+	Truncated    bool                   `json:"truncated"` // 告警超过上限时只返回最早的部分
+	Notes        []string               `json:"notes,omitempty"`
+}
+
+// dryRunRecorder 记录试运行产生的告警，按规则的冷却时间去重
+type dryRunRecorder struct {
+	result   *AlertRuleDryRunResult
+	level    model.AlertLevel
+	cooldown time.Duration
+	last     map[string]time.Time
+}
+
+// fire 记录一次告警，距该设备上次告警未超过冷却时间时返回false
+func (r *dryRunRecorder) fire(deviceID string, at time.Time, description string, details map[string]interface{}) bool {
+	if last, ok := r.last[deviceID]; ok && r.cooldown > 0 && at.Sub(last) < r.cooldown {
+		return false
+	}
+	if _, ok := r.last[deviceID]; !ok {
+		r.result.FiredDevices++
+	}
+	r.last[deviceID] = at
+	r.result.Fired++
+	if len(r.result.Alerts) >= maxDryRunAlerts {
+		r.result.Truncated = true
+		return true
+	}
+	r.result.Alerts = append(r.result.Alerts, AlertRuleDryRunAlert{
+		DeviceID:    deviceID,
+		Time:        at,
+		Level:       r.level,
+		Description: description,
+		Details:     details,
+	})
+	return true
+}
+
+// DryRunAlertRule 用历史数据评估规则，报告规则会产生的告警，不创建告警也不执行动作
+//
+// 试运行假设告警产生后立即被处理，同一设备的告警只受冷却时间限制。
+func DryRunAlertRule(req AlertRuleDryRunRequest) (*AlertRuleDryRunResult, error) {
+	rule, err := dryRunRule(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	to := now
+	if req.To != nil && req.To.Before(now) {
+		to = *req.To
+	}
+	from := to.Add(-defaultDryRunRange)
+	if req.From != nil {
+		from = *req.From
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidDryRun)
+	}
+	if to.Sub(from) > maxDryRunRange {
+		return nil, fmt.Errorf("%w: range must be at most %d days", ErrInvalidDryRun, int(maxDryRunRange.Hours()/24))
+	}
+
+	result := &AlertRuleDryRunResult{Rule: rule, From: from, To: to, Alerts: []AlertRuleDryRunAlert{}}
+	devices, err := dryRunDevices(rule, req.DeviceIDs, result)
+	if err != nil {
+		return nil, err
+	}
+	result.Devices = len(devices)
+
+	switch rule.Type {
+	case model.AlertRuleTypeThreshold:
+		cond, err := ParseThresholdConditions(rule.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		step := defaultDryRunStep
+		if req.Step != 0 {
+			step = time.Duration(req.Step) * time.Second
+		}
+		if step < minDryRunStep {
+			return nil, fmt.Errorf("%w: step must be at least %d seconds", ErrInvalidDryRun, int(minDryRunStep.Seconds()))
+		}
+		if int(to.Sub(from)/step) >= maxDryRunPoints {
+			return nil, fmt.Errorf("%w: range and step give more than %d evaluations per device", ErrInvalidDryRun, maxDryRunPoints)
+		}
+		err = dryRunThresholdRule(rule, cond, devices, from, to, step, newDryRunRecorder(result, cond.AlertRuleTrigger))
+		if err != nil {
+			return nil, err
+		}
+
+	case model.AlertRuleTypePattern:
+		p, err := compilePatternRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		if err := dryRunPatternRule(p, devices, from, to, newDryRunRecorder(result, p.cond.AlertRuleTrigger)); err != nil {
+			return nil, err
+		}
+
+	case model.AlertRuleTypeAnomaly:
+		cond, err := ParseAnomalyConditions(rule.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		if err := dryRunAnomalyRule(cond, devices, from, to, newDryRunRecorder(result, cond.AlertRuleTrigger)); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(result.Alerts, func(i, j int) bool {
+		return result.Alerts[i].Time.Before(result.Alerts[j].Time)
+	})
+	return result, nil
+}
+
+// newDryRunRecorder 创建试运行告警记录器
+func newDryRunRecorder(result *AlertRuleDryRunResult, trigger model.AlertRuleTrigger) *dryRunRecorder {
+	return &dryRunRecorder{
+		result:   result,
+		level:    alertTriggerLevel(trigger),
+		cooldown: time.Duration(trigger.Cooldown) * time.Second,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// dryRunRule 获取已保存的规则，或校验未保存的规则
+func dryRunRule(req AlertRuleDryRunRequest) (*model.AlertRule, error) {
+	if (req.RuleID == "") == (req.Rule == nil) {
+		return nil, fmt.Errorf("%w: exactly one of rule_id and rule is required", ErrInvalidDryRun)
+	}
+	if req.RuleID != "" {
+		return GetAlertRule(req.RuleID)
+	}
+
+	rule := &model.AlertRule{Enabled: true}
+	if err := req.Rule.apply(rule); err != nil {
+		return nil, err
+	}
+	if err := checkAlertRule(rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// dryRunDevices 获取试运行评估的设备，全局规则最多评估maxDryRunDevices台设备
+func dryRunDevices(rule *model.AlertRule, deviceIDs []string, result *AlertRuleDryRunResult) ([]model.Device, error) {
+	query := database.GetDB().Model(&model.Device{})
+	switch {
+	case rule.DeviceID != "":
+		query = query.Where("id = ?", rule.DeviceID)
+	case len(deviceIDs) > maxDryRunDevices:
+		return nil, fmt.Errorf("%w: at most %d devices are allowed", ErrInvalidDryRun, maxDryRunDevices)
+	case len(deviceIDs) > 0:
+		query = query.Where("id IN ?", deviceIDs)
+	}
+
+	var devices []model.Device
+	if err := query.Order("id ASC").Limit(maxDryRunDevices + 1).Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to get devices: %v", err)
+	}
+	if len(devices) > maxDryRunDevices {
+		devices = devices[:maxDryRunDevices]
+		result.Notes = append(result.Notes, fmt.Sprintf("only the first %d devices were evaluated; pass device_ids to choose others", maxDryRunDevices))
+	}
+	return devices, nil
+}
+
+// dryRunThresholdRule 在时间范围内按step评估阈值规则，条件开始满足时告警，持续满足时按冷却时间重复告警
+//
+// risk_level和license_usage_percent没有历史记录，只在to时刻用当前值评估一次。
+func dryRunThresholdRule(rule *model.AlertRule, cond *model.ThresholdConditions, devices []model.Device, from, to time.Time, step time.Duration, recorder *dryRunRecorder) error {
+	if cond.Metric == model.AlertMetricRiskLevel || cond.Metric == model.AlertMetricLicenseUsagePercent {
+		recorder.result.Notes = append(recorder.result.Notes,
+			fmt.Sprintf("%s has no history; the current value was evaluated once", cond.Metric))
+		for i := range devices {
+			value, ok, err := thresholdMetricValue(&devices[i], rule, cond, to)
+			if err != nil {
+				return err
+			}
+			if ok && thresholdOperators[cond.Operator](value, cond.Value) {
+				description, details := thresholdAlertDetails(cond, value)
+				recorder.fire(devices[i].ID, to, description, details)
+			}
+		}
+		return nil
+	}
+
+	for i := range devices {
+		value, err := thresholdHistory(rule, cond, devices[i].ID, from, to)
+		if err != nil {
+			return err
+		}
+		active := false
+		var last time.Time
+		for at := from; !at.After(to); at = at.Add(step) {
+			v, ok := value(at)
+			if !ok || !thresholdOperators[cond.Operator](v, cond.Value) {
+				active = false
+				continue
+			}
+			if active && (recorder.cooldown <= 0 || at.Sub(last) < recorder.cooldown) {
+				continue
+			}
+			description, details := thresholdAlertDetails(cond, v)
+			if recorder.fire(devices[i].ID, at, description, details) {
+				last = at
+			}
+			active = true
+		}
+	}
+	return nil
+}
+
+// thresholdHistory 加载设备的历史数据，返回计算任意时刻指标值的函数
+func thresholdHistory(rule *model.AlertRule, cond *model.ThresholdConditions, deviceID string, from, to time.Time) (func(at time.Time) (float64, bool), error) {
+	db := database.GetDB()
+	window := time.Duration(cond.Window) * time.Second
+
+	switch cond.Metric {
+	case model.AlertMetricHeartbeatGap:
+		// 会话内视为心跳正常，会话结束后的间隔为距会话最后一次心跳的时间
+		var sessions []model.UsageRecord
+		if err := db.Where("device_id = ? AND start_time <= ? AND end_time >= ?", deviceID, to, from).
+			Order("start_time ASC").Limit(maxDryRunEvents).Find(&sessions).Error; err != nil {
+			return nil, fmt.Errorf("failed to get device sessions: %v", err)
+		}
+		var previous []model.UsageRecord
+		if err := db.Where("device_id = ? AND end_time < ?", deviceID, from).
+			Order("end_time DESC").Limit(1).Find(&previous).Error; err != nil {
+			return nil, fmt.Errorf("failed to get device sessions: %v", err)
+		}
+		sessions = append(previous, sessions...)
+		return func(at time.Time) (float64, bool) {
+			var lastHeartbeat *time.Time
+			for i := range sessions {
+				if sessions[i].StartTime.After(at) {
+					break
+				}
+				end := sessions[i].EndTime
+				if end.After(at) {
+					end = at
+				}
+				if lastHeartbeat == nil || end.After(*lastHeartbeat) {
+					lastHeartbeat = &end
+				}
+			}
+			if lastHeartbeat == nil {
+				return 0, false
+			}
+			return at.Sub(*lastHeartbeat).Truncate(time.Second).Seconds(), true
+		}, nil
+
+	case model.AlertMetricAbnormalBehaviorCount:
+		if window <= 0 {
+			window = defaultBehaviorWindow
+		}
+		query := db.Model(&model.AbnormalBehavior{}).
+			Where("device_id = ? AND created_at >= ? AND created_at <= ?", deviceID, from.Add(-window), to)
+		if cond.BehaviorType != "" {
+			query = query.Where("type = ?", cond.BehaviorType)
+		}
+		var times []time.Time
+		if err := query.Order("created_at ASC").Limit(maxDryRunEvents).Pluck("created_at", &times).Error; err != nil {
+			return nil, fmt.Errorf("failed to get abnormal behaviors: %v", err)
+		}
+		return func(at time.Time) (float64, bool) {
+			return float64(countTimesBetween(times, at.Add(-window), at)), true
+		}, nil
+
+	case model.AlertMetricAlertCount:
+		query := db.Where("device_id = ? AND created_at <= ?", deviceID, to)
+		if rule.ID != "" {
+			encoded, _ := json.Marshal(rule.ID)
+			query = query.Where("metadata IS NULL OR metadata NOT LIKE ? ESCAPE '!'", likePattern(`"rule_id":`+string(encoded)))
+		}
+		if window > 0 {
+			query = query.Where("created_at >= ?", from.Add(-window))
+		} else {
+			query = query.Where("resolved_at IS NULL OR resolved_at > ?", from)
+		}
+		var alerts []model.Alert
+		if err := query.Select("created_at", "resolved_at").Order("created_at ASC").
+			Limit(maxDryRunEvents).Find(&alerts).Error; err != nil {
+			return nil, fmt.Errorf("failed to get alerts: %v", err)
+		}
+		return func(at time.Time) (float64, bool) {
+			count := 0
+			for _, alert := range alerts {
+				if alert.CreatedAt.After(at) {
+					break
+				}
+				if window > 0 {
+					if !alert.CreatedAt.Before(at.Add(-window)) {
+						count++
+					}
+				} else if alert.ResolvedAt == nil || alert.ResolvedAt.After(at) {
+					count++
+				}
+			}
+			return float64(count), true
+		}, nil
+	}
+	return func(time.Time) (float64, bool) { return 0, false }, nil
+}
+
+// countTimesBetween 统计有序时间列表中位于[from, to]的个数
+func countTimesBetween(times []time.Time, from, to time.Time) int {
+	lo := sort.Search(len(times), func(i int) bool { return !times[i].Before(from) })
+	hi := sort.Search(len(times), func(i int) bool { return times[i].After(to) })
+	return hi - lo
+}
+
+// dryRunPatternRule 按时间顺序回放设备事件，模拟事件到达时的增量匹配
+func dryRunPatternRule(p *patternRule, devices []model.Device, from, to time.Time, recorder *dryRunRecorder) error {
+	window := time.Duration(p.cond.Window) * time.Second
+	last := len(p.cond.Steps) - 1
+	for i := range devices {
+		events, err := p.queryEvents(devices[i].ID, from.Add(-window), to, nil, maxDryRunEvents)
+		if err != nil {
+			return err
+		}
+
+		// 只有满足最后一步的事件到达时才可能完成匹配
+		indexes := p.stepIndexes(events)
+		var consumed *time.Time
+		lo := 0
+		for _, k := range indexes[last] {
+			at := events[k].Time
+			if at.Before(from) {
+				continue
+			}
+			for lo < k && (events[lo].Time.Before(at.Add(-window)) || (consumed != nil && !events[lo].Time.After(*consumed))) {
+				lo++
+			}
+			matched := p.matchRange(events, indexes, lo, k+1)
+			if matched == nil {
+				continue
+			}
+			description, details := p.alertDetails(matched)
+			if recorder.fire(devices[i].ID, at, description, details) {
+				consumed = &events[k].Time
+			}
+		}
+	}
+	return nil
+}
+
+// anomalySample 异常规则回放的一个样本
+type anomalySample struct {
+	DeviceID string
+	GroupID  string
+	Time     time.Time
+	Value    float64
+}
+
+// dryRunAnomalyRule 从范围开始前30天起按时间顺序回放指标值，在内存中学习基线并评估范围内的值
+//
+// 单次心跳没有保存，heartbeat_interval不能试运行。
+func dryRunAnomalyRule(cond *model.AnomalyConditions, devices []model.Device, from, to time.Time, recorder *dryRunRecorder) error {
+	if cond.Metric == model.AnomalyMetricHeartbeatInterval {
+		return fmt.Errorf("%w: heartbeat_interval cannot be replayed because individual heartbeats are not stored", ErrInvalidDryRun)
+	}
+
+	targets := make(map[string]bool, len(devices))
+	scope := devices
+	groupIDs := make(map[string]bool)
+	for _, device := range devices {
+		targets[device.ID] = true
+		if device.GroupID != "" {
+			groupIDs[device.GroupID] = true
+		}
+	}
+	// 分组基线需要分组内所有设备的样本
+	if cond.Baseline == model.BaselineScopeGroup && len(groupIDs) > 0 {
+		ids := make([]string, 0, len(groupIDs))
+		for id := range groupIDs {
+			ids = append(ids, id)
+		}
+		scope = nil
+		if err := database.GetDB().Where("group_id IN ?", ids).Find(&scope).Error; err != nil {
+			return fmt.Errorf("failed to get group devices: %v", err)
+		}
+	}
+
+	samples, err := anomalyHistory(cond.Metric, scope, from.Add(-anomalyDryRunLookback), to)
+	if err != nil {
+		return err
+	}
+
+	baselines := make(map[string]*model.AnomalyBaseline)
+	for _, sample := range samples {
+		scopeID := sample.DeviceID
+		if cond.Baseline == model.BaselineScopeGroup {
+			scopeID = sample.GroupID
+		}
+		if scopeID == "" {
+			continue
+		}
+		baseline := baselines[scopeID]
+		if baseline == nil {
+			baseline = &model.AnomalyBaseline{Metric: cond.Metric, Scope: cond.Baseline, ScopeID: scopeID, StartedAt: sample.Time}
+			baselines[scopeID] = baseline
+		}
+
+		if targets[sample.DeviceID] && !sample.Time.Before(from) && baselineReady(baseline, cond, sample.Time) {
+			if details, anomalous := detectAnomaly(cond, baseline, sample.Value); anomalous {
+				recorder.fire(sample.DeviceID, sample.Time, anomalyDescription(cond, baseline, sample.Value), details)
+			}
+		}
+		addBaselineSample(baseline, sample.Value)
+	}
+	return nil
+}
+
+// anomalyHistory 加载设备在时间范围内的历史指标值，按时间排序
+func anomalyHistory(metric model.AnomalyMetric, devices []model.Device, from, to time.Time) ([]anomalySample, error) {
+	if len(devices) == 0 {
+		return nil, nil
+	}
+	groups := make(map[string]string, len(devices))
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		groups[device.ID] = device.GroupID
+		ids = append(ids, device.ID)
+	}
+
+	var samples []anomalySample
+	switch metric {
+	case model.AnomalyMetricSessionLength:
+		var sessions []model.UsageRecord
+		if err := database.GetDB().Where("device_id IN ? AND active = ? AND end_time >= ? AND end_time <= ?", ids, false, from, to).
+			Order("end_time ASC").Limit(maxDryRunSamples).Find(&sessions).Error; err != nil {
+			return nil, fmt.Errorf("failed to get device sessions: %v", err)
+		}
+		for _, session := range sessions {
+			samples = append(samples, anomalySample{
+				DeviceID: session.DeviceID,
+				GroupID:  groups[session.DeviceID],
+				Time:     session.EndTime,
+				Value:    float64(session.Duration),
+			})
+		}
+
+	case model.AnomalyMetricActivationCount, model.AnomalyMetricLocationChanges:
+		// 每天结束时产生一个样本，设备创建之前的日期不计入
+		day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+		for ; !day.AddDate(0, 0, 1).After(to); day = day.AddDate(0, 0, 1) {
+			end := day.AddDate(0, 0, 1)
+			values, err := dailyAnomalyValues(metric, day, end)
+			if err != nil {
+				return nil, err
+			}
+			for _, device := range devices {
+				if !device.CreatedAt.Before(end) {
+					continue
+				}
+				samples = append(samples, anomalySample{
+					DeviceID: device.ID,
+					GroupID:  device.GroupID,
+					Time:     end,
+					Value:    values[device.ID],
+				})
+			}
+			if len(samples) > maxDryRunSamples {
+				return nil, fmt.Errorf("%w: too many samples; pass fewer device_ids or a shorter range", ErrInvalidDryRun)
+			}
+		}
+	}
+	return samples, nil
+}
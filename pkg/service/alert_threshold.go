@@ -0,0 +1,220 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+// defaultBehaviorWindow abnormal_behavior_count未指定窗口时的统计窗口
+const defaultBehaviorWindow = time.Hour
+
+// thresholdOperators 阈值规则支持的比较运算
+var thresholdOperators = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// ParseThresholdConditions 解析并校验阈值规则的条件
+func ParseThresholdConditions(conditions string) (*model.ThresholdConditions, error) {
+	var cond model.ThresholdConditions
+	if err := json.Unmarshal([]byte(conditions), &cond); err != nil {
+		return nil, fmt.Errorf("%w: conditions must be a JSON object: %v", ErrInvalidAlertRule, err)
+	}
+	if !cond.Metric.IsValid() {
+		return nil, fmt.Errorf("%w: unsupported metric %q", ErrInvalidAlertRule, cond.Metric)
+	}
+	if _, ok := thresholdOperators[cond.Operator]; !ok {
+		return nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidAlertRule, cond.Operator)
+	}
+	if cond.Window < 0 {
+		return nil, fmt.Errorf("%w: window must not be negative", ErrInvalidAlertRule)
+	}
+	if err := validateAlertTrigger(cond.AlertRuleTrigger); err != nil {
+		return nil, err
+	}
+	return &cond, nil
+}
+
+// checkThresholdRule 评估阈值规则，设备指标满足条件时创建告警
+func checkThresholdRule(device *model.Device, rule *model.AlertRule) error {
+	cond, err := ParseThresholdConditions(rule.Conditions)
+	if err != nil {
+		return err
+	}
+	_, err = evaluateThresholdRule(device, rule, cond, time.Now())
+	return err
+}
+
+// evaluateThresholdRule 计算指标并比较，满足条件时返回创建的告警
+func evaluateThresholdRule(device *model.Device, rule *model.AlertRule, cond *model.ThresholdConditions, now time.Time) (*model.Alert, error) {
+	value, ok, err := thresholdMetricValue(device, rule, cond, now)
+	if err != nil || !ok || !thresholdOperators[cond.Operator](value, cond.Value) {
+		return nil, err
+	}
+
+	description, details := thresholdAlertDetails(cond, value)
+	return fireRuleAlert(rule, device, cond.AlertRuleTrigger, description, details)
+}
+
+// thresholdAlertDetails 生成阈值规则告警的描述和元数据
+func thresholdAlertDetails(cond *model.ThresholdConditions, value float64) (string, map[string]interface{}) {
+	description := fmt.Sprintf("%s is %s (threshold %s %s)",
+		cond.Metric, formatMetricValue(value), cond.Operator, formatMetricValue(cond.Value))
+	return description, map[string]interface{}{
+		"metric":    cond.Metric,
+		"value":     value,
+		"operator":  cond.Operator,
+		"threshold": cond.Value,
+		"window":    cond.Window,
+	}
+}
+
+// thresholdMetricValue 计算设备指标，指标不适用于该设备时ok为false
+func thresholdMetricValue(device *model.Device, rule *model.AlertRule, cond *model.ThresholdConditions, now time.Time) (float64, bool, error) {
+	db := database.GetDB()
+	window := time.Duration(cond.Window) * time.Second
+
+	switch cond.Metric {
+	case model.AlertMetricRiskLevel:
+		return device.RiskLevel, true, nil
+
+	case model.AlertMetricHeartbeatGap:
+		if device.LastHeartbeat == nil {
+			return 0, false, nil
+		}
+		return math.Floor(now.Sub(*device.LastHeartbeat).Seconds()), true, nil
+
+	case model.AlertMetricAlertCount:
+		// 不统计本规则产生的告警，避免告警自身触发规则
+		encoded, _ := json.Marshal(rule.ID)
+		query := db.Model(&model.Alert{}).Where("device_id = ?", device.ID).
+			Where("metadata IS NULL OR metadata NOT LIKE ? ESCAPE '!'", likePattern(`"rule_id":`+string(encoded)))
+		if window > 0 {
+			query = query.Where("created_at >= ?", now.Add(-window))
+		} else {
+			query = query.Where("status = ?", model.AlertStatusOpen)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return 0, false, fmt.Errorf("failed to count alerts: %v", err)
+		}
+		return float64(count), true, nil
+
+	case model.AlertMetricAbnormalBehaviorCount:
+		if window <= 0 {
+			window = defaultBehaviorWindow
+		}
+		query := db.Model(&model.AbnormalBehavior{}).Where("device_id = ? AND created_at >= ?", device.ID, now.Add(-window))
+		if cond.BehaviorType != "" {
+			query = query.Where("type = ?", cond.BehaviorType)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return 0, false, fmt.Errorf("failed to count abnormal behaviors: %v", err)
+		}
+		return float64(count), true, nil
+
+	case model.AlertMetricLicenseUsagePercent:
+		var licenses []model.License
+		if err := db.Select("usage_count", "usage_limit").
+			Where("device_id = ? AND usage_limit > 0", device.ID).Find(&licenses).Error; err != nil {
+			return 0, false, fmt.Errorf("failed to get licenses: %v", err)
+		}
+		if len(licenses) == 0 {
+			return 0, false, nil
+		}
+		percent := 0.0
+		for _, license := range licenses {
+			if p := float64(license.UsageCount) * 100 / float64(license.UsageLimit); p > percent {
+				percent = p
+			}
+		}
+		return percent, true, nil
+	}
+	return 0, false, nil
+}
+
+// formatMetricValue 格式化指标值用于告警描述
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// triggerThresholdRules 设备指标变化后在后台评估使用该指标的阈值规则
+func triggerThresholdRules(deviceID string, metric model.AlertMetric) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Threshold rule evaluation for device %s panicked: %v", deviceID, r)
+			}
+		}()
+		if err := evaluateDeviceThresholdRules(deviceID, metric); err != nil {
+			log.Printf("Error evaluating threshold rules for device %s: %v", deviceID, err)
+		}
+	}()
+}
+
+// evaluateDeviceThresholdRules 评估设备上使用指定指标的阈值规则
+func evaluateDeviceThresholdRules(deviceID string, metric model.AlertMetric) error {
+	rules, err := loadAlertRules(deviceID, model.AlertRuleTypeThreshold)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %v", err)
+	}
+
+	now := time.Now()
+	for i := range rules {
+		cond, err := ParseThresholdConditions(rules[i].Conditions)
+		if err != nil || cond.Metric != metric {
+			continue
+		}
+		if _, err := evaluateThresholdRule(device, &rules[i], cond, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EvaluateThresholdRules 评估所有启用的阈值规则，返回产生的告警数
+//
+// 由定时任务调用，覆盖没有事件触发的指标（如心跳间隔）。条件无效的规则会被跳过。
+func EvaluateThresholdRules() (int, error) {
+	rules, err := loadEnabledAlertRules(model.AlertRuleTypeThreshold)
+	if err != nil {
+		return 0, err
+	}
+
+	fired := 0
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		cond, err := ParseThresholdConditions(rule.Conditions)
+		if err != nil {
+			log.Printf("Skipping alert rule %s: %v", rule.ID, err)
+			continue
+		}
+		err = forEachRuleDevice(rule, func(device *model.Device) error {
+			alert, err := evaluateThresholdRule(device, rule, cond, now)
+			if alert != nil {
+				fired++
+			}
+			return err
+		})
+		if err != nil {
+			return fired, err
+		}
+	}
+	return fired, nil
+}
@@ -0,0 +1,601 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 触发黑名单检查的操作
+const (
+	BlacklistActionRegister  = "register"  // 设备注册
+	BlacklistActionActivate  = "activate"  // 授权激活
+	BlacklistActionHeartbeat = "heartbeat" // 设备心跳
+)
+
+// blacklistBehaviorType 命中黑名单时记录的异常行为类型
+const blacklistBehaviorType = "blacklist_match"
+
+// maxCachedPatterns 正则缓存的最大条目数，超出后整体清空
+const maxCachedPatterns = 1024
+
+const (
+	countryCacheTTL        = time.Hour              // IP所属国家的缓存时间
+	countryFailureCacheTTL = time.Minute            // 查询失败的缓存时间，避免外部接口故障时每次请求都等待超时
+	maxCachedCountries     = 4096                   // 国家缓存的最大条目数，超出后整体清空
+	countryLookupTimeout   = 500 * time.Millisecond // 请求中等待国家查询的最长时间，超时后查询在后台继续并写入缓存
+)
+
+// blacklistRuleCacheTTL 有效规则缓存的最长时间，多实例部署时其他实例修改的规则最迟在该时间后生效
+const blacklistRuleCacheTTL = time.Minute
+
+var (
+	ErrBlacklistRuleNotFound = errors.New("blacklist rule not found")
+	ErrInvalidBlacklistRule  = errors.New("invalid blacklist rule")
+)
+
+// patternCache 已编译的黑名单正则表达式
+var patternCache = struct {
+	sync.RWMutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// compileBlacklistPattern 编译黑名单规则的正则表达式，结果按模式缓存
+func compileBlacklistPattern(pattern string) (*regexp.Regexp, error) {
+	patternCache.RLock()
+	re, ok := patternCache.patterns[pattern]
+	patternCache.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	patternCache.Lock()
+	if len(patternCache.patterns) >= maxCachedPatterns {
+		patternCache.patterns = make(map[string]*regexp.Regexp)
+	}
+	patternCache.patterns[pattern] = re
+	patternCache.Unlock()
+
+	return re, nil
+}
+
+// blacklistRuleCache 有效黑名单规则缓存，规则增删改时清空，最早的规则过期时重新加载
+var blacklistRuleCache = struct {
+	sync.RWMutex
+	db         *gorm.DB // 加载规则时的数据库连接，连接更换后重新加载
+	rules      []model.BlacklistRule
+	expiresAt  time.Time // 缓存失效时间，不晚于最早的规则过期时间
+	generation uint64    // 每次清空时递增，避免清空前开始的加载写入旧规则
+}{}
+
+// activeBlacklistRules 获取当前有效的黑名单规则，按创建时间升序，调用方不得修改返回的规则
+func activeBlacklistRules(now time.Time) ([]model.BlacklistRule, error) {
+	db := database.GetDB()
+	blacklistRuleCache.RLock()
+	if blacklistRuleCache.db == db && now.Before(blacklistRuleCache.expiresAt) {
+		rules := blacklistRuleCache.rules
+		blacklistRuleCache.RUnlock()
+		return rules, nil
+	}
+	generation := blacklistRuleCache.generation
+	blacklistRuleCache.RUnlock()
+
+	var rules []model.BlacklistRule
+	if err := db.Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("created_at ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to get blacklist rules: %v", err)
+	}
+
+	expiresAt := now.Add(blacklistRuleCacheTTL)
+	for i := range rules {
+		if rules[i].ExpiresAt != nil && rules[i].ExpiresAt.Before(expiresAt) {
+			expiresAt = *rules[i].ExpiresAt
+		}
+		// 预先编译正则，匹配时直接使用缓存
+		switch rules[i].Type {
+		case model.BlacklistRuleTypeDiskID, model.BlacklistRuleTypeBIOS, model.BlacklistRuleTypeMotherboard,
+			model.BlacklistRuleTypeLicenseCode, model.BlacklistRuleTypeCustomer:
+			compileBlacklistPattern(rules[i].Pattern)
+		}
+	}
+
+	blacklistRuleCache.Lock()
+	if blacklistRuleCache.generation == generation {
+		blacklistRuleCache.db = db
+		blacklistRuleCache.rules = rules
+		blacklistRuleCache.expiresAt = expiresAt
+	}
+	blacklistRuleCache.Unlock()
+	return rules, nil
+}
+
+// invalidateBlacklistRules 清空有效规则缓存，规则修改后调用
+func invalidateBlacklistRules() {
+	blacklistRuleCache.Lock()
+	blacklistRuleCache.db = nil
+	blacklistRuleCache.rules = nil
+	blacklistRuleCache.generation++
+	blacklistRuleCache.Unlock()
+}
+
+// countryCache IP地理位置查询结果缓存，避免每次心跳都请求外部接口
+var countryCache = struct {
+	sync.Mutex
+	entries map[string]countryCacheEntry
+}{entries: make(map[string]countryCacheEntry)}
+
+// countryCacheEntry 国家缓存条目
+type countryCacheEntry struct {
+	location  *model.Location
+	expiresAt time.Time
+}
+
+// countryLookups 进行中的国家查询，同一IP只查询一次，完成时关闭通道
+var countryLookups = struct {
+	sync.Mutex
+	pending map[string]chan struct{}
+}{pending: make(map[string]chan struct{})}
+
+// lookupCountry 查询IP所属国家，内网地址、查询失败或超时时返回nil
+//
+// 查询失败时若有过期的查询结果则继续使用，并在countryFailureCacheTTL后重试。
+// 查询超过countryLookupTimeout时先返回过期结果或nil，查询在后台完成后写入缓存。
+func lookupCountry(ip string) *model.Location {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsUnspecified() {
+		return nil
+	}
+
+	countryCache.Lock()
+	entry, ok := countryCache.entries[ip]
+	countryCache.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.location
+	}
+
+	timer := time.NewTimer(countryLookupTimeout)
+	defer timer.Stop()
+	select {
+	case <-resolveCountry(ip):
+		countryCache.Lock()
+		entry = countryCache.entries[ip]
+		countryCache.Unlock()
+	case <-timer.C:
+		log.Printf("Country lookup for %s timed out, continuing in background", ip)
+	}
+	return entry.location
+}
+
+// resolveCountry 在后台查询IP所属国家并写入缓存，返回查询完成时关闭的通道
+func resolveCountry(ip string) <-chan struct{} {
+	countryLookups.Lock()
+	defer countryLookups.Unlock()
+	if done, ok := countryLookups.pending[ip]; ok {
+		return done
+	}
+	done := make(chan struct{})
+	countryLookups.pending[ip] = done
+	resolver := currentLocationResolver()
+
+	go func() {
+		location, err := resolver(ip)
+		now := time.Now()
+
+		countryCache.Lock()
+		entry := countryCache.entries[ip]
+		if err != nil {
+			log.Printf("Failed to resolve country for %s: %v", ip, err)
+			// 过期的结果比没有结果更接近实际位置
+			entry.expiresAt = now.Add(countryFailureCacheTTL)
+		} else {
+			entry = countryCacheEntry{location: location, expiresAt: now.Add(countryCacheTTL)}
+		}
+		if len(countryCache.entries) >= maxCachedCountries {
+			countryCache.entries = make(map[string]countryCacheEntry)
+		}
+		countryCache.entries[ip] = entry
+		countryCache.Unlock()
+
+		countryLookups.Lock()
+		delete(countryLookups.pending, ip)
+		countryLookups.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// BlacklistSubject 黑名单检查对象
+type BlacklistSubject struct {
+	Device      *model.Device   // 设备信息，需已填写硬件和网卡字段
+	IP          string          // 客户端IP
+	LicenseCode string          // 授权码
+	Customer    string          // 客户标识（授权组ID）
+	Location    *model.Location // 客户端位置，为空时按IP查询
+
+	locationResolved bool
+}
+
+// country 获取客户端位置，首次调用时按IP解析
+func (s *BlacklistSubject) country() *model.Location {
+	if s.Location == nil && !s.locationResolved && s.IP != "" {
+		s.Location = lookupCountry(s.IP)
+		s.locationResolved = true
+	}
+	return s.Location
+}
+
+// NewBlacklistSubject 根据设备和客户端IP构建检查对象，并补充设备绑定的授权信息
+func NewBlacklistSubject(device *model.Device, clientIP string) *BlacklistSubject {
+	subject := &BlacklistSubject{Device: device, IP: clientIP}
+
+	var license model.License
+	if device.ID != "" && database.GetDB().Where("device_id = ?", device.ID).
+		Order("updated_at DESC").First(&license).Error == nil {
+		subject.LicenseCode = license.Code
+		subject.Customer = license.GroupID
+	}
+
+	return subject
+}
+
+// matchBlacklistPattern 使用正则表达式匹配字段值，空值不匹配
+func matchBlacklistPattern(pattern, value string) (bool, error) {
+	re, err := compileBlacklistPattern(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid pattern: %v", err)
+	}
+	if value == "" {
+		return false, nil
+	}
+	return re.MatchString(value), nil
+}
+
+// matchIPRule 精确匹配客户端IP
+func matchIPRule(pattern, ip string) (bool, error) {
+	ruleIP := net.ParseIP(strings.TrimSpace(pattern))
+	if ruleIP == nil {
+		return false, fmt.Errorf("invalid ip: %s", pattern)
+	}
+	clientIP := net.ParseIP(ip)
+	return clientIP != nil && ruleIP.Equal(clientIP), nil
+}
+
+// matchCIDRRule 检查客户端IP是否在网段内
+func matchCIDRRule(pattern, ip string) (bool, error) {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(pattern))
+	if err != nil {
+		return false, fmt.Errorf("invalid cidr: %v", err)
+	}
+	clientIP := net.ParseIP(ip)
+	return clientIP != nil && network.Contains(clientIP), nil
+}
+
+// matchMACRule 匹配设备任一网卡的MAC地址
+//
+// 规则为合法MAC地址时精确匹配，否则作为正则表达式匹配小写、冒号分隔的MAC地址。
+func matchMACRule(pattern, networkCards string) (bool, error) {
+	ruleMAC, macErr := net.ParseMAC(strings.TrimSpace(pattern))
+	var re *regexp.Regexp
+	if macErr != nil {
+		var err error
+		if re, err = compileBlacklistPattern(pattern); err != nil {
+			return false, fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+
+	for _, mac := range deviceMACAddresses(networkCards) {
+		if macErr == nil && mac == ruleMAC.String() {
+			return true, nil
+		}
+		if re != nil && re.MatchString(mac) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deviceMACAddresses 从网卡信息中解析MAC地址，统一为小写冒号分隔格式
+func deviceMACAddresses(networkCards string) []string {
+	if networkCards == "" {
+		return nil
+	}
+	cards, err := ParseNetworkCards(networkCards)
+	if err != nil {
+		return nil
+	}
+
+	var macs []string
+	for _, card := range cards {
+		if hw, err := net.ParseMAC(card["mac"]); err == nil {
+			macs = append(macs, hw.String())
+		}
+	}
+	return macs
+}
+
+// matchCountryRule 匹配客户端所在国家，规则为逗号分隔的国家名称或ISO代码，不区分大小写
+func matchCountryRule(pattern string, location *model.Location) (bool, error) {
+	if location == nil {
+		return false, nil
+	}
+	for _, country := range strings.Split(pattern, ",") {
+		country = strings.TrimSpace(country)
+		if country == "" {
+			continue
+		}
+		if strings.EqualFold(country, location.Country) || strings.EqualFold(country, location.CountryCode) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidateBlacklistRule 校验规则类型、动作和匹配模式
+func ValidateBlacklistRule(rule *model.BlacklistRule) error {
+	if rule.Action == "" {
+		rule.Action = model.BlacklistRuleActionDeny
+	}
+	if rule.Action != model.BlacklistRuleActionDeny && rule.Action != model.BlacklistRuleActionAllow {
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidBlacklistRule, rule.Action)
+	}
+	if rule.Pattern == "" {
+		return fmt.Errorf("%w: pattern is required", ErrInvalidBlacklistRule)
+	}
+
+	var err error
+	switch rule.Type {
+	case model.BlacklistRuleTypeDiskID, model.BlacklistRuleTypeBIOS, model.BlacklistRuleTypeMotherboard,
+		model.BlacklistRuleTypeLicenseCode, model.BlacklistRuleTypeCustomer:
+		_, err = compileBlacklistPattern(rule.Pattern)
+	case model.BlacklistRuleTypeIP:
+		_, err = matchIPRule(rule.Pattern, "")
+	case model.BlacklistRuleTypeCIDR:
+		_, err = matchCIDRRule(rule.Pattern, "")
+	case model.BlacklistRuleTypeMAC:
+		_, err = matchMACRule(rule.Pattern, "")
+	case model.BlacklistRuleTypeCountry:
+		if strings.Trim(rule.Pattern, ", ") == "" {
+			err = errors.New("country list is empty")
+		}
+	default:
+		return fmt.Errorf("%w: unknown rule type %q", ErrInvalidBlacklistRule, rule.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBlacklistRule, err)
+	}
+
+	if rule.BlockDevice && rule.IsAllow() {
+		return fmt.Errorf("%w: allow rules cannot block devices", ErrInvalidBlacklistRule)
+	}
+
+	return nil
+}
+
+// ListBlacklistRules 获取黑名单规则列表，ruleType和action为空时不过滤
+func ListBlacklistRules(ruleType, action string, page, pageSize int) ([]model.BlacklistRule, int64, error) {
+	var rules []model.BlacklistRule
+	var total int64
+
+	query := database.GetDB().Model(&model.BlacklistRule{})
+	if ruleType != "" {
+		query = query.Where("type = ?", ruleType)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count blacklist rules: %v", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&rules).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get blacklist rules: %v", err)
+	}
+
+	return rules, total, nil
+}
+
+// GetBlacklistRule 获取黑名单规则
+func GetBlacklistRule(id string) (*model.BlacklistRule, error) {
+	var rule model.BlacklistRule
+	if err := database.GetDB().Where("id = ?", id).First(&rule).Error; err != nil {
+		return nil, ErrBlacklistRuleNotFound
+	}
+	return &rule, nil
+}
+
+// CreateBlacklistRule 创建黑名单规则
+func CreateBlacklistRule(rule *model.BlacklistRule) error {
+	if err := ValidateBlacklistRule(rule); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if rule.ID == "" {
+		rule.ID = utils.GenerateUUID()
+	}
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	if err := database.GetDB().Create(rule).Error; err != nil {
+		return fmt.Errorf("failed to create blacklist rule: %v", err)
+	}
+	invalidateBlacklistRules()
+	return nil
+}
+
+// UpdateBlacklistRule 更新黑名单规则
+func UpdateBlacklistRule(rule *model.BlacklistRule) error {
+	if err := ValidateBlacklistRule(rule); err != nil {
+		return err
+	}
+
+	rule.UpdatedAt = time.Now()
+	if err := database.GetDB().Save(rule).Error; err != nil {
+		return fmt.Errorf("failed to update blacklist rule: %v", err)
+	}
+	invalidateBlacklistRules()
+	return nil
+}
+
+// DeleteBlacklistRule 删除黑名单规则
+func DeleteBlacklistRule(id string) error {
+	result := database.GetDB().Where("id = ?", id).Delete(&model.BlacklistRule{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete blacklist rule: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrBlacklistRuleNotFound
+	}
+	invalidateBlacklistRules()
+	return nil
+}
+
+// FindMatchingBlacklistRule 查找拒绝检查对象的黑名单规则，未命中或命中放行规则时返回nil
+func FindMatchingBlacklistRule(subject *BlacklistSubject) (*model.BlacklistRule, error) {
+	rules, err := FindMatchingBlacklistRules(subject)
+	if err != nil {
+		return nil, err
+	}
+	return decideBlacklist(rules), nil
+}
+
+// FindMatchingBlacklistRules 查找检查对象命中的全部有效规则（包括放行规则）
+func FindMatchingBlacklistRules(subject *BlacklistSubject) ([]model.BlacklistRule, error) {
+	rules, err := activeBlacklistRules(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []model.BlacklistRule{}
+	for i := range rules {
+		ok, err := MatchBlacklistRule(subject, &rules[i])
+		if err != nil {
+			// 无效规则不应阻断正常设备
+			continue
+		}
+		if ok {
+			matched = append(matched, rules[i])
+		}
+	}
+
+	return matched, nil
+}
+
+// decideBlacklist 根据命中的规则判定结果：任一放行规则优先，否则返回第一条拒绝规则
+func decideBlacklist(matched []model.BlacklistRule) *model.BlacklistRule {
+	var deny *model.BlacklistRule
+	for i := range matched {
+		if matched[i].IsAllow() {
+			return nil
+		}
+		if deny == nil {
+			deny = &matched[i]
+		}
+	}
+	return deny
+}
+
+// EnforceBlacklist 对已存在的设备执行黑名单检查
+//
+// 命中拒绝规则时记录异常行为，规则要求时封禁设备，并返回ErrDeviceBlacklisted。
+func EnforceBlacklist(subject *BlacklistSubject, action string) error {
+	rule, err := FindMatchingBlacklistRule(subject)
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		return nil
+	}
+
+	handleBlacklistMatch(subject, rule, action)
+	return ErrDeviceBlacklisted
+}
+
+// handleBlacklistMatch 处理黑名单命中：记录异常行为并按规则封禁设备
+//
+// 规则设置了过期时间时，设备的解封时间与规则过期时间一致。处理失败只记录日志，不影响对本次操作的拒绝。
+func handleBlacklistMatch(subject *BlacklistSubject, rule *model.BlacklistRule, action string) {
+	deviceID := subject.Device.ID
+	description := fmt.Sprintf("设备命中黑名单规则（%s: %s），操作 %s 被拒绝", rule.Type, rule.Pattern, action)
+	data := map[string]interface{}{
+		"rule_id":      rule.ID,
+		"rule_type":    rule.Type,
+		"pattern":      rule.Pattern,
+		"action":       action,
+		"block_device": rule.BlockDevice,
+		"ip":           subject.IP,
+		"license_code": subject.LicenseCode,
+	}
+	if err := RecordAbnormalBehavior(deviceID, blacklistBehaviorType, description, "high", data); err != nil {
+		log.Printf("Failed to record blacklist match for device %s: %v", deviceID, err)
+	}
+
+	if !rule.BlockDevice {
+		return
+	}
+
+	if _, err := BlockDeviceWithOptions(deviceID, BlockOptions{
+		Reason:   fmt.Sprintf("命中黑名单规则 %s", rule.ID),
+		Until:    rule.ExpiresAt,
+		Operator: BlockOperatorBlacklist,
+	}); err != nil {
+		log.Printf("Failed to block blacklisted device %s: %v", deviceID, err)
+	}
+}
+
+// BlacklistTestResult 黑名单匹配测试结果
+type BlacklistTestResult struct {
+	Denied   bool                  `json:"denied"`    // 是否会被拒绝
+	DenyRule *model.BlacklistRule  `json:"deny_rule"` // 导致拒绝的规则
+	Rules    []model.BlacklistRule `json:"rules"`     // 命中的全部规则
+}
+
+// TestBlacklistRules 测试检查对象命中的黑名单规则
+//
+// ruleID不为空时只测试该规则（不考虑过期时间），否则测试全部有效规则。
+func TestBlacklistRules(subject *BlacklistSubject, ruleID string) (*BlacklistTestResult, error) {
+	var matched []model.BlacklistRule
+	if ruleID == "" {
+		var err error
+		if matched, err = FindMatchingBlacklistRules(subject); err != nil {
+			return nil, err
+		}
+	} else {
+		rule, err := GetBlacklistRule(ruleID)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := MatchBlacklistRule(subject, rule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBlacklistRule, err)
+		}
+		matched = []model.BlacklistRule{}
+		if ok {
+			matched = append(matched, *rule)
+		}
+	}
+
+	deny := decideBlacklist(matched)
+	return &BlacklistTestResult{
+		Denied:   deny != nil,
+		DenyRule: deny,
+		Rules:    matched,
+	}, nil
+}
@@ -6,7 +6,11 @@ import (
 	"LVerity/pkg/utils"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // RegisterDevice 注册设备
@@ -53,21 +57,9 @@ func GetDeviceByHardwareInfo(diskID, bios, motherboard string) (*model.Device, e
 	return &device, nil
 }
 
-// UpdateDeviceInfo 更新设备信息
-func UpdateDeviceInfo(deviceID string, updateData map[string]interface{}) error {
-	// 验证设备是否存在
-	if err := database.GetDB().Where("id = ?", deviceID).First(&model.Device{}).Error; err != nil {
-		return err
-	}
-
-	// 更新设备信息
-	if err := database.GetDB().Model(&model.Device{}).
-		Where("id = ?", deviceID).
-		Updates(updateData).Error; err != nil {
-		return err
-	}
-
-	return nil
+// UpdateDeviceInfo 更新设备信息，operator为操作人用户ID，记录在状态历史中
+func UpdateDeviceInfo(deviceID string, updateData map[string]interface{}, operator string) error {
+	return updateDevice(deviceID, updateData, operator, "设备信息更新")
 }
 
 // DeleteDevice 删除设备
@@ -80,40 +72,13 @@ func DeleteDevice(deviceID string) error {
 
 // BlockDevice 禁用设备
 func BlockDevice(deviceID string) error {
-	device, err := GetDevice(deviceID)
-	if err != nil {
-		return err
-	}
-
-	now := time.Now()
-	device.Status = model.DeviceStatusBlocked
-	device.BlockTime = &now
-	device.UpdatedAt = now
-
-	if err := database.GetDB().Save(device).Error; err != nil {
-		return err
-	}
-
-	return nil
+	_, err := BlockDeviceWithOptions(deviceID, BlockOptions{Operator: BlockOperatorSystem})
+	return err
 }
 
 // UnblockDevice 解除设备禁用
 func UnblockDevice(deviceID string) error {
-	device, err := GetDevice(deviceID)
-	if err != nil {
-		return err
-	}
-
-	device.Status = model.DeviceStatusNormal
-	device.BlockTime = nil
-	device.BlockReason = ""
-	device.UpdatedAt = time.Now()
-
-	if err := database.GetDB().Save(device).Error; err != nil {
-		return err
-	}
-
-	return nil
+	return UnblockDeviceWithReason(deviceID, BlockOperatorSystem, "")
 }
 
 // GetDevicesByStatus 获取指定状态的设备列表
@@ -178,33 +143,62 @@ func AssignDeviceToGroup(deviceID string, groupID string) error {
 
 // UpdateDeviceHeartbeat 更新设备心跳
 func UpdateDeviceHeartbeat(deviceID string) error {
-	now := time.Now()
-	updates := map[string]interface{}{
-		"last_heartbeat": now,
-		"updated_at":     now,
-	}
-	return database.GetDB().Model(&model.Device{}).Where("id = ?", deviceID).Updates(updates).Error
+	return recordDeviceHeartbeat(deviceID, "")
 }
 
 // CheckOfflineDevices 检查离线设备
+//
+// 超过心跳超时未上报心跳的设备，以及从未上报心跳且超过device.offline_threshold未活动的设备，
+// 标记为离线并结束其会话。
 func CheckOfflineDevices() error {
 	var devices []model.Device
 	if err := database.GetDB().Where("status = ?", model.DeviceStatusNormal).Find(&devices).Error; err != nil {
 		return err
 	}
 
+	now := time.Now()
 	for _, device := range devices {
-		if device.LastHeartbeat == nil {
+		var (
+			lastActive time.Time
+			timeout    time.Duration
+			reason     string
+		)
+		switch {
+		case device.LastHeartbeat != nil:
+			lastActive, timeout, reason = *device.LastHeartbeat, deviceHeartbeatTimeout(&device), "心跳超时"
+		case device.LastSeen != nil:
+			lastActive, timeout, reason = *device.LastSeen, deviceOfflineThreshold(), "长时间未活动"
+		default:
+			lastActive, timeout, reason = device.CreatedAt, deviceOfflineThreshold(), "长时间未活动"
+		}
+		if now.Sub(lastActive) <= timeout {
 			continue
 		}
 
-		heartbeatTimeout := time.Duration(device.HeartbeatRate) * time.Second * 2
-		if time.Since(*device.LastHeartbeat) > heartbeatTimeout {
-			device.Status = model.DeviceStatusOffline
-			device.UpdatedAt = time.Now()
-			if err := database.GetDB().Save(&device).Error; err != nil {
-				return err
-			}
+		changed, err := TransitionDeviceStatus(device.ID, DeviceTransition{
+			Status: model.DeviceStatusOffline,
+			Reason: reason,
+			Actor:  BlockOperatorScheduler,
+			From:   []string{model.DeviceStatusNormal},
+			Metadata: map[string]interface{}{
+				"last_heartbeat":    device.LastHeartbeat,
+				"last_active":       lastActive,
+				"heartbeat_timeout": timeout.Seconds(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if err := endDeviceSessions(device.ID); err != nil {
+			log.Printf("Failed to end sessions for device %s: %v", device.ID, err)
+		}
+		_, err = CreateAlert(device.ID, AlertTitleDeviceOffline, model.AlertLevelWarning,
+			fmt.Sprintf("设备%s，最后活动时间 %s", reason, lastActive.Format(time.RFC3339)), "")
+		if err != nil && !errors.Is(err, ErrAlertSuppressed) {
+			log.Printf("Failed to create offline alert for device %s: %v", device.ID, err)
 		}
 	}
 
@@ -226,22 +220,28 @@ func GetDeviceInfo(deviceID string) (*model.Device, error) {
 	return device, nil
 }
 
-// UpdateDeviceMetadata 更新设备元数据
+// UpdateDeviceMetadata 替换设备元数据，按设备类型的结构定义校验
 func UpdateDeviceMetadata(deviceID string, metadata map[string]interface{}) error {
 	device, err := GetDevice(deviceID)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDeviceNotFound
+		}
+		return err
+	}
+	if err := ValidateMetadata(model.MetadataTargetDevice, device.Type, metadata); err != nil {
 		return err
 	}
 
-	metadataJSON, err := json.Marshal(metadata)
+	metadataJSON, err := encodeMetadata(metadata)
 	if err != nil {
 		return err
 	}
 
-	device.Metadata = string(metadataJSON)
-	device.UpdatedAt = time.Now()
-
-	return database.GetDB().Save(device).Error
+	return database.GetDB().Model(&model.Device{}).Where("id = ?", deviceID).Updates(map[string]interface{}{
+		"metadata":   metadataJSON,
+		"updated_at": time.Now(),
+	}).Error
 }
 
 // GetDeviceStats 获取设备统计信息
@@ -296,8 +296,7 @@ func GetDeviceStatus(deviceID string) string {
 		return string(model.DeviceStatusOffline)
 	}
 
-	heartbeatTimeout := time.Duration(device.HeartbeatRate) * time.Second * 2
-	if time.Since(*device.LastHeartbeat) > heartbeatTimeout {
+	if time.Since(*device.LastHeartbeat) > deviceHeartbeatTimeout(device) {
 		return string(model.DeviceStatusOffline)
 	}
 
@@ -327,8 +326,7 @@ func CalculateDeviceRiskLevel(deviceID string) int {
 
 	// 心跳检查
 	if device.LastHeartbeat != nil {
-		heartbeatTimeout := time.Duration(device.HeartbeatRate) * time.Second * 2
-		if time.Since(*device.LastHeartbeat) > heartbeatTimeout {
+		if time.Since(*device.LastHeartbeat) > deviceHeartbeatTimeout(device) {
 			riskLevel += 30
 		}
 	} else {
@@ -363,18 +361,16 @@ func CalculateDeviceRiskLevel(deviceID string) int {
 }
 
 // ListDevices 获取设备列表
-func ListDevices(page string, pageSize string, filters ...string) ([]model.Device, int64, error) {
+func ListDevices(page string, pageSize string, statuses ...string) ([]model.Device, int64, error) {
 	var devices []model.Device
 	var total int64
 
 	offset, limit := utils.GetPagination(page, pageSize)
 	query := database.GetDB().Model(&model.Device{})
 
-	// 应用过滤条件
-	for _, filter := range filters {
-		if filter != "" {
-			query = query.Where("status = ?", filter)
-		}
+	// 按状态过滤，匹配任一状态
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
 	}
 
 	// 获取总数
@@ -390,16 +386,12 @@ func ListDevices(page string, pageSize string, filters ...string) ([]model.Devic
 	return devices, total, nil
 }
 
-// UpdateDevice 更新设备
-func UpdateDevice(deviceID string, updates map[string]interface{}) error {
-	result := database.GetDB().Model(&model.Device{}).Where("id = ?", deviceID).Updates(updates)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("device not found")
+// UpdateDevice 更新设备，operator为操作人用户ID，记录在状态历史中
+func UpdateDevice(deviceID string, updates map[string]interface{}, operator string) error {
+	if err := prepareDeviceMetadataUpdate(deviceID, updates); err != nil {
+		return err
 	}
-	return nil
+	return updateDevice(deviceID, updates, operator, "设备更新")
 }
 
 // GetAllDevices 获取所有设备
@@ -422,27 +414,7 @@ func UpdateDeviceRiskLevel(deviceID string, riskLevel float64) error {
 	if result.RowsAffected == 0 {
 		return errors.New("device not found")
 	}
-	return nil
-}
-
-// UpdateDeviceStats 更新设备使用统计
-func UpdateDeviceStats(deviceID string, stats *model.UsageStats) error {
-	// 将 UsageStats 转换为数据库字段
-	updates := map[string]interface{}{
-		"last_active_date":   stats.LastActiveDate,
-		"average_usage_time": stats.AverageUsageTime,
-		"peak_usage_time":    stats.PeakUsageTime,
-	}
-
-	result := database.GetDB().Model(&model.Device{}).
-		Where("id = ?", deviceID).
-		Updates(updates)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("device not found")
-	}
+	triggerThresholdRules(deviceID, model.AlertMetricRiskLevel)
 	return nil
 }
 
@@ -477,27 +449,13 @@ func RecordAbnormalBehavior(deviceID, behaviorType, description, level string, d
 		return err
 	}
 
+	triggerThresholdRules(deviceID, model.AlertMetricAbnormalBehaviorCount)
+	triggerPatternRules(deviceID, model.PatternEventBehavior)
 	return nil
 }
 
 // BlockDeviceWithReason 禁用设备并记录原因
 func BlockDeviceWithReason(deviceID string, reason string) error {
-	now := time.Now()
-	updates := map[string]interface{}{
-		"status":       model.DeviceStatusBlocked,
-		"block_reason": reason,
-		"block_time":   now,
-		"updated_at":   now,
-	}
-
-	result := database.GetDB().Model(&model.Device{}).
-		Where("id = ?", deviceID).
-		Updates(updates)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("device not found")
-	}
-	return nil
+	_, err := BlockDeviceWithOptions(deviceID, BlockOptions{Reason: reason, Operator: BlockOperatorSystem})
+	return err
 }
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"LVerity/pkg/model"
+)
+
+// RecordAgentHeartbeat 处理设备代理上报的心跳
+//
+// 每次心跳都会重新执行黑名单检查，命中时拒绝心跳并按规则封禁设备；客户端所在国家不在策略允许范围内时同样拒绝。
+func RecordAgentHeartbeat(deviceID, clientIP string) (*model.Device, error) {
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := EnforceBlacklist(NewBlacklistSubject(device, clientIP), BlacklistActionHeartbeat); err != nil {
+		return nil, err
+	}
+	if err := EnforceCountryPolicy(device, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := recordDeviceHeartbeat(deviceID, clientIP); err != nil {
+		return nil, err
+	}
+
+	return GetDevice(deviceID)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 系统操作的操作人标识
+const (
+	BlockOperatorSystem    = "system"     // 系统自动操作
+	BlockOperatorScheduler = "scheduler"  // 定时任务
+	BlockOperatorBlacklist = "blacklist"  // 黑名单规则
+	BlockOperatorPolicy    = "policy"     // 分组策略自动封禁
+	BlockOperatorAlertRule = "alert_rule" // 告警规则的自动响应动作
+)
+
+var (
+	ErrDeviceNotFound     = errors.New("device not found")
+	ErrInvalidBlockPeriod = errors.New("unblock time must be in the future")
+)
+
+// BlockOptions 封禁设备参数
+type BlockOptions struct {
+	Reason   string        // 封禁原因
+	Duration time.Duration // 封禁时长，为0且未指定Until时永久封禁
+	Until    *time.Time    // 解封时间，优先于Duration
+	Operator string        // 操作人
+}
+
+// unblockTime 计算计划解封时间，永久封禁时返回nil
+func (o *BlockOptions) unblockTime(now time.Time) (*time.Time, error) {
+	if o.Until != nil {
+		if !o.Until.After(now) {
+			return nil, ErrInvalidBlockPeriod
+		}
+		until := *o.Until
+		return &until, nil
+	}
+	if o.Duration < 0 {
+		return nil, ErrInvalidBlockPeriod
+	}
+	if o.Duration > 0 {
+		until := now.Add(o.Duration)
+		return &until, nil
+	}
+	return nil, nil
+}
+
+// BlockDeviceWithOptions 封禁设备，支持临时封禁，并记录封禁历史
+func BlockDeviceWithOptions(deviceID string, opts BlockOptions) (*model.Device, error) {
+	now := time.Now()
+	unblockAt, err := opts.unblockTime(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var change *statusChange
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = blockDeviceTx(tx, deviceID, opts, unblockAt, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	publishStatusChange(change)
+
+	return GetDevice(deviceID)
+}
+
+// blockDeviceTx 在事务内封禁设备并记录封禁历史，调用方在提交后发布状态变更事件
+func blockDeviceTx(tx *gorm.DB, deviceID string, opts BlockOptions, unblockAt *time.Time, now time.Time) (*statusChange, error) {
+	change, err := transitionDeviceStatusTx(tx, deviceID, DeviceTransition{
+		Status: model.DeviceStatusBlocked,
+		Reason: opts.Reason,
+		Actor:  opts.Operator,
+		Metadata: map[string]interface{}{
+			"unblock_time": unblockAt,
+		},
+		Updates: map[string]interface{}{
+			"block_reason": opts.Reason,
+			"block_time":   now,
+			"unblock_time": unblockAt,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&model.DeviceBlockHistory{
+		ID:          utils.GenerateUUID(),
+		DeviceID:    deviceID,
+		Action:      model.DeviceBlockActionBlock,
+		Reason:      opts.Reason,
+		Operator:    opts.Operator,
+		UnblockTime: unblockAt,
+		CreatedAt:   now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// UnblockDeviceWithReason 解除设备封禁并记录解封历史，设备未被封禁时不做修改
+func UnblockDeviceWithReason(deviceID, operator, reason string) error {
+	_, err := unblockDeviceIf(deviceID, operator, reason, nil)
+	return err
+}
+
+// unblockDeviceIf 设备被封禁且guard在锁定的设备行上返回true时解除封禁，返回是否已解封
+func unblockDeviceIf(deviceID, operator, reason string, guard func(device *model.Device) bool) (bool, error) {
+	var change *statusChange
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = unblockDeviceTx(tx, deviceID, operator, reason, time.Now(), guard)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	publishStatusChange(change)
+	return change != nil, nil
+}
+
+// unblockDeviceTx 在事务内解除封禁并记录解封历史，设备未被封禁或guard返回false时返回nil
+func unblockDeviceTx(tx *gorm.DB, deviceID, operator, reason string, now time.Time, guard func(device *model.Device) bool) (*statusChange, error) {
+	change, err := transitionDeviceStatusTx(tx, deviceID, DeviceTransition{
+		Status: model.DeviceStatusNormal,
+		Reason: reason,
+		Actor:  operator,
+		From:   []string{model.DeviceStatusBlocked},
+		Guard:  guard,
+		Updates: map[string]interface{}{
+			"block_reason": "",
+			"block_time":   nil,
+			"unblock_time": nil,
+		},
+	})
+	if err != nil || change == nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&model.DeviceBlockHistory{
+		ID:        utils.GenerateUUID(),
+		DeviceID:  deviceID,
+		Action:    model.DeviceBlockActionUnblock,
+		Reason:    reason,
+		Operator:  operator,
+		CreatedAt: now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// ReleaseExpiredBlocks 解封已到解封时间的设备，返回解封数量
+func ReleaseExpiredBlocks() (int, error) {
+	var devices []model.Device
+	if err := database.GetDB().Where("status = ? AND unblock_time IS NOT NULL AND unblock_time <= ?",
+		model.DeviceStatusBlocked, time.Now()).Find(&devices).Error; err != nil {
+		return 0, fmt.Errorf("failed to get expired blocks: %v", err)
+	}
+
+	released := 0
+	for _, device := range devices {
+		// 查询之后设备可能被重新封禁或延长封禁，在锁定的设备行上重新检查解封时间
+		unblocked, err := unblockDeviceIf(device.ID, BlockOperatorScheduler, "封禁到期自动解封", func(locked *model.Device) bool {
+			return locked.UnblockTime != nil && !locked.UnblockTime.After(time.Now())
+		})
+		if err != nil {
+			log.Printf("Failed to release expired block of device %s: %v", device.ID, err)
+			continue
+		}
+		if unblocked {
+			released++
+		}
+	}
+
+	return released, nil
+}
+
+// GetDeviceBlockHistory 获取设备封禁/解封历史，按时间倒序
+func GetDeviceBlockHistory(deviceID string) ([]model.DeviceBlockHistory, error) {
+	var history []model.DeviceBlockHistory
+	if err := database.GetDB().Where("device_id = ?", deviceID).
+		Order("created_at DESC").Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device block history: %v", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxBulkDevices = 5000
+	bulkBatchSize  = 100
+)
+
+var (
+	ErrInvalidBulkOperation  = errors.New("invalid bulk operation")
+	ErrBulkOperationNotFound = errors.New("bulk operation not found")
+)
+
+// errBulkDeviceSkipped 解封时设备未被封禁，该设备记录为跳过
+var errBulkDeviceSkipped = errors.New("device is not blocked")
+
+// BulkOperationParams 批量操作参数
+type BulkOperationParams struct {
+	Reason        string     `json:"reason,omitempty"`         // 操作原因，记录到封禁历史、状态历史和配置历史
+	Duration      int64      `json:"duration,omitempty"`       // block的封禁时长（秒），为0且未指定until时永久封禁
+	Until         *time.Time `json:"until,omitempty"`          // block的解封时间，优先于duration
+	GroupID       string     `json:"group_id,omitempty"`       // move_group的目标分组，为空时移出分组
+	HeartbeatRate int        `json:"heartbeat_rate,omitempty"` // set_heartbeat_rate的心跳间隔（秒）
+}
+
+// BulkOperationRequest 批量操作请求，DeviceIDs和Filter二选一
+type BulkOperationRequest struct {
+	Action    model.BulkAction    `json:"action"`
+	DeviceIDs []string            `json:"device_ids"`
+	Filter    *DeviceSearchQuery  `json:"filter"`
+	Params    BulkOperationParams `json:"params"`
+	Async     bool                `json:"async"` // 在后台执行，立即返回操作记录
+}
+
+// BulkActor 发起批量操作的用户，记录到操作日志
+type BulkActor struct {
+	UserID   string
+	Username string
+	IP       string
+}
+
+// BulkOperationReport 批量操作及设备执行结果
+type BulkOperationReport struct {
+	*model.BulkOperation
+	Results     []model.BulkOperationResult `json:"results"`
+	ResultTotal int64                       `json:"result_total"`
+}
+
+// bulkTask 执行中的批量操作
+type bulkTask struct {
+	operation *model.BulkOperation
+	params    BulkOperationParams
+	actor     BulkActor
+	unblockAt *time.Time
+}
+
+// StartBulkOperation 校验并执行批量操作
+//
+// 设备按批执行，每批在一个事务中完成：单个设备的业务错误只影响该设备，其它错误使整批回滚。
+// Async为true时在后台执行，可通过GetBulkOperation查询进度。
+func StartBulkOperation(req BulkOperationRequest, actor BulkActor) (*BulkOperationReport, error) {
+	task := &bulkTask{params: req.Params, actor: actor}
+	if err := task.validate(req.Action); err != nil {
+		return nil, err
+	}
+	ids, err := resolveBulkTargets(req)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bulk params: %v", err)
+	}
+	filter := ""
+	if req.Filter != nil {
+		data, err := json.Marshal(req.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode bulk filter: %v", err)
+		}
+		filter = string(data)
+	}
+	task.operation = &model.BulkOperation{
+		ID:        utils.GenerateUUID(),
+		Action:    req.Action,
+		Params:    string(params),
+		Filter:    filter,
+		Status:    model.BulkOperationPending,
+		Total:     len(ids),
+		CreatedBy: actor.UserID,
+		CreatedAt: time.Now(),
+	}
+	if err := database.GetDB().Create(task.operation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create bulk operation: %v", err)
+	}
+
+	if req.Async {
+		go task.run(ids)
+		return &BulkOperationReport{BulkOperation: task.operation, Results: []model.BulkOperationResult{}}, nil
+	}
+	task.run(ids)
+	return GetBulkOperation(task.operation.ID, false, 1, maxBulkDevices)
+}
+
+// validate 校验操作类型和参数
+func (t *bulkTask) validate(action model.BulkAction) error {
+	if !action.IsValid() {
+		return fmt.Errorf("%w: unsupported action %q", ErrInvalidBulkOperation, action)
+	}
+	switch action {
+	case model.BulkActionBlock:
+		opts := BlockOptions{Duration: time.Duration(t.params.Duration) * time.Second, Until: t.params.Until}
+		unblockAt, err := opts.unblockTime(time.Now())
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBulkOperation, err)
+		}
+		t.unblockAt = unblockAt
+	case model.BulkActionMoveGroup:
+		if t.params.GroupID != "" {
+			if _, err := findGroup(t.params.GroupID); err != nil {
+				return err
+			}
+		}
+	case model.BulkActionSetHeartbeatRate:
+		if t.params.HeartbeatRate < minConfigHeartbeatRate || t.params.HeartbeatRate > maxConfigHeartbeatRate {
+			return fmt.Errorf("%w: heartbeat_rate must be between %d and %d", ErrInvalidBulkOperation, minConfigHeartbeatRate, maxConfigHeartbeatRate)
+		}
+	}
+	return nil
+}
+
+// resolveBulkTargets 获取要操作的设备ID，按条件选择时按创建时间排序
+func resolveBulkTargets(req BulkOperationRequest) ([]string, error) {
+	if (len(req.DeviceIDs) > 0) == (req.Filter != nil) {
+		return nil, fmt.Errorf("%w: exactly one of device_ids and filter is required", ErrInvalidBulkOperation)
+	}
+	if req.Filter == nil {
+		ids := uniqueStrings(req.DeviceIDs)
+		if len(ids) > maxBulkDevices {
+			return nil, fmt.Errorf("%w: at most %d devices per operation", ErrInvalidBulkOperation, maxBulkDevices)
+		}
+		return ids, nil
+	}
+
+	query, err := applyDeviceSearch(database.GetDB().Model(&model.Device{}), *req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := query.Order("created_at ASC, id ASC").Limit(maxBulkDevices+1).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve bulk targets: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no devices match the filter", ErrInvalidBulkOperation)
+	}
+	if len(ids) > maxBulkDevices {
+		return nil, fmt.Errorf("%w: filter matches more than %d devices", ErrInvalidBulkOperation, maxBulkDevices)
+	}
+	return ids, nil
+}
+
+// run 分批执行并保存每个设备的结果，每批完成后更新进度
+func (t *bulkTask) run(ids []string) {
+	op := t.operation
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Bulk operation %s panicked: %v", op.ID, r)
+			t.finish(model.BulkOperationFailed, fmt.Sprintf("panic: %v", r))
+		}
+	}()
+
+	now := time.Now()
+	op.StartedAt = &now
+	op.Status = model.BulkOperationRunning
+	if err := database.GetDB().Model(op).Updates(map[string]interface{}{
+		"status":     op.Status,
+		"started_at": now,
+	}).Error; err != nil {
+		log.Printf("Failed to start bulk operation %s: %v", op.ID, err)
+	}
+
+	for start := 0; start < len(ids); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		results := t.runBatch(ids[start:end])
+		for _, result := range results {
+			switch {
+			case result.Success:
+				op.Succeeded++
+			case result.Skipped:
+				op.Skipped++
+			default:
+				op.Failed++
+			}
+		}
+		if err := database.GetDB().CreateInBatches(results, bulkBatchSize).Error; err != nil {
+			t.finish(model.BulkOperationFailed, fmt.Sprintf("failed to save results: %v", err))
+			return
+		}
+		if err := database.GetDB().Model(op).Updates(map[string]interface{}{
+			"succeeded": op.Succeeded,
+			"failed":    op.Failed,
+			"skipped":   op.Skipped,
+		}).Error; err != nil {
+			log.Printf("Failed to update bulk operation %s progress: %v", op.ID, err)
+		}
+	}
+	t.finish(model.BulkOperationCompleted, "")
+}
+
+// finish 记录批量操作的最终状态
+func (t *bulkTask) finish(status model.BulkOperationStatus, message string) {
+	op := t.operation
+	now := time.Now()
+	op.Status = status
+	op.Error = message
+	op.FinishedAt = &now
+	if err := database.GetDB().Model(op).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       message,
+		"succeeded":   op.Succeeded,
+		"failed":      op.Failed,
+		"skipped":     op.Skipped,
+		"finished_at": now,
+	}).Error; err != nil {
+		log.Printf("Failed to finish bulk operation %s: %v", op.ID, err)
+	}
+}
+
+// runBatch 在一个事务中对一批设备执行操作，并为成功的设备写入操作日志
+func (t *bulkTask) runBatch(ids []string) []model.BulkOperationResult {
+	now := time.Now()
+	failures := make(map[string]string)
+	skipped := make(map[string]bool)
+
+	var existing []string
+	if err := database.GetDB().Model(&model.Device{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+		return bulkResults(t.operation.ID, ids, nil, nil, err.Error(), now)
+	}
+	found := make(map[string]bool, len(existing))
+	for _, id := range existing {
+		found[id] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			failures[id] = ErrDeviceNotFound.Error()
+		}
+	}
+
+	var changes []*statusChange
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		changes = changes[:0]
+		var audits []model.OperationLog
+		for _, id := range ids {
+			if !found[id] {
+				continue
+			}
+			change, err := t.apply(tx, id, now)
+			if err != nil {
+				if errors.Is(err, errBulkDeviceSkipped) {
+					skipped[id] = true
+					continue
+				}
+				if errors.Is(err, ErrDeviceNotFound) || errors.Is(err, ErrInvalidDeviceConfig) {
+					failures[id] = err.Error()
+					continue
+				}
+				return err
+			}
+			if change != nil {
+				changes = append(changes, change)
+			}
+			audits = append(audits, t.auditRecord(id, now))
+		}
+		if len(audits) > 0 {
+			return tx.Create(&audits).Error
+		}
+		return nil
+	})
+	if err != nil {
+		message := fmt.Sprintf("batch rolled back: %v", err)
+		for _, id := range ids {
+			if found[id] {
+				failures[id] = message
+			}
+		}
+		return bulkResults(t.operation.ID, ids, failures, nil, "", now)
+	}
+
+	for _, change := range changes {
+		publishStatusChange(change)
+	}
+	return bulkResults(t.operation.ID, ids, failures, skipped, "", now)
+}
+
+// apply 在事务内对单个设备执行操作
+func (t *bulkTask) apply(tx *gorm.DB, deviceID string, now time.Time) (*statusChange, error) {
+	switch t.operation.Action {
+	case model.BulkActionBlock:
+		return blockDeviceTx(tx, deviceID, BlockOptions{Reason: t.params.Reason, Operator: t.actor.UserID}, t.unblockAt, now)
+	case model.BulkActionUnblock:
+		change, err := unblockDeviceTx(tx, deviceID, t.actor.UserID, t.params.Reason, now, nil)
+		if err == nil && change == nil {
+			return nil, errBulkDeviceSkipped
+		}
+		return change, err
+	case model.BulkActionMoveGroup:
+		return nil, tx.Model(&model.Device{}).Where("id = ?", deviceID).Updates(map[string]interface{}{
+			"group_id":   t.params.GroupID,
+			"updated_at": now,
+		}).Error
+	case model.BulkActionSetHeartbeatRate:
+		rate := t.params.HeartbeatRate
+		_, err := saveDeviceConfigTx(tx, model.DeviceConfigTargetDevice, deviceID, func(spec model.DeviceConfigSpec) model.DeviceConfigSpec {
+			spec.HeartbeatRate = &rate
+			return spec
+		}, t.actor.UserID, t.params.Reason, map[string]interface{}{"bulk_operation_id": t.operation.ID})
+		return nil, err
+	case model.BulkActionDelete:
+		if err := tx.Model(&model.UsageRecord{}).Where("device_id = ? AND active = ?", deviceID, true).
+			Update("active", false).Error; err != nil {
+			return nil, err
+		}
+		return nil, tx.Delete(&model.Device{}, "id = ?", deviceID).Error
+	}
+	return nil, fmt.Errorf("%w: unsupported action %q", ErrInvalidBulkOperation, t.operation.Action)
+}
+
+// auditRecord 生成单个设备的操作日志
+func (t *bulkTask) auditRecord(deviceID string, now time.Time) model.OperationLog {
+	detail, _ := json.Marshal(map[string]interface{}{
+		"bulk_operation_id": t.operation.ID,
+		"params":            t.params,
+	})
+	return model.OperationLog{
+		ID:         utils.GenerateUUID(),
+		UserID:     t.actor.UserID,
+		Username:   t.actor.Username,
+		Action:     "device." + string(t.operation.Action),
+		Resource:   "device",
+		ResourceID: deviceID,
+		Detail:     string(detail),
+		IP:         t.actor.IP,
+		CreatedAt:  now,
+	}
+}
+
+// bulkResults 生成一批设备的结果，failures中的设备为失败，skipped中的设备为跳过，message不为空时所有设备均失败
+func bulkResults(operationID string, ids []string, failures map[string]string, skipped map[string]bool, message string, now time.Time) []model.BulkOperationResult {
+	results := make([]model.BulkOperationResult, 0, len(ids))
+	for _, id := range ids {
+		result := model.BulkOperationResult{OperationID: operationID, DeviceID: id, Success: true, CreatedAt: now}
+		if message != "" {
+			result.Success, result.Error = false, message
+		} else if failure, ok := failures[id]; ok {
+			result.Success, result.Error = false, failure
+		} else if skipped[id] {
+			result.Success, result.Skipped, result.Error = false, true, errBulkDeviceSkipped.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// GetBulkOperation 获取批量操作及设备结果，failedOnly为true时只返回失败的设备，不含跳过的设备
+func GetBulkOperation(id string, failedOnly bool, page, pageSize int) (*BulkOperationReport, error) {
+	var op model.BulkOperation
+	if err := database.GetDB().Where("id = ?", id).First(&op).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBulkOperationNotFound
+		}
+		return nil, fmt.Errorf("failed to get bulk operation: %v", err)
+	}
+
+	report := &BulkOperationReport{BulkOperation: &op, Results: []model.BulkOperationResult{}}
+	query := database.GetDB().Model(&model.BulkOperationResult{}).Where("operation_id = ?", id)
+	if failedOnly {
+		query = query.Where("success = ? AND skipped = ?", false, false)
+	}
+	if err := query.Count(&report.ResultTotal).Error; err != nil {
+		return nil, fmt.Errorf("failed to count bulk results: %v", err)
+	}
+	if err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&report.Results).Error; err != nil {
+		return nil, fmt.Errorf("failed to get bulk results: %v", err)
+	}
+	return report, nil
+}
+
+// ListBulkOperations 分页获取批量操作，按创建时间倒序
+func ListBulkOperations(page, pageSize int) ([]model.BulkOperation, int64, error) {
+	var operations []model.BulkOperation
+	var total int64
+	query := database.GetDB().Model(&model.BulkOperation{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count bulk operations: %v", err)
+	}
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&operations).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get bulk operations: %v", err)
+	}
+	return operations, total, nil
+}
+
+// FailInterruptedBulkOperations 将服务重启前未执行完的批量操作标记为失败，已完成的批次保持不变
+func FailInterruptedBulkOperations() error {
+	now := time.Now()
+	if err := database.GetDB().Model(&model.BulkOperation{}).
+		Where("status IN ?", []model.BulkOperationStatus{model.BulkOperationPending, model.BulkOperationRunning}).
+		Updates(map[string]interface{}{
+			"status":      model.BulkOperationFailed,
+			"error":       "interrupted by server restart",
+			"finished_at": now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to mark interrupted bulk operations: %v", err)
+	}
+	return nil
+}
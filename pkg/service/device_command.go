@@ -0,0 +1,370 @@
+package service
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxCommandsPerPull = 20 // 每次拉取最多下发的命令数
+
+var (
+	ErrCommandNotFound     = errors.New("command not found")
+	ErrInvalidCommand      = errors.New("invalid command")
+	ErrCommandFinished     = errors.New("command already finished")
+	ErrCommandNotDelivered = errors.New("command has not been delivered")
+)
+
+// DeviceCommandRequest 创建远程命令的参数
+type DeviceCommandRequest struct {
+	Type    model.DeviceCommandType `json:"type"`
+	Payload json.RawMessage         `json:"payload"`
+	TTL     time.Duration           `json:"-"` // 为0时使用device.command_default_ttl
+}
+
+// DeviceCommandFilter 远程命令查询条件，字段为空时不过滤
+type DeviceCommandFilter struct {
+	DeviceID string
+	GroupID  string // 当前属于该分组的设备的命令
+	Types    []model.DeviceCommandType
+	Status   []model.DeviceCommandStatus
+}
+
+// commandNotifier 通知正在长轮询的设备有新命令
+type commandNotifier struct {
+	mu      sync.Mutex
+	waiters map[string][]chan struct{}
+}
+
+var deviceCommandNotifier = &commandNotifier{waiters: make(map[string][]chan struct{})}
+
+// subscribe 注册等待通道，返回取消注册函数
+func (n *commandNotifier) subscribe(deviceID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	n.mu.Lock()
+	n.waiters[deviceID] = append(n.waiters[deviceID], ch)
+	n.mu.Unlock()
+
+	return ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		waiters := n.waiters[deviceID]
+		for i, w := range waiters {
+			if w == ch {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(n.waiters, deviceID)
+		} else {
+			n.waiters[deviceID] = waiters
+		}
+	}
+}
+
+// notify 唤醒等待该设备命令的所有请求
+func (n *commandNotifier) notify(deviceID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, ch := range n.waiters[deviceID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// commandTTL 计算命令有效期
+func commandTTL(ttl time.Duration) (time.Duration, error) {
+	cfg := config.GetConfig().Device
+	if ttl == 0 {
+		ttl = cfg.CommandDefaultTTL
+	}
+	if ttl <= 0 || (cfg.CommandMaxTTL > 0 && ttl > cfg.CommandMaxTTL) {
+		return 0, fmt.Errorf("%w: ttl must be positive and at most %v", ErrInvalidCommand, cfg.CommandMaxTTL)
+	}
+	return ttl, nil
+}
+
+// newDeviceCommand 校验参数并构造命令
+func newDeviceCommand(deviceID string, req DeviceCommandRequest, operator string, now time.Time) (*model.DeviceCommand, error) {
+	if !req.Type.IsValid() {
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidCommand, req.Type)
+	}
+	ttl, err := commandTTL(req.TTL)
+	if err != nil {
+		return nil, err
+	}
+	return &model.DeviceCommand{
+		ID:         utils.GenerateUUID(),
+		DeviceID:   deviceID,
+		Type:       req.Type,
+		Payload:    rawJSONString(req.Payload),
+		Status:     model.DeviceCommandPending,
+		ExpiresAt:  now.Add(ttl),
+		CreateTime: now,
+		CreatedBy:  operator,
+		UpdateTime: now,
+	}, nil
+}
+
+// EnqueueDeviceCommand 为设备创建远程命令
+func EnqueueDeviceCommand(deviceID string, req DeviceCommandRequest, operator string) (*model.DeviceCommand, error) {
+	if _, err := GetDevice(deviceID); err != nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	command, err := newDeviceCommand(deviceID, req, operator, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Create(command).Error; err != nil {
+		return nil, fmt.Errorf("failed to create command: %v", err)
+	}
+
+	deviceCommandNotifier.notify(deviceID)
+	return command, nil
+}
+
+// EnqueueGroupCommand 为分组内的每个设备创建远程命令
+func EnqueueGroupCommand(groupID string, req DeviceCommandRequest, operator string) ([]model.DeviceCommand, error) {
+	devices, err := GetDevicesByGroup(groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group devices: %v", err)
+	}
+
+	now := time.Now()
+	commands := make([]model.DeviceCommand, 0, len(devices))
+	for _, device := range devices {
+		command, err := newDeviceCommand(device.ID, req, operator, now)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, *command)
+	}
+	if len(commands) == 0 {
+		return commands, nil
+	}
+
+	if err := database.GetDB().CreateInBatches(commands, logInsertBatchSize).Error; err != nil {
+		return nil, fmt.Errorf("failed to create commands: %v", err)
+	}
+	for _, command := range commands {
+		deviceCommandNotifier.notify(command.DeviceID)
+	}
+	return commands, nil
+}
+
+// PullDeviceCommands 取出设备待执行的命令并标记为已下发
+func PullDeviceCommands(deviceID string) ([]model.DeviceCommand, error) {
+	var commands []model.DeviceCommand
+	now := time.Now()
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("device_id = ? AND status = ? AND expires_at > ?", deviceID, model.DeviceCommandPending, now).
+			Order("create_time ASC").Limit(maxCommandsPerPull).Find(&commands).Error; err != nil {
+			return err
+		}
+		if len(commands) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(commands))
+		for i := range commands {
+			ids[i] = commands[i].ID
+			commands[i].Status = model.DeviceCommandDelivered
+			commands[i].DeliveredAt = &now
+			commands[i].UpdateTime = now
+		}
+		return tx.Model(&model.DeviceCommand{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":       model.DeviceCommandDelivered,
+			"delivered_at": now,
+			"update_time":  now,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull commands: %v", err)
+	}
+	return commands, nil
+}
+
+// WaitDeviceCommands 长轮询拉取命令：没有待执行命令时等待新命令或超时
+func WaitDeviceCommands(ctx context.Context, deviceID string, timeout time.Duration) ([]model.DeviceCommand, error) {
+	// 先注册再查询，避免查询后、等待前创建的命令被漏掉
+	wake, cancel := deviceCommandNotifier.subscribe(deviceID)
+	defer cancel()
+
+	commands, err := PullDeviceCommands(deviceID)
+	if err != nil || len(commands) > 0 || timeout <= 0 {
+		return commands, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-wake:
+		return PullDeviceCommands(deviceID)
+	case <-timer.C:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, nil
+	}
+}
+
+// ReportDeviceCommandResult 记录设备上报的命令执行结果
+func ReportDeviceCommandResult(deviceID, commandID string, status model.DeviceCommandStatus, result json.RawMessage, message string) (*model.DeviceCommand, error) {
+	if status != model.DeviceCommandSucceeded && status != model.DeviceCommandFailed {
+		return nil, fmt.Errorf("%w: result status must be succeeded or failed", ErrInvalidCommand)
+	}
+
+	var command model.DeviceCommand
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND device_id = ?", commandID, deviceID).First(&command).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCommandNotFound
+			}
+			return err
+		}
+		if command.Status.IsFinal() {
+			return ErrCommandFinished
+		}
+		if command.Status != model.DeviceCommandDelivered {
+			return ErrCommandNotDelivered
+		}
+
+		now := time.Now()
+		command.Status = status
+		command.Result = rawJSONString(result)
+		command.ErrorMessage = truncateString(message, maxLogMessageLength)
+		command.CompletedAt = &now
+		command.UpdateTime = now
+		return tx.Save(&command).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+// CancelDeviceCommand 取消尚未完成的命令
+func CancelDeviceCommand(commandID string) (*model.DeviceCommand, error) {
+	command, err := GetDeviceCommand(commandID)
+	if err != nil {
+		return nil, err
+	}
+	if command.Status.IsFinal() {
+		return nil, ErrCommandFinished
+	}
+
+	now := time.Now()
+	res := database.GetDB().Model(&model.DeviceCommand{}).
+		Where("id = ? AND status IN ?", commandID, []model.DeviceCommandStatus{model.DeviceCommandPending, model.DeviceCommandDelivered}).
+		Updates(map[string]interface{}{
+			"status":       model.DeviceCommandCancelled,
+			"completed_at": now,
+			"update_time":  now,
+		})
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to cancel command: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrCommandFinished
+	}
+	return GetDeviceCommand(commandID)
+}
+
+// ExpireDeviceCommands 将超过有效期仍未完成的命令标记为过期，返回过期数量
+func ExpireDeviceCommands() (int64, error) {
+	now := time.Now()
+	res := database.GetDB().Model(&model.DeviceCommand{}).
+		Where("status IN ? AND expires_at <= ?",
+			[]model.DeviceCommandStatus{model.DeviceCommandPending, model.DeviceCommandDelivered}, now).
+		Updates(map[string]interface{}{
+			"status":       model.DeviceCommandExpired,
+			"completed_at": now,
+			"update_time":  now,
+		})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to expire commands: %v", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// GetDeviceCommand 获取命令详情
+func GetDeviceCommand(commandID string) (*model.DeviceCommand, error) {
+	var command model.DeviceCommand
+	if err := database.GetDB().Where("id = ?", commandID).First(&command).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommandNotFound
+		}
+		return nil, fmt.Errorf("failed to get command: %v", err)
+	}
+	return &command, nil
+}
+
+// ListDeviceCommands 分页查询命令，按创建时间倒序
+func ListDeviceCommands(filter DeviceCommandFilter, page, pageSize int) ([]model.DeviceCommand, int64, error) {
+	var commands []model.DeviceCommand
+	var total int64
+
+	query := applyDeviceCommandFilter(database.GetDB().Model(&model.DeviceCommand{}), filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count commands: %v", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("create_time DESC").Offset(offset).Limit(pageSize).Find(&commands).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get commands: %v", err)
+	}
+
+	return commands, total, nil
+}
+
+// CountDeviceCommandsByStatus 按状态统计命令数量
+func CountDeviceCommandsByStatus(filter DeviceCommandFilter) (map[model.DeviceCommandStatus]int64, error) {
+	var rows []struct {
+		Status model.DeviceCommandStatus
+		Count  int64
+	}
+	filter.Status = nil
+	query := applyDeviceCommandFilter(database.GetDB().Model(&model.DeviceCommand{}), filter)
+	if err := query.Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count commands: %v", err)
+	}
+
+	counts := make(map[model.DeviceCommandStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// applyDeviceCommandFilter 为命令查询添加过滤条件
+func applyDeviceCommandFilter(query *gorm.DB, filter DeviceCommandFilter) *gorm.DB {
+	if filter.DeviceID != "" {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.GroupID != "" {
+		query = query.Where("device_id IN (?)",
+			database.GetDB().Model(&model.Device{}).Select("id").Where("group_id = ?", filter.GroupID))
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if len(filter.Status) > 0 {
+		query = query.Where("status IN ?", filter.Status)
+	}
+	return query
+}
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	minConfigHeartbeatRate = 10    // 允许下发的最小心跳间隔（秒）
+	maxConfigHeartbeatRate = 86400 // 允许下发的最大心跳间隔（秒）
+	maxFeatureFlagLength   = 64    // 功能开关名称的最大长度
+)
+
+var (
+	ErrInvalidDeviceConfig   = errors.New("invalid device config")
+	ErrConfigTargetNotFound  = errors.New("config target not found")
+	ErrConfigVersionNotFound = errors.New("config version not found")
+)
+
+// validConfigLogLevels 允许下发的客户端日志级别
+var validConfigLogLevels = map[string]bool{
+	"debug":   true,
+	"info":    true,
+	"warning": true,
+	"error":   true,
+}
+
+// ConfigChange 单个配置字段的变化
+type ConfigChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// EffectiveDeviceConfig 合并分组配置和设备配置后实际下发给设备的配置
+type EffectiveDeviceConfig struct {
+	ETag          string                 `json:"etag"`
+	Config        model.DeviceConfigSpec `json:"config"`
+	DeviceVersion int                    `json:"device_version"`
+	GroupVersion  int                    `json:"group_version"` // 设备所在分组（不含上级分组）的配置版本
+}
+
+// ValidateDeviceConfigSpec 校验配置内容
+func ValidateDeviceConfigSpec(spec *model.DeviceConfigSpec) error {
+	if spec.HeartbeatRate != nil && (*spec.HeartbeatRate < minConfigHeartbeatRate || *spec.HeartbeatRate > maxConfigHeartbeatRate) {
+		return fmt.Errorf("%w: heartbeat_rate must be between %d and %d", ErrInvalidDeviceConfig, minConfigHeartbeatRate, maxConfigHeartbeatRate)
+	}
+	spec.LogLevel = strings.ToLower(strings.TrimSpace(spec.LogLevel))
+	if spec.LogLevel != "" && !validConfigLogLevels[spec.LogLevel] {
+		return fmt.Errorf("%w: unsupported log_level %s", ErrInvalidDeviceConfig, spec.LogLevel)
+	}
+	for name := range spec.FeatureFlags {
+		if strings.TrimSpace(name) == "" || len(name) > maxFeatureFlagLength {
+			return fmt.Errorf("%w: invalid feature flag name %q", ErrInvalidDeviceConfig, name)
+		}
+	}
+	return nil
+}
+
+// MergeDeviceConfig 用override覆盖base中的字段，功能开关按名称合并
+func MergeDeviceConfig(base, override model.DeviceConfigSpec) model.DeviceConfigSpec {
+	merged := model.DeviceConfigSpec{
+		HeartbeatRate: base.HeartbeatRate,
+		LogLevel:      base.LogLevel,
+	}
+	if override.HeartbeatRate != nil {
+		merged.HeartbeatRate = override.HeartbeatRate
+	}
+	if override.LogLevel != "" {
+		merged.LogLevel = override.LogLevel
+	}
+	if len(base.FeatureFlags)+len(override.FeatureFlags) > 0 {
+		merged.FeatureFlags = make(map[string]bool, len(base.FeatureFlags)+len(override.FeatureFlags))
+		for name, enabled := range base.FeatureFlags {
+			merged.FeatureFlags[name] = enabled
+		}
+		for name, enabled := range override.FeatureFlags {
+			merged.FeatureFlags[name] = enabled
+		}
+	}
+	return merged
+}
+
+// DiffDeviceConfig 比较两份配置，返回发生变化的字段，功能开关以 feature_flags.<名称> 表示
+func DiffDeviceConfig(oldSpec, newSpec model.DeviceConfigSpec) map[string]ConfigChange {
+	diff := make(map[string]ConfigChange)
+
+	oldRate, newRate := intValue(oldSpec.HeartbeatRate), intValue(newSpec.HeartbeatRate)
+	if oldRate != newRate {
+		diff["heartbeat_rate"] = ConfigChange{Old: oldRate, New: newRate}
+	}
+	if oldSpec.LogLevel != newSpec.LogLevel {
+		diff["log_level"] = ConfigChange{Old: oldSpec.LogLevel, New: newSpec.LogLevel}
+	}
+	for name, enabled := range newSpec.FeatureFlags {
+		if prev, ok := oldSpec.FeatureFlags[name]; !ok || prev != enabled {
+			var oldValue interface{}
+			if ok {
+				oldValue = prev
+			}
+			diff["feature_flags."+name] = ConfigChange{Old: oldValue, New: enabled}
+		}
+	}
+	for name, enabled := range oldSpec.FeatureFlags {
+		if _, ok := newSpec.FeatureFlags[name]; !ok {
+			diff["feature_flags."+name] = ConfigChange{Old: enabled, New: nil}
+		}
+	}
+	return diff
+}
+
+// DeviceConfigETag 计算配置内容的版本标识，内容相同时结果相同
+func DeviceConfigETag(spec model.DeviceConfigSpec) string {
+	// encoding/json按键排序输出map，保证结果稳定
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// intValue 取指针的值，nil时返回nil
+func intValue(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// parseDeviceConfigSpec 解析保存的配置JSON，空字符串视为空配置
+func parseDeviceConfigSpec(data string) (model.DeviceConfigSpec, error) {
+	var spec model.DeviceConfigSpec
+	if data == "" {
+		return spec, nil
+	}
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return spec, fmt.Errorf("failed to parse device config: %v", err)
+	}
+	return spec, nil
+}
+
+// checkConfigTarget 检查配置作用对象是否存在
+func checkConfigTarget(target model.DeviceConfigTarget, targetID string) error {
+	var count int64
+	var err error
+	switch target {
+	case model.DeviceConfigTargetDevice:
+		err = database.GetDB().Model(&model.Device{}).Where("id = ?", targetID).Count(&count).Error
+	case model.DeviceConfigTargetGroup:
+		err = database.GetDB().Model(&model.DeviceGroup{}).Where("id = ?", targetID).Count(&count).Error
+	default:
+		return fmt.Errorf("%w: unsupported target %s", ErrInvalidDeviceConfig, target)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check config target: %v", err)
+	}
+	if count == 0 {
+		return ErrConfigTargetNotFound
+	}
+	return nil
+}
+
+// GetDeviceConfig 获取设备或分组的期望配置，未设置时返回版本为0的空配置
+func GetDeviceConfig(target model.DeviceConfigTarget, targetID string) (*model.DeviceConfig, error) {
+	if err := checkConfigTarget(target, targetID); err != nil {
+		return nil, err
+	}
+	return findDeviceConfig(database.GetDB(), target, targetID)
+}
+
+// findDeviceConfig 查询期望配置，未设置时返回版本为0的空配置
+func findDeviceConfig(db *gorm.DB, target model.DeviceConfigTarget, targetID string) (*model.DeviceConfig, error) {
+	var cfg model.DeviceConfig
+	err := db.Where("target_type = ? AND target_id = ?", target, targetID).First(&cfg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.DeviceConfig{TargetType: target, TargetID: targetID, Config: "{}"}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device config: %v", err)
+	}
+	return &cfg, nil
+}
+
+// SetDeviceConfig 设置设备或分组的期望配置，内容有变化时版本加一并记录历史
+func SetDeviceConfig(target model.DeviceConfigTarget, targetID string, spec model.DeviceConfigSpec, operator, reason string) (*model.DeviceConfig, error) {
+	return setDeviceConfig(target, targetID, spec, operator, reason, nil)
+}
+
+// setDeviceConfig 设置期望配置，metadata记录到配置历史
+func setDeviceConfig(target model.DeviceConfigTarget, targetID string, spec model.DeviceConfigSpec, operator, reason string, metadata map[string]interface{}) (*model.DeviceConfig, error) {
+	if err := ValidateDeviceConfigSpec(&spec); err != nil {
+		return nil, err
+	}
+	if err := checkConfigTarget(target, targetID); err != nil {
+		return nil, err
+	}
+
+	var result *model.DeviceConfig
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = saveDeviceConfigTx(tx, target, targetID, func(model.DeviceConfigSpec) model.DeviceConfigSpec {
+			return spec
+		}, operator, reason, metadata)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// saveDeviceConfigTx 在事务内根据当前配置生成新配置并保存，配置未变化时不产生新版本
+func saveDeviceConfigTx(tx *gorm.DB, target model.DeviceConfigTarget, targetID string, update func(current model.DeviceConfigSpec) model.DeviceConfigSpec, operator, reason string, metadata map[string]interface{}) (*model.DeviceConfig, error) {
+	current, err := findDeviceConfig(tx.Clauses(clause.Locking{Strength: "UPDATE"}), target, targetID)
+	if err != nil {
+		return nil, err
+	}
+	oldSpec, err := parseDeviceConfigSpec(current.Config)
+	if err != nil {
+		return nil, err
+	}
+	spec := update(oldSpec)
+	if err := ValidateDeviceConfigSpec(&spec); err != nil {
+		return nil, err
+	}
+
+	diff := DiffDeviceConfig(oldSpec, spec)
+	if len(diff) == 0 {
+		return current, nil
+	}
+	newValue, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal device config: %v", err)
+	}
+	diffData, err := json.Marshal(diff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config diff: %v", err)
+	}
+	metaData := ""
+	if len(metadata) > 0 {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config metadata: %v", err)
+		}
+		metaData = string(data)
+	}
+
+	now := time.Now()
+	oldValue := ""
+	if current.Version > 0 {
+		oldValue = current.Config
+	}
+	if current.ID == "" {
+		current.ID = utils.GenerateUUID()
+	}
+	current.Version++
+	current.Config = string(newValue)
+	current.UpdateTime = now
+	current.UpdatedBy = operator
+	if err := tx.Save(current).Error; err != nil {
+		return nil, fmt.Errorf("failed to save device config: %v", err)
+	}
+
+	if err := tx.Create(&model.DeviceConfigHistory{
+		ID:         utils.GenerateUUID(),
+		DeviceID:   targetID,
+		ConfigType: string(target),
+		Version:    current.Version,
+		OldValue:   oldValue,
+		NewValue:   string(newValue),
+		Diff:       string(diffData),
+		Reason:     reason,
+		Metadata:   metaData,
+		CreateTime: now,
+		CreatedBy:  operator,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to record config history: %v", err)
+	}
+	return current, nil
+}
+
+// RollbackDeviceConfig 将配置恢复为指定历史版本的内容，回滚本身作为新版本记录
+func RollbackDeviceConfig(target model.DeviceConfigTarget, targetID string, version int, operator, reason string) (*model.DeviceConfig, error) {
+	var history model.DeviceConfigHistory
+	err := database.GetDB().Where("config_type = ? AND device_id = ? AND version = ?", target, targetID, version).
+		First(&history).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrConfigVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config history: %v", err)
+	}
+
+	spec, err := parseDeviceConfigSpec(history.NewValue)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("回滚到版本 %d", version)
+	}
+	return setDeviceConfig(target, targetID, spec, operator, reason, map[string]interface{}{
+		"rollback_to": version,
+	})
+}
+
+// GetDeviceConfigHistory 分页获取配置变更历史，按版本倒序
+func GetDeviceConfigHistory(target model.DeviceConfigTarget, targetID string, page, pageSize int) ([]model.DeviceConfigHistory, int64, error) {
+	var history []model.DeviceConfigHistory
+	var total int64
+
+	query := database.GetDB().Model(&model.DeviceConfigHistory{}).
+		Where("config_type = ? AND device_id = ?", target, targetID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count config history: %v", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("version DESC").Offset(offset).Limit(pageSize).Find(&history).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get config history: %v", err)
+	}
+
+	return history, total, nil
+}
+
+// GetEffectiveDeviceConfig 计算设备实际生效的配置：分组配置被设备配置覆盖，心跳间隔未配置时取自设备策略
+func GetEffectiveDeviceConfig(deviceID string) (*EffectiveDeviceConfig, error) {
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	effective := &EffectiveDeviceConfig{}
+	if device.GroupID != "" {
+		// 从顶级分组开始逐级合并，下级分组覆盖上级分组
+		groups, err := groupAncestors(device.GroupID)
+		if err != nil && !errors.Is(err, ErrGroupNotFound) {
+			return nil, err
+		}
+		for _, group := range groups {
+			groupConfig, err := findDeviceConfig(database.GetDB(), model.DeviceConfigTargetGroup, group.ID)
+			if err != nil {
+				return nil, err
+			}
+			spec, err := parseDeviceConfigSpec(groupConfig.Config)
+			if err != nil {
+				return nil, err
+			}
+			effective.Config = MergeDeviceConfig(effective.Config, spec)
+			if group.ID == device.GroupID {
+				effective.GroupVersion = groupConfig.Version
+			}
+		}
+	}
+
+	deviceConfig, err := findDeviceConfig(database.GetDB(), model.DeviceConfigTargetDevice, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := parseDeviceConfigSpec(deviceConfig.Config)
+	if err != nil {
+		return nil, err
+	}
+	effective.Config = MergeDeviceConfig(effective.Config, spec)
+	effective.DeviceVersion = deviceConfig.Version
+
+	// 配置未指定心跳间隔时使用分组策略中的心跳间隔
+	if effective.Config.HeartbeatRate == nil {
+		policy, err := effectiveDevicePolicy(device)
+		if err != nil {
+			return nil, err
+		}
+		effective.Config.HeartbeatRate = policy.Policy.HeartbeatRate
+	}
+	effective.ETag = DeviceConfigETag(effective.Config)
+
+	return effective, nil
+}
+
+// AcknowledgeDeviceConfig 记录设备应用配置的结果
+//
+// 设备确认已应用当前生效的配置时，同步设备的心跳间隔，使离线检测使用新的间隔。
+func AcknowledgeDeviceConfig(deviceID, etag string, status model.DeviceConfigAckStatus, message string) (*model.DeviceConfigState, error) {
+	if etag == "" {
+		return nil, fmt.Errorf("%w: etag is required", ErrInvalidDeviceConfig)
+	}
+	if status == "" {
+		status = model.DeviceConfigAckApplied
+	}
+	if status != model.DeviceConfigAckApplied && status != model.DeviceConfigAckFailed {
+		return nil, fmt.Errorf("%w: unsupported ack status %s", ErrInvalidDeviceConfig, status)
+	}
+
+	effective, err := GetEffectiveDeviceConfig(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	state := &model.DeviceConfigState{
+		DeviceID:   deviceID,
+		ETag:       etag,
+		Status:     status,
+		Message:    truncateString(message, maxLogMessageLength),
+		AckTime:    now,
+		UpdateTime: now,
+	}
+	if err := database.GetDB().Save(state).Error; err != nil {
+		return nil, fmt.Errorf("failed to save config state: %v", err)
+	}
+
+	if status == model.DeviceConfigAckApplied && etag == effective.ETag && effective.Config.HeartbeatRate != nil {
+		if err := database.GetDB().Model(&model.Device{}).Where("id = ?", deviceID).
+			Update("heartbeat_rate", *effective.Config.HeartbeatRate).Error; err != nil {
+			return nil, fmt.Errorf("failed to update heartbeat rate: %v", err)
+		}
+	}
+
+	return state, nil
+}
+
+// GetDeviceConfigState 获取设备最近一次确认的配置，从未确认时返回nil
+func GetDeviceConfigState(deviceID string) (*model.DeviceConfigState, error) {
+	var state model.DeviceConfigState
+	err := database.GetDB().Where("device_id = ?", deviceID).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config state: %v", err)
+	}
+	return &state, nil
+}
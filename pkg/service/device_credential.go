@@ -0,0 +1,371 @@
+package service
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// deviceSecretLength 设备密钥长度（字节）
+const deviceSecretLength = 32
+
+var (
+	ErrCredentialNotFound   = errors.New("device credential not found")
+	ErrCredentialUnusable   = errors.New("device credential is revoked or expired")
+	ErrInvalidSignature     = errors.New("invalid request signature")
+	ErrSignatureExpired     = errors.New("request timestamp out of range")
+	ErrNonceReused          = errors.New("request nonce already used")
+	ErrInvalidFingerprint   = errors.New("invalid certificate fingerprint")
+	ErrUnsupportedOperation = errors.New("operation not supported for this credential type")
+)
+
+// nonceCache 已使用的请求随机数，用于防重放
+var nonceCache = &usedNonces{entries: make(map[string]time.Time)}
+
+// usedNonces 带过期时间的随机数集合
+type usedNonces struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	lastGC  time.Time
+}
+
+// claim 记录随机数，已存在且未过期时返回false
+func (n *usedNonces) claim(key string, now time.Time, ttl time.Duration) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if now.Sub(n.lastGC) > ttl {
+		for k, expires := range n.entries {
+			if now.After(expires) {
+				delete(n.entries, k)
+			}
+		}
+		n.lastGC = now
+	}
+
+	if expires, ok := n.entries[key]; ok && now.Before(expires) {
+		return false
+	}
+	n.entries[key] = now.Add(ttl)
+	return true
+}
+
+// IssueDeviceCredential 为设备签发密钥凭证，返回凭证记录和明文密钥
+func IssueDeviceCredential(deviceID string) (*model.DeviceCredential, string, error) {
+	return issueDeviceCredentialTx(database.GetDB(), deviceID)
+}
+
+// issueDeviceCredentialTx 在事务内签发密钥凭证
+func issueDeviceCredentialTx(tx *gorm.DB, deviceID string) (*model.DeviceCredential, string, error) {
+	secretBytes, err := utils.GenerateRandomBytes(deviceSecretLength)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate device secret: %v", err)
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	encrypted, err := utils.EncryptAES([]byte(secret))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encrypt device secret: %v", err)
+	}
+
+	now := time.Now()
+	credential := &model.DeviceCredential{
+		ID:        utils.GenerateUUID(),
+		DeviceID:  deviceID,
+		Type:      model.DeviceCredentialTypeSecret,
+		Secret:    encrypted,
+		Status:    model.DeviceCredentialStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := tx.Create(credential).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create device credential: %v", err)
+	}
+
+	return credential, secret, nil
+}
+
+// ReissueDeviceCredential 吊销设备已有的密钥凭证并签发新密钥，证书凭证保持不变
+//
+// 设备重新注册时使用，保证每台设备只有一个有效的注册密钥。
+func ReissueDeviceCredential(deviceID, revokedBy string) (*model.DeviceCredential, string, error) {
+	var credential *model.DeviceCredential
+	var secret string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		credential, secret, err = reissueDeviceCredentialTx(tx, deviceID, revokedBy)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return credential, secret, nil
+}
+
+// reissueDeviceCredentialTx 在事务内吊销设备已有的密钥凭证并签发新密钥
+func reissueDeviceCredentialTx(tx *gorm.DB, deviceID, revokedBy string) (*model.DeviceCredential, string, error) {
+	now := time.Now()
+	if err := tx.Model(&model.DeviceCredential{}).
+		Where("device_id = ? AND type = ? AND status = ?", deviceID,
+			model.DeviceCredentialTypeSecret, model.DeviceCredentialStatusActive).
+		Updates(map[string]interface{}{
+			"status":     model.DeviceCredentialStatusRevoked,
+			"revoked_at": now,
+			"revoked_by": revokedBy,
+			"updated_at": now,
+		}).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to revoke device credentials: %v", err)
+	}
+	return issueDeviceCredentialTx(tx, deviceID)
+}
+
+// RegisterDeviceCertificate 为设备登记客户端证书指纹
+func RegisterDeviceCertificate(deviceID, fingerprint string) (*model.DeviceCredential, error) {
+	fingerprint = NormalizeFingerprint(fingerprint)
+	if len(fingerprint) != sha256.Size*2 {
+		return nil, ErrInvalidFingerprint
+	}
+	if _, err := hex.DecodeString(fingerprint); err != nil {
+		return nil, ErrInvalidFingerprint
+	}
+
+	if _, err := GetDevice(deviceID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	credential := &model.DeviceCredential{
+		ID:          utils.GenerateUUID(),
+		DeviceID:    deviceID,
+		Type:        model.DeviceCredentialTypeCertificate,
+		Fingerprint: fingerprint,
+		Status:      model.DeviceCredentialStatusActive,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := database.GetDB().Create(credential).Error; err != nil {
+		return nil, fmt.Errorf("failed to create device credential: %v", err)
+	}
+
+	return credential, nil
+}
+
+// GetDeviceCredential 获取设备的指定凭证
+func GetDeviceCredential(deviceID, credentialID string) (*model.DeviceCredential, error) {
+	var credential model.DeviceCredential
+	if err := database.GetDB().Where("id = ? AND device_id = ?", credentialID, deviceID).
+		First(&credential).Error; err != nil {
+		return nil, ErrCredentialNotFound
+	}
+	return &credential, nil
+}
+
+// ListDeviceCredentials 获取设备的所有凭证
+func ListDeviceCredentials(deviceID string) ([]model.DeviceCredential, error) {
+	var credentials []model.DeviceCredential
+	if err := database.GetDB().Where("device_id = ?", deviceID).
+		Order("created_at DESC").Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device credentials: %v", err)
+	}
+	return credentials, nil
+}
+
+// RotateDeviceCredential 轮换密钥凭证，旧凭证在宽限期后失效
+func RotateDeviceCredential(deviceID, credentialID string) (*model.DeviceCredential, string, error) {
+	old, err := GetDeviceCredential(deviceID, credentialID)
+	if err != nil {
+		return nil, "", err
+	}
+	if old.Type != model.DeviceCredentialTypeSecret {
+		return nil, "", ErrUnsupportedOperation
+	}
+	if !old.IsUsable(time.Now()) {
+		return nil, "", ErrCredentialUnusable
+	}
+
+	credential, secret, err := IssueDeviceCredential(deviceID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	expiresAt := time.Now().Add(config.GetConfig().Device.CredentialRotationGrace)
+	if err := database.GetDB().Model(old).Updates(map[string]interface{}{
+		"expires_at": expiresAt,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to expire old credential: %v", err)
+	}
+
+	return credential, secret, nil
+}
+
+// RevokeDeviceCredential 吊销设备凭证
+func RevokeDeviceCredential(deviceID, credentialID, revokedBy string) error {
+	credential, err := GetDeviceCredential(deviceID, credentialID)
+	if err != nil {
+		return err
+	}
+	if credential.Status == model.DeviceCredentialStatusRevoked {
+		return nil
+	}
+
+	now := time.Now()
+	return database.GetDB().Model(credential).Updates(map[string]interface{}{
+		"status":     model.DeviceCredentialStatusRevoked,
+		"revoked_at": now,
+		"revoked_by": revokedBy,
+		"updated_at": now,
+	}).Error
+}
+
+// RevokeAllDeviceCredentials 吊销设备的全部有效凭证
+func RevokeAllDeviceCredentials(deviceID, revokedBy string) error {
+	now := time.Now()
+	return database.GetDB().Model(&model.DeviceCredential{}).
+		Where("device_id = ? AND status = ?", deviceID, model.DeviceCredentialStatusActive).
+		Updates(map[string]interface{}{
+			"status":     model.DeviceCredentialStatusRevoked,
+			"revoked_at": now,
+			"revoked_by": revokedBy,
+			"updated_at": now,
+		}).Error
+}
+
+// SignDeviceRequest 计算设备请求签名
+//
+// 待签名字符串为：METHOD\nURI\nTIMESTAMP\nNONCE\nhex(sha256(body))，其中URI包含查询参数，
+// 签名为使用设备密钥计算的HMAC-SHA256十六进制值。
+func SignDeviceRequest(secret, method, uri, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	payload := strings.Join([]string{
+		strings.ToUpper(method),
+		uri,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeviceSignedRequest 设备签名请求的认证参数
+type DeviceSignedRequest struct {
+	DeviceID     string
+	CredentialID string
+	Timestamp    string
+	Nonce        string
+	Signature    string
+	Method       string
+	URI          string
+	Body         []byte
+}
+
+// AuthenticateDeviceRequest 校验设备HMAC签名请求
+func AuthenticateDeviceRequest(req *DeviceSignedRequest) (*model.DeviceCredential, error) {
+	now := time.Now()
+	maxSkew := config.GetConfig().Device.SignatureMaxSkew
+
+	ts, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrSignatureExpired
+	}
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return nil, ErrSignatureExpired
+	}
+	if req.Nonce == "" {
+		return nil, ErrInvalidSignature
+	}
+
+	credential, err := GetDeviceCredential(req.DeviceID, req.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	if credential.Type != model.DeviceCredentialTypeSecret {
+		return nil, ErrUnsupportedOperation
+	}
+	if !credential.IsUsable(now) {
+		return nil, ErrCredentialUnusable
+	}
+
+	secret, err := utils.DecryptAES(credential.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt device secret: %v", err)
+	}
+
+	expected := SignDeviceRequest(string(secret), req.Method, req.URI, req.Timestamp, req.Nonce, req.Body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.Signature))) {
+		return nil, ErrInvalidSignature
+	}
+
+	// 签名通过后再登记随机数，避免伪造请求占用合法随机数
+	if !nonceCache.claim(credential.ID+":"+req.Nonce, now, 2*maxSkew) {
+		return nil, ErrNonceReused
+	}
+
+	if err := activateDeviceForAuth(credential, now); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// AuthenticateDeviceCertificate 使用客户端证书指纹认证设备
+func AuthenticateDeviceCertificate(deviceID, fingerprint string) (*model.DeviceCredential, error) {
+	now := time.Now()
+
+	var credential model.DeviceCredential
+	if err := database.GetDB().Where("device_id = ? AND type = ? AND fingerprint = ?",
+		deviceID, model.DeviceCredentialTypeCertificate, NormalizeFingerprint(fingerprint)).
+		First(&credential).Error; err != nil {
+		return nil, ErrCredentialNotFound
+	}
+	if !credential.IsUsable(now) {
+		return nil, ErrCredentialUnusable
+	}
+
+	if err := activateDeviceForAuth(&credential, now); err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// activateDeviceForAuth 确认设备可用并记录凭证使用时间
+func activateDeviceForAuth(credential *model.DeviceCredential, now time.Time) error {
+	device, err := GetDevice(credential.DeviceID)
+	if err != nil {
+		return err
+	}
+	if IsDeviceBlocked(device) {
+		return ErrDeviceBlocked
+	}
+
+	return database.GetDB().Model(credential).Update("last_used_at", now).Error
+}
+
+// NormalizeFingerprint 统一证书指纹格式（去除冒号并转为小写）
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", "")
+	return strings.ToLower(fingerprint)
+}
+
+// CertificateFingerprint 计算DER编码证书的SHA-256指纹
+func CertificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,619 @@
+package service
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDuplicateThreshold = 0.5
+	maxDuplicateBucket        = 20 // 同一取值的设备超过该数量时视为通用值，不作为相似依据
+	duplicateIPLookback       = 30 * 24 * time.Hour
+	maxMergeDevices           = 50
+)
+
+var (
+	ErrDuplicateNotFound = errors.New("duplicate candidate not found")
+	ErrInvalidMerge      = errors.New("invalid device merge")
+)
+
+// 相似项及其权重，设备对的相似度为命中项权重之和（最大为1）
+const (
+	duplicateSignalDiskID      = "disk_id"
+	duplicateSignalMotherboard = "motherboard"
+	duplicateSignalBIOS        = "bios"
+	duplicateSignalMAC         = "mac"
+	duplicateSignalLicense     = "license"
+	duplicateSignalIP          = "ip"
+)
+
+var duplicateSignalWeights = map[string]float64{
+	duplicateSignalDiskID:      0.4,
+	duplicateSignalMotherboard: 0.3,
+	duplicateSignalBIOS:        0.1,
+	duplicateSignalMAC:         0.3,
+	duplicateSignalLicense:     0.2,
+	duplicateSignalIP:          0.1,
+}
+
+// placeholderHardwareValues 主板厂商常用的占位值，不能用于识别设备
+var placeholderHardwareValues = map[string]bool{
+	"":                       true,
+	"0":                      true,
+	"none":                   true,
+	"unknown":                true,
+	"default string":         true,
+	"to be filled by o.e.m.": true,
+	"system serial number":   true,
+	"not applicable":         true,
+}
+
+// DuplicateDetectionResult 重复设备检测结果
+type DuplicateDetectionResult struct {
+	Devices    int `json:"devices"`    // 参与检测的设备数
+	Candidates int `json:"candidates"` // 相似度达到阈值的设备对数
+}
+
+// DuplicateCluster 相互疑似重复的一组设备
+type DuplicateCluster struct {
+	DeviceIDs []string                `json:"device_ids"`
+	Devices   []model.Device          `json:"devices"`
+	Pairs     []model.DeviceDuplicate `json:"pairs"`
+	Score     float64                 `json:"score"` // 组内最高相似度
+}
+
+// DeviceMergeResult 设备合并结果
+type DeviceMergeResult struct {
+	SurvivorID string           `json:"survivor_id"`
+	MergedIDs  []string         `json:"merged_ids"`
+	Moved      map[string]int64 `json:"moved"` // 各类记录转移到保留设备的条数
+}
+
+// duplicatePair 按字典序排列的设备对
+type duplicatePair [2]string
+
+func newDuplicatePair(a, b string) duplicatePair {
+	if a > b {
+		a, b = b, a
+	}
+	return duplicatePair{a, b}
+}
+
+// DetectDuplicateDevices 按硬件信息、网卡MAC、授权绑定和近期IP检测疑似重复的设备
+//
+// 仅比较至少一项取值相同的设备；已忽略或已合并的设备对不会再次检出，不再满足阈值的待审核记录会被移除。
+func DetectDuplicateDevices() (*DuplicateDetectionResult, error) {
+	startedAt := time.Now()
+	threshold := config.GetConfig().Device.DuplicateScoreThreshold
+	if threshold <= 0 {
+		threshold = defaultDuplicateThreshold
+	}
+
+	var devices []model.Device
+	if err := database.GetDB().Select("id", "disk_id", "bios", "motherboard", "network_cards").
+		Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to get devices: %v", err)
+	}
+	buckets, err := duplicateBuckets(devices, startedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	signals := make(map[duplicatePair]map[string]bool)
+	for signal, values := range buckets {
+		for _, ids := range values {
+			ids = uniqueStrings(ids)
+			if len(ids) < 2 || len(ids) > maxDuplicateBucket {
+				continue
+			}
+			for i := 0; i < len(ids); i++ {
+				for j := i + 1; j < len(ids); j++ {
+					pair := newDuplicatePair(ids[i], ids[j])
+					if signals[pair] == nil {
+						signals[pair] = make(map[string]bool)
+					}
+					signals[pair][signal] = true
+				}
+			}
+		}
+	}
+
+	result := &DuplicateDetectionResult{Devices: len(devices)}
+	for pair, hits := range signals {
+		score, reasons := duplicateScore(hits)
+		if score < threshold {
+			continue
+		}
+		if err := saveDuplicateCandidate(pair, score, reasons, startedAt); err != nil {
+			return nil, err
+		}
+		result.Candidates++
+	}
+
+	if err := database.GetDB().Where("status = ? AND detected_at < ?", model.DuplicateStatusPending, startedAt).
+		Delete(&model.DeviceDuplicate{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove stale duplicate candidates: %v", err)
+	}
+	return result, nil
+}
+
+// duplicateBuckets 按相似项和取值对设备分桶
+func duplicateBuckets(devices []model.Device, now time.Time) (map[string]map[string][]string, error) {
+	buckets := map[string]map[string][]string{
+		duplicateSignalDiskID:      {},
+		duplicateSignalMotherboard: {},
+		duplicateSignalBIOS:        {},
+		duplicateSignalMAC:         {},
+		duplicateSignalLicense:     {},
+		duplicateSignalIP:          {},
+	}
+	add := func(signal, value, deviceID string) {
+		buckets[signal][value] = append(buckets[signal][value], deviceID)
+	}
+
+	exists := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		exists[device.ID] = true
+		for signal, value := range map[string]string{
+			duplicateSignalDiskID:      device.DiskID,
+			duplicateSignalMotherboard: device.Motherboard,
+			duplicateSignalBIOS:        device.BIOS,
+		} {
+			if value = normalizeHardwareValue(value); value != "" {
+				add(signal, value, device.ID)
+			}
+		}
+		for _, mac := range deviceMACAddresses(device.NetworkCards) {
+			if mac != "00:00:00:00:00:00" {
+				add(duplicateSignalMAC, mac, device.ID)
+			}
+		}
+	}
+
+	var bindings []struct {
+		DeviceID string
+		Value    string
+	}
+	db := database.GetDB()
+	queries := []struct {
+		signal string
+		query  *gorm.DB
+	}{
+		{duplicateSignalLicense, db.Model(&model.License{}).Select("device_id, id AS value").Where("device_id <> ''")},
+		{duplicateSignalLicense, db.Model(&model.LicenseUsage{}).Select("DISTINCT device_id, license_id AS value").Where("device_id <> ''")},
+		{duplicateSignalIP, db.Model(&model.DeviceLocation{}).Select("DISTINCT device_id, ip AS value").
+			Where("ip <> '' AND created_at >= ?", now.Add(-duplicateIPLookback))},
+		{duplicateSignalIP, db.Model(&model.DeviceActivity{}).Select("DISTINCT device_id, ip_address AS value").
+			Where("ip_address <> '' AND create_time >= ?", now.Add(-duplicateIPLookback))},
+	}
+	for _, q := range queries {
+		bindings = bindings[:0]
+		if err := q.query.Scan(&bindings).Error; err != nil {
+			return nil, fmt.Errorf("failed to get device %s bindings: %v", q.signal, err)
+		}
+		for _, binding := range bindings {
+			if exists[binding.DeviceID] {
+				add(q.signal, binding.Value, binding.DeviceID)
+			}
+		}
+	}
+	return buckets, nil
+}
+
+// normalizeHardwareValue 统一硬件信息格式，占位值返回空字符串
+func normalizeHardwareValue(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if placeholderHardwareValues[value] {
+		return ""
+	}
+	return value
+}
+
+// duplicateScore 计算相似度，返回分数和按名称排序的命中项
+func duplicateScore(hits map[string]bool) (float64, []string) {
+	var score float64
+	reasons := make([]string, 0, len(hits))
+	for signal := range hits {
+		score += duplicateSignalWeights[signal]
+		reasons = append(reasons, signal)
+	}
+	sort.Strings(reasons)
+	// 避免浮点累加误差影响阈值比较
+	return math.Min(math.Round(score*100)/100, 1), reasons
+}
+
+// saveDuplicateCandidate 保存或刷新待审核的设备对，已处理的设备对保持不变
+func saveDuplicateCandidate(pair duplicatePair, score float64, reasons []string, now time.Time) error {
+	var candidate model.DeviceDuplicate
+	err := database.GetDB().Where("device_id = ? AND duplicate_id = ?", pair[0], pair[1]).First(&candidate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		candidate = model.DeviceDuplicate{
+			ID:          utils.GenerateUUID(),
+			DeviceID:    pair[0],
+			DuplicateID: pair[1],
+			Status:      model.DuplicateStatusPending,
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get duplicate candidate: %v", err)
+	} else if candidate.Status != model.DuplicateStatusPending {
+		return nil
+	}
+
+	candidate.Score = score
+	candidate.Reasons = strings.Join(reasons, ",")
+	candidate.DetectedAt = now
+	if err := database.GetDB().Save(&candidate).Error; err != nil {
+		return fmt.Errorf("failed to save duplicate candidate: %v", err)
+	}
+	return nil
+}
+
+// ListDuplicateClusters 获取待审核的疑似重复设备，相互关联的设备对合并为一组，按最高相似度降序分页
+func ListDuplicateClusters(page, pageSize int) ([]DuplicateCluster, int, error) {
+	var pairs []model.DeviceDuplicate
+	if err := database.GetDB().Where("status = ?", model.DuplicateStatusPending).
+		Order("score DESC").Find(&pairs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get duplicate candidates: %v", err)
+	}
+
+	clusters := clusterDuplicates(pairs)
+	total := len(clusters)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []DuplicateCluster{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	clusters = clusters[start:end]
+
+	for i := range clusters {
+		if err := database.GetDB().Where("id IN ?", clusters[i].DeviceIDs).
+			Order("created_at ASC").Find(&clusters[i].Devices).Error; err != nil {
+			return nil, 0, fmt.Errorf("failed to get duplicate devices: %v", err)
+		}
+	}
+	return clusters, total, nil
+}
+
+// clusterDuplicates 按设备对的连通关系分组，结果按最高相似度降序
+func clusterDuplicates(pairs []model.DeviceDuplicate) []DuplicateCluster {
+	parent := make(map[string]string)
+	var find func(id string) string
+	find = func(id string) string {
+		if parent[id] == "" || parent[id] == id {
+			parent[id] = id
+			return id
+		}
+		root := find(parent[id])
+		parent[id] = root
+		return root
+	}
+	for _, pair := range pairs {
+		a, b := find(pair.DeviceID), find(pair.DuplicateID)
+		if a != b {
+			parent[b] = a
+		}
+	}
+
+	byRoot := make(map[string]*DuplicateCluster)
+	var roots []string
+	for _, pair := range pairs {
+		root := find(pair.DeviceID)
+		cluster := byRoot[root]
+		if cluster == nil {
+			cluster = &DuplicateCluster{}
+			byRoot[root] = cluster
+			roots = append(roots, root)
+		}
+		cluster.Pairs = append(cluster.Pairs, pair)
+		if pair.Score > cluster.Score {
+			cluster.Score = pair.Score
+		}
+	}
+
+	clusters := make([]DuplicateCluster, 0, len(roots))
+	for _, root := range roots {
+		cluster := byRoot[root]
+		ids := make([]string, 0, len(cluster.Pairs)*2)
+		for _, pair := range cluster.Pairs {
+			ids = append(ids, pair.DeviceID, pair.DuplicateID)
+		}
+		cluster.DeviceIDs = uniqueStrings(ids)
+		sort.Strings(cluster.DeviceIDs)
+		clusters = append(clusters, *cluster)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].Score > clusters[j].Score
+	})
+	return clusters
+}
+
+// DismissDuplicate 将待审核的设备对标记为不是重复设备
+func DismissDuplicate(id, operator string) (*model.DeviceDuplicate, error) {
+	var candidate model.DeviceDuplicate
+	if err := database.GetDB().Where("id = ?", id).First(&candidate).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDuplicateNotFound
+		}
+		return nil, fmt.Errorf("failed to get duplicate candidate: %v", err)
+	}
+	if candidate.Status != model.DuplicateStatusPending {
+		return nil, fmt.Errorf("%w: candidate is already %s", ErrInvalidMerge, candidate.Status)
+	}
+
+	now := time.Now()
+	candidate.Status = model.DuplicateStatusDismissed
+	candidate.ReviewedAt = &now
+	candidate.ReviewedBy = operator
+	if err := database.GetDB().Save(&candidate).Error; err != nil {
+		return nil, fmt.Errorf("failed to dismiss duplicate candidate: %v", err)
+	}
+	return &candidate, nil
+}
+
+// deviceMergeTables 合并时转移到保留设备的记录
+var deviceMergeTables = []struct {
+	name  string
+	model interface{}
+}{
+	{"licenses", &model.License{}},
+	{"license_usages", &model.LicenseUsage{}},
+	{"alerts", &model.Alert{}},
+	{"logs", &model.DeviceLog{}},
+	{"activities", &model.DeviceActivity{}},
+	{"locations", &model.DeviceLocation{}},
+	{"abnormal_behaviors", &model.AbnormalBehavior{}},
+	{"usage_records", &model.UsageRecord{}},
+	{"block_history", &model.DeviceBlockHistory{}},
+	{"status_history", &model.DeviceStatusHistory{}},
+	{"maintenance", &model.DeviceMaintenance{}},
+}
+
+// MergeDevices 将重复设备的授权、告警、日志、位置和异常行为等记录转移到保留设备，并软删除重复设备
+//
+// 重复设备的标签合并到保留设备，保留设备的最后活动时间取各设备的最大值，受影响周期的使用汇总在同一事务中重新计算。
+// 重复设备的凭证被吊销，未完成的命令和维护窗口被取消，设备级配置和策略被删除，保留设备的配置和策略不变。
+func MergeDevices(survivorID string, duplicateIDs []string, operator string) (*DeviceMergeResult, error) {
+	duplicateIDs = uniqueStrings(duplicateIDs)
+	if len(duplicateIDs) == 0 || len(duplicateIDs) > maxMergeDevices {
+		return nil, fmt.Errorf("%w: between 1 and %d device ids are required", ErrInvalidMerge, maxMergeDevices)
+	}
+	for _, id := range duplicateIDs {
+		if id == survivorID {
+			return nil, fmt.Errorf("%w: survivor cannot be merged into itself", ErrInvalidMerge)
+		}
+	}
+	survivor, err := GetDevice(survivorID)
+	if err != nil {
+		return nil, ErrDeviceNotFound
+	}
+	var duplicates []model.Device
+	if err := database.GetDB().Where("id IN ?", duplicateIDs).Find(&duplicates).Error; err != nil {
+		return nil, fmt.Errorf("failed to get devices: %v", err)
+	}
+	if len(duplicates) != len(duplicateIDs) {
+		return nil, ErrDeviceNotFound
+	}
+
+	result := &DeviceMergeResult{
+		SurvivorID: survivorID,
+		MergedIDs:  duplicateIDs,
+		Moved:      make(map[string]int64, len(deviceMergeTables)),
+	}
+	now := time.Now()
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 重复设备的会话随设备一起结束，不再由心跳延长
+		if err := tx.Model(&model.UsageRecord{}).Where("device_id IN ? AND active = ?", duplicateIDs, true).
+			Update("active", false).Error; err != nil {
+			return fmt.Errorf("failed to end duplicate sessions: %v", err)
+		}
+		if err := retireDuplicateDevices(tx, duplicateIDs, operator, now); err != nil {
+			return err
+		}
+		periods, err := duplicateUsagePeriods(tx, duplicateIDs)
+		if err != nil {
+			return err
+		}
+		for _, table := range deviceMergeTables {
+			res := tx.Unscoped().Model(table.model).Where("device_id IN ?", duplicateIDs).Update("device_id", survivorID)
+			if res.Error != nil {
+				return fmt.Errorf("failed to move %s: %v", table.name, res.Error)
+			}
+			result.Moved[table.name] = res.RowsAffected
+		}
+
+		if err := mergeDeviceTags(tx, survivorID, duplicateIDs, operator); err != nil {
+			return err
+		}
+		if err := tx.Where("device_id IN ?", duplicateIDs).Delete(&model.DeviceUsageRollup{}).Error; err != nil {
+			return fmt.Errorf("failed to delete duplicate usage rollups: %v", err)
+		}
+		for _, p := range periods {
+			if err := rollupUsageTx(tx, p.Period, usagePeriodStart(p.PeriodStart.Local(), p.Period)); err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{"updated_at": now}
+		lastSeen, lastHeartbeat := survivor.LastSeen, survivor.LastHeartbeat
+		for _, duplicate := range duplicates {
+			lastSeen = laterTime(lastSeen, duplicate.LastSeen)
+			lastHeartbeat = laterTime(lastHeartbeat, duplicate.LastHeartbeat)
+		}
+		if lastSeen != nil {
+			updates["last_seen"] = *lastSeen
+		}
+		if lastHeartbeat != nil {
+			updates["last_heartbeat"] = *lastHeartbeat
+		}
+		if err := tx.Model(&model.Device{}).Where("id = ?", survivorID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update survivor device: %v", err)
+		}
+		if err := tx.Where("id IN ?", duplicateIDs).Delete(&model.Device{}).Error; err != nil {
+			return fmt.Errorf("failed to delete duplicate devices: %v", err)
+		}
+
+		return recordDeviceMerge(tx, survivorID, duplicateIDs, operator, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// retireDuplicateDevices 吊销重复设备的凭证，取消其未完成的命令和维护窗口，并删除设备级配置和策略
+func retireDuplicateDevices(tx *gorm.DB, duplicateIDs []string, operator string, now time.Time) error {
+	if err := tx.Model(&model.DeviceCredential{}).
+		Where("device_id IN ? AND status = ?", duplicateIDs, model.DeviceCredentialStatusActive).
+		Updates(map[string]interface{}{
+			"status":     model.DeviceCredentialStatusRevoked,
+			"revoked_at": now,
+			"revoked_by": operator,
+			"updated_at": now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to revoke duplicate credentials: %v", err)
+	}
+	if err := tx.Model(&model.DeviceCommand{}).
+		Where("device_id IN ? AND status IN ?", duplicateIDs, []model.DeviceCommandStatus{model.DeviceCommandPending, model.DeviceCommandDelivered}).
+		Updates(map[string]interface{}{
+			"status":       model.DeviceCommandCancelled,
+			"completed_at": now,
+			"update_time":  now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to cancel duplicate commands: %v", err)
+	}
+	// 未结束的维护窗口不转移给保留设备，避免改变保留设备的状态和告警抑制
+	if err := tx.Model(&model.DeviceMaintenance{}).
+		Where("device_id IN ? AND status IN ?", duplicateIDs, []model.MaintenanceStatus{model.MaintenanceStatusScheduled, model.MaintenanceStatusInProgress}).
+		Updates(map[string]interface{}{
+			"status":       model.MaintenanceStatusCancelled,
+			"completed_at": now,
+			"update_time":  now,
+			"updated_by":   operator,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to cancel duplicate maintenance windows: %v", err)
+	}
+	if err := tx.Where("target_type = ? AND target_id IN ?", model.DeviceConfigTargetDevice, duplicateIDs).
+		Delete(&model.DeviceConfig{}).Error; err != nil {
+		return fmt.Errorf("failed to delete duplicate device configs: %v", err)
+	}
+	if err := tx.Where("device_id IN ?", duplicateIDs).Delete(&model.DeviceConfigState{}).Error; err != nil {
+		return fmt.Errorf("failed to delete duplicate config states: %v", err)
+	}
+	if err := tx.Where("target_type = ? AND target_id IN ?", model.DevicePolicyTargetDevice, duplicateIDs).
+		Delete(&model.DevicePolicy{}).Error; err != nil {
+		return fmt.Errorf("failed to delete duplicate device policies: %v", err)
+	}
+	return nil
+}
+
+// duplicateUsagePeriods 返回重复设备已有使用汇总的统计周期
+func duplicateUsagePeriods(tx *gorm.DB, duplicateIDs []string) ([]model.DeviceUsageRollup, error) {
+	var periods []model.DeviceUsageRollup
+	if err := tx.Model(&model.DeviceUsageRollup{}).Where("device_id IN ?", duplicateIDs).
+		Distinct("period", "period_start").Find(&periods).Error; err != nil {
+		return nil, fmt.Errorf("failed to get duplicate usage periods: %v", err)
+	}
+	return periods, nil
+}
+
+// mergeDeviceTags 将重复设备的标签追加到保留设备
+func mergeDeviceTags(tx *gorm.DB, survivorID string, duplicateIDs []string, operator string) error {
+	var tags []string
+	if err := tx.Model(&model.DeviceTag{}).Where("device_id IN ?", duplicateIDs).
+		Distinct("tag").Pluck("tag", &tags).Error; err != nil {
+		return fmt.Errorf("failed to get duplicate tags: %v", err)
+	}
+	if len(tags) > 0 {
+		var existing []string
+		if err := tx.Model(&model.DeviceTag{}).Where("device_id = ?", survivorID).Pluck("tag", &existing).Error; err != nil {
+			return fmt.Errorf("failed to get device tags: %v", err)
+		}
+		has := make(map[string]bool, len(existing))
+		for _, tag := range existing {
+			has[tag] = true
+		}
+		var rows []model.DeviceTag
+		for _, tag := range tags {
+			if !has[tag] && len(existing)+len(rows) < maxDeviceTags {
+				rows = append(rows, model.DeviceTag{DeviceID: survivorID, Tag: tag, CreatedAt: time.Now(), CreatedBy: operator})
+			}
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return fmt.Errorf("failed to merge device tags: %v", err)
+			}
+		}
+	}
+	if err := tx.Where("device_id IN ?", duplicateIDs).Delete(&model.DeviceTag{}).Error; err != nil {
+		return fmt.Errorf("failed to delete duplicate tags: %v", err)
+	}
+	return nil
+}
+
+// recordDeviceMerge 将保留设备与各重复设备的设备对记为已合并，并移除涉及重复设备的其它待审核记录
+func recordDeviceMerge(tx *gorm.DB, survivorID string, duplicateIDs []string, operator string, now time.Time) error {
+	for _, id := range duplicateIDs {
+		pair := newDuplicatePair(survivorID, id)
+		var candidate model.DeviceDuplicate
+		err := tx.Where("device_id = ? AND duplicate_id = ?", pair[0], pair[1]).First(&candidate).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			candidate = model.DeviceDuplicate{
+				ID:          utils.GenerateUUID(),
+				DeviceID:    pair[0],
+				DuplicateID: pair[1],
+				Reasons:     "manual",
+				DetectedAt:  now,
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to get duplicate candidate: %v", err)
+		}
+		candidate.Status = model.DuplicateStatusMerged
+		candidate.MergedInto = survivorID
+		candidate.ReviewedAt = &now
+		candidate.ReviewedBy = operator
+		if err := tx.Save(&candidate).Error; err != nil {
+			return fmt.Errorf("failed to record device merge: %v", err)
+		}
+	}
+
+	if err := tx.Where("status = ? AND (device_id IN ? OR duplicate_id IN ?)", model.DuplicateStatusPending, duplicateIDs, duplicateIDs).
+		Delete(&model.DeviceDuplicate{}).Error; err != nil {
+		return fmt.Errorf("failed to remove merged duplicate candidates: %v", err)
+	}
+	return nil
+}
+
+// laterTime 返回两个可空时间中较晚的一个
+func laterTime(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+// uniqueStrings 去除空字符串和重复值，保持原有顺序
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"LVerity/pkg/model"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	eventReplaySize        = 512  // 保留用于断线重放的最近事件数
+	eventSubscriberBuffer  = 64   // 每个订阅者的事件缓冲区大小
+	maxEventSubscriberSize = 1000 // 同时在线的订阅者上限
+)
+
+// 设备事件类型
+const (
+	DeviceEventOnline        = "device_online"    // 设备恢复在线
+	DeviceEventOffline       = "device_offline"   // 设备离线
+	DeviceEventHeartbeat     = "heartbeat"        // 设备心跳
+	DeviceEventBlocked       = "device_blocked"   // 设备被封禁
+	DeviceEventUnblocked     = "device_unblocked" // 设备解封
+	DeviceEventStatusChanged = "status_changed"   // 其他状态变化
+	DeviceEventAlert         = "alert_created"    // 新告警
+)
+
+// DeviceEvent 推送给控制台的设备实时事件
+type DeviceEvent struct {
+	ID       uint64                 `json:"id"`
+	Type     string                 `json:"type"`
+	DeviceID string                 `json:"device_id"`
+	GroupID  string                 `json:"group_id,omitempty"`
+	Status   string                 `json:"status,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Time     time.Time              `json:"time"`
+}
+
+// DeviceEventFilter 事件订阅过滤条件，字段为空时不过滤
+type DeviceEventFilter struct {
+	DeviceIDs []string
+	GroupIDs  []string
+	Types     []string
+}
+
+// Match 判断事件是否满足过滤条件
+func (f *DeviceEventFilter) Match(event *DeviceEvent) bool {
+	return matchEventField(f.DeviceIDs, event.DeviceID) &&
+		matchEventField(f.GroupIDs, event.GroupID) &&
+		matchEventField(f.Types, event.Type)
+}
+
+// matchEventField 过滤值为空或包含该值时匹配
+func matchEventField(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EventSubscription 事件订阅，C在订阅取消或消费过慢时关闭
+type EventSubscription struct {
+	C      <-chan DeviceEvent
+	ch     chan DeviceEvent
+	filter DeviceEventFilter
+}
+
+// DeviceEventBus 进程内设备事件总线
+//
+// 发布不会阻塞：订阅者缓冲区满时订阅被关闭，客户端可携带Last-Event-ID重连并从重放缓冲区补齐。
+type DeviceEventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	replay      []DeviceEvent
+	subscribers map[*EventSubscription]struct{}
+}
+
+// NewDeviceEventBus 创建事件总线
+func NewDeviceEventBus() *DeviceEventBus {
+	return &DeviceEventBus{
+		replay:      make([]DeviceEvent, 0, eventReplaySize),
+		subscribers: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// DeviceEvents 全局设备事件总线
+var DeviceEvents = NewDeviceEventBus()
+
+// ErrTooManySubscribers 订阅者数量达到上限
+var ErrTooManySubscribers = errors.New("too many event subscribers")
+
+// Subscribe 订阅事件，lastEventID大于0时先补发之后的事件
+func (b *DeviceEventBus) Subscribe(filter DeviceEventFilter, lastEventID uint64) (*EventSubscription, error) {
+	ch := make(chan DeviceEvent, eventSubscriberBuffer+eventReplaySize)
+	sub := &EventSubscription{C: ch, ch: ch, filter: filter}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subscribers) >= maxEventSubscriberSize {
+		return nil, ErrTooManySubscribers
+	}
+	if lastEventID > 0 {
+		for i := range b.replay {
+			if b.replay[i].ID > lastEventID && filter.Match(&b.replay[i]) {
+				ch <- b.replay[i]
+			}
+		}
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe 取消订阅，可重复调用
+func (b *DeviceEventBus) Unsubscribe(sub *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish 发布事件，自动分配ID和时间
+func (b *DeviceEventBus) Publish(event DeviceEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if len(b.replay) == eventReplaySize {
+		copy(b.replay, b.replay[1:])
+		b.replay = b.replay[:eventReplaySize-1]
+	}
+	b.replay = append(b.replay, event)
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(&event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// 消费过慢，关闭订阅让客户端重连补齐
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// statusChange 设备状态的一次实际变化
+type statusChange struct {
+	DeviceID  string
+	GroupID   string
+	OldStatus string
+	NewStatus string
+	Reason    string
+	Actor     string
+}
+
+// publishStatusChange 将状态变化发布为设备事件，需在事务提交后调用
+func publishStatusChange(change *statusChange) {
+	if change == nil {
+		return
+	}
+
+	eventType := DeviceEventStatusChanged
+	switch {
+	case change.NewStatus == model.DeviceStatusBlocked:
+		eventType = DeviceEventBlocked
+	case change.OldStatus == model.DeviceStatusBlocked:
+		eventType = DeviceEventUnblocked
+	case change.NewStatus == model.DeviceStatusOffline:
+		eventType = DeviceEventOffline
+	case change.NewStatus == model.DeviceStatusNormal &&
+		(change.OldStatus == model.DeviceStatusOffline || change.OldStatus == model.DeviceStatusUnknown):
+		eventType = DeviceEventOnline
+	}
+
+	DeviceEvents.Publish(DeviceEvent{
+		Type:     eventType,
+		DeviceID: change.DeviceID,
+		GroupID:  change.GroupID,
+		Status:   change.NewStatus,
+		Data: map[string]interface{}{
+			"old_status": change.OldStatus,
+			"reason":     change.Reason,
+			"actor":      change.Actor,
+		},
+	})
+}
+
+// publishHeartbeat 发布设备心跳事件
+func publishHeartbeat(device *model.Device) {
+	DeviceEvents.Publish(DeviceEvent{
+		Type:     DeviceEventHeartbeat,
+		DeviceID: device.ID,
+		GroupID:  device.GroupID,
+		Status:   device.Status,
+		Data: map[string]interface{}{
+			"last_heartbeat": device.LastHeartbeat,
+		},
+	})
+}
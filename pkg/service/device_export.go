@@ -0,0 +1,205 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const deviceExportBatchSize = 500
+
+// ErrInvalidExport 导出格式或列无效
+var ErrInvalidExport = errors.New("invalid device export")
+
+// deviceExportColumn 导出列取值，返回JSON导出时的值，CSV导出时转换为字符串
+type deviceExportColumn func(device *model.Device) interface{}
+
+var deviceExportColumns = map[string]deviceExportColumn{
+	"id":             func(d *model.Device) interface{} { return d.ID },
+	"name":           func(d *model.Device) interface{} { return d.Name },
+	"type":           func(d *model.Device) interface{} { return d.Type },
+	"status":         func(d *model.Device) interface{} { return d.Status },
+	"description":    func(d *model.Device) interface{} { return d.Description },
+	"disk_id":        func(d *model.Device) interface{} { return d.DiskID },
+	"bios":           func(d *model.Device) interface{} { return d.BIOS },
+	"motherboard":    func(d *model.Device) interface{} { return d.Motherboard },
+	"network_cards":  func(d *model.Device) interface{} { return rawJSONColumn(d.NetworkCards) },
+	"display_card":   func(d *model.Device) interface{} { return d.DisplayCard },
+	"resolution":     func(d *model.Device) interface{} { return d.Resolution },
+	"timezone":       func(d *model.Device) interface{} { return d.Timezone },
+	"language":       func(d *model.Device) interface{} { return d.Language },
+	"group_id":       func(d *model.Device) interface{} { return d.GroupID },
+	"tags":           func(d *model.Device) interface{} { return d.Tags },
+	"metadata":       func(d *model.Device) interface{} { return rawJSONColumn(d.Metadata) },
+	"risk_level":     func(d *model.Device) interface{} { return d.RiskLevel },
+	"heartbeat_rate": func(d *model.Device) interface{} { return d.HeartbeatRate },
+	"last_heartbeat": func(d *model.Device) interface{} { return d.LastHeartbeat },
+	"last_seen":      func(d *model.Device) interface{} { return d.LastSeen },
+	"created_at":     func(d *model.Device) interface{} { return d.CreatedAt },
+	"updated_at":     func(d *model.Device) interface{} { return d.UpdatedAt },
+}
+
+// DefaultDeviceExportColumns 未指定列时导出的列，可直接用于导入
+var DefaultDeviceExportColumns = []string{
+	"id", "name", "type", "status", "description", "disk_id", "bios", "motherboard", "network_cards",
+	"display_card", "resolution", "timezone", "language", "group_id", "tags", "metadata",
+	"last_seen", "created_at",
+}
+
+// DeviceExportOptions 设备导出选项，过滤条件与设备搜索相同（排序、游标和数量限制除外）
+type DeviceExportOptions struct {
+	Format  model.ExportFormat
+	Columns []string
+	Query   DeviceSearchQuery
+}
+
+// DeviceExport 已校验的导出任务
+type DeviceExport struct {
+	format  model.ExportFormat
+	columns []string
+	query   *gorm.DB
+}
+
+// PrepareDeviceExport 校验导出格式、列和过滤条件，在写入响应之前调用以便返回错误
+func PrepareDeviceExport(opts DeviceExportOptions) (*DeviceExport, error) {
+	if !opts.Format.IsValid() {
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidExport, opts.Format)
+	}
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = DefaultDeviceExportColumns
+	}
+	for _, column := range columns {
+		if _, ok := deviceExportColumns[column]; !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidExport, column)
+		}
+	}
+
+	query, err := applyDeviceSearch(database.GetDB().Model(&model.Device{}), opts.Query)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceExport{format: opts.Format, columns: columns, query: query}, nil
+}
+
+// Write 按设备ID分批查询并写出设备，不会一次加载全部设备
+func (e *DeviceExport) Write(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	var csvWriter *csv.Writer
+	switch e.format {
+	case model.ExportFormatCSV:
+		csvWriter = csv.NewWriter(buffered)
+		if err := csvWriter.Write(e.columns); err != nil {
+			return err
+		}
+	case model.ExportFormatJSON:
+		if _, err := buffered.WriteString("["); err != nil {
+			return err
+		}
+	}
+
+	first := true
+	var devices []model.Device
+	err := e.query.FindInBatches(&devices, deviceExportBatchSize, func(tx *gorm.DB, batch int) error {
+		if err := loadDeviceTags(devices); err != nil {
+			return err
+		}
+		for i := range devices {
+			if csvWriter != nil {
+				if err := csvWriter.Write(e.csvRecord(&devices[i])); err != nil {
+					return err
+				}
+				continue
+			}
+
+			data, err := json.Marshal(e.jsonRecord(&devices[i]))
+			if err != nil {
+				return err
+			}
+			if !first {
+				if err := buffered.WriteByte(','); err != nil {
+					return err
+				}
+			}
+			first = false
+			if _, err := buffered.Write(data); err != nil {
+				return err
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+		return buffered.Flush()
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to export devices: %v", err)
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+	} else if _, err := buffered.WriteString("]\n"); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// jsonRecord 生成一条JSON记录
+func (e *DeviceExport) jsonRecord(device *model.Device) map[string]interface{} {
+	record := make(map[string]interface{}, len(e.columns))
+	for _, column := range e.columns {
+		record[column] = deviceExportColumns[column](device)
+	}
+	return record
+}
+
+// csvRecord 生成一条CSV记录，标签以逗号分隔，时间为RFC3339格式
+func (e *DeviceExport) csvRecord(device *model.Device) []string {
+	record := make([]string, 0, len(e.columns))
+	for _, column := range e.columns {
+		switch v := deviceExportColumns[column](device).(type) {
+		case string:
+			record = append(record, v)
+		case json.RawMessage:
+			record = append(record, string(v))
+		case []string:
+			record = append(record, strings.Join(v, ","))
+		case float64:
+			record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+		case int:
+			record = append(record, strconv.Itoa(v))
+		case time.Time:
+			record = append(record, v.Format(time.RFC3339))
+		case *time.Time:
+			if v == nil {
+				record = append(record, "")
+			} else {
+				record = append(record, v.Format(time.RFC3339))
+			}
+		default:
+			record = append(record, fmt.Sprint(v))
+		}
+	}
+	return record
+}
+
+// rawJSONColumn 将保存为JSON字符串的字段原样输出，空值和无效JSON输出为null
+func rawJSONColumn(value string) json.RawMessage {
+	if value == "" || !json.Valid([]byte(value)) {
+		return nil
+	}
+	return json.RawMessage(value)
+}
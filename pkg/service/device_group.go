@@ -0,0 +1,339 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxGroupDepth     = 8   // 分组最大嵌套层数
+	maxGroupNameLen   = 191 // 分组名称最大长度
+	maxBulkAssignSize = 1000
+)
+
+var (
+	ErrGroupNotFound = errors.New("device group not found")
+	ErrInvalidGroup  = errors.New("invalid device group")
+	ErrGroupNotEmpty = errors.New("device group has child groups")
+)
+
+// GroupInput 创建或更新分组的参数，ParentID为空表示顶级分组
+type GroupInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ParentID    string `json:"parent_id"`
+}
+
+// CreateGroup 创建设备分组
+func CreateGroup(input GroupInput, operator string) (*model.DeviceGroup, error) {
+	id := utils.GenerateUUID()
+	if err := validateGroupInput(id, &input); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	group := &model.DeviceGroup{
+		ID:          id,
+		ParentID:    input.ParentID,
+		Name:        input.Name,
+		Description: input.Description,
+		CreatedBy:   operator,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := database.GetDB().Create(group).Error; err != nil {
+		return nil, fmt.Errorf("failed to create device group: %v", err)
+	}
+	return group, nil
+}
+
+// GetGroup 获取分组，包含直接子分组和设备数
+func GetGroup(id string) (*model.DeviceGroup, error) {
+	group, err := findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Where("parent_id = ?", id).Order("name ASC").Find(&group.Children).Error; err != nil {
+		return nil, fmt.Errorf("failed to get child groups: %v", err)
+	}
+	if err := database.GetDB().Model(&model.Device{}).Where("group_id = ?", id).Count(&group.DeviceCount).Error; err != nil {
+		return nil, fmt.Errorf("failed to count group devices: %v", err)
+	}
+	return group, nil
+}
+
+// UpdateGroup 更新分组名称、描述和上级分组
+func UpdateGroup(id string, input GroupInput) (*model.DeviceGroup, error) {
+	group, err := findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateGroupInput(id, &input); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":        input.Name,
+		"description": input.Description,
+		"parent_id":   input.ParentID,
+		"updated_at":  time.Now(),
+	}
+	if err := database.GetDB().Model(&model.DeviceGroup{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update device group: %v", err)
+	}
+	group.Name = input.Name
+	group.Description = input.Description
+	group.ParentID = input.ParentID
+	group.UpdatedAt = updates["updated_at"].(time.Time)
+	return group, nil
+}
+
+// DeleteGroup 删除没有子分组的分组，组内设备移至上级分组（顶级分组时变为未分组），分组策略一并删除
+func DeleteGroup(id string) error {
+	group, err := findGroup(id)
+	if err != nil {
+		return err
+	}
+
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&model.DeviceGroup{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return fmt.Errorf("failed to count child groups: %v", err)
+		}
+		if children > 0 {
+			return ErrGroupNotEmpty
+		}
+		if err := tx.Model(&model.Device{}).Where("group_id = ?", id).
+			Update("group_id", group.ParentID).Error; err != nil {
+			return fmt.Errorf("failed to move group devices: %v", err)
+		}
+		if err := tx.Where("target_type = ? AND target_id = ?", model.DevicePolicyTargetGroup, id).
+			Delete(&model.DevicePolicy{}).Error; err != nil {
+			return fmt.Errorf("failed to delete group policy: %v", err)
+		}
+		if err := tx.Delete(&model.DeviceGroup{}, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("failed to delete device group: %v", err)
+		}
+		return nil
+	})
+}
+
+// ListGroups 获取全部分组及各自的直接设备数，tree为true时组装为树，仅返回顶级分组
+func ListGroups(tree bool) ([]model.DeviceGroup, error) {
+	var groups []model.DeviceGroup
+	if err := database.GetDB().Order("name ASC").Find(&groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device groups: %v", err)
+	}
+
+	var counts []struct {
+		GroupID string
+		Count   int64
+	}
+	if err := database.GetDB().Model(&model.Device{}).Select("group_id, COUNT(*) AS count").
+		Where("group_id <> ''").Group("group_id").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count group devices: %v", err)
+	}
+	byGroup := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byGroup[c.GroupID] = c.Count
+	}
+	for i := range groups {
+		groups[i].DeviceCount = byGroup[groups[i].ID]
+	}
+
+	if !tree {
+		return groups, nil
+	}
+	return buildGroupTree(groups), nil
+}
+
+// buildGroupTree 按ParentID组装分组树，上级分组不存在的分组作为顶级分组
+func buildGroupTree(groups []model.DeviceGroup) []model.DeviceGroup {
+	exists := make(map[string]bool, len(groups))
+	children := make(map[string][]model.DeviceGroup)
+	for _, g := range groups {
+		exists[g.ID] = true
+	}
+	var roots []model.DeviceGroup
+	for _, g := range groups {
+		if g.ParentID == "" || !exists[g.ParentID] {
+			roots = append(roots, g)
+			continue
+		}
+		children[g.ParentID] = append(children[g.ParentID], g)
+	}
+
+	var attach func(nodes []model.DeviceGroup, depth int)
+	attach = func(nodes []model.DeviceGroup, depth int) {
+		if depth > maxGroupDepth {
+			return
+		}
+		for i := range nodes {
+			nodes[i].Children = children[nodes[i].ID]
+			attach(nodes[i].Children, depth+1)
+		}
+	}
+	attach(roots, 1)
+	return roots
+}
+
+// AssignDevicesToGroup 批量将设备移入分组，groupID为空时移出分组，返回更新的设备数
+func AssignDevicesToGroup(groupID string, deviceIDs []string) (int64, error) {
+	if len(deviceIDs) == 0 || len(deviceIDs) > maxBulkAssignSize {
+		return 0, fmt.Errorf("%w: between 1 and %d device ids are required", ErrInvalidGroup, maxBulkAssignSize)
+	}
+	if groupID != "" {
+		if _, err := findGroup(groupID); err != nil {
+			return 0, err
+		}
+	}
+
+	res := database.GetDB().Model(&model.Device{}).Where("id IN ?", deviceIDs).
+		Updates(map[string]interface{}{
+			"group_id":   groupID,
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to assign devices: %v", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// GetGroupDevices 获取分组内的设备，recursive为true时包含所有下级分组的设备
+func GetGroupDevices(groupID string, recursive bool, page, pageSize int) ([]model.Device, int64, error) {
+	if _, err := findGroup(groupID); err != nil {
+		return nil, 0, err
+	}
+	groupIDs := []string{groupID}
+	if recursive {
+		descendants, err := groupDescendantIDs(groupID)
+		if err != nil {
+			return nil, 0, err
+		}
+		groupIDs = append(groupIDs, descendants...)
+	}
+
+	query := database.GetDB().Model(&model.Device{}).Where("group_id IN ?", groupIDs)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count group devices: %v", err)
+	}
+	var devices []model.Device
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&devices).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get group devices: %v", err)
+	}
+	return devices, total, nil
+}
+
+// findGroup 按ID获取分组
+func findGroup(id string) (*model.DeviceGroup, error) {
+	var group model.DeviceGroup
+	err := database.GetDB().Where("id = ?", id).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device group: %v", err)
+	}
+	return &group, nil
+}
+
+// validateGroupInput 校验分组参数，上级分组必须存在，且不能形成环或超过最大层数
+func validateGroupInput(id string, input *GroupInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	input.ParentID = strings.TrimSpace(input.ParentID)
+	if input.Name == "" || len(input.Name) > maxGroupNameLen {
+		return fmt.Errorf("%w: name is required and at most %d characters", ErrInvalidGroup, maxGroupNameLen)
+	}
+	if input.ParentID == "" {
+		return nil
+	}
+	if input.ParentID == id {
+		return fmt.Errorf("%w: group cannot be its own parent", ErrInvalidGroup)
+	}
+
+	ancestors, err := groupAncestors(input.ParentID)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.ID == id {
+			return fmt.Errorf("%w: parent cannot be a descendant of the group", ErrInvalidGroup)
+		}
+	}
+	depth, err := groupSubtreeDepth(id)
+	if err != nil {
+		return err
+	}
+	if len(ancestors)+depth > maxGroupDepth {
+		return fmt.Errorf("%w: groups can be nested at most %d levels", ErrInvalidGroup, maxGroupDepth)
+	}
+	return nil
+}
+
+// groupAncestors 返回分组及其所有上级分组，顺序为从顶级分组到该分组
+func groupAncestors(id string) ([]model.DeviceGroup, error) {
+	var chain []model.DeviceGroup
+	seen := make(map[string]bool)
+	for current := id; current != ""; {
+		if seen[current] || len(chain) > maxGroupDepth {
+			return nil, fmt.Errorf("%w: group hierarchy of %s is corrupted", ErrInvalidGroup, id)
+		}
+		seen[current] = true
+
+		group, err := findGroup(current)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, *group)
+		current = group.ParentID
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// groupDescendantIDs 返回所有下级分组ID，不包含分组本身
+func groupDescendantIDs(id string) ([]string, error) {
+	var result []string
+	level := []string{id}
+	for depth := 0; len(level) > 0 && depth < maxGroupDepth; depth++ {
+		var children []string
+		if err := database.GetDB().Model(&model.DeviceGroup{}).Where("parent_id IN ?", level).
+			Pluck("id", &children).Error; err != nil {
+			return nil, fmt.Errorf("failed to get child groups: %v", err)
+		}
+		result = append(result, children...)
+		level = children
+	}
+	return result, nil
+}
+
+// groupSubtreeDepth 返回以分组为根的子树层数，分组不存在子分组时为1
+func groupSubtreeDepth(id string) (int, error) {
+	depth := 1
+	level := []string{id}
+	for depth <= maxGroupDepth {
+		var children []string
+		if err := database.GetDB().Model(&model.DeviceGroup{}).Where("parent_id IN ?", level).
+			Pluck("id", &children).Error; err != nil {
+			return 0, fmt.Errorf("failed to get child groups: %v", err)
+		}
+		if len(children) == 0 {
+			break
+		}
+		depth++
+		level = children
+	}
+	return depth, nil
+}
@@ -0,0 +1,472 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxImportRows = 5000
+
+// ErrInvalidImport 导入文件格式或参数无效
+var ErrInvalidImport = errors.New("invalid device import")
+
+// DeviceImportMode 导入时已存在设备（硬盘、BIOS和主板均相同）的处理方式
+type DeviceImportMode string
+
+const (
+	DeviceImportSkip   DeviceImportMode = "skip"   // 跳过已存在的设备
+	DeviceImportUpdate DeviceImportMode = "update" // 用导入的非空字段更新已存在的设备，标签追加、元数据按字段合并
+)
+
+// DeviceImportOptions 设备导入选项
+type DeviceImportOptions struct {
+	Format   model.ExportFormat
+	Mode     DeviceImportMode
+	DryRun   bool // 仅校验，不写入数据库
+	Operator string
+}
+
+// DeviceImportError 导入失败的行，Row为CSV文件中的行号（表头为第1行）或JSON数组中的序号（从1开始）
+type DeviceImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// DeviceImportResult 设备导入结果
+type DeviceImportResult struct {
+	DryRun  bool                `json:"dry_run"`
+	Total   int                 `json:"total"`
+	Created int                 `json:"created"`
+	Updated int                 `json:"updated"`
+	Skipped int                 `json:"skipped"`
+	Failed  int                 `json:"failed"`
+	Errors  []DeviceImportError `json:"errors"`
+}
+
+// DeviceImportRow 导入的一行设备数据，JSON导入时字段名与CSV表头相同
+type DeviceImportRow struct {
+	Name         string          `json:"name"`
+	Type         string          `json:"type"`
+	Description  string          `json:"description"`
+	DiskID       string          `json:"disk_id"`
+	BIOS         string          `json:"bios"`
+	Motherboard  string          `json:"motherboard"`
+	NetworkCards json.RawMessage `json:"network_cards"` // 网卡对象数组，或逗号分隔的MAC地址字符串
+	DisplayCard  string          `json:"display_card"`
+	Resolution   string          `json:"resolution"`
+	Timezone     string          `json:"timezone"`
+	Language     string          `json:"language"`
+	GroupID      string          `json:"group_id"`
+	Tags         []string        `json:"tags"`
+	Metadata     json.RawMessage `json:"metadata"` // JSON对象
+}
+
+// deviceImportColumns CSV导入支持的列，其余导出列（如id、status）导入时忽略
+var deviceImportColumns = map[string]bool{
+	"name": true, "type": true, "description": true, "disk_id": true, "bios": true, "motherboard": true,
+	"network_cards": true, "display_card": true, "resolution": true, "timezone": true, "language": true,
+	"group_id": true, "tags": true, "metadata": true,
+}
+
+// preparedImportRow 校验通过的导入行
+type preparedImportRow struct {
+	row      int
+	device   model.Device
+	tags     []string
+	metadata map[string]interface{}
+	existing *model.Device
+}
+
+// ImportDevices 从CSV或JSON导入设备
+//
+// 每行单独校验，校验失败的行记录在Errors中，其余行在同一事务中写入。
+func ImportDevices(r io.Reader, opts DeviceImportOptions) (*DeviceImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = DeviceImportSkip
+	}
+	if opts.Mode != DeviceImportSkip && opts.Mode != DeviceImportUpdate {
+		return nil, fmt.Errorf("%w: unsupported mode %q", ErrInvalidImport, opts.Mode)
+	}
+
+	var rows []DeviceImportRow
+	var lines []int
+	var err error
+	switch opts.Format {
+	case model.ExportFormatCSV:
+		rows, lines, err = readDeviceImportCSV(r)
+	case model.ExportFormatJSON:
+		rows, lines, err = readDeviceImportJSON(r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidImport, opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeviceImportResult{DryRun: opts.DryRun, Total: len(rows), Errors: []DeviceImportError{}}
+	groups := make(map[string]bool)
+	seen := make(map[string]int)
+	validator := metadataValidator{}
+	var prepared []preparedImportRow
+	for i, row := range rows {
+		item, importErr := prepareImportRow(row, groups)
+		if importErr == nil {
+			key := GetDeviceIdentifier(&item.device)
+			if first, ok := seen[key]; ok {
+				importErr = &DeviceImportError{Message: fmt.Sprintf("duplicate of row %d in the same file", first)}
+			} else {
+				seen[key] = lines[i]
+			}
+		}
+		if importErr != nil {
+			importErr.Row = lines[i]
+			result.Errors = append(result.Errors, *importErr)
+			continue
+		}
+
+		existing, err := GetDeviceByHardwareInfo(item.device.DiskID, item.device.BIOS, item.device.Motherboard)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to check existing device: %v", err)
+		}
+		if existing != nil && opts.Mode == DeviceImportSkip {
+			result.Skipped++
+			continue
+		}
+		item.row = lines[i]
+		item.existing = existing
+		importErr, err = validateImportMetadata(validator, item)
+		if err != nil {
+			return nil, err
+		}
+		if importErr != nil {
+			importErr.Row = lines[i]
+			result.Errors = append(result.Errors, *importErr)
+			continue
+		}
+		prepared = append(prepared, *item)
+	}
+	result.Failed = len(result.Errors)
+
+	for _, item := range prepared {
+		if item.existing != nil {
+			result.Updated++
+		} else {
+			result.Created++
+		}
+	}
+	if opts.DryRun || len(prepared) == 0 {
+		return result, nil
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, item := range prepared {
+			if err := writeImportRow(tx, &item, opts.Operator); err != nil {
+				return fmt.Errorf("row %d: %v", item.row, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import devices: %v", err)
+	}
+	return result, nil
+}
+
+// readDeviceImportCSV 按表头读取CSV，列名不区分大小写，返回每条记录的行号
+func readDeviceImportCSV(r io.Reader) ([]DeviceImportRow, []int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("%w: empty file", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := deviceExportColumns[name]; !ok && !deviceImportColumns[name] {
+			return nil, nil, fmt.Errorf("%w: unknown column %q", ErrInvalidImport, name)
+		}
+		columns[name] = i
+	}
+
+	var rows []DeviceImportRow
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		if len(rows) >= maxImportRows {
+			return nil, nil, fmt.Errorf("%w: at most %d rows can be imported at once", ErrInvalidImport, maxImportRows)
+		}
+		line, _ := reader.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := DeviceImportRow{
+			Name:        get("name"),
+			Type:        get("type"),
+			Description: get("description"),
+			DiskID:      get("disk_id"),
+			BIOS:        get("bios"),
+			Motherboard: get("motherboard"),
+			DisplayCard: get("display_card"),
+			Resolution:  get("resolution"),
+			Timezone:    get("timezone"),
+			Language:    get("language"),
+			GroupID:     get("group_id"),
+			Tags:        splitImportList(get("tags")),
+		}
+		if value := get("network_cards"); value != "" {
+			if strings.HasPrefix(value, "[") {
+				row.NetworkCards = json.RawMessage(value)
+			} else {
+				row.NetworkCards, _ = json.Marshal(value)
+			}
+		}
+		if value := get("metadata"); value != "" {
+			row.Metadata = json.RawMessage(value)
+		}
+		rows = append(rows, row)
+		lines = append(lines, line)
+	}
+	return rows, lines, nil
+}
+
+// readDeviceImportJSON 读取JSON数组，返回每条记录的序号
+func readDeviceImportJSON(r io.Reader) ([]DeviceImportRow, []int, error) {
+	var rows []DeviceImportRow
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if len(rows) > maxImportRows {
+		return nil, nil, fmt.Errorf("%w: at most %d rows can be imported at once", ErrInvalidImport, maxImportRows)
+	}
+	lines := make([]int, len(rows))
+	for i := range rows {
+		lines[i] = i + 1
+	}
+	return rows, lines, nil
+}
+
+// prepareImportRow 校验一行数据并转换为设备
+func prepareImportRow(row DeviceImportRow, groups map[string]bool) (*preparedImportRow, *DeviceImportError) {
+	item := &preparedImportRow{
+		device: model.Device{
+			Name:        strings.TrimSpace(row.Name),
+			Type:        strings.TrimSpace(row.Type),
+			Description: row.Description,
+			DiskID:      strings.TrimSpace(row.DiskID),
+			BIOS:        strings.TrimSpace(row.BIOS),
+			Motherboard: strings.TrimSpace(row.Motherboard),
+			DisplayCard: strings.TrimSpace(row.DisplayCard),
+			Resolution:  strings.TrimSpace(row.Resolution),
+			Timezone:    strings.TrimSpace(row.Timezone),
+			Language:    strings.TrimSpace(row.Language),
+			GroupID:     strings.TrimSpace(row.GroupID),
+		},
+	}
+	if err := ValidateDeviceInfo(&item.device); err != nil {
+		return nil, &DeviceImportError{Message: err.Error()}
+	}
+
+	cards, err := parseImportNetworkCards(row.NetworkCards)
+	if err != nil {
+		return nil, &DeviceImportError{Field: "network_cards", Message: err.Error()}
+	}
+	if len(cards) > 0 {
+		if item.device.NetworkCards, err = FormatNetworkCards(cards); err != nil {
+			return nil, &DeviceImportError{Field: "network_cards", Message: err.Error()}
+		}
+	}
+
+	if item.device.GroupID != "" {
+		exists, checked := groups[item.device.GroupID]
+		if !checked {
+			_, err := findGroup(item.device.GroupID)
+			exists = err == nil
+			groups[item.device.GroupID] = exists
+		}
+		if !exists {
+			return nil, &DeviceImportError{Field: "group_id", Message: fmt.Sprintf("group %s not found", item.device.GroupID)}
+		}
+	}
+
+	if item.tags, err = normalizeTags(row.Tags); err != nil {
+		return nil, &DeviceImportError{Field: "tags", Message: err.Error()}
+	}
+	if len(item.tags) > maxDeviceTags {
+		return nil, &DeviceImportError{Field: "tags", Message: fmt.Sprintf("a device can have at most %d tags", maxDeviceTags)}
+	}
+
+	if raw := bytes.TrimSpace(row.Metadata); len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &item.metadata); err != nil || item.metadata == nil {
+			return nil, &DeviceImportError{Field: "metadata", Message: "metadata must be a JSON object"}
+		}
+	}
+	return item, nil
+}
+
+// validateImportMetadata 按设备类型的结构定义校验导入后的元数据，更新已有设备时校验合并后的结果
+func validateImportMetadata(validator metadataValidator, item *preparedImportRow) (*DeviceImportError, error) {
+	deviceType := item.device.Type
+	metadata := item.metadata
+	if item.existing != nil {
+		if deviceType == "" {
+			deviceType = item.existing.Type
+		}
+		if len(item.metadata) == 0 && deviceType == item.existing.Type {
+			return nil, nil
+		}
+		merged, err := decodeMetadata(item.existing.Metadata)
+		if err != nil {
+			merged = make(map[string]interface{})
+		}
+		for key, value := range item.metadata {
+			merged[key] = value
+		}
+		metadata = merged
+	}
+
+	if err := validator.validate(model.MetadataTargetDevice, deviceType, metadata); err != nil {
+		if errors.Is(err, ErrInvalidMetadata) {
+			return &DeviceImportError{Field: "metadata", Message: err.Error()}, nil
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// parseImportNetworkCards 解析网卡信息，支持网卡对象数组或逗号分隔的MAC地址
+func parseImportNetworkCards(raw json.RawMessage) ([]map[string]string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var macs string
+	if err := json.Unmarshal(raw, &macs); err == nil {
+		var cards []map[string]string
+		for _, mac := range splitImportList(macs) {
+			hw, err := net.ParseMAC(mac)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mac address %q", mac)
+			}
+			cards = append(cards, map[string]string{"mac": hw.String()})
+		}
+		return cards, nil
+	}
+
+	var cards []map[string]string
+	if err := json.Unmarshal(raw, &cards); err != nil {
+		return nil, fmt.Errorf("network_cards must be an array of objects or comma separated mac addresses")
+	}
+	return cards, nil
+}
+
+// writeImportRow 写入一行导入数据
+func writeImportRow(tx *gorm.DB, item *preparedImportRow, operator string) error {
+	now := time.Now()
+	device := item.device
+	deviceID := ""
+
+	if item.existing == nil {
+		device.ID = utils.GenerateUUID()
+		device.Status = model.DeviceStatusNormal
+		device.HeartbeatRate = defaultHeartbeatRate
+		device.CreatedAt = now
+		device.UpdatedAt = now
+		if len(item.metadata) > 0 {
+			data, err := json.Marshal(item.metadata)
+			if err != nil {
+				return err
+			}
+			device.Metadata = string(data)
+		}
+		if err := tx.Create(&device).Error; err != nil {
+			return err
+		}
+		deviceID = device.ID
+	} else {
+		deviceID = item.existing.ID
+		updates := map[string]interface{}{"updated_at": now}
+		for column, value := range map[string]string{
+			"name":          device.Name,
+			"type":          device.Type,
+			"description":   device.Description,
+			"network_cards": device.NetworkCards,
+			"display_card":  device.DisplayCard,
+			"resolution":    device.Resolution,
+			"timezone":      device.Timezone,
+			"language":      device.Language,
+			"group_id":      device.GroupID,
+		} {
+			if value != "" {
+				updates[column] = value
+			}
+		}
+		if len(item.metadata) > 0 {
+			metadata := make(map[string]interface{})
+			if item.existing.Metadata != "" {
+				_ = json.Unmarshal([]byte(item.existing.Metadata), &metadata)
+			}
+			for key, value := range item.metadata {
+				metadata[key] = value
+			}
+			data, err := json.Marshal(metadata)
+			if err != nil {
+				return err
+			}
+			updates["metadata"] = string(data)
+		}
+		if err := tx.Model(&model.Device{}).Where("id = ?", deviceID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(item.tags) == 0 {
+		return nil
+	}
+	tags := make([]model.DeviceTag, 0, len(item.tags))
+	for _, tag := range item.tags {
+		tags = append(tags, model.DeviceTag{DeviceID: deviceID, Tag: tag, CreatedAt: now, CreatedBy: operator})
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error
+}
+
+// splitImportList 拆分逗号分隔的值并去除空白
+func splitImportList(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
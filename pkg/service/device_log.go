@@ -0,0 +1,277 @@
+package service
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxLogMessageLength = 8192            // 单条日志内容的最大长度，超出部分截断
+	maxLogFutureSkew    = 5 * time.Minute // 允许的客户端时间超前量，超出时使用服务端时间
+	logInsertBatchSize  = 100             // 批量写入时每批的条数
+	defaultLogSource    = "agent"         // 未指定来源时的默认值
+	defaultLogType      = "general"       // 未指定类型时的默认值
+	maxLogFieldLength   = 50              // 类型字段的最大长度
+)
+
+var (
+	ErrLogBatchTooLarge = errors.New("too many log entries in one batch")
+	ErrLogBatchEmpty    = errors.New("log batch is empty")
+	ErrInvalidLogLevel  = errors.New("invalid log level")
+)
+
+// DeviceLogEntry 客户端上报的单条日志
+type DeviceLogEntry struct {
+	Type           string          `json:"type"`
+	Level          model.LogLevel  `json:"level"`
+	Message        string          `json:"message"`
+	Source         string          `json:"source"`
+	Timestamp      *time.Time      `json:"timestamp"`
+	AdditionalInfo json.RawMessage `json:"additional_info"`
+}
+
+// DeviceActivityEntry 客户端上报的单条活动
+type DeviceActivityEntry struct {
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Metadata    json.RawMessage `json:"metadata"`
+	Timestamp   *time.Time      `json:"timestamp"`
+}
+
+// DeviceLogBatch 客户端批量上报的日志和活动
+type DeviceLogBatch struct {
+	Logs       []DeviceLogEntry      `json:"logs"`
+	Activities []DeviceActivityEntry `json:"activities"`
+}
+
+// DeviceLogFilter 设备日志查询条件，字段为空时不过滤
+type DeviceLogFilter struct {
+	DeviceID  string
+	Types     []string
+	Levels    []model.LogLevel
+	Source    string
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// IngestDeviceLogs 保存设备上报的日志和活动，并补充客户端IP和地理位置
+//
+// 返回写入的日志条数和活动条数。
+func IngestDeviceLogs(deviceID, clientIP string, batch *DeviceLogBatch) (int, int, error) {
+	total := len(batch.Logs) + len(batch.Activities)
+	if total == 0 {
+		return 0, 0, ErrLogBatchEmpty
+	}
+	if limit := config.GetConfig().Device.LogMaxBatchSize; limit > 0 && total > limit {
+		return 0, 0, fmt.Errorf("%w: %d > %d", ErrLogBatchTooLarge, total, limit)
+	}
+
+	now := time.Now()
+	country, city := resolveLogLocation(deviceID, clientIP)
+	location := strings.Trim(country+" "+city, " ")
+
+	logs := make([]model.DeviceLog, 0, len(batch.Logs))
+	for _, entry := range batch.Logs {
+		level, err := normalizeLogLevel(entry.Level)
+		if err != nil {
+			return 0, 0, err
+		}
+		logs = append(logs, model.DeviceLog{
+			ID:             utils.GenerateUUID(),
+			DeviceID:       deviceID,
+			Type:           truncateString(defaultString(entry.Type, defaultLogType), maxLogFieldLength),
+			Level:          level,
+			Message:        truncateString(entry.Message, maxLogMessageLength),
+			Source:         truncateString(defaultString(entry.Source, defaultLogSource), 100),
+			Timestamp:      clientTimestamp(entry.Timestamp, now),
+			AdditionalInfo: rawJSONString(entry.AdditionalInfo),
+			IP:             clientIP,
+			Country:        country,
+			City:           city,
+			ReceivedAt:     now,
+		})
+	}
+
+	activities := make([]model.DeviceActivity, 0, len(batch.Activities))
+	for _, entry := range batch.Activities {
+		activities = append(activities, model.DeviceActivity{
+			ID:          utils.GenerateUUID(),
+			DeviceID:    deviceID,
+			Type:        truncateString(defaultString(entry.Type, defaultLogType), maxLogFieldLength),
+			Description: truncateString(entry.Description, maxLogMessageLength),
+			Metadata:    rawJSONString(entry.Metadata),
+			IPAddress:   clientIP,
+			Location:    truncateString(location, 255),
+			CreateTime:  clientTimestamp(entry.Timestamp, now),
+		})
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if len(logs) > 0 {
+			if err := tx.CreateInBatches(logs, logInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if len(activities) > 0 {
+			if err := tx.CreateInBatches(activities, logInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to save device logs: %v", err)
+	}
+
+	if len(logs) > 0 {
+		triggerPatternRules(deviceID, model.PatternEventLog)
+	}
+
+	return len(logs), len(activities), nil
+}
+
+// resolveLogLocation 获取日志的国家和城市，IP与设备上一条日志相同时沿用其结果，不再查询地理位置
+func resolveLogLocation(deviceID, clientIP string) (string, string) {
+	if clientIP == "" {
+		return "", ""
+	}
+	var last model.DeviceLog
+	err := database.GetDB().Select("ip", "country", "city").Where("device_id = ?", deviceID).
+		Order("received_at DESC").Limit(1).Find(&last).Error
+	if err == nil && last.IP == clientIP && last.Country != "" {
+		return last.Country, last.City
+	}
+
+	if loc := lookupCountry(clientIP); loc != nil {
+		return loc.Country, loc.City
+	}
+	return "", ""
+}
+
+// QueryDeviceLogs 分页查询设备日志
+func QueryDeviceLogs(filter DeviceLogFilter, page, pageSize int) ([]model.DeviceLog, int64, error) {
+	var logs []model.DeviceLog
+	var total int64
+
+	query := applyDeviceLogFilter(database.GetDB().Model(&model.DeviceLog{}), filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count device logs: %v", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("timestamp DESC").Offset(offset).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get device logs: %v", err)
+	}
+
+	return logs, total, nil
+}
+
+// QueryDeviceActivities 分页查询设备活动
+func QueryDeviceActivities(deviceID, activityType string, startTime, endTime *time.Time, page, pageSize int) ([]model.DeviceActivity, int64, error) {
+	var activities []model.DeviceActivity
+	var total int64
+
+	query := database.GetDB().Model(&model.DeviceActivity{}).Where("device_id = ?", deviceID)
+	if activityType != "" {
+		query = query.Where("type = ?", activityType)
+	}
+	if startTime != nil {
+		query = query.Where("create_time >= ?", *startTime)
+	}
+	if endTime != nil {
+		query = query.Where("create_time <= ?", *endTime)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count device activities: %v", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("create_time DESC").Offset(offset).Limit(pageSize).Find(&activities).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get device activities: %v", err)
+	}
+
+	return activities, total, nil
+}
+
+// applyDeviceLogFilter 为设备日志查询添加过滤条件
+func applyDeviceLogFilter(query *gorm.DB, filter DeviceLogFilter) *gorm.DB {
+	if filter.DeviceID != "" {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if len(filter.Levels) > 0 {
+		query = query.Where("level IN ?", filter.Levels)
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.StartTime != nil {
+		query = query.Where("timestamp >= ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		query = query.Where("timestamp <= ?", *filter.EndTime)
+	}
+	return query
+}
+
+// normalizeLogLevel 校验日志级别，未指定时为info
+func normalizeLogLevel(level model.LogLevel) (model.LogLevel, error) {
+	switch model.LogLevel(strings.ToLower(string(level))) {
+	case "", model.LogLevelInfo:
+		return model.LogLevelInfo, nil
+	case model.LogLevelWarning, "warn":
+		return model.LogLevelWarning, nil
+	case model.LogLevelError:
+		return model.LogLevelError, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidLogLevel, level)
+	}
+}
+
+// clientTimestamp 使用客户端时间，缺失或明显超前时使用服务端时间
+func clientTimestamp(ts *time.Time, now time.Time) time.Time {
+	if ts == nil || ts.IsZero() || ts.After(now.Add(maxLogFutureSkew)) {
+		return now
+	}
+	return *ts
+}
+
+// rawJSONString 将原始JSON转为字符串，null视为空
+func rawJSONString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// defaultString 字符串为空时返回默认值
+func defaultString(value, def string) string {
+	if strings.TrimSpace(value) == "" {
+		return def
+	}
+	return value
+}
+
+// truncateString 按字节数截断字符串，不截断多字节字符
+func truncateString(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
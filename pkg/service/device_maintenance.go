@@ -0,0 +1,555 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMaintenanceType  = "routine"           // 未指定类型时的默认值
+	maxMaintenanceDuration  = 30 * 24 * time.Hour // 单个维护窗口的最大时长
+	maxMaintenanceCalendar  = 92 * 24 * time.Hour // 日历查询的最大时间范围
+	maintenanceCalendarDate = "2006-01-02"        // 日历按天分组的日期格式
+)
+
+var (
+	ErrMaintenanceNotFound = errors.New("maintenance window not found")
+	ErrInvalidMaintenance  = errors.New("invalid maintenance window")
+	ErrMaintenanceFinished = errors.New("maintenance window already finished")
+)
+
+// maintenanceEnterStatuses 进入维护窗口时允许切换为维护状态的设备状态
+var maintenanceEnterStatuses = []string{
+	model.DeviceStatusNormal,
+	model.DeviceStatusOffline,
+	model.DeviceStatusUnknown,
+}
+
+// MaintenanceInput 创建或更新维护窗口的参数
+type MaintenanceInput struct {
+	DeviceID    string    `json:"device_id"`
+	GroupID     string    `json:"group_id"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	EndAt       time.Time `json:"end_at"`
+	Metadata    string    `json:"metadata"`
+	Notes       string    `json:"notes"`
+}
+
+// MaintenanceFilter 维护窗口查询条件，字段为空时不过滤
+type MaintenanceFilter struct {
+	DeviceID  string // 包含作用于该设备所在分组的窗口
+	GroupID   string
+	Status    []model.MaintenanceStatus
+	StartTime *time.Time // 与[StartTime, EndTime]有重叠的窗口
+	EndTime   *time.Time
+}
+
+// MaintenanceCalendarDay 日历中某一天的维护窗口
+type MaintenanceCalendarDay struct {
+	Date    string                    `json:"date"`
+	Windows []model.DeviceMaintenance `json:"windows"`
+}
+
+// validateMaintenanceInput 校验维护窗口参数
+func validateMaintenanceInput(input *MaintenanceInput) error {
+	input.DeviceID = strings.TrimSpace(input.DeviceID)
+	input.GroupID = strings.TrimSpace(input.GroupID)
+	if (input.DeviceID == "") == (input.GroupID == "") {
+		return fmt.Errorf("%w: exactly one of device_id and group_id is required", ErrInvalidMaintenance)
+	}
+	if input.ScheduledAt.IsZero() || input.EndAt.IsZero() {
+		return fmt.Errorf("%w: scheduled_at and end_at are required", ErrInvalidMaintenance)
+	}
+	if !input.EndAt.After(input.ScheduledAt) {
+		return fmt.Errorf("%w: end_at must be after scheduled_at", ErrInvalidMaintenance)
+	}
+	if input.EndAt.Sub(input.ScheduledAt) > maxMaintenanceDuration {
+		return fmt.Errorf("%w: window longer than %v", ErrInvalidMaintenance, maxMaintenanceDuration)
+	}
+	if !input.EndAt.After(time.Now()) {
+		return fmt.Errorf("%w: end_at must be in the future", ErrInvalidMaintenance)
+	}
+	input.Type = truncateString(defaultString(input.Type, defaultMaintenanceType), maxLogFieldLength)
+
+	if input.DeviceID != "" {
+		if _, err := GetDevice(input.DeviceID); err != nil {
+			return ErrDeviceNotFound
+		}
+		return nil
+	}
+
+	var count int64
+	if err := database.GetDB().Model(&model.DeviceGroup{}).Where("id = ?", input.GroupID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check device group: %v", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: device group not found", ErrInvalidMaintenance)
+	}
+	return nil
+}
+
+// CreateMaintenance 创建维护窗口，开始时间已到时立即进入维护
+func CreateMaintenance(input MaintenanceInput, operator string) (*model.DeviceMaintenance, error) {
+	if err := validateMaintenanceInput(&input); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	window := &model.DeviceMaintenance{
+		ID:          utils.GenerateUUID(),
+		DeviceID:    input.DeviceID,
+		GroupID:     input.GroupID,
+		Type:        input.Type,
+		Status:      model.MaintenanceStatusScheduled,
+		Description: input.Description,
+		ScheduledAt: input.ScheduledAt,
+		EndAt:       input.EndAt,
+		Metadata:    input.Metadata,
+		Notes:       input.Notes,
+		CreateTime:  now,
+		CreatedBy:   operator,
+		UpdateTime:  now,
+		UpdatedBy:   operator,
+	}
+
+	if err := database.GetDB().Create(window).Error; err != nil {
+		return nil, fmt.Errorf("failed to create maintenance window: %v", err)
+	}
+
+	if !window.ScheduledAt.After(now) {
+		if err := startMaintenance(window, operator); err != nil {
+			return nil, err
+		}
+	}
+
+	return window, nil
+}
+
+// GetMaintenance 获取维护窗口
+func GetMaintenance(id string) (*model.DeviceMaintenance, error) {
+	var window model.DeviceMaintenance
+	if err := database.GetDB().Where("id = ?", id).First(&window).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMaintenanceNotFound
+		}
+		return nil, fmt.Errorf("failed to get maintenance window: %v", err)
+	}
+	return &window, nil
+}
+
+// UpdateMaintenance 更新维护窗口
+//
+// 已计划的窗口可修改所有字段；进行中的窗口不能修改作用目标和开始时间，
+// 缩短后的结束时间由定时任务处理。
+func UpdateMaintenance(id string, input MaintenanceInput, operator string) (*model.DeviceMaintenance, error) {
+	window, err := GetMaintenance(id)
+	if err != nil {
+		return nil, err
+	}
+	if window.IsFinished() {
+		return nil, ErrMaintenanceFinished
+	}
+	if err := validateMaintenanceInput(&input); err != nil {
+		return nil, err
+	}
+	if window.Status == model.MaintenanceStatusInProgress &&
+		(input.DeviceID != window.DeviceID || input.GroupID != window.GroupID || !input.ScheduledAt.Equal(window.ScheduledAt)) {
+		return nil, fmt.Errorf("%w: target and start time of an in-progress window cannot be changed", ErrInvalidMaintenance)
+	}
+
+	window.DeviceID = input.DeviceID
+	window.GroupID = input.GroupID
+	window.Type = input.Type
+	window.Description = input.Description
+	window.ScheduledAt = input.ScheduledAt
+	window.EndAt = input.EndAt
+	window.Metadata = input.Metadata
+	window.Notes = input.Notes
+	window.UpdateTime = time.Now()
+	window.UpdatedBy = operator
+
+	if err := database.GetDB().Save(window).Error; err != nil {
+		return nil, fmt.Errorf("failed to update maintenance window: %v", err)
+	}
+
+	if window.Status == model.MaintenanceStatusScheduled && !window.ScheduledAt.After(time.Now()) {
+		if err := startMaintenance(window, operator); err != nil {
+			return nil, err
+		}
+	}
+
+	return window, nil
+}
+
+// CancelMaintenance 取消维护窗口，进行中的窗口会恢复设备状态
+func CancelMaintenance(id, operator string) (*model.DeviceMaintenance, error) {
+	window, err := GetMaintenance(id)
+	if err != nil {
+		return nil, err
+	}
+	if window.IsFinished() {
+		return nil, ErrMaintenanceFinished
+	}
+	if err := finishMaintenance(window, model.MaintenanceStatusCancelled, operator, "维护已取消"); err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+// CompleteMaintenance 提前结束进行中的维护窗口
+func CompleteMaintenance(id, operator string) (*model.DeviceMaintenance, error) {
+	window, err := GetMaintenance(id)
+	if err != nil {
+		return nil, err
+	}
+	if window.IsFinished() {
+		return nil, ErrMaintenanceFinished
+	}
+	if window.Status != model.MaintenanceStatusInProgress {
+		return nil, fmt.Errorf("%w: window has not started", ErrInvalidMaintenance)
+	}
+	if err := finishMaintenance(window, model.MaintenanceStatusCompleted, operator, "维护已完成"); err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+// ListMaintenance 分页查询维护窗口，按开始时间升序
+func ListMaintenance(filter MaintenanceFilter, page, pageSize int) ([]model.DeviceMaintenance, int64, error) {
+	var windows []model.DeviceMaintenance
+	var total int64
+
+	query, err := applyMaintenanceFilter(database.GetDB().Model(&model.DeviceMaintenance{}), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count maintenance windows: %v", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("scheduled_at ASC").Offset(offset).Limit(pageSize).Find(&windows).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get maintenance windows: %v", err)
+	}
+
+	return windows, total, nil
+}
+
+// GetMaintenanceCalendar 按天列出与[start, end)有重叠的维护窗口，跨天的窗口出现在每一天中
+func GetMaintenanceCalendar(filter MaintenanceFilter, start, end time.Time) ([]MaintenanceCalendarDay, error) {
+	if !end.After(start) || end.Sub(start) > maxMaintenanceCalendar {
+		return nil, fmt.Errorf("%w: calendar range must be positive and at most %v", ErrInvalidMaintenance, maxMaintenanceCalendar)
+	}
+
+	filter.StartTime = &start
+	filter.EndTime = &end
+	if len(filter.Status) == 0 {
+		filter.Status = []model.MaintenanceStatus{
+			model.MaintenanceStatusScheduled,
+			model.MaintenanceStatusInProgress,
+			model.MaintenanceStatusCompleted,
+		}
+	}
+
+	query, err := applyMaintenanceFilter(database.GetDB().Model(&model.DeviceMaintenance{}), filter)
+	if err != nil {
+		return nil, err
+	}
+	var windows []model.DeviceMaintenance
+	if err := query.Order("scheduled_at ASC").Find(&windows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get maintenance windows: %v", err)
+	}
+
+	return groupMaintenanceByDay(windows, start, end), nil
+}
+
+// groupMaintenanceByDay 将维护窗口按天分组，日期使用start所在时区
+func groupMaintenanceByDay(windows []model.DeviceMaintenance, start, end time.Time) []MaintenanceCalendarDay {
+	loc := start.Location()
+	byDay := make(map[string][]model.DeviceMaintenance)
+	for _, w := range windows {
+		from, to := w.ScheduledAt.In(loc), w.EndAt.In(loc)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+		for day.Before(to) {
+			key := day.Format(maintenanceCalendarDate)
+			byDay[key] = append(byDay[key], w)
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+
+	days := make([]MaintenanceCalendarDay, 0, len(byDay))
+	for date, list := range byDay {
+		days = append(days, MaintenanceCalendarDay{Date: date, Windows: list})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// applyMaintenanceFilter 为维护窗口查询添加过滤条件
+func applyMaintenanceFilter(query *gorm.DB, filter MaintenanceFilter) (*gorm.DB, error) {
+	if filter.DeviceID != "" {
+		device, err := GetDevice(filter.DeviceID)
+		if err != nil {
+			return nil, ErrDeviceNotFound
+		}
+		groupIDs, err := maintenanceGroupIDs(device)
+		if err != nil {
+			return nil, err
+		}
+		if len(groupIDs) > 0 {
+			query = query.Where("device_id = ? OR group_id IN ?", device.ID, groupIDs)
+		} else {
+			query = query.Where("device_id = ?", device.ID)
+		}
+	}
+	if filter.GroupID != "" {
+		query = query.Where("group_id = ?", filter.GroupID)
+	}
+	if len(filter.Status) > 0 {
+		query = query.Where("status IN ?", filter.Status)
+	}
+	if filter.StartTime != nil {
+		query = query.Where("end_at > ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		query = query.Where("scheduled_at < ?", *filter.EndTime)
+	}
+	return query, nil
+}
+
+// ProcessMaintenanceWindows 开始已到开始时间的窗口，结束已到结束时间的窗口
+//
+// 返回本次开始和结束的窗口数量。
+func ProcessMaintenanceWindows() (int, int, error) {
+	now := time.Now()
+	started, finished := 0, 0
+
+	var due []model.DeviceMaintenance
+	if err := database.GetDB().Where("status = ? AND scheduled_at <= ?", model.MaintenanceStatusScheduled, now).
+		Find(&due).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to get due maintenance windows: %v", err)
+	}
+	for i := range due {
+		window := &due[i]
+		// 错过整个窗口（例如服务停机期间）时直接标记为完成，不再切换设备状态
+		if !window.EndAt.After(now) {
+			if err := finishMaintenance(window, model.MaintenanceStatusCompleted, BlockOperatorScheduler, "维护窗口已过期"); err != nil {
+				log.Printf("Failed to expire maintenance window %s: %v", window.ID, err)
+				continue
+			}
+			finished++
+			continue
+		}
+		if err := startMaintenance(window, BlockOperatorScheduler); err != nil {
+			log.Printf("Failed to start maintenance window %s: %v", window.ID, err)
+			continue
+		}
+		started++
+	}
+
+	var ended []model.DeviceMaintenance
+	if err := database.GetDB().Where("status = ? AND end_at <= ?", model.MaintenanceStatusInProgress, now).
+		Find(&ended).Error; err != nil {
+		return started, finished, fmt.Errorf("failed to get ended maintenance windows: %v", err)
+	}
+	for i := range ended {
+		if err := finishMaintenance(&ended[i], model.MaintenanceStatusCompleted, BlockOperatorScheduler, "维护窗口结束"); err != nil {
+			log.Printf("Failed to finish maintenance window %s: %v", ended[i].ID, err)
+			continue
+		}
+		finished++
+	}
+
+	return started, finished, nil
+}
+
+// IsDeviceInMaintenance 判断设备当前是否处于进行中的维护窗口内
+//
+// 窗口到达结束时间后即不再算作维护中，即使定时任务尚未结束窗口、设备仍为维护状态；
+// 没有任何进行中窗口的维护状态视为手动设置，仍算作维护中。
+func IsDeviceInMaintenance(deviceID string) bool {
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return false
+	}
+	if activeMaintenanceCount(device, "") > 0 {
+		return true
+	}
+	if device.Status != model.DeviceStatusMaintenance {
+		return false
+	}
+	var count int64
+	if err := coveringMaintenanceQuery(device, "").Count(&count).Error; err != nil {
+		log.Printf("Failed to count maintenance windows of device %s: %v", device.ID, err)
+		return true
+	}
+	return count == 0
+}
+
+// activeMaintenanceCount 统计覆盖设备且未到结束时间的进行中维护窗口数量，excludeID不计入
+func activeMaintenanceCount(device *model.Device, excludeID string) int64 {
+	var count int64
+	if err := coveringMaintenanceQuery(device, excludeID).Where("end_at > ?", time.Now()).
+		Count(&count).Error; err != nil {
+		log.Printf("Failed to count active maintenance windows of device %s: %v", device.ID, err)
+		return 0
+	}
+	return count
+}
+
+// coveringMaintenanceQuery 查询覆盖设备的进行中维护窗口，包括已到结束时间但尚未结束的窗口，excludeID不计入
+func coveringMaintenanceQuery(device *model.Device, excludeID string) *gorm.DB {
+	query := database.GetDB().Model(&model.DeviceMaintenance{}).
+		Where("status = ?", model.MaintenanceStatusInProgress)
+	groupIDs, err := maintenanceGroupIDs(device)
+	if err != nil {
+		log.Printf("Failed to get groups of device %s: %v", device.ID, err)
+		groupIDs = []string{device.GroupID}
+	}
+	if len(groupIDs) > 0 {
+		query = query.Where("device_id = ? OR group_id IN ?", device.ID, groupIDs)
+	} else {
+		query = query.Where("device_id = ?", device.ID)
+	}
+	if excludeID != "" {
+		query = query.Where("id <> ?", excludeID)
+	}
+	return query
+}
+
+// maintenanceDevices 获取维护窗口作用的设备
+func maintenanceDevices(window *model.DeviceMaintenance) ([]model.Device, error) {
+	if window.DeviceID != "" {
+		device, err := GetDevice(window.DeviceID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return []model.Device{*device}, nil
+	}
+
+	// 分组的维护窗口同样作用于下级分组中的设备
+	groupIDs, err := groupDescendantIDs(window.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	var devices []model.Device
+	if err := database.GetDB().Where("group_id IN ?", append(groupIDs, window.GroupID)).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// maintenanceGroupIDs 返回设备所在分组及其全部上级分组的ID，这些分组的维护窗口都作用于设备
+func maintenanceGroupIDs(device *model.Device) ([]string, error) {
+	if device.GroupID == "" {
+		return nil, nil
+	}
+	groups, err := groupAncestors(device.GroupID)
+	if errors.Is(err, ErrGroupNotFound) {
+		return []string{device.GroupID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	return ids, nil
+}
+
+// startMaintenance 将窗口标记为进行中，并将作用设备切换为维护状态
+func startMaintenance(window *model.DeviceMaintenance, operator string) error {
+	now := time.Now()
+	if err := database.GetDB().Model(window).Updates(map[string]interface{}{
+		"status":      model.MaintenanceStatusInProgress,
+		"started_at":  now,
+		"update_time": now,
+		"updated_by":  operator,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to start maintenance window: %v", err)
+	}
+	window.Status = model.MaintenanceStatusInProgress
+	window.StartedAt = &now
+	window.UpdateTime = now
+	window.UpdatedBy = operator
+
+	devices, err := maintenanceDevices(window)
+	if err != nil {
+		return fmt.Errorf("failed to get maintenance devices: %v", err)
+	}
+	for _, device := range devices {
+		if _, err := TransitionDeviceStatus(device.ID, DeviceTransition{
+			Status:   model.DeviceStatusMaintenance,
+			Reason:   "进入维护窗口",
+			Actor:    operator,
+			From:     maintenanceEnterStatuses,
+			Metadata: map[string]interface{}{"maintenance_id": window.ID, "end_at": window.EndAt},
+		}); err != nil {
+			log.Printf("Failed to put device %s into maintenance: %v", device.ID, err)
+		}
+	}
+	return nil
+}
+
+// finishMaintenance 结束维护窗口，并恢复不再被其他进行中窗口覆盖的设备
+func finishMaintenance(window *model.DeviceMaintenance, status model.MaintenanceStatus, operator, reason string) error {
+	wasActive := window.Status == model.MaintenanceStatusInProgress
+	now := time.Now()
+	if err := database.GetDB().Model(window).Updates(map[string]interface{}{
+		"status":       status,
+		"completed_at": now,
+		"update_time":  now,
+		"updated_by":   operator,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to finish maintenance window: %v", err)
+	}
+	window.Status = status
+	window.CompletedAt = &now
+	window.UpdateTime = now
+	window.UpdatedBy = operator
+	if !wasActive {
+		return nil
+	}
+
+	devices, err := maintenanceDevices(window)
+	if err != nil {
+		return fmt.Errorf("failed to get maintenance devices: %v", err)
+	}
+	for i := range devices {
+		device := &devices[i]
+		if activeMaintenanceCount(device, window.ID) > 0 {
+			continue
+		}
+		if _, err := TransitionDeviceStatus(device.ID, DeviceTransition{
+			Status:   model.DeviceStatusNormal,
+			Reason:   reason,
+			Actor:    operator,
+			From:     []string{model.DeviceStatusMaintenance},
+			Metadata: map[string]interface{}{"maintenance_id": window.ID},
+		}); err != nil {
+			log.Printf("Failed to restore device %s from maintenance: %v", device.ID, err)
+		}
+	}
+	return nil
+}
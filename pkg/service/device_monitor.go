@@ -1,17 +1,20 @@
 package service
 
 import (
+	"LVerity/pkg/config"
 	"LVerity/pkg/database"
 	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"log"
 	"sync"
 	"time"
-
-	"gorm.io/gorm"
 )
 
 const (
-	deviceOfflineThreshold = 30 * time.Minute
-	deviceCleanupInterval  = 1 * time.Hour
+	defaultMonitorInterval        = time.Minute
+	defaultAbnormalCheckInterval  = 5 * time.Minute
+	defaultHeartbeatTimeoutFactor = 2
+	defaultOfflineThreshold       = 30 * time.Minute
 )
 
 var (
@@ -20,161 +23,203 @@ var (
 )
 
 // DeviceMonitor 设备监控器
+//
+// 定期将心跳超时的设备标记为离线、结束空闲的设备会话，并检查设备异常行为。
+// 会话保存在usage_records表中，服务重启后继续沿用。
 type DeviceMonitor struct {
+	mu       sync.Mutex
 	stopChan chan struct{}
-	sessions map[string]*DeviceSession
-	mu       sync.RWMutex
+	wg       sync.WaitGroup
 	running  bool
 }
 
-// DeviceSession 设备会话
-type DeviceSession struct {
-	DeviceID  string
-	StartTime time.Time
-}
-
 // GetDeviceMonitor 获取设备监控器单例
 func GetDeviceMonitor() *DeviceMonitor {
 	monitorOnce.Do(func() {
-		deviceMonitor = &DeviceMonitor{
-			stopChan: make(chan struct{}),
-			sessions: make(map[string]*DeviceSession),
-		}
+		deviceMonitor = &DeviceMonitor{}
 	})
 	return deviceMonitor
 }
 
-// Start 启动监控
+// Start 启动监控，重复调用无效
 func (dm *DeviceMonitor) Start() {
 	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	if dm.running {
-		dm.mu.Unlock()
 		return
 	}
 	dm.running = true
-	dm.mu.Unlock()
+	dm.stopChan = make(chan struct{})
 
-	go func() {
-		ticker := time.NewTicker(deviceCleanupInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				dm.CleanupOfflineDevices()
-			case <-dm.stopChan:
-				return
-			}
-		}
-	}()
+	cfg := config.GetConfig().Device
+	dm.runEvery(cfg.MonitorInterval, defaultMonitorInterval, dm.CleanupOfflineDevices)
+	dm.runEvery(cfg.AbnormalCheckInterval, defaultAbnormalCheckInterval, dm.checkAbnormalBehaviors)
 }
 
-// Stop 停止监控
+// Stop 停止监控并等待正在执行的检查结束
 func (dm *DeviceMonitor) Stop() {
 	dm.mu.Lock()
-	defer dm.mu.Unlock()
-
 	if !dm.running {
+		dm.mu.Unlock()
 		return
 	}
-
 	close(dm.stopChan)
 	dm.running = false
-}
-
-// UpdateDeviceHeartbeat 更新设备心跳
-func (dm *DeviceMonitor) UpdateDeviceHeartbeat(deviceID, ip string, location *model.Location) error {
-	dm.mu.Lock()
-	defer dm.mu.Unlock()
-
-	now := time.Now()
+	dm.mu.Unlock()
 
-	// 更新设备状态
-	updates := map[string]interface{}{
-		"status":     model.DeviceStatusNormal,
-		"last_seen":  now,
-		"last_ip":    ip,
-		"updated_at": now,
-	}
+	dm.wg.Wait()
+}
 
-	if location != nil {
-		updates["location"] = location
+// runEvery 按间隔执行任务直到监控停止
+func (dm *DeviceMonitor) runEvery(interval, def time.Duration, task func()) {
+	if interval <= 0 {
+		interval = def
 	}
+	stop := dm.stopChan
 
-	// 更新设备状态
-	if err := database.GetDB().Model(&model.Device{}).
-		Where("id = ?", deviceID).
-		Updates(updates).Error; err != nil {
-		return err
-	}
+	dm.wg.Add(1)
+	go func() {
+		defer dm.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 
-	// 检查是否需要创建新会话
-	if _, exists := dm.sessions[deviceID]; !exists {
-		dm.sessions[deviceID] = &DeviceSession{
-			DeviceID:  deviceID,
-			StartTime: now,
+		for {
+			select {
+			case <-ticker.C:
+				task()
+			case <-stop:
+				return
+			}
 		}
-	}
+	}()
+}
 
-	return nil
+// UpdateDeviceHeartbeat 记录设备心跳，ip为空时不更新会话IP
+func (dm *DeviceMonitor) UpdateDeviceHeartbeat(deviceID, ip string) error {
+	return recordDeviceHeartbeat(deviceID, ip)
 }
 
-// CleanupOfflineDevices 清理离线设备
+// CleanupOfflineDevices 将心跳超时的设备标记为离线，并结束空闲的会话
 func (dm *DeviceMonitor) CleanupOfflineDevices() {
-	dm.mu.RLock()
-	defer dm.mu.RUnlock()
-
-	offlineTime := time.Now().Add(-deviceOfflineThreshold)
+	if err := CheckOfflineDevices(); err != nil {
+		log.Printf("Error checking offline devices: %v", err)
+	}
+	closed, err := CloseIdleSessions(time.Now())
+	if err != nil {
+		log.Printf("Error closing idle device sessions: %v", err)
+		return
+	}
+	if closed > 0 {
+		log.Printf("Closed %d idle device sessions", closed)
+	}
+}
 
-	// 查找所有长时间未活动的设备
-	var devices []model.Device
-	if err := database.GetDB().Where("last_seen < ? AND status = ?", offlineTime, model.DeviceStatusNormal).Find(&devices).Error; err != nil {
+// checkAbnormalBehaviors 检查正常状态设备的异常行为并更新风险等级
+func (dm *DeviceMonitor) checkAbnormalBehaviors() {
+	devices, err := GetDevicesByStatus(model.DeviceStatusNormal)
+	if err != nil {
+		log.Printf("Error getting devices for abnormal behavior check: %v", err)
 		return
 	}
 
-	// 更新设备状态为离线
 	for _, device := range devices {
-		if err := database.GetDB().Model(&device).Updates(map[string]interface{}{
-			"status":     model.DeviceStatusOffline,
-			"updated_at": time.Now(),
-		}).Error; err != nil {
+		// 获取设备的异常行为记录
+		behaviors, err := GetDeviceAbnormalBehaviors(device.ID)
+		if err != nil {
+			log.Printf("Error getting abnormal behaviors for device %s: %v", device.ID, err)
 			continue
 		}
 
-		// 结束设备会话
-		if session, ok := dm.sessions[device.ID]; ok {
-			session.End(device.ID)
-			delete(dm.sessions, device.ID)
+		// 检查设备是否可疑
+		if utils.IsDeviceSuspicious(&device) {
+			// 记录可疑行为
+			err := RecordAbnormalBehavior(
+				device.ID,
+				"suspicious_activity",
+				"Device showing suspicious behavior patterns",
+				"high",
+				map[string]interface{}{
+					"risk_level":  device.RiskLevel,
+					"alert_count": device.AlertCount,
+				},
+			)
+			if err != nil {
+				log.Printf("Error recording abnormal behavior for device %s: %v", device.ID, err)
+				continue
+			}
+
+			if err := BlockDeviceWithReason(
+				device.ID,
+				"Suspicious activity detected - multiple abnormal behaviors",
+			); err != nil {
+				log.Printf("Error blocking suspicious device %s: %v", device.ID, err)
+			}
+		}
+
+		// 检查设备风险等级
+		riskLevel := utils.CalculateDeviceRisk(&device, behaviors)
+		if riskLevel > device.RiskLevel {
+			if err := UpdateDeviceRiskLevel(device.ID, riskLevel); err != nil {
+				log.Printf("Error updating risk level for device %s: %v", device.ID, err)
+			}
 		}
+		applyAutoBlockPolicy(&device, riskLevel)
 	}
 }
 
-// NewDeviceSession 创建新的设备会话
-func NewDeviceSession(deviceID string) *DeviceSession {
-	return &DeviceSession{
-		DeviceID:  deviceID,
-		StartTime: time.Now(),
+// deviceHeartbeatTimeout 设备的心跳超时时间：心跳间隔乘以device.heartbeat_timeout_factor
+func deviceHeartbeatTimeout(device *model.Device) time.Duration {
+	factor := config.GetConfig().Device.HeartbeatTimeoutFactor
+	if factor <= 0 {
+		factor = defaultHeartbeatTimeoutFactor
+	}
+	rate := device.HeartbeatRate
+	if rate <= 0 {
+		rate = defaultHeartbeatRate
 	}
+	return time.Duration(float64(rate) * factor * float64(time.Second))
 }
 
-// End 结束会话并更新设备使用统计
-func (s *DeviceSession) End(deviceID string) int64 {
-	duration := time.Since(s.StartTime).Seconds()
+// deviceOfflineThreshold 从未上报心跳的设备视为离线的未活动时间
+func deviceOfflineThreshold() time.Duration {
+	if threshold := config.GetConfig().Device.OfflineThreshold; threshold > 0 {
+		return threshold
+	}
+	return defaultOfflineThreshold
+}
 
-	// 更新设备使用统计
+// recordDeviceHeartbeat 更新心跳时间，离线设备重新上线，延长或开始设备会话并发布心跳事件
+func recordDeviceHeartbeat(deviceID, ip string) error {
 	now := time.Now()
-	updates := map[string]interface{}{
-		"avg_usage_time":   gorm.Expr("(avg_usage_time * alert_count + ?) / (alert_count + 1)", duration),
-		"alert_count":      gorm.Expr("alert_count + 1"),
-		"last_active_date": now,
-		"updated_at":       now,
+	if err := database.GetDB().Model(&model.Device{}).Where("id = ?", deviceID).Updates(map[string]interface{}{
+		"last_heartbeat": now,
+		"last_seen":      now,
+		"updated_at":     now,
+	}).Error; err != nil {
+		return err
+	}
+
+	// 离线设备恢复心跳后重新上线，封禁等状态保持不变
+	if _, err := TransitionDeviceStatus(deviceID, DeviceTransition{
+		Status: model.DeviceStatusNormal,
+		Reason: "心跳恢复",
+		Actor:  BlockOperatorSystem,
+		From:   []string{model.DeviceStatusOffline, model.DeviceStatusUnknown},
+		Metadata: map[string]interface{}{
+			"ip": ip,
+		},
+	}); err != nil {
+		return err
 	}
 
-	if err := database.GetDB().Model(&model.Device{}).
-		Where("id = ?", deviceID).
-		Updates(updates).Error; err != nil {
-		return 0
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	if err := touchDeviceSession(device, ip, now); err != nil {
+		return err
 	}
+	publishHeartbeat(device)
 
-	return int64(duration)
+	return nil
 }
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxPolicyCountries = 300
+
+var (
+	ErrInvalidDevicePolicy = errors.New("invalid device policy")
+	ErrCountryNotAllowed   = errors.New("device country is not allowed by policy")
+)
+
+// 策略字段名，用于标注生效策略的来源
+const (
+	policyFieldHeartbeatRate       = "heartbeat_rate"
+	policyFieldAllowedCountries    = "allowed_countries"
+	policyFieldAlertRules          = "alert_rules"
+	policyFieldAutoBlockRiskLevel  = "auto_block_risk_level"
+	policyFieldAutoBlockAlertCount = "auto_block_alert_count"
+)
+
+// EffectiveDevicePolicy 设备实际生效的策略
+//
+// Sources记录每个字段的来源，格式为"group:<分组ID>"或"device:<设备ID>"；告警开关按告警标题记录，键为"alert_rules.<标题>"。
+type EffectiveDevicePolicy struct {
+	DeviceID string                 `json:"device_id"`
+	GroupIDs []string               `json:"group_ids"` // 从顶级分组到设备所在分组
+	Policy   model.DevicePolicySpec `json:"policy"`
+	Sources  map[string]string      `json:"sources"`
+}
+
+// AlertEnabled 判断告警是否未被策略关闭
+func (p *EffectiveDevicePolicy) AlertEnabled(title string) bool {
+	enabled, ok := p.Policy.AlertRules[title]
+	return !ok || enabled
+}
+
+// CountryAllowed 判断位置是否在允许的国家内，未限制国家或位置未知时允许
+func (p *EffectiveDevicePolicy) CountryAllowed(location *model.Location) bool {
+	if len(p.Policy.AllowedCountries) == 0 || location == nil {
+		return true
+	}
+	for _, country := range p.Policy.AllowedCountries {
+		if strings.EqualFold(country, location.Country) || strings.EqualFold(country, location.CountryCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDevicePolicy 校验并规范化策略
+func ValidateDevicePolicy(spec *model.DevicePolicySpec) error {
+	if spec.HeartbeatRate != nil && (*spec.HeartbeatRate < minConfigHeartbeatRate || *spec.HeartbeatRate > maxConfigHeartbeatRate) {
+		return fmt.Errorf("%w: heartbeat_rate must be between %d and %d", ErrInvalidDevicePolicy, minConfigHeartbeatRate, maxConfigHeartbeatRate)
+	}
+	if len(spec.AllowedCountries) > maxPolicyCountries {
+		return fmt.Errorf("%w: at most %d allowed_countries", ErrInvalidDevicePolicy, maxPolicyCountries)
+	}
+	countries := spec.AllowedCountries[:0]
+	for _, country := range spec.AllowedCountries {
+		if country = strings.TrimSpace(country); country != "" {
+			countries = append(countries, country)
+		}
+	}
+	spec.AllowedCountries = countries
+	for title := range spec.AlertRules {
+		if strings.TrimSpace(title) == "" || len(title) > maxFeatureFlagLength {
+			return fmt.Errorf("%w: invalid alert rule name %q", ErrInvalidDevicePolicy, title)
+		}
+	}
+	if spec.AutoBlockRiskLevel != nil && (*spec.AutoBlockRiskLevel <= 0 || *spec.AutoBlockRiskLevel > 1) {
+		return fmt.Errorf("%w: auto_block_risk_level must be greater than 0 and at most 1", ErrInvalidDevicePolicy)
+	}
+	if spec.AutoBlockAlertCount != nil && *spec.AutoBlockAlertCount < 1 {
+		return fmt.Errorf("%w: auto_block_alert_count must be at least 1", ErrInvalidDevicePolicy)
+	}
+	return nil
+}
+
+// GetDevicePolicy 获取分组或设备自身设置的策略，未设置时返回空策略
+func GetDevicePolicy(target model.DevicePolicyTarget, targetID string) (*model.DevicePolicySpec, error) {
+	if err := ensurePolicyTarget(target, targetID); err != nil {
+		return nil, err
+	}
+	return findDevicePolicy(target, targetID)
+}
+
+// SetDevicePolicy 设置分组或设备的策略，整体替换原有策略
+func SetDevicePolicy(target model.DevicePolicyTarget, targetID string, spec model.DevicePolicySpec, operator string) (*model.DevicePolicySpec, error) {
+	if err := ensurePolicyTarget(target, targetID); err != nil {
+		return nil, err
+	}
+	if err := ValidateDevicePolicy(&spec); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode device policy: %v", err)
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var policy model.DevicePolicy
+		err := tx.Where("target_type = ? AND target_id = ?", target, targetID).First(&policy).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			policy = model.DevicePolicy{
+				ID:         utils.GenerateUUID(),
+				TargetType: target,
+				TargetID:   targetID,
+			}
+		} else if err != nil {
+			return err
+		}
+		policy.Policy = string(data)
+		policy.UpdateTime = time.Now()
+		policy.UpdatedBy = operator
+		return tx.Save(&policy).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save device policy: %v", err)
+	}
+	return &spec, nil
+}
+
+// DeleteDevicePolicy 删除分组或设备的策略，之后完全继承上级分组
+func DeleteDevicePolicy(target model.DevicePolicyTarget, targetID string) error {
+	if err := ensurePolicyTarget(target, targetID); err != nil {
+		return err
+	}
+	if err := database.GetDB().Where("target_type = ? AND target_id = ?", target, targetID).
+		Delete(&model.DevicePolicy{}).Error; err != nil {
+		return fmt.Errorf("failed to delete device policy: %v", err)
+	}
+	return nil
+}
+
+// GetEffectiveDevicePolicy 计算设备实际生效的策略
+//
+// 从顶级分组到设备所在分组依次合并，下级分组覆盖上级，设备自身的策略最后覆盖。
+func GetEffectiveDevicePolicy(deviceID string) (*EffectiveDevicePolicy, error) {
+	device, err := GetDevice(deviceID)
+	if err != nil {
+		return nil, ErrDeviceNotFound
+	}
+	return effectiveDevicePolicy(device)
+}
+
+// effectiveDevicePolicy 计算已加载设备的生效策略
+func effectiveDevicePolicy(device *model.Device) (*EffectiveDevicePolicy, error) {
+	effective := &EffectiveDevicePolicy{
+		DeviceID: device.ID,
+		GroupIDs: []string{},
+		Sources:  make(map[string]string),
+	}
+	if device.GroupID != "" {
+		groups, err := groupAncestors(device.GroupID)
+		if err != nil && !errors.Is(err, ErrGroupNotFound) {
+			return nil, err
+		}
+		for _, group := range groups {
+			spec, err := findDevicePolicy(model.DevicePolicyTargetGroup, group.ID)
+			if err != nil {
+				return nil, err
+			}
+			effective.GroupIDs = append(effective.GroupIDs, group.ID)
+			effective.merge(spec, "group:"+group.ID)
+		}
+	}
+
+	spec, err := findDevicePolicy(model.DevicePolicyTargetDevice, device.ID)
+	if err != nil {
+		return nil, err
+	}
+	effective.merge(spec, "device:"+device.ID)
+	return effective, nil
+}
+
+// merge 用spec中已设置的字段覆盖当前策略，并记录来源
+func (p *EffectiveDevicePolicy) merge(spec *model.DevicePolicySpec, source string) {
+	if spec.HeartbeatRate != nil {
+		p.Policy.HeartbeatRate = spec.HeartbeatRate
+		p.Sources[policyFieldHeartbeatRate] = source
+	}
+	if len(spec.AllowedCountries) > 0 {
+		p.Policy.AllowedCountries = spec.AllowedCountries
+		p.Sources[policyFieldAllowedCountries] = source
+	}
+	if len(spec.AlertRules) > 0 {
+		if p.Policy.AlertRules == nil {
+			p.Policy.AlertRules = make(map[string]bool, len(spec.AlertRules))
+		}
+		for title, enabled := range spec.AlertRules {
+			p.Policy.AlertRules[title] = enabled
+			p.Sources[policyFieldAlertRules+"."+title] = source
+		}
+	}
+	if spec.AutoBlockRiskLevel != nil {
+		p.Policy.AutoBlockRiskLevel = spec.AutoBlockRiskLevel
+		p.Sources[policyFieldAutoBlockRiskLevel] = source
+	}
+	if spec.AutoBlockAlertCount != nil {
+		p.Policy.AutoBlockAlertCount = spec.AutoBlockAlertCount
+		p.Sources[policyFieldAutoBlockAlertCount] = source
+	}
+}
+
+// EnforceCountryPolicy 检查客户端所在国家是否被设备的生效策略允许
+//
+// 只有策略限制了国家时才查询IP位置，查询结果有缓存且带超时。无法确定位置时（内网地址，或地理位置接口
+// 不可用且没有该IP的历史结果）放行心跳，避免接口故障时所有受限设备同时离线。
+func EnforceCountryPolicy(device *model.Device, clientIP string) error {
+	policy, err := effectiveDevicePolicy(device)
+	if err != nil {
+		return err
+	}
+	if len(policy.Policy.AllowedCountries) == 0 {
+		return nil
+	}
+	if !policy.CountryAllowed(lookupCountry(clientIP)) {
+		return ErrCountryNotAllowed
+	}
+	return nil
+}
+
+// applyAutoBlockPolicy 设备风险等级或未处理告警数达到策略阈值时自动封禁设备
+func applyAutoBlockPolicy(device *model.Device, riskLevel float64) {
+	if device.Status == model.DeviceStatusBlocked {
+		return
+	}
+	policy, err := GetEffectiveDevicePolicy(device.ID)
+	if err != nil {
+		log.Printf("Failed to get effective policy for device %s: %v", device.ID, err)
+		return
+	}
+
+	var reason string
+	if threshold := policy.Policy.AutoBlockRiskLevel; threshold != nil && riskLevel >= *threshold {
+		reason = fmt.Sprintf("风险等级 %.2f 达到策略阈值 %.2f", riskLevel, *threshold)
+	}
+	if threshold := policy.Policy.AutoBlockAlertCount; reason == "" && threshold != nil {
+		var open int64
+		if err := database.GetDB().Model(&model.Alert{}).
+			Where("device_id = ? AND status = ?", device.ID, model.AlertStatusOpen).
+			Count(&open).Error; err != nil {
+			log.Printf("Failed to count open alerts for device %s: %v", device.ID, err)
+			return
+		}
+		if open >= int64(*threshold) {
+			reason = fmt.Sprintf("未处理告警数 %d 达到策略阈值 %d", open, *threshold)
+		}
+	}
+	if reason == "" {
+		return
+	}
+
+	if _, err := BlockDeviceWithOptions(device.ID, BlockOptions{
+		Reason:   reason,
+		Operator: BlockOperatorPolicy,
+	}); err != nil {
+		log.Printf("Failed to auto-block device %s by policy: %v", device.ID, err)
+	}
+}
+
+// findDevicePolicy 获取已保存的策略，未设置时返回空策略
+func findDevicePolicy(target model.DevicePolicyTarget, targetID string) (*model.DevicePolicySpec, error) {
+	var policy model.DevicePolicy
+	err := database.GetDB().Where("target_type = ? AND target_id = ?", target, targetID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.DevicePolicySpec{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device policy: %v", err)
+	}
+
+	var spec model.DevicePolicySpec
+	if err := json.Unmarshal([]byte(policy.Policy), &spec); err != nil {
+		return nil, fmt.Errorf("failed to decode device policy: %v", err)
+	}
+	return &spec, nil
+}
+
+// ensurePolicyTarget 检查策略作用对象是否存在
+func ensurePolicyTarget(target model.DevicePolicyTarget, targetID string) error {
+	switch target {
+	case model.DevicePolicyTargetDevice:
+		if _, err := GetDevice(targetID); err != nil {
+			return ErrDeviceNotFound
+		}
+	case model.DevicePolicyTargetGroup:
+		if _, err := findGroup(targetID); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown target type %s", ErrInvalidDevicePolicy, target)
+	}
+	return nil
+}
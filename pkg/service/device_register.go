@@ -0,0 +1,226 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDeviceBlacklisted      = errors.New("device is blacklisted")
+	ErrDeviceBlocked          = errors.New("device is blocked")
+	ErrInvalidLicenseCode     = errors.New("invalid license code")
+	ErrLicenseUnavailable     = errors.New("license is not available for this device")
+	ErrLicenseExpired         = errors.New("license has expired")
+	ErrReregisterUnauthorized = errors.New("device is already registered, sign the request with its credential")
+)
+
+// defaultHeartbeatRate 新设备默认心跳间隔（秒），与Device.HeartbeatRate的列默认值一致
+const defaultHeartbeatRate = 60
+
+// credentialRevokedByRegister 设备重新注册时吊销旧密钥记录的操作人
+const credentialRevokedByRegister = "register"
+
+// DeviceProfile 客户端上报的设备硬件信息
+type DeviceProfile struct {
+	Name         string
+	Type         string
+	DiskID       string
+	BIOS         string
+	Motherboard  string
+	NetworkCards []map[string]string
+	DisplayCard  string
+	Resolution   string
+	Timezone     string
+	Language     string
+	ClientIP     string // 客户端IP，由服务端根据请求填写
+	// AuthenticatedDeviceID 请求通过设备凭证认证时的设备ID，由服务端根据请求填写；重新注册已有设备时必须与该设备一致
+	AuthenticatedDeviceID string
+}
+
+// DeviceRegistration 设备自注册结果
+type DeviceRegistration struct {
+	Device       *model.Device  `json:"device"`
+	License      *model.License `json:"license"`
+	CredentialID string         `json:"credential_id"`
+	Secret       string         `json:"secret"`
+	Created      bool           `json:"created"`
+}
+
+// SelfRegisterDevice 客户端自注册设备并激活授权码
+//
+// 硬件信息与已有设备相同时视为重新注册，请求必须使用该设备的有效凭证签名，否则返回ErrReregisterUnauthorized，
+// 避免仅凭硬件信息接管其他设备。设备写入、授权绑定和密钥签发在同一事务中完成。
+func SelfRegisterDevice(licenseCode string, profile *DeviceProfile) (*DeviceRegistration, error) {
+	license, err := GetLicenseByCode(licenseCode)
+	if err != nil {
+		return nil, ErrInvalidLicenseCode
+	}
+	if time.Now().After(license.ExpireTime) {
+		return nil, ErrLicenseExpired
+	}
+
+	candidate, err := buildDeviceFromProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按硬件信息去重
+	existing, err := GetDeviceByHardwareInfo(profile.DiskID, profile.BIOS, profile.Motherboard)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if existing != nil && IsDeviceBlocked(existing) {
+		return nil, ErrDeviceBlocked
+	}
+	if existing != nil && profile.AuthenticatedDeviceID != existing.ID {
+		return nil, ErrReregisterUnauthorized
+	}
+
+	// 黑名单检查，使用本次上报的硬件信息匹配
+	subject := &BlacklistSubject{
+		Device:      candidate,
+		IP:          profile.ClientIP,
+		LicenseCode: license.Code,
+		Customer:    license.GroupID,
+	}
+	rule, err := FindMatchingBlacklistRule(subject)
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil {
+		switch {
+		case existing != nil:
+			subject.Device = existing
+			handleBlacklistMatch(subject, rule, BlacklistActionRegister)
+		case rule.BlockDevice:
+			// 需要封禁的新设备先入库，便于记录异常行为和后续审核
+			if err := database.GetDB().Create(candidate).Error; err != nil {
+				return nil, fmt.Errorf("failed to create device: %v", err)
+			}
+			handleBlacklistMatch(subject, rule, BlacklistActionRegister)
+		default:
+			log.Printf("Rejected registration of blacklisted device (rule %s, disk %s)", rule.ID, candidate.DiskID)
+		}
+		return nil, ErrDeviceBlacklisted
+	}
+
+	// 授权码已绑定到本设备时视为重复激活
+	alreadyActivated := existing != nil && license.DeviceID == existing.ID &&
+		license.Status == model.LicenseStatusUsed
+	if !alreadyActivated && license.Status != model.LicenseStatusUnused {
+		return nil, ErrLicenseUnavailable
+	}
+
+	created := existing == nil
+	device := candidate
+	if !created {
+		device = existing
+	}
+	var credential *model.DeviceCredential
+	var secret string
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if created {
+			if err := tx.Create(device).Error; err != nil {
+				return fmt.Errorf("failed to create device: %v", err)
+			}
+		} else if err := refreshDeviceProfile(tx, device, candidate); err != nil {
+			return err
+		}
+
+		// 黑名单已按包含客户端IP的检查对象判定过，这里直接绑定授权，不经过ActivateLicense的再次检查，
+		// 否则放行本次注册的IP、网段或国家规则不再生效，刚创建的设备会被拒绝甚至封禁
+		if !alreadyActivated {
+			if err := activateLicenseTx(tx, licenseCode, device.ID); err != nil {
+				return err
+			}
+		}
+
+		// 重新注册时吊销之前签发的密钥，避免有效密钥不断累积
+		var err error
+		credential, secret, err = reissueDeviceCredentialTx(tx, device.ID, credentialRevokedByRegister)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !alreadyActivated {
+		triggerThresholdRules(device.ID, model.AlertMetricLicenseUsagePercent)
+		if license, err = GetLicenseByCode(licenseCode); err != nil {
+			return nil, err
+		}
+	}
+
+	return &DeviceRegistration{
+		Device:       device,
+		License:      license,
+		CredentialID: credential.ID,
+		Secret:       secret,
+		Created:      created,
+	}, nil
+}
+
+// buildDeviceFromProfile 根据上报信息构建设备记录
+func buildDeviceFromProfile(profile *DeviceProfile) (*model.Device, error) {
+	now := time.Now()
+	device := &model.Device{
+		ID:            utils.GenerateUUID(),
+		Name:          profile.Name,
+		Type:          profile.Type,
+		Status:        model.DeviceStatusNormal,
+		DiskID:        profile.DiskID,
+		BIOS:          profile.BIOS,
+		Motherboard:   profile.Motherboard,
+		DisplayCard:   profile.DisplayCard,
+		Resolution:    profile.Resolution,
+		Timezone:      profile.Timezone,
+		Language:      profile.Language,
+		HeartbeatRate: defaultHeartbeatRate,
+		LastSeen:      &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if len(profile.NetworkCards) > 0 {
+		networkCards, err := FormatNetworkCards(profile.NetworkCards)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network cards: %v", err)
+		}
+		device.NetworkCards = networkCards
+	}
+
+	if err := ValidateDeviceInfo(device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// refreshDeviceProfile 在事务内用最新上报的信息更新已有设备
+func refreshDeviceProfile(tx *gorm.DB, device, latest *model.Device) error {
+	updates := map[string]interface{}{
+		"name":          latest.Name,
+		"network_cards": latest.NetworkCards,
+		"display_card":  latest.DisplayCard,
+		"resolution":    latest.Resolution,
+		"timezone":      latest.Timezone,
+		"language":      latest.Language,
+		"last_seen":     latest.LastSeen,
+		"updated_at":    latest.UpdatedAt,
+	}
+	if latest.Type != "" {
+		updates["type"] = latest.Type
+	}
+
+	if err := tx.Model(device).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update device: %v", err)
+	}
+	return nil
+}
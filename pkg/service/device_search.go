@@ -0,0 +1,319 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 200
+	defaultSearchSort  = "-created_at"
+)
+
+// ErrInvalidSearch 设备搜索参数无效
+var ErrInvalidSearch = errors.New("invalid device search")
+
+// DeviceSearchQuery 设备搜索条件，字段为空时不过滤，多个条件同时满足；JSON字段名与查询参数相同
+type DeviceSearchQuery struct {
+	Text             string            `json:"q"`                 // 在ID、名称、描述、硬件信息、网卡和授权码中模糊匹配
+	Name             string            `json:"name"`              // 名称模糊匹配
+	Types            []string          `json:"type"`              // 设备类型，匹配任一
+	Statuses         []string          `json:"status"`            // 设备状态，匹配任一
+	DiskID           string            `json:"disk_id"`           // 硬盘序列号模糊匹配
+	BIOS             string            `json:"bios"`              // BIOS信息模糊匹配
+	Motherboard      string            `json:"motherboard"`       // 主板信息模糊匹配
+	GroupID          string            `json:"group_id"`          // 所在分组
+	IncludeSubgroups bool              `json:"include_subgroups"` // 是否包含GroupID的下级分组
+	Tags             []string          `json:"tag"`               // 必须同时具有的标签
+	Customer         string            `json:"customer"`          // 绑定授权所属的授权组（客户）
+	LicenseCode      string            `json:"license_code"`      // 绑定的授权码
+	RiskMin          *float64          `json:"risk_min"`          // 风险等级下限（含）
+	RiskMax          *float64          `json:"risk_max"`          // 风险等级上限（含）
+	LastSeenFrom     *time.Time        `json:"last_seen_from"`    // 最后活动时间下限（含）
+	LastSeenTo       *time.Time        `json:"last_seen_to"`      // 最后活动时间上限（不含）
+	MetadataKeys     []string          `json:"metadata_key"`      // 元数据中必须存在的顶层字段
+	Metadata         map[string]string `json:"metadata"`          // 元数据顶层字段等于指定值
+	Sort             string            `json:"-"`                 // 排序字段，前缀"-"表示降序，默认"-created_at"
+	Cursor           string            `json:"-"`                 // 上一页返回的next_cursor
+	Limit            int               `json:"-"`                 // 每页数量，默认20，最大200
+}
+
+// DeviceSearchResult 设备搜索结果，NextCursor为空表示没有更多数据
+type DeviceSearchResult struct {
+	List       []model.Device `json:"list"`
+	Total      int64          `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// searchSortKind 排序字段的值类型
+type searchSortKind int
+
+const (
+	sortKindTime searchSortKind = iota
+	sortKindString
+	sortKindFloat
+)
+
+// searchSortField 可排序字段，nullable字段的空值按最早时间排序
+type searchSortField struct {
+	column   string
+	kind     searchSortKind
+	nullable bool
+}
+
+var deviceSortFields = map[string]searchSortField{
+	"created_at":     {column: "created_at", kind: sortKindTime},
+	"updated_at":     {column: "updated_at", kind: sortKindTime},
+	"last_seen":      {column: "last_seen", kind: sortKindTime, nullable: true},
+	"last_heartbeat": {column: "last_heartbeat", kind: sortKindTime, nullable: true},
+	"name":           {column: "name", kind: sortKindString},
+	"risk_level":     {column: "risk_level", kind: sortKindFloat},
+}
+
+// searchNullTime 可空时间字段排序时空值的替代值
+var searchNullTime = time.Unix(0, 0).UTC()
+
+// searchCursor 游标内容：排序方式、上一页最后一条记录的排序值和ID
+type searchCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// SearchDevices 按条件搜索设备，使用游标分页
+func SearchDevices(q DeviceSearchQuery) (*DeviceSearchResult, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultSearchLimit
+	}
+	if q.Limit > maxSearchLimit {
+		q.Limit = maxSearchLimit
+	}
+	if q.Sort == "" {
+		q.Sort = defaultSearchSort
+	}
+	desc := strings.HasPrefix(q.Sort, "-")
+	field, ok := deviceSortFields[strings.TrimPrefix(q.Sort, "-")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported sort %q", ErrInvalidSearch, q.Sort)
+	}
+
+	query, err := applyDeviceSearch(database.GetDB().Model(&model.Device{}), q)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count devices: %v", err)
+	}
+
+	expr, exprVars := field.expr()
+	if q.Cursor != "" {
+		cursor, value, err := decodeSearchCursor(q.Cursor, field)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != q.Sort {
+			return nil, fmt.Errorf("%w: cursor does not match sort %q", ErrInvalidSearch, q.Sort)
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		vars := append(append([]interface{}{}, exprVars...), value)
+		vars = append(append(vars, exprVars...), value, cursor.ID)
+		query = query.Where(fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", expr, op, expr, op), vars...)
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	var devices []model.Device
+	if err := query.
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                fmt.Sprintf("%s %s, id %s", expr, direction, direction),
+			Vars:               exprVars,
+			WithoutParentheses: true,
+		}}).
+		Limit(q.Limit + 1).Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to search devices: %v", err)
+	}
+
+	result := &DeviceSearchResult{Total: total}
+	if len(devices) > q.Limit {
+		devices = devices[:q.Limit]
+		result.NextCursor = encodeSearchCursor(q.Sort, field, &devices[len(devices)-1])
+	}
+	if err := loadDeviceTags(devices); err != nil {
+		return nil, err
+	}
+	result.List = devices
+	return result, nil
+}
+
+// applyDeviceSearch 将搜索条件应用到查询
+func applyDeviceSearch(query *gorm.DB, q DeviceSearchQuery) (*gorm.DB, error) {
+	db := database.GetDB()
+
+	if text := strings.TrimSpace(q.Text); text != "" {
+		pattern := likePattern(text)
+		query = query.Where(
+			"id = ? OR name LIKE ? ESCAPE '!' OR description LIKE ? ESCAPE '!' OR disk_id LIKE ? ESCAPE '!' "+
+				"OR bios LIKE ? ESCAPE '!' OR motherboard LIKE ? ESCAPE '!' OR network_cards LIKE ? ESCAPE '!' OR id IN (?)",
+			text, pattern, pattern, pattern, pattern, pattern, pattern,
+			db.Model(&model.License{}).Select("device_id").Where("code = ?", text),
+		)
+	}
+	if q.Name != "" {
+		query = query.Where("name LIKE ? ESCAPE '!'", likePattern(q.Name))
+	}
+	if len(q.Types) > 0 {
+		query = query.Where("type IN ?", q.Types)
+	}
+	if len(q.Statuses) > 0 {
+		query = query.Where("status IN ?", q.Statuses)
+	}
+	if q.DiskID != "" {
+		query = query.Where("disk_id LIKE ? ESCAPE '!'", likePattern(q.DiskID))
+	}
+	if q.BIOS != "" {
+		query = query.Where("bios LIKE ? ESCAPE '!'", likePattern(q.BIOS))
+	}
+	if q.Motherboard != "" {
+		query = query.Where("motherboard LIKE ? ESCAPE '!'", likePattern(q.Motherboard))
+	}
+
+	if q.GroupID != "" {
+		groupIDs := []string{q.GroupID}
+		if q.IncludeSubgroups {
+			descendants, err := groupDescendantIDs(q.GroupID)
+			if err != nil {
+				return nil, err
+			}
+			groupIDs = append(groupIDs, descendants...)
+		}
+		query = query.Where("group_id IN ?", groupIDs)
+	}
+
+	if len(q.Tags) > 0 {
+		tags, err := normalizeTags(q.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+		query = query.Where("id IN (?)", db.Model(&model.DeviceTag{}).Select("device_id").
+			Where("tag IN ?", tags).Group("device_id").Having("COUNT(*) = ?", len(tags)))
+	}
+	if q.Customer != "" {
+		query = query.Where("id IN (?)", db.Model(&model.License{}).Select("device_id").Where("group_id = ?", q.Customer))
+	}
+	if q.LicenseCode != "" {
+		query = query.Where("id IN (?)", db.Model(&model.License{}).Select("device_id").Where("code = ?", q.LicenseCode))
+	}
+
+	if q.RiskMin != nil {
+		query = query.Where("risk_level >= ?", *q.RiskMin)
+	}
+	if q.RiskMax != nil {
+		query = query.Where("risk_level <= ?", *q.RiskMax)
+	}
+	if q.LastSeenFrom != nil {
+		query = query.Where("last_seen >= ?", *q.LastSeenFrom)
+	}
+	if q.LastSeenTo != nil {
+		query = query.Where("last_seen < ?", *q.LastSeenTo)
+	}
+
+	for _, key := range q.MetadataKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			query = applyMetadataKeyFilter(query, "metadata", key)
+		}
+	}
+	query = applyMetadataFilters(query, "metadata", q.Metadata)
+
+	return query, nil
+}
+
+// likePattern 转义LIKE通配符并生成包含匹配模式，转义字符为'!'
+func likePattern(value string) string {
+	replacer := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return "%" + replacer.Replace(value) + "%"
+}
+
+// expr 返回排序表达式及其参数
+func (f searchSortField) expr() (string, []interface{}) {
+	if f.nullable {
+		return fmt.Sprintf("COALESCE(%s, ?)", f.column), []interface{}{searchNullTime}
+	}
+	return f.column, nil
+}
+
+// encodeSearchCursor 根据一页中最后一条记录生成游标
+func encodeSearchCursor(sort string, field searchSortField, device *model.Device) string {
+	var value string
+	switch field.column {
+	case "created_at":
+		value = device.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "updated_at":
+		value = device.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case "last_seen":
+		value = nullableCursorTime(device.LastSeen)
+	case "last_heartbeat":
+		value = nullableCursorTime(device.LastHeartbeat)
+	case "name":
+		value = device.Name
+	case "risk_level":
+		value = strconv.FormatFloat(device.RiskLevel, 'g', -1, 64)
+	}
+
+	data, _ := json.Marshal(searchCursor{Sort: sort, Value: value, ID: device.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// nullableCursorTime 格式化可空时间，空值使用排序时的替代值
+func nullableCursorTime(t *time.Time) string {
+	if t == nil {
+		return searchNullTime.Format(time.RFC3339Nano)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// decodeSearchCursor 解析游标，并按排序字段类型转换排序值
+func decodeSearchCursor(raw string, field searchSortField) (*searchCursor, interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	var cursor searchCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+
+	switch field.kind {
+	case sortKindTime:
+		t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+		}
+		return &cursor, t, nil
+	case sortKindFloat:
+		f, err := strconv.ParseFloat(cursor.Value, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+		}
+		return &cursor, f, nil
+	default:
+		return &cursor, cursor.Value, nil
+	}
+}
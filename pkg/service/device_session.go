@@ -0,0 +1,163 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// touchDeviceSession 根据心跳延长设备当前会话，会话已超时或不存在时开始新会话
+func touchDeviceSession(device *model.Device, ip string, now time.Time) error {
+	timeout := deviceHeartbeatTimeout(device)
+	var interval time.Duration
+	var ended *model.UsageRecord
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 锁定设备行，避免并发心跳同时创建会话
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").Where("id = ?", device.ID).First(&model.Device{}).Error; err != nil {
+			return err
+		}
+
+		var record model.UsageRecord
+		err := tx.Where("device_id = ? AND active = ?", device.ID, true).
+			Order("start_time DESC").First(&record).Error
+		switch {
+		case err == nil && now.Sub(record.EndTime) <= timeout:
+			interval = now.Sub(record.EndTime)
+			updates := map[string]interface{}{
+				"end_time": now,
+				"duration": int64(now.Sub(record.StartTime).Seconds()),
+			}
+			if ip != "" {
+				updates["ip"] = ip
+			}
+			return tx.Model(&model.UsageRecord{}).Where("id = ?", record.ID).Updates(updates).Error
+		case err == nil:
+			// 上一个会话已超时但尚未被监控结束，在最后一次心跳处结束
+			if err := tx.Model(&model.UsageRecord{}).Where("device_id = ? AND active = ?", device.ID, true).
+				Update("active", false).Error; err != nil {
+				return err
+			}
+			ended = &record
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		id := utils.GenerateUUID()
+		return tx.Create(&model.UsageRecord{
+			ID:        id,
+			DeviceID:  device.ID,
+			StartTime: now,
+			EndTime:   now,
+			SessionID: id,
+			IP:        ip,
+			Active:    true,
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if interval > 0 {
+		triggerAnomalyObservation(device.ID, model.AnomalyMetricHeartbeatInterval, math.Floor(interval.Seconds()))
+	}
+	if ended != nil {
+		triggerAnomalyObservation(device.ID, model.AnomalyMetricSessionLength, float64(ended.Duration))
+	}
+	return nil
+}
+
+// endDeviceSessions 结束设备所有进行中的会话，结束时间为最后一次心跳
+func endDeviceSessions(deviceID string) error {
+	var records []model.UsageRecord
+	if err := database.GetDB().Where("device_id = ? AND active = ?", deviceID, true).Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to get device sessions: %v", err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if err := database.GetDB().Model(&model.UsageRecord{}).
+		Where("device_id = ? AND active = ?", deviceID, true).
+		Update("active", false).Error; err != nil {
+		return fmt.Errorf("failed to end device sessions: %v", err)
+	}
+	for _, record := range records {
+		triggerAnomalyObservation(deviceID, model.AnomalyMetricSessionLength, float64(record.Duration))
+	}
+	return nil
+}
+
+// CloseIdleSessions 结束超过心跳超时未收到心跳的会话，返回结束的会话数
+func CloseIdleSessions(now time.Time) (int, error) {
+	var records []model.UsageRecord
+	if err := database.GetDB().Where("active = ?", true).Find(&records).Error; err != nil {
+		return 0, fmt.Errorf("failed to get active sessions: %v", err)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	deviceIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		deviceIDs = append(deviceIDs, record.DeviceID)
+	}
+	var devices []model.Device
+	if err := database.GetDB().Unscoped().Where("id IN ?", deviceIDs).Find(&devices).Error; err != nil {
+		return 0, fmt.Errorf("failed to get session devices: %v", err)
+	}
+	byID := make(map[string]*model.Device, len(devices))
+	for i := range devices {
+		byID[devices[i].ID] = &devices[i]
+	}
+
+	closed := 0
+	for _, record := range records {
+		query := database.GetDB().Model(&model.UsageRecord{}).Where("id = ? AND active = ?", record.ID, true)
+		device, ok := byID[record.DeviceID]
+		// 设备已删除时直接结束会话
+		deleted := !ok || device.DeletedAt.Valid
+		if !deleted {
+			cutoff := now.Add(-deviceHeartbeatTimeout(device))
+			if !record.EndTime.Before(cutoff) {
+				continue
+			}
+			// 查询之后收到的心跳会延长会话，条件不再满足时保留会话
+			query = query.Where("end_time < ?", cutoff)
+		}
+
+		res := query.Update("active", false)
+		if res.Error != nil {
+			return closed, fmt.Errorf("failed to close idle sessions: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		closed++
+		if !deleted {
+			triggerAnomalyObservation(record.DeviceID, model.AnomalyMetricSessionLength, float64(record.Duration))
+		}
+	}
+	return closed, nil
+}
+
+// GetActiveDeviceSession 获取设备进行中的会话，没有时返回nil
+func GetActiveDeviceSession(deviceID string) (*model.UsageRecord, error) {
+	var record model.UsageRecord
+	err := database.GetDB().Where("device_id = ? AND active = ?", deviceID, true).
+		Order("start_time DESC").First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device session: %v", err)
+	}
+	return &record, nil
+}
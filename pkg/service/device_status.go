@@ -0,0 +1,263 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidDeviceStatus = errors.New("invalid device status")
+
+// validDeviceStatuses 允许设置的设备状态
+var validDeviceStatuses = map[string]bool{
+	model.DeviceStatusNormal:      true,
+	model.DeviceStatusOffline:     true,
+	model.DeviceStatusBlocked:     true,
+	model.DeviceStatusSuspect:     true,
+	model.DeviceStatusDisabled:    true,
+	model.DeviceStatusUnknown:     true,
+	model.DeviceStatusMaintenance: true,
+}
+
+// DeviceTransition 设备状态变更参数
+type DeviceTransition struct {
+	Status   string                 // 目标状态
+	Reason   string                 // 变更原因
+	Actor    string                 // 操作人用户ID或系统标识
+	Metadata map[string]interface{} // 附加信息
+	Updates  map[string]interface{} // 与状态一同更新的其他字段
+	From     []string               // 仅当当前状态为其中之一时变更，为空时不限制
+	// Guard 在锁定的设备行上执行的额外检查，返回false时与不满足From相同，不做任何修改
+	Guard func(device *model.Device) bool
+}
+
+// TransitionDeviceStatus 变更设备状态并记录状态历史
+//
+// 所有设备状态变化都应通过该函数完成。返回值表示状态是否发生了变化；
+// 当前状态不满足From限制时不做任何修改。
+func TransitionDeviceStatus(deviceID string, t DeviceTransition) (bool, error) {
+	var change *statusChange
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = transitionDeviceStatusTx(tx, deviceID, t)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	publishStatusChange(change)
+	return change != nil, nil
+}
+
+// transitionDeviceStatusTx 在事务内变更设备状态
+//
+// 状态未变化时返回nil。调用方应在事务提交后通过publishStatusChange发布事件。
+func transitionDeviceStatusTx(tx *gorm.DB, deviceID string, t DeviceTransition) (*statusChange, error) {
+	if !validDeviceStatuses[t.Status] {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDeviceStatus, t.Status)
+	}
+
+	var device model.Device
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", deviceID).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, err
+	}
+
+	if len(t.From) > 0 && !containsStatus(t.From, device.Status) {
+		return nil, nil
+	}
+	if t.Guard != nil && !t.Guard(&device) {
+		return nil, nil
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+	for k, v := range t.Updates {
+		updates[k] = v
+	}
+	updates["status"] = t.Status
+	updates["updated_at"] = now
+
+	if err := tx.Model(&model.Device{}).Where("id = ?", deviceID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if device.Status == t.Status {
+		return nil, nil
+	}
+
+	metadata := ""
+	if len(t.Metadata) > 0 {
+		data, err := json.Marshal(t.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal status metadata: %v", err)
+		}
+		metadata = string(data)
+	}
+
+	if err := tx.Create(&model.DeviceStatusHistory{
+		ID:         utils.GenerateUUID(),
+		DeviceID:   deviceID,
+		OldStatus:  device.Status,
+		NewStatus:  t.Status,
+		Reason:     t.Reason,
+		Metadata:   metadata,
+		CreateTime: now,
+		CreatedBy:  t.Actor,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to record status history: %v", err)
+	}
+
+	return &statusChange{
+		DeviceID:  deviceID,
+		GroupID:   device.GroupID,
+		OldStatus: device.Status,
+		NewStatus: t.Status,
+		Reason:    t.Reason,
+		Actor:     t.Actor,
+	}, nil
+}
+
+// containsStatus 判断状态是否在列表中
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// updateDevice 在同一事务中更新设备字段和状态，提交后发布状态变更事件
+func updateDevice(deviceID string, updates map[string]interface{}, operator, reason string) error {
+	var changes []*statusChange
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		changes, err = applyDeviceUpdatesTx(tx, deviceID, updates, operator, reason)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		publishStatusChange(change)
+	}
+	return nil
+}
+
+// applyDeviceUpdatesTx 在事务内应用设备的通用更新，status字段通过状态变更函数处理
+//
+// 设为blocked时按永久封禁处理，block_reason作为封禁原因；离开blocked时先解除封禁，
+// 保证封禁字段和封禁历史与直接调用封禁接口一致。
+func applyDeviceUpdatesTx(tx *gorm.DB, deviceID string, updates map[string]interface{}, operator, reason string) ([]*statusChange, error) {
+	var device model.Device
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", deviceID).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, err
+	}
+
+	var changes []*statusChange
+	if raw, ok := updates["status"]; ok {
+		status, ok := raw.(string)
+		if !ok || !validDeviceStatuses[status] {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDeviceStatus, raw)
+		}
+		delete(updates, "status")
+
+		var err error
+		if changes, err = applyStatusUpdateTx(tx, &device, status, updates, operator, reason); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(updates) == 0 {
+		return changes, nil
+	}
+	if err := tx.Model(&model.Device{}).Where("id = ?", deviceID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// applyStatusUpdateTx 将锁定的设备变更为目标状态，封禁和解封分别走blockDeviceTx和unblockDeviceTx
+func applyStatusUpdateTx(tx *gorm.DB, device *model.Device, status string, updates map[string]interface{}, operator, reason string) ([]*statusChange, error) {
+	if status == device.Status {
+		return nil, nil
+	}
+	now := time.Now()
+
+	if status == model.DeviceStatusBlocked {
+		opts := BlockOptions{Reason: reason, Operator: operator}
+		if blockReason, ok := updates["block_reason"].(string); ok && blockReason != "" {
+			opts.Reason = blockReason
+		}
+		delete(updates, "block_reason")
+		delete(updates, "block_time")
+		delete(updates, "unblock_time")
+		change, err := blockDeviceTx(tx, device.ID, opts, nil, now)
+		if err != nil {
+			return nil, err
+		}
+		return []*statusChange{change}, nil
+	}
+
+	var changes []*statusChange
+	if device.Status == model.DeviceStatusBlocked {
+		change, err := unblockDeviceTx(tx, device.ID, operator, reason, now, nil)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+		if status == model.DeviceStatusNormal {
+			return changes, nil
+		}
+	}
+
+	change, err := transitionDeviceStatusTx(tx, device.ID, DeviceTransition{
+		Status: status,
+		Reason: reason,
+		Actor:  operator,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, change), nil
+}
+
+// GetDeviceStatusHistory 获取设备状态变更历史，startTime/endTime为nil时不限制
+func GetDeviceStatusHistory(deviceID string, startTime, endTime *time.Time, page, pageSize int) ([]model.DeviceStatusHistory, int64, error) {
+	var history []model.DeviceStatusHistory
+	var total int64
+
+	query := database.GetDB().Model(&model.DeviceStatusHistory{}).Where("device_id = ?", deviceID)
+	if startTime != nil {
+		query = query.Where("create_time >= ?", *startTime)
+	}
+	if endTime != nil {
+		query = query.Where("create_time <= ?", *endTime)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count device status history: %v", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("create_time DESC").Offset(offset).Limit(pageSize).Find(&history).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get device status history: %v", err)
+	}
+
+	return history, total, nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxDeviceTags  = 50 // 单个设备最多的标签数
+	maxTagLength   = 64
+	maxTagListSize = 1000
+)
+
+// ErrInvalidTag 标签无效
+var ErrInvalidTag = errors.New("invalid device tag")
+
+// TagCount 标签及使用该标签的设备数
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// normalizeTags 去除空白、转为小写并去重
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || strings.ContainsAny(tag, ",") {
+			return nil, fmt.Errorf("%w: %q must be at most %d characters without commas", ErrInvalidTag, tag, maxTagLength)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result, nil
+}
+
+// GetDeviceTags 获取设备标签，按名称排序
+func GetDeviceTags(deviceID string) ([]string, error) {
+	if _, err := GetDevice(deviceID); err != nil {
+		return nil, ErrDeviceNotFound
+	}
+	return findDeviceTags(database.GetDB(), deviceID)
+}
+
+// SetDeviceTags 替换设备的全部标签
+func SetDeviceTags(deviceID string, tags []string, operator string) ([]string, error) {
+	return updateDeviceTags(deviceID, tags, operator, true)
+}
+
+// AddDeviceTags 为设备追加标签，已有的标签保持不变
+func AddDeviceTags(deviceID string, tags []string, operator string) ([]string, error) {
+	return updateDeviceTags(deviceID, tags, operator, false)
+}
+
+// RemoveDeviceTag 删除设备的一个标签
+func RemoveDeviceTag(deviceID, tag string) error {
+	if _, err := GetDevice(deviceID); err != nil {
+		return ErrDeviceNotFound
+	}
+	if err := database.GetDB().Where("device_id = ? AND tag = ?", deviceID, strings.ToLower(strings.TrimSpace(tag))).
+		Delete(&model.DeviceTag{}).Error; err != nil {
+		return fmt.Errorf("failed to remove device tag: %v", err)
+	}
+	return nil
+}
+
+// ListTags 获取所有标签及设备数，按设备数降序
+func ListTags() ([]TagCount, error) {
+	var counts []TagCount
+	if err := database.GetDB().Model(&model.DeviceTag{}).
+		Select("tag, COUNT(*) AS count").
+		Where("device_id IN (?)", database.GetDB().Model(&model.Device{}).Select("id")).
+		Group("tag").Order("count DESC, tag ASC").Limit(maxTagListSize).
+		Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list device tags: %v", err)
+	}
+	return counts, nil
+}
+
+// updateDeviceTags 追加或替换设备标签，返回更新后的全部标签
+func updateDeviceTags(deviceID string, tags []string, operator string, replace bool) ([]string, error) {
+	if _, err := GetDevice(deviceID); err != nil {
+		return nil, ErrDeviceNotFound
+	}
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if replace {
+			if err := tx.Where("device_id = ?", deviceID).Delete(&model.DeviceTag{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(tags) > 0 {
+			now := time.Now()
+			rows := make([]model.DeviceTag, 0, len(tags))
+			for _, tag := range tags {
+				rows = append(rows, model.DeviceTag{DeviceID: deviceID, Tag: tag, CreatedAt: now, CreatedBy: operator})
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		result, err = findDeviceTags(tx, deviceID)
+		if err != nil {
+			return err
+		}
+		if len(result) > maxDeviceTags {
+			return fmt.Errorf("%w: a device can have at most %d tags", ErrInvalidTag, maxDeviceTags)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidTag) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update device tags: %v", err)
+	}
+	return result, nil
+}
+
+// findDeviceTags 查询设备标签
+func findDeviceTags(db *gorm.DB, deviceID string) ([]string, error) {
+	tags := []string{}
+	if err := db.Model(&model.DeviceTag{}).Where("device_id = ?", deviceID).
+		Order("tag ASC").Pluck("tag", &tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device tags: %v", err)
+	}
+	return tags, nil
+}
+
+// loadDeviceTags 为设备列表批量填充标签
+func loadDeviceTags(devices []model.Device) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+
+	var rows []model.DeviceTag
+	if err := database.GetDB().Where("device_id IN ?", ids).Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to get device tags: %v", err)
+	}
+	byDevice := make(map[string][]string, len(devices))
+	for _, row := range rows {
+		byDevice[row.DeviceID] = append(byDevice[row.DeviceID], row.Tag)
+	}
+	for i := range devices {
+		tags := byDevice[devices[i].ID]
+		sort.Strings(tags)
+		devices[i].Tags = tags
+	}
+	return nil
+}
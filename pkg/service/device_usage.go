@@ -0,0 +1,377 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxUsageRange         = 366 * 24 * time.Hour // 使用统计查询和重建的最大时间范围
+	maxUsageReportRecords = 1000                 // 使用报告最多返回的会话记录数
+	usageRollupBatchSize  = 200
+)
+
+// ErrInvalidUsageQuery 使用统计查询参数无效
+var ErrInvalidUsageQuery = errors.New("invalid usage query")
+
+// usagePeriodStart 返回t所在统计周期的开始时间，使用t所在时区；汇总统一按服务器本地时区划分周期
+func usagePeriodStart(t time.Time, period model.UsagePeriod) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if period == model.UsagePeriodWeek {
+		// 周一为一周开始
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+// usagePeriodEnd 返回统计周期的结束时间（不含）
+func usagePeriodEnd(start time.Time, period model.UsagePeriod) time.Time {
+	if period == model.UsagePeriodWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// validateUsageRange 检查统计时间范围
+func validateUsageRange(from, to time.Time) error {
+	if !to.After(from) || to.Sub(from) > maxUsageRange {
+		return fmt.Errorf("%w: range must be positive and at most %v", ErrInvalidUsageQuery, maxUsageRange)
+	}
+	return nil
+}
+
+// usageSlice 会话落在统计周期内的部分
+type usageSlice struct {
+	deviceID string
+	from, to time.Time
+	started  bool // 会话是否在周期内开始
+}
+
+// RollupUsage 根据会话记录重新计算at所在周期的设备和分组使用汇总，覆盖已有结果
+func RollupUsage(period model.UsagePeriod, at time.Time) error {
+	if !period.IsValid() {
+		return fmt.Errorf("%w: unknown period %q", ErrInvalidUsageQuery, period)
+	}
+	start := usagePeriodStart(at.Local(), period)
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		return rollupUsageTx(tx, period, start)
+	})
+}
+
+// rollupUsageTx 在事务中重新计算从start开始的统计周期的使用汇总
+func rollupUsageTx(tx *gorm.DB, period model.UsagePeriod, start time.Time) error {
+	end := usagePeriodEnd(start, period)
+
+	var records []model.UsageRecord
+	if err := tx.Where("start_time < ? AND end_time >= ?", end, start).
+		Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to get usage records: %v", err)
+	}
+
+	slices := make([]usageSlice, 0, len(records))
+	deviceIDs := make([]string, 0, len(records))
+	seen := make(map[string]bool)
+	for _, record := range records {
+		slice := usageSlice{
+			deviceID: record.DeviceID,
+			from:     record.StartTime,
+			to:       record.EndTime,
+			started:  !record.StartTime.Before(start),
+		}
+		if slice.from.Before(start) {
+			slice.from = start
+		}
+		if slice.to.After(end) {
+			slice.to = end
+		}
+		slices = append(slices, slice)
+		if !seen[record.DeviceID] {
+			seen[record.DeviceID] = true
+			deviceIDs = append(deviceIDs, record.DeviceID)
+		}
+	}
+
+	groups, err := deviceGroupIDs(tx, deviceIDs)
+	if err != nil {
+		return err
+	}
+	deviceRollups := buildDeviceUsageRollups(slices, groups, period, start)
+	groupRollups := buildGroupUsageRollups(slices, groups, period, start)
+
+	if err := tx.Where("period = ? AND period_start = ?", period, start).
+		Delete(&model.DeviceUsageRollup{}).Error; err != nil {
+		return fmt.Errorf("failed to clear device usage rollups: %v", err)
+	}
+	if err := tx.Where("period = ? AND period_start = ?", period, start).
+		Delete(&model.GroupUsageRollup{}).Error; err != nil {
+		return fmt.Errorf("failed to clear group usage rollups: %v", err)
+	}
+	if len(deviceRollups) > 0 {
+		if err := tx.CreateInBatches(deviceRollups, usageRollupBatchSize).Error; err != nil {
+			return fmt.Errorf("failed to save device usage rollups: %v", err)
+		}
+	}
+	if len(groupRollups) > 0 {
+		if err := tx.CreateInBatches(groupRollups, usageRollupBatchSize).Error; err != nil {
+			return fmt.Errorf("failed to save group usage rollups: %v", err)
+		}
+	}
+	return nil
+}
+
+// deviceGroupIDs 查询设备当前所属分组，已删除的设备同样计入
+func deviceGroupIDs(db *gorm.DB, deviceIDs []string) (map[string]string, error) {
+	groups := make(map[string]string, len(deviceIDs))
+	if len(deviceIDs) == 0 {
+		return groups, nil
+	}
+	var devices []model.Device
+	if err := db.Unscoped().Select("id", "group_id").
+		Where("id IN ?", deviceIDs).Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device groups: %v", err)
+	}
+	for _, device := range devices {
+		groups[device.ID] = device.GroupID
+	}
+	return groups, nil
+}
+
+// buildDeviceUsageRollups 按设备汇总会话
+func buildDeviceUsageRollups(slices []usageSlice, groups map[string]string, period model.UsagePeriod, start time.Time) []model.DeviceUsageRollup {
+	byDevice := make(map[string]*model.DeviceUsageRollup)
+	var order []string
+	for _, s := range slices {
+		rollup, ok := byDevice[s.deviceID]
+		if !ok {
+			rollup = &model.DeviceUsageRollup{
+				DeviceID:    s.deviceID,
+				GroupID:     groups[s.deviceID],
+				Period:      period,
+				PeriodStart: start,
+			}
+			byDevice[s.deviceID] = rollup
+			order = append(order, s.deviceID)
+		}
+
+		seconds := int64(s.to.Sub(s.from).Seconds())
+		rollup.TotalTime += seconds
+		if seconds > rollup.LongestSession {
+			rollup.LongestSession = seconds
+		}
+		if s.started {
+			rollup.SessionCount++
+		}
+		if s.to.After(rollup.LastActive) {
+			rollup.LastActive = s.to
+		}
+	}
+
+	rollups := make([]model.DeviceUsageRollup, 0, len(order))
+	for _, id := range order {
+		rollups = append(rollups, *byDevice[id])
+	}
+	return rollups
+}
+
+// buildGroupUsageRollups 按分组汇总会话，并计算活跃设备数和并发峰值
+func buildGroupUsageRollups(slices []usageSlice, groups map[string]string, period model.UsagePeriod, start time.Time) []model.GroupUsageRollup {
+	byGroup := make(map[string][]usageSlice)
+	var order []string
+	for _, s := range slices {
+		groupID := groups[s.deviceID]
+		if _, ok := byGroup[groupID]; !ok {
+			order = append(order, groupID)
+		}
+		byGroup[groupID] = append(byGroup[groupID], s)
+	}
+
+	rollups := make([]model.GroupUsageRollup, 0, len(order))
+	for _, groupID := range order {
+		rollup := model.GroupUsageRollup{
+			GroupID:     groupID,
+			Period:      period,
+			PeriodStart: start,
+		}
+		devices := make(map[string]bool)
+		for _, s := range byGroup[groupID] {
+			rollup.TotalTime += int64(s.to.Sub(s.from).Seconds())
+			if s.started {
+				rollup.SessionCount++
+			}
+			devices[s.deviceID] = true
+		}
+		rollup.ActiveDevices = len(devices)
+		rollup.PeakConcurrency, rollup.PeakAt = peakConcurrency(byGroup[groupID])
+		rollups = append(rollups, rollup)
+	}
+	return rollups
+}
+
+// peakConcurrency 计算同时进行的会话数峰值及首次达到峰值的时间，忽略时长为0的会话
+func peakConcurrency(slices []usageSlice) (int, *time.Time) {
+	type edge struct {
+		at    time.Time
+		delta int
+	}
+	edges := make([]edge, 0, len(slices)*2)
+	for _, s := range slices {
+		if !s.to.After(s.from) {
+			continue
+		}
+		edges = append(edges, edge{s.from, 1}, edge{s.to, -1})
+	}
+	// 同一时刻先处理结束再处理开始，首尾相接的会话不算并发
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at.Equal(edges[j].at) {
+			return edges[i].delta < edges[j].delta
+		}
+		return edges[i].at.Before(edges[j].at)
+	})
+
+	var (
+		current, peak int
+		peakAt        *time.Time
+	)
+	for i := range edges {
+		current += edges[i].delta
+		if current > peak {
+			peak = current
+			at := edges[i].at
+			peakAt = &at
+		}
+	}
+	return peak, peakAt
+}
+
+// RefreshUsageRollups 重新计算now所在及上一个自然日和自然周的使用汇总
+func RefreshUsageRollups(now time.Time) error {
+	for _, period := range []model.UsagePeriod{model.UsagePeriodDay, model.UsagePeriodWeek} {
+		current := usagePeriodStart(now, period)
+		previous := usagePeriodStart(current.Add(-time.Second), period)
+		for _, at := range []time.Time{previous, current} {
+			if err := RollupUsage(period, at); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RebuildUsageRollups 重新计算[from, to)范围内所有自然日和自然周的使用汇总，返回计算的周期数
+func RebuildUsageRollups(from, to time.Time) (int, error) {
+	if err := validateUsageRange(from, to); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, period := range []model.UsagePeriod{model.UsagePeriodDay, model.UsagePeriodWeek} {
+		for start := usagePeriodStart(from.Local(), period); start.Before(to); start = usagePeriodEnd(start, period) {
+			if err := RollupUsage(period, start); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetDeviceUsageRollups 获取设备在[from, to)内开始的周期汇总，没有使用记录的周期不返回
+func GetDeviceUsageRollups(deviceID string, period model.UsagePeriod, from, to time.Time) ([]model.DeviceUsageRollup, error) {
+	if !period.IsValid() {
+		return nil, fmt.Errorf("%w: unknown period %q", ErrInvalidUsageQuery, period)
+	}
+	if err := validateUsageRange(from, to); err != nil {
+		return nil, err
+	}
+	if _, err := GetDevice(deviceID); err != nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	var rollups []model.DeviceUsageRollup
+	if err := database.GetDB().
+		Where("device_id = ? AND period = ? AND period_start >= ? AND period_start < ?", deviceID, period, from, to).
+		Order("period_start ASC").Find(&rollups).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device usage rollups: %v", err)
+	}
+	return rollups, nil
+}
+
+// GetGroupUsageRollups 获取分组在[from, to)内开始的周期汇总，groupIDs为空时返回所有分组
+func GetGroupUsageRollups(groupIDs []string, period model.UsagePeriod, from, to time.Time) ([]model.GroupUsageRollup, error) {
+	if !period.IsValid() {
+		return nil, fmt.Errorf("%w: unknown period %q", ErrInvalidUsageQuery, period)
+	}
+	if err := validateUsageRange(from, to); err != nil {
+		return nil, err
+	}
+
+	query := database.GetDB().Where("period = ? AND period_start >= ? AND period_start < ?", period, from, to)
+	if len(groupIDs) > 0 {
+		query = query.Where("group_id IN ?", groupIDs)
+	}
+	var rollups []model.GroupUsageRollup
+	if err := query.Order("period_start ASC, group_id ASC").Find(&rollups).Error; err != nil {
+		return nil, fmt.Errorf("failed to get group usage rollups: %v", err)
+	}
+	return rollups, nil
+}
+
+// GetDeviceUsageStats 根据按天汇总计算设备在[from, to)内的使用统计
+func GetDeviceUsageStats(deviceID string, from, to time.Time) (*model.UsageStats, error) {
+	rollups, err := GetDeviceUsageRollups(deviceID, model.UsagePeriodDay, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &model.UsageStats{}
+	sessions := 0
+	weeks := make(map[time.Time]bool)
+	for _, rollup := range rollups {
+		stats.TotalUsageTime += rollup.TotalTime
+		sessions += rollup.SessionCount
+		if rollup.TotalTime > stats.PeakUsageTime {
+			stats.PeakUsageTime = rollup.TotalTime
+		}
+		if rollup.LastActive.After(stats.LastActiveDate) {
+			stats.LastActiveDate = rollup.LastActive
+		}
+		weeks[usagePeriodStart(rollup.PeriodStart, model.UsagePeriodWeek)] = true
+	}
+	if sessions > 0 {
+		stats.AverageUsageTime = stats.TotalUsageTime / int64(sessions)
+	}
+	stats.DailyActiveCount = len(rollups)
+	stats.WeeklyActiveCount = len(weeks)
+	return stats, nil
+}
+
+// GetDeviceUsageReport 生成设备在[from, to)内的使用报告，合计来自按天汇总，明细为与范围重叠的会话
+func GetDeviceUsageReport(deviceID string, from, to time.Time) (*model.UsageReport, error) {
+	rollups, err := GetDeviceUsageRollups(deviceID, model.UsagePeriodDay, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.UsageReport{
+		DeviceID:  deviceID,
+		StartTime: from,
+		EndTime:   to,
+	}
+	for _, rollup := range rollups {
+		report.TotalTime += rollup.TotalTime
+		report.SessionCount += rollup.SessionCount
+	}
+
+	if err := database.GetDB().Where("device_id = ? AND start_time < ? AND end_time >= ?", deviceID, to, from).
+		Order("start_time ASC").Limit(maxUsageReportRecords).Find(&report.Records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get usage records: %v", err)
+	}
+	return report, nil
+}
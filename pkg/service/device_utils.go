@@ -4,34 +4,42 @@ import (
 	"LVerity/pkg/model"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 )
 
-// MatchBlacklistRule 检查设备是否匹配黑名单规则
-func MatchBlacklistRule(device *model.Device, rule *model.BlacklistRule) (bool, error) {
-	var value string
+// MatchBlacklistRule 检查黑名单检查对象是否匹配规则
+//
+// 对象缺少规则所需的字段（如未知客户端IP）时视为不匹配。
+func MatchBlacklistRule(subject *BlacklistSubject, rule *model.BlacklistRule) (bool, error) {
+	device := subject.Device
+	if device == nil {
+		device = &model.Device{}
+	}
 
-	// 根据规则类型获取对应的设备信息
+	// 根据规则类型获取对应的信息
 	switch rule.Type {
-	case "disk_id":
-		value = device.DiskID
-	case "bios":
-		value = device.BIOS
-	case "motherboard":
-		value = device.Motherboard
+	case model.BlacklistRuleTypeDiskID:
+		return matchBlacklistPattern(rule.Pattern, device.DiskID)
+	case model.BlacklistRuleTypeBIOS:
+		return matchBlacklistPattern(rule.Pattern, device.BIOS)
+	case model.BlacklistRuleTypeMotherboard:
+		return matchBlacklistPattern(rule.Pattern, device.Motherboard)
+	case model.BlacklistRuleTypeLicenseCode:
+		return matchBlacklistPattern(rule.Pattern, subject.LicenseCode)
+	case model.BlacklistRuleTypeCustomer:
+		return matchBlacklistPattern(rule.Pattern, subject.Customer)
+	case model.BlacklistRuleTypeIP:
+		return matchIPRule(rule.Pattern, subject.IP)
+	case model.BlacklistRuleTypeCIDR:
+		return matchCIDRRule(rule.Pattern, subject.IP)
+	case model.BlacklistRuleTypeMAC:
+		return matchMACRule(rule.Pattern, device.NetworkCards)
+	case model.BlacklistRuleTypeCountry:
+		return matchCountryRule(rule.Pattern, subject.country())
 	default:
 		return false, fmt.Errorf("unknown rule type: %s", rule.Type)
 	}
-
-	// 使用正则表达式匹配
-	matched, err := regexp.MatchString(rule.Pattern, value)
-	if err != nil {
-		return false, fmt.Errorf("invalid pattern: %v", err)
-	}
-
-	return matched, nil
 }
 
 // CompareDevices 比较两个设备的差异
@@ -79,8 +87,7 @@ func IsDeviceOnline(device *model.Device) bool {
 	if device.LastHeartbeat == nil {
 		return false
 	}
-	heartbeatTimeout := time.Duration(device.HeartbeatRate) * time.Second * 2
-	return time.Since(*device.LastHeartbeat) <= heartbeatTimeout
+	return time.Since(*device.LastHeartbeat) <= deviceHeartbeatTimeout(device)
 }
 
 // IsDeviceBlocked 检查设备是否被封禁
@@ -5,38 +5,79 @@ import (
 	"LVerity/pkg/model"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
+	"sync"
 	"time"
 )
 
 const (
 	geoIPAPIEndpoint = "http://ip-api.com/json/%s"
+	geoIPTimeout     = 3 * time.Second // 地理位置查询超时，查询在心跳和日志上报的请求中同步进行
+	geoIPMaxBodySize = 64 << 10
 	earthRadius      = 6371.0 // 地球半径，单位：公里
 )
 
+// geoIPClient 地理位置查询使用的HTTP客户端
+var geoIPClient = &http.Client{Timeout: geoIPTimeout}
+
 // GeoIPResponse IP地理位置信息响应
 type GeoIPResponse struct {
-	Status  string  `json:"status"`
-	Country string  `json:"country"`
-	City    string  `json:"city"`
-	Lat     float64 `json:"lat"`
-	Lon     float64 `json:"lon"`
-	Message string  `json:"message"`
+	Status      string  `json:"status"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"countryCode"`
+	City        string  `json:"city"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Message     string  `json:"message"`
+}
+
+// LocationResolver 按IP解析地理位置
+type LocationResolver func(ip string) (*model.Location, error)
+
+// locationResolver 黑名单、设备策略和日志上报查询IP所属国家时使用的解析函数，默认为GetLocationFromIP
+var locationResolver = struct {
+	sync.RWMutex
+	resolve LocationResolver
+}{resolve: GetLocationFromIP}
+
+// SetLocationResolver 替换查询IP所属国家使用的解析函数（如离线IP库），resolver为nil时恢复默认，并清空国家缓存
+func SetLocationResolver(resolver LocationResolver) {
+	if resolver == nil {
+		resolver = GetLocationFromIP
+	}
+	locationResolver.Lock()
+	locationResolver.resolve = resolver
+	locationResolver.Unlock()
+
+	countryCache.Lock()
+	countryCache.entries = make(map[string]countryCacheEntry)
+	countryCache.Unlock()
+}
+
+// currentLocationResolver 返回当前的解析函数
+func currentLocationResolver() LocationResolver {
+	locationResolver.RLock()
+	defer locationResolver.RUnlock()
+	return locationResolver.resolve
 }
 
 // GetLocationFromIP 从IP获取地理位置信息
 func GetLocationFromIP(ip string) (*model.Location, error) {
 	url := fmt.Sprintf(geoIPAPIEndpoint, ip)
 
-	resp, err := http.Get(url)
+	resp, err := geoIPClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geolocation failed: status %d", resp.StatusCode)
+	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, geoIPMaxBodySize))
 	if err != nil {
 		return nil, err
 	}
@@ -51,10 +92,11 @@ func GetLocationFromIP(ip string) (*model.Location, error) {
 	}
 
 	return &model.Location{
-		Latitude:  geoIP.Lat,
-		Longitude: geoIP.Lon,
-		Country:   geoIP.Country,
-		City:      geoIP.City,
+		Latitude:    geoIP.Lat,
+		Longitude:   geoIP.Lon,
+		Country:     geoIP.Country,
+		CountryCode: geoIP.CountryCode,
+		City:        geoIP.City,
 	}, nil
 }
 
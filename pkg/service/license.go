@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // GenerateLicense 生成授权码
@@ -74,19 +76,14 @@ func VerifyLicense(code string) (bool, error) {
 }
 
 // ActivateLicense 激活授权码
+//
+// 管理端激活没有设备的客户端IP，黑名单只按设备硬件、授权码和客户匹配；设备自注册在SelfRegisterDevice中已做完整检查。
 func ActivateLicense(code string, deviceID string) error {
 	var license model.License
 	if err := database.GetDB().Where("code = ?", code).First(&license).Error; err != nil {
 		return fmt.Errorf("failed to get license: %v", err)
 	}
 
-	// 处理 Features 字段
-	if license.FeaturesStr != "" {
-		if err := json.Unmarshal([]byte(license.FeaturesStr), &license.Features); err != nil {
-			return fmt.Errorf("failed to unmarshal features: %v", err)
-		}
-	}
-
 	// 检查授权状态
 	if license.Status != model.LicenseStatusUnused {
 		return fmt.Errorf("license is not unused")
@@ -97,13 +94,49 @@ func ActivateLicense(code string, deviceID string) error {
 		return fmt.Errorf("license has expired")
 	}
 
-	// 更新授权状态
-	license.Status = model.LicenseStatusUsed
-	license.DeviceID = deviceID
-	license.UpdatedAt = time.Now()
+	// 黑名单检查
+	if device, err := GetDevice(deviceID); err == nil {
+		if IsDeviceBlocked(device) {
+			return ErrDeviceBlocked
+		}
+		subject := &BlacklistSubject{Device: device, LicenseCode: license.Code, Customer: license.GroupID}
+		if err := EnforceBlacklist(subject, BlacklistActionActivate); err != nil {
+			return err
+		}
+	}
 
-	if err := database.GetDB().Save(&license).Error; err != nil {
-		return fmt.Errorf("failed to update license: %v", err)
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		return activateLicenseTx(tx, code, deviceID)
+	}); err != nil {
+		return err
+	}
+
+	triggerThresholdRules(deviceID, model.AlertMetricLicenseUsagePercent)
+	return nil
+}
+
+// activateLicenseTx 在事务内将未使用的授权码绑定到设备并创建使用记录
+//
+// 状态检查和绑定在同一条条件更新中完成，并发激活同一授权码时只有一个成功，其余返回ErrLicenseUnavailable。
+func activateLicenseTx(tx *gorm.DB, code string, deviceID string) error {
+	now := time.Now()
+	res := tx.Model(&model.License{}).
+		Where("code = ? AND status = ? AND expire_time > ?", code, model.LicenseStatusUnused, now).
+		Updates(map[string]interface{}{
+			"status":     model.LicenseStatusUsed,
+			"device_id":  deviceID,
+			"updated_at": now,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("failed to update license: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrLicenseUnavailable
+	}
+
+	var license model.License
+	if err := tx.Select("id").Where("code = ?", code).First(&license).Error; err != nil {
+		return fmt.Errorf("failed to get license: %v", err)
 	}
 
 	// 创建使用记录
@@ -111,16 +144,14 @@ func ActivateLicense(code string, deviceID string) error {
 		ID:        utils.GenerateUUID(),
 		LicenseID: license.ID,
 		DeviceID:  deviceID,
-		StartTime: time.Now(),
+		StartTime: now,
 		Status:    "active",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
-
-	if err := database.GetDB().Create(usage).Error; err != nil {
+	if err := tx.Create(usage).Error; err != nil {
 		return fmt.Errorf("failed to create license usage: %v", err)
 	}
-
 	return nil
 }
 
@@ -443,21 +474,6 @@ func AddTagsToLicense(licenseID string, tagIDs []string) error {
 	return tx.Commit().Error
 }
 
-// UpdateLicenseMetadata 更新授权码元数据
-func UpdateLicenseMetadata(code string, metadata string) error {
-	result := database.GetDB().Model(&model.License{}).
-		Where("code = ?", code).
-		Update("metadata", metadata)
-
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("license not found")
-	}
-	return nil
-}
-
 // UpdateLicenseFeatures 更新授权码功能列表
 func UpdateLicenseFeatures(licenseID string, features []string) error {
 	featuresJSON, err := json.Marshal(features)
@@ -471,7 +487,7 @@ func UpdateLicenseFeatures(licenseID string, features []string) error {
 }
 
 // ListLicenses 获取授权码列表
-func ListLicenses(page string, pageSize string, status string, groupID string) ([]model.License, int64, error) {
+func ListLicenses(page string, pageSize string, status string, groupID string, metadata map[string]string) ([]model.License, int64, error) {
 	var licenses []model.License
 	var total int64
 
@@ -485,6 +501,7 @@ func ListLicenses(page string, pageSize string, status string, groupID string) (
 	if groupID != "" {
 		query = query.Where("group_id = ?", groupID)
 	}
+	query = applyMetadataFilters(query, "metadata", metadata)
 
 	// 获取总数
 	if err := query.Count(&total).Error; err != nil {
@@ -12,15 +12,22 @@ import (
 
 // ExportDeviceLogs 导出设备日志
 func ExportDeviceLogs(writer io.Writer, opts model.LogExportOptions) error {
-	query := database.GetDB().Model(&model.DeviceLog{}).
-		Where("timestamp BETWEEN ? AND ?", opts.StartTime, opts.EndTime)
-
-	if opts.DeviceID != "" {
-		query = query.Where("device_id = ?", opts.DeviceID)
+	filter := DeviceLogFilter{
+		DeviceID: opts.DeviceID,
+		Types:    opts.LogTypes,
+		Levels:   opts.Levels,
+		Source:   opts.Source,
 	}
+	if !opts.StartTime.IsZero() {
+		filter.StartTime = &opts.StartTime
+	}
+	if !opts.EndTime.IsZero() {
+		filter.EndTime = &opts.EndTime
+	}
+	query := applyDeviceLogFilter(database.GetDB().Model(&model.DeviceLog{}), filter)
 
 	var logs []model.DeviceLog
-	if err := query.Find(&logs).Error; err != nil {
+	if err := query.Order("timestamp ASC").Find(&logs).Error; err != nil {
 		return err
 	}
 
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLicenseNotFound 授权码不存在
+var ErrLicenseNotFound = errors.New("license not found")
+
+// ApplyMergePatch 按JSON Merge Patch（RFC 7386）修改元数据，值为null的字段被删除
+func ApplyMergePatch(metadata map[string]interface{}, patch json.RawMessage) (map[string]interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(patch, &value); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	patchObject, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: merge patch must be a JSON object", ErrInvalidMetadata)
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	return mergePatch(metadata, patchObject).(map[string]interface{}), nil
+}
+
+// mergePatch 递归合并，patch不是对象时整体替换
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// decodeMetadata 解析保存的元数据，空值返回空对象
+func decodeMetadata(value string) (map[string]interface{}, error) {
+	metadata := make(map[string]interface{})
+	if value == "" {
+		return metadata, nil
+	}
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		return nil, fmt.Errorf("%w: stored metadata is not a JSON object", ErrInvalidMetadata)
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	return metadata, nil
+}
+
+// encodeMetadata 序列化元数据，空对象保存为空字符串
+func encodeMetadata(metadata map[string]interface{}) (string, error) {
+	if len(metadata) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+	return string(data), nil
+}
+
+// PatchDeviceMetadata 按JSON Merge Patch修改设备元数据并按设备类型的结构定义校验
+func PatchDeviceMetadata(deviceID string, patch json.RawMessage) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var device model.Device
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", deviceID).First(&device).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDeviceNotFound
+			}
+			return err
+		}
+
+		metadata, err := decodeMetadata(device.Metadata)
+		if err != nil {
+			return err
+		}
+		if metadata, err = ApplyMergePatch(metadata, patch); err != nil {
+			return err
+		}
+		if err := ValidateMetadata(model.MetadataTargetDevice, device.Type, metadata); err != nil {
+			return err
+		}
+		value, err := encodeMetadata(metadata)
+		if err != nil {
+			return err
+		}
+		result = metadata
+		return tx.Model(&model.Device{}).Where("id = ?", deviceID).Updates(map[string]interface{}{
+			"metadata":   value,
+			"updated_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prepareDeviceMetadataUpdate 校验设备更新中的元数据字段，并转换为保存的JSON字符串
+func prepareDeviceMetadataUpdate(deviceID string, updates map[string]interface{}) error {
+	value, ok := updates["metadata"]
+	if !ok {
+		return nil
+	}
+
+	var metadata map[string]interface{}
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		metadata = v
+	case string:
+		var err error
+		if metadata, err = decodeMetadata(v); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidMetadata)
+	}
+
+	deviceType, _ := updates["type"].(string)
+	if _, ok := updates["type"]; !ok {
+		device, err := GetDevice(deviceID)
+		if err != nil {
+			return err
+		}
+		deviceType = device.Type
+	}
+	if err := ValidateMetadata(model.MetadataTargetDevice, deviceType, metadata); err != nil {
+		return err
+	}
+	encoded, err := encodeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	updates["metadata"] = encoded
+	return nil
+}
+
+// UpdateLicenseMetadata 更新授权码元数据，key为授权码ID或授权码，metadata为JSON对象或空字符串
+func UpdateLicenseMetadata(key string, metadata string) error {
+	license, err := findLicenseByKey(database.GetDB(), key)
+	if err != nil {
+		return err
+	}
+	values, err := decodeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	if err := ValidateMetadata(model.MetadataTargetLicense, string(license.Type), values); err != nil {
+		return err
+	}
+	value, err := encodeMetadata(values)
+	if err != nil {
+		return err
+	}
+	return database.GetDB().Model(&model.License{}).Where("id = ?", license.ID).Updates(map[string]interface{}{
+		"metadata":   value,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// PatchLicenseMetadata 按JSON Merge Patch修改授权码元数据并按授权类型的结构定义校验
+func PatchLicenseMetadata(key string, patch json.RawMessage) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		license, err := findLicenseByKey(tx.Clauses(clause.Locking{Strength: "UPDATE"}), key)
+		if err != nil {
+			return err
+		}
+
+		metadata, err := decodeMetadata(license.Metadata)
+		if err != nil {
+			return err
+		}
+		if metadata, err = ApplyMergePatch(metadata, patch); err != nil {
+			return err
+		}
+		if err := ValidateMetadata(model.MetadataTargetLicense, string(license.Type), metadata); err != nil {
+			return err
+		}
+		value, err := encodeMetadata(metadata)
+		if err != nil {
+			return err
+		}
+		result = metadata
+		return tx.Model(&model.License{}).Where("id = ?", license.ID).Updates(map[string]interface{}{
+			"metadata":   value,
+			"updated_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// findLicenseByKey 按授权码ID或授权码查找授权
+func findLicenseByKey(db *gorm.DB, key string) (*model.License, error) {
+	var license model.License
+	if err := db.Where("id = ? OR code = ?", key, key).First(&license).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLicenseNotFound
+		}
+		return nil, fmt.Errorf("failed to get license: %v", err)
+	}
+	return &license, nil
+}
+
+// applyMetadataFilters 按元数据顶层字段的值过滤
+//
+// 使用JSON路径函数取出字段后按JSON值比较，值为JSON数字或布尔值时同时匹配字符串和对应的字面量。
+func applyMetadataFilters(query *gorm.DB, column string, filters map[string]string) *gorm.DB {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		encodedValue, _ := json.Marshal(filters[key])
+		candidates := []string{string(encodedValue)}
+
+		var literal interface{}
+		if json.Unmarshal([]byte(filters[key]), &literal) == nil {
+			switch literal.(type) {
+			case float64, bool:
+				encodedLiteral, _ := json.Marshal(literal)
+				candidates = append(candidates, string(encodedLiteral))
+			}
+		}
+
+		conditions := make([]string, 0, len(candidates))
+		args := make([]interface{}, 0, len(candidates)*2)
+		for _, candidate := range candidates {
+			conditions = append(conditions, metadataValueCondition(query, column))
+			args = append(args, metadataPath(key), candidate)
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return query
+}
+
+// applyMetadataKeyFilter 要求元数据中存在指定的顶层字段
+func applyMetadataKeyFilter(query *gorm.DB, column, key string) *gorm.DB {
+	document := metadataDocument(query, column)
+	if query.Dialector.Name() == "sqlite" {
+		return query.Where(fmt.Sprintf("json_type(%s, ?) IS NOT NULL", document), metadataPath(key))
+	}
+	return query.Where(fmt.Sprintf("JSON_CONTAINS_PATH(%s, 'one', ?) = 1", document), metadataPath(key))
+}
+
+// metadataValueCondition 生成比较元数据字段与JSON编码值的条件，参数依次为JSON路径和编码后的值
+func metadataValueCondition(query *gorm.DB, column string) string {
+	document := metadataDocument(query, column)
+	if query.Dialector.Name() == "sqlite" {
+		// -> 返回字段的紧凑JSON文本，与Go编码结果一致
+		return fmt.Sprintf("(%s -> ?) = ?", document)
+	}
+	return fmt.Sprintf("JSON_EXTRACT(%s, ?) = CAST(? AS JSON)", document)
+}
+
+// metadataDocument 返回元数据列的JSON文档表达式，空值或非法JSON视为NULL，避免JSON函数报错
+func metadataDocument(query *gorm.DB, column string) string {
+	if query.Dialector.Name() == "sqlite" {
+		return fmt.Sprintf("CASE WHEN json_valid(%s) THEN %s END", column, column)
+	}
+	return fmt.Sprintf("CASE WHEN JSON_VALID(%s) THEN %s END", column, column)
+}
+
+// metadataPath 生成元数据顶层字段的JSON路径，字段名按JSON字符串转义
+func metadataPath(key string) string {
+	encoded, _ := json.Marshal(key)
+	return "$." + string(encoded)
+}
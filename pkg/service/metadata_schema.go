@@ -0,0 +1,343 @@
+package service
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxMetadataFields = 100
+
+var (
+	ErrMetadataSchemaNotFound = errors.New("metadata schema not found")
+	ErrMetadataSchemaExists   = errors.New("metadata schema already exists")
+	ErrInvalidMetadataSchema  = errors.New("invalid metadata schema")
+	ErrInvalidMetadata        = errors.New("invalid metadata")
+)
+
+// MetadataSchemaInput 创建或更新元数据结构定义的参数
+type MetadataSchemaInput struct {
+	Target          model.MetadataTarget  `json:"target"`
+	Scope           string                `json:"scope"` // 设备类型或授权类型，为空时为默认定义
+	Fields          []model.MetadataField `json:"fields"`
+	AllowAdditional bool                  `json:"allow_additional"`
+	Description     string                `json:"description"`
+}
+
+// validate 校验结构定义
+func (in *MetadataSchemaInput) validate() error {
+	if !in.Target.IsValid() {
+		return fmt.Errorf("%w: unsupported target %q", ErrInvalidMetadataSchema, in.Target)
+	}
+	in.Scope = strings.TrimSpace(in.Scope)
+	if len(in.Scope) > 100 {
+		return fmt.Errorf("%w: scope must be at most 100 characters", ErrInvalidMetadataSchema)
+	}
+	if len(in.Fields) > maxMetadataFields {
+		return fmt.Errorf("%w: at most %d fields are allowed", ErrInvalidMetadataSchema, maxMetadataFields)
+	}
+
+	names := make(map[string]bool, len(in.Fields))
+	for i := range in.Fields {
+		field := &in.Fields[i]
+		field.Name = strings.TrimSpace(field.Name)
+		if field.Name == "" {
+			return fmt.Errorf("%w: field name is required", ErrInvalidMetadataSchema)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("%w: duplicate field %q", ErrInvalidMetadataSchema, field.Name)
+		}
+		names[field.Name] = true
+		if !field.Type.IsValid() {
+			return fmt.Errorf("%w: field %q has unsupported type %q", ErrInvalidMetadataSchema, field.Name, field.Type)
+		}
+		if len(field.Enum) == 0 {
+			continue
+		}
+		switch field.Type {
+		case model.MetadataFieldString, model.MetadataFieldNumber, model.MetadataFieldInteger:
+		default:
+			return fmt.Errorf("%w: enum is not supported for %s field %q", ErrInvalidMetadataSchema, field.Type, field.Name)
+		}
+		for _, value := range field.Enum {
+			if !metadataTypeMatches(field.Type, value) {
+				return fmt.Errorf("%w: enum value %v of field %q is not of type %s", ErrInvalidMetadataSchema, value, field.Name, field.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateMetadataSchema 创建元数据结构定义，同一对象和类型只能有一个定义
+func CreateMetadataSchema(input MetadataSchemaInput, operator string) (*model.MetadataSchema, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	if err := checkMetadataSchemaScope(input.Target, input.Scope, ""); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	schema := &model.MetadataSchema{
+		ID:        utils.GenerateUUID(),
+		CreatedBy: operator,
+		CreatedAt: now,
+	}
+	if err := applyMetadataSchemaInput(schema, input, operator, now); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Create(schema).Error; err != nil {
+		return nil, fmt.Errorf("failed to create metadata schema: %v", err)
+	}
+	return schema, nil
+}
+
+// UpdateMetadataSchema 更新元数据结构定义，只影响之后的写入，已保存的元数据不会重新校验
+func UpdateMetadataSchema(id string, input MetadataSchemaInput, operator string) (*model.MetadataSchema, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	schema, err := GetMetadataSchema(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMetadataSchemaScope(input.Target, input.Scope, id); err != nil {
+		return nil, err
+	}
+
+	if err := applyMetadataSchemaInput(schema, input, operator, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Save(schema).Error; err != nil {
+		return nil, fmt.Errorf("failed to update metadata schema: %v", err)
+	}
+	return schema, nil
+}
+
+// DeleteMetadataSchema 删除元数据结构定义，之后该类型的元数据按默认定义校验
+func DeleteMetadataSchema(id string) error {
+	result := database.GetDB().Where("id = ?", id).Delete(&model.MetadataSchema{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete metadata schema: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrMetadataSchemaNotFound
+	}
+	return nil
+}
+
+// GetMetadataSchema 获取元数据结构定义
+func GetMetadataSchema(id string) (*model.MetadataSchema, error) {
+	var schema model.MetadataSchema
+	if err := database.GetDB().Where("id = ?", id).First(&schema).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMetadataSchemaNotFound
+		}
+		return nil, fmt.Errorf("failed to get metadata schema: %v", err)
+	}
+	if err := decodeMetadataSchema(&schema); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// ListMetadataSchemas 获取元数据结构定义，target为空时返回全部
+func ListMetadataSchemas(target model.MetadataTarget) ([]model.MetadataSchema, error) {
+	query := database.GetDB().Model(&model.MetadataSchema{})
+	if target != "" {
+		query = query.Where("target = ?", target)
+	}
+	var schemas []model.MetadataSchema
+	if err := query.Order("target ASC, scope ASC").Find(&schemas).Error; err != nil {
+		return nil, fmt.Errorf("failed to list metadata schemas: %v", err)
+	}
+	for i := range schemas {
+		if err := decodeMetadataSchema(&schemas[i]); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// checkMetadataSchemaScope 检查对象和类型是否已有其它定义
+func checkMetadataSchemaScope(target model.MetadataTarget, scope, excludeID string) error {
+	query := database.GetDB().Model(&model.MetadataSchema{}).Where("target = ? AND scope = ?", target, scope)
+	if excludeID != "" {
+		query = query.Where("id <> ?", excludeID)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check metadata schema: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s scope %q", ErrMetadataSchemaExists, target, scope)
+	}
+	return nil
+}
+
+// applyMetadataSchemaInput 将参数写入结构定义
+func applyMetadataSchemaInput(schema *model.MetadataSchema, input MetadataSchemaInput, operator string, now time.Time) error {
+	fields := input.Fields
+	if fields == nil {
+		fields = []model.MetadataField{}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fields: %v", err)
+	}
+	schema.Target = input.Target
+	schema.Scope = input.Scope
+	schema.Fields = fields
+	schema.FieldsStr = string(data)
+	schema.AllowAdditional = input.AllowAdditional
+	schema.Description = input.Description
+	schema.UpdatedBy = operator
+	schema.UpdatedAt = now
+	return nil
+}
+
+// decodeMetadataSchema 解析保存的字段定义
+func decodeMetadataSchema(schema *model.MetadataSchema) error {
+	schema.Fields = []model.MetadataField{}
+	if schema.FieldsStr == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(schema.FieldsStr), &schema.Fields); err != nil {
+		return fmt.Errorf("failed to unmarshal metadata schema fields: %v", err)
+	}
+	return nil
+}
+
+// ValidateMetadata 按对象类型的结构定义校验元数据，没有定义时不做限制
+func ValidateMetadata(target model.MetadataTarget, scope string, metadata map[string]interface{}) error {
+	return metadataValidator{}.validate(target, scope, metadata)
+}
+
+// metadataValidator 缓存已加载的结构定义，批量校验时避免重复查询
+type metadataValidator map[string]*model.MetadataSchema
+
+// validate 校验元数据，优先使用对应类型的定义，其次使用默认定义
+func (v metadataValidator) validate(target model.MetadataTarget, scope string, metadata map[string]interface{}) error {
+	schema, err := v.schema(target, scope)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	var problems []string
+	defined := make(map[string]bool, len(schema.Fields))
+	for _, field := range schema.Fields {
+		defined[field.Name] = true
+		value, ok := metadata[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", field.Name))
+			}
+			continue
+		}
+		if !metadataTypeMatches(field.Type, value) {
+			problems = append(problems, fmt.Sprintf("%s must be of type %s", field.Name, field.Type))
+			continue
+		}
+		if len(field.Enum) > 0 && !metadataEnumContains(field.Enum, value) {
+			problems = append(problems, fmt.Sprintf("%s must be one of %s", field.Name, formatMetadataEnum(field.Enum)))
+		}
+	}
+	if !schema.AllowAdditional {
+		var unknown []string
+		for key := range metadata {
+			if !defined[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			problems = append(problems, fmt.Sprintf("%s is not defined in the schema", key))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidMetadata, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// schema 加载对象类型的结构定义，没有定义时返回nil
+func (v metadataValidator) schema(target model.MetadataTarget, scope string) (*model.MetadataSchema, error) {
+	key := string(target) + "/" + scope
+	if schema, ok := v[key]; ok {
+		return schema, nil
+	}
+
+	scopes := []string{scope}
+	if scope != "" {
+		scopes = append(scopes, "")
+	}
+	var schemas []model.MetadataSchema
+	if err := database.GetDB().Where("target = ? AND scope IN ?", target, scopes).Find(&schemas).Error; err != nil {
+		return nil, fmt.Errorf("failed to load metadata schema: %v", err)
+	}
+	var found *model.MetadataSchema
+	for i := range schemas {
+		if found == nil || schemas[i].Scope == scope {
+			found = &schemas[i]
+		}
+	}
+	if found != nil {
+		if err := decodeMetadataSchema(found); err != nil {
+			return nil, err
+		}
+	}
+	v[key] = found
+	return found, nil
+}
+
+// metadataTypeMatches 检查JSON解码后的值是否符合字段类型
+func metadataTypeMatches(fieldType model.MetadataFieldType, value interface{}) bool {
+	switch fieldType {
+	case model.MetadataFieldString:
+		_, ok := value.(string)
+		return ok
+	case model.MetadataFieldNumber:
+		_, ok := value.(float64)
+		return ok
+	case model.MetadataFieldInteger:
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case model.MetadataFieldBoolean:
+		_, ok := value.(bool)
+		return ok
+	case model.MetadataFieldObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case model.MetadataFieldArray:
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+// metadataEnumContains 检查值是否在可选值中
+func metadataEnumContains(enum []interface{}, value interface{}) bool {
+	for _, option := range enum {
+		if reflect.DeepEqual(option, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatMetadataEnum 生成可选值的提示文本
+func formatMetadataEnum(enum []interface{}) string {
+	data, _ := json.Marshal(enum)
+	return string(data)
+}
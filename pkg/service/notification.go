@@ -0,0 +1,865 @@
+package service
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxNotificationTemplate = 4096 // 模板的最大长度
+	maxNotifyChannels       = 20   // notify动作最多指定的渠道数
+	maxNotificationBackoff  = time.Hour
+	maxNotificationRetries  = 100 // 每次检查最多重试的通知数
+	notificationSecretMask  = "******"
+	// notificationEncryptedPrefix 加密保存的连接参数的前缀，没有前缀的值是加密之前保存的明文
+	notificationEncryptedPrefix = "enc:"
+)
+
+// 默认的通知模板
+const (
+	defaultNotificationSubject = `[{{.Alert.Level}}] {{.Alert.Title}}`
+	defaultNotificationBody    = `{{.Alert.Description}}
+
+Device: {{.Alert.DeviceID}}{{with .Device}} ({{.Name}}){{end}}
+Level: {{.Alert.Level}}
+Time: {{.Alert.CreatedAt.Format "2006-01-02 15:04:05 MST"}}{{with .Metadata.rule_name}}
+Rule: {{.}}{{end}}
+Alert ID: {{.Alert.ID}}`
+)
+
+var (
+	ErrNotificationChannelNotFound = errors.New("notification channel not found")
+	ErrNotificationChannelExists   = errors.New("notification channel already exists")
+	ErrNotificationChannelInUse    = errors.New("notification channel is used by alert rules")
+	ErrInvalidNotificationChannel  = errors.New("invalid notification channel")
+)
+
+// notificationMu 串行化通知的去重检查和创建，同一告警在每个渠道只发送一次
+var notificationMu sync.Mutex
+
+func init() {
+	alertActionTypes[model.AlertActionNotify] = alertActionType{
+		validate: validateNotifyAction,
+		check:    checkNotifyAction,
+		run:      runNotifyAction,
+	}
+}
+
+// NotificationChannelInput 创建或更新通知渠道的参数
+type NotificationChannelInput struct {
+	Name      string                          `json:"name"`
+	Type      model.NotificationChannelType   `json:"type"`
+	Config    model.NotificationChannelConfig `json:"config"`
+	MinLevel  model.AlertLevel                `json:"min_level"`
+	AllAlerts bool                            `json:"all_alerts"`
+	Subject   string                          `json:"subject"`
+	Template  string                          `json:"template"`
+	Enabled   *bool                           `json:"enabled"` // 创建时默认启用，更新时为空则保持不变
+}
+
+// validate 校验渠道参数
+func (in *NotificationChannelInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || len(in.Name) > 100 {
+		return fmt.Errorf("%w: name is required and must be at most 100 characters", ErrInvalidNotificationChannel)
+	}
+	if !in.Type.IsValid() {
+		return fmt.Errorf("%w: unsupported type %q", ErrInvalidNotificationChannel, in.Type)
+	}
+	if in.MinLevel != "" && !in.MinLevel.IsValid() {
+		return fmt.Errorf("%w: invalid min_level %q", ErrInvalidNotificationChannel, in.MinLevel)
+	}
+	if err := validateNotificationTemplates(in.Subject, in.Template); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotificationChannel, err)
+	}
+	if err := validateNotificationConfig(in.Type, &in.Config); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotificationChannel, err)
+	}
+	return nil
+}
+
+// validateNotificationConfig 按渠道类型校验连接参数
+func validateNotificationConfig(channelType model.NotificationChannelType, cfg *model.NotificationChannelConfig) error {
+	if channelType == model.NotificationChannelEmail {
+		cfg.Host = strings.TrimSpace(cfg.Host)
+		if cfg.Host == "" {
+			return fmt.Errorf("config.host is required")
+		}
+		if cfg.Port == 0 {
+			cfg.Port = 587
+		}
+		if cfg.Port < 1 || cfg.Port > 65535 {
+			return fmt.Errorf("config.port must be between 1 and 65535")
+		}
+		switch cfg.TLS {
+		case "", "starttls", "tls", "none":
+		default:
+			return fmt.Errorf("config.tls must be starttls, tls or none")
+		}
+		if _, err := mail.ParseAddress(cfg.From); err != nil {
+			return fmt.Errorf("config.from: %v", err)
+		}
+		if len(cfg.To) == 0 {
+			return fmt.Errorf("config.to is required")
+		}
+		for _, to := range cfg.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return fmt.Errorf("config.to %q: %v", to, err)
+			}
+		}
+		return nil
+	}
+
+	u, err := url.Parse(strings.TrimSpace(cfg.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("config.url must be an http or https URL")
+	}
+	cfg.URL = u.String()
+	return nil
+}
+
+// validateNotificationTemplates 检查标题和正文模板能否解析
+func validateNotificationTemplates(subject, body string) error {
+	if _, err := parseNotificationTemplate("subject", subject, defaultNotificationSubject); err != nil {
+		return err
+	}
+	_, err := parseNotificationTemplate("template", body, defaultNotificationBody)
+	return err
+}
+
+// parseNotificationTemplate 解析模板，text为空时使用默认模板
+func parseNotificationTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	if len(text) > maxNotificationTemplate {
+		return nil, fmt.Errorf("%s must be at most %d characters", name, maxNotificationTemplate)
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// CreateNotificationChannel 创建通知渠道
+func CreateNotificationChannel(input NotificationChannelInput, operator string) (*model.NotificationChannel, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	if err := checkNotificationChannelName(input.Name, ""); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	channel := &model.NotificationChannel{
+		ID:        utils.GenerateUUID(),
+		Enabled:   true,
+		CreatedBy: operator,
+		CreatedAt: now,
+	}
+	if err := applyNotificationChannelInput(channel, input, now); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Create(channel).Error; err != nil {
+		return nil, fmt.Errorf("failed to create notification channel: %v", err)
+	}
+	return maskNotificationChannel(channel), nil
+}
+
+// UpdateNotificationChannel 替换通知渠道，密码、密钥、URL和请求头为掩码时保持不变
+func UpdateNotificationChannel(id string, input NotificationChannelInput) (*model.NotificationChannel, error) {
+	channel, err := getNotificationChannel(id)
+	if err != nil {
+		return nil, err
+	}
+	if input.Config.Password == notificationSecretMask {
+		input.Config.Password = channel.Config.Password
+	}
+	if input.Config.Secret == notificationSecretMask {
+		input.Config.Secret = channel.Config.Secret
+	}
+	if input.Config.URL != "" && input.Config.URL == maskNotificationURL(channel.Config.URL) {
+		input.Config.URL = channel.Config.URL
+	}
+	for key, value := range input.Config.Headers {
+		if stored, ok := channel.Config.Headers[key]; ok && value == notificationSecretMask {
+			input.Config.Headers[key] = stored
+		}
+	}
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	if err := checkNotificationChannelName(input.Name, id); err != nil {
+		return nil, err
+	}
+
+	if err := applyNotificationChannelInput(channel, input, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Save(channel).Error; err != nil {
+		return nil, fmt.Errorf("failed to update notification channel: %v", err)
+	}
+	return maskNotificationChannel(channel), nil
+}
+
+// DeleteNotificationChannel 删除通知渠道，被告警规则引用的渠道不能删除，发送记录保留
+func DeleteNotificationChannel(id string) error {
+	if _, err := getNotificationChannel(id); err != nil {
+		return err
+	}
+
+	encoded, _ := json.Marshal(id)
+	var rules []string
+	if err := database.GetDB().Model(&model.AlertRule{}).
+		Where("actions LIKE ? ESCAPE '!'", likePattern(string(encoded))).
+		Limit(10).Pluck("name", &rules).Error; err != nil {
+		return fmt.Errorf("failed to check alert rules: %v", err)
+	}
+	if len(rules) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotificationChannelInUse, strings.Join(rules, ", "))
+	}
+
+	if err := database.GetDB().Where("id = ?", id).Delete(&model.NotificationChannel{}).Error; err != nil {
+		return fmt.Errorf("failed to delete notification channel: %v", err)
+	}
+	return nil
+}
+
+// GetNotificationChannel 获取通知渠道，密码、密钥、URL和请求头以掩码返回
+func GetNotificationChannel(id string) (*model.NotificationChannel, error) {
+	channel, err := getNotificationChannel(id)
+	if err != nil {
+		return nil, err
+	}
+	return maskNotificationChannel(channel), nil
+}
+
+// ListNotificationChannels 获取所有通知渠道，密码、密钥、URL和请求头以掩码返回
+func ListNotificationChannels() ([]model.NotificationChannel, error) {
+	var channels []model.NotificationChannel
+	if err := database.GetDB().Order("name ASC").Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to list notification channels: %v", err)
+	}
+	for i := range channels {
+		if err := decodeNotificationChannel(&channels[i]); err != nil {
+			return nil, err
+		}
+		channels[i] = *maskNotificationChannel(&channels[i])
+	}
+	return channels, nil
+}
+
+// getNotificationChannel 获取包含密码和密钥的通知渠道
+func getNotificationChannel(id string) (*model.NotificationChannel, error) {
+	var channel model.NotificationChannel
+	if err := database.GetDB().Where("id = ?", id).First(&channel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotificationChannelNotFound
+		}
+		return nil, fmt.Errorf("failed to get notification channel: %v", err)
+	}
+	if err := decodeNotificationChannel(&channel); err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// checkNotificationChannelName 检查名称是否已被其它渠道使用
+func checkNotificationChannelName(name, excludeID string) error {
+	query := database.GetDB().Model(&model.NotificationChannel{}).Where("name = ?", name)
+	if excludeID != "" {
+		query = query.Where("id <> ?", excludeID)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check notification channel: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %q", ErrNotificationChannelExists, name)
+	}
+	return nil
+}
+
+// applyNotificationChannelInput 将参数写入渠道，连接参数中的敏感字段加密保存
+func applyNotificationChannelInput(channel *model.NotificationChannel, input NotificationChannelInput, now time.Time) error {
+	stored, err := encryptNotificationConfig(input.Config)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+	channel.Name = input.Name
+	channel.Type = input.Type
+	channel.Config = input.Config
+	channel.ConfigStr = string(data)
+	channel.MinLevel = input.MinLevel
+	channel.AllAlerts = input.AllAlerts
+	channel.Subject = input.Subject
+	channel.Template = input.Template
+	if input.Enabled != nil {
+		channel.Enabled = *input.Enabled
+	}
+	channel.UpdatedAt = now
+	return nil
+}
+
+// decodeNotificationChannel 解析并解密渠道保存的连接参数
+func decodeNotificationChannel(channel *model.NotificationChannel) error {
+	if channel.ConfigStr == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(channel.ConfigStr), &channel.Config); err != nil {
+		return fmt.Errorf("failed to decode notification channel %s: %v", channel.ID, err)
+	}
+	if err := decryptNotificationConfig(&channel.Config); err != nil {
+		return fmt.Errorf("failed to decrypt notification channel %s: %v", channel.ID, err)
+	}
+	return nil
+}
+
+// encryptNotificationConfig 返回密码、密钥、URL和请求头的值加密后的副本，URL中通常带有机器人的令牌
+func encryptNotificationConfig(cfg model.NotificationChannelConfig) (model.NotificationChannelConfig, error) {
+	var err error
+	for _, field := range []*string{&cfg.Password, &cfg.Secret, &cfg.URL} {
+		if *field, err = encryptNotificationValue(*field); err != nil {
+			return cfg, err
+		}
+	}
+	if len(cfg.Headers) > 0 {
+		headers := make(map[string]string, len(cfg.Headers))
+		for key, value := range cfg.Headers {
+			if headers[key], err = encryptNotificationValue(value); err != nil {
+				return cfg, err
+			}
+		}
+		cfg.Headers = headers
+	}
+	return cfg, nil
+}
+
+// decryptNotificationConfig 解密encryptNotificationConfig加密的字段
+func decryptNotificationConfig(cfg *model.NotificationChannelConfig) error {
+	var err error
+	for _, field := range []*string{&cfg.Password, &cfg.Secret, &cfg.URL} {
+		if *field, err = decryptNotificationValue(*field); err != nil {
+			return err
+		}
+	}
+	for key, value := range cfg.Headers {
+		if cfg.Headers[key], err = decryptNotificationValue(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptNotificationValue 加密单个值，空值不加密
+func encryptNotificationValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	encrypted, err := utils.EncryptAES([]byte(value))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt notification config: %v", err)
+	}
+	return notificationEncryptedPrefix + encrypted, nil
+}
+
+// decryptNotificationValue 解密单个值，没有加密前缀的值原样返回
+func decryptNotificationValue(value string) (string, error) {
+	if !strings.HasPrefix(value, notificationEncryptedPrefix) {
+		return value, nil
+	}
+	plain, err := utils.DecryptAES(strings.TrimPrefix(value, notificationEncryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// maskNotificationChannel 返回密码、密钥和请求头的值替换为掩码、URL只保留协议和主机的副本
+func maskNotificationChannel(channel *model.NotificationChannel) *model.NotificationChannel {
+	masked := *channel
+	if masked.Config.Password != "" {
+		masked.Config.Password = notificationSecretMask
+	}
+	if masked.Config.Secret != "" {
+		masked.Config.Secret = notificationSecretMask
+	}
+	masked.Config.URL = maskNotificationURL(masked.Config.URL)
+	if len(masked.Config.Headers) > 0 {
+		headers := make(map[string]string, len(masked.Config.Headers))
+		for key := range masked.Config.Headers {
+			headers[key] = notificationSecretMask
+		}
+		masked.Config.Headers = headers
+	}
+	return &masked
+}
+
+// maskNotificationURL 将URL的路径和查询参数的值替换为掩码，机器人和Slack的令牌可能在路径或参数中
+func maskNotificationURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return notificationSecretMask
+	}
+	masked := u.Scheme + "://" + u.Host
+	if u.Path != "" && u.Path != "/" {
+		masked += "/" + notificationSecretMask
+	}
+	query := u.Query()
+	if len(query) > 0 {
+		keys := make([]string, 0, len(query))
+		for key := range query {
+			keys = append(keys, url.QueryEscape(key)+"="+notificationSecretMask)
+		}
+		sort.Strings(keys)
+		masked += "?" + strings.Join(keys, "&")
+	}
+	return masked
+}
+
+// alertLevelAtLeast 检查告警级别是否不低于min，min为空时总是满足
+func alertLevelAtLeast(level, min model.AlertLevel) bool {
+	return min == "" || level.GetPriority() >= min.GetPriority()
+}
+
+// NotificationData 通知模板的数据
+type NotificationData struct {
+	Alert    *model.Alert
+	Device   *model.Device          // 设备已删除或测试发送时为空
+	Metadata map[string]interface{} // 告警的元数据，规则告警包含rule_id、rule_name等
+}
+
+// RenderNotification 用渠道的模板渲染告警通知
+func RenderNotification(channel *model.NotificationChannel, alert *model.Alert, device *model.Device) (*NotificationMessage, error) {
+	return renderNotification(channel.Subject, channel.Template, alert, device)
+}
+
+// renderNotification 用指定模板渲染告警通知，模板为空时使用默认模板
+func renderNotification(subjectText, bodyText string, alert *model.Alert, device *model.Device) (*NotificationMessage, error) {
+	subjectTmpl, err := parseNotificationTemplate("subject", subjectText, defaultNotificationSubject)
+	if err != nil {
+		return nil, err
+	}
+	bodyTmpl, err := parseNotificationTemplate("template", bodyText, defaultNotificationBody)
+	if err != nil {
+		return nil, err
+	}
+
+	data := NotificationData{Alert: alert, Device: device}
+	if alert.Metadata != "" {
+		// 元数据不是JSON对象时模板中不可用
+		json.Unmarshal([]byte(alert.Metadata), &data.Metadata)
+	}
+
+	var subject, body bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %v", err)
+	}
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %v", err)
+	}
+	return &NotificationMessage{
+		// 标题用于邮件头，不能包含换行
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Body:    body.String(),
+		Level:   alert.Level,
+		Alert:   alert,
+	}, nil
+}
+
+// notifyAlert 将告警发送到接收所有告警的渠道
+func notifyAlert(alert *model.Alert, device *model.Device) {
+	var channels []model.NotificationChannel
+	if err := database.GetDB().Where("enabled = ? AND all_alerts = ?", true, true).Find(&channels).Error; err != nil {
+		log.Printf("Error getting notification channels for alert %s: %v", alert.ID, err)
+		return
+	}
+	for i := range channels {
+		channel := &channels[i]
+		if !alertLevelAtLeast(alert.Level, channel.MinLevel) {
+			continue
+		}
+		if err := enqueueNotification(channel, alert, device, "", channel.Subject, channel.Template); err != nil {
+			log.Printf("Error queueing notification for alert %s on channel %s: %v", alert.ID, channel.ID, err)
+		}
+	}
+}
+
+// enqueueNotification 渲染通知并创建发送记录，随后在后台发送；该告警已发送到该渠道时跳过
+func enqueueNotification(channel *model.NotificationChannel, alert *model.Alert, device *model.Device, ruleID, subject, body string) error {
+	notificationMu.Lock()
+	defer notificationMu.Unlock()
+
+	var count int64
+	if err := database.GetDB().Model(&model.NotificationDelivery{}).
+		Where("alert_id = ? AND channel_id = ?", alert.ID, channel.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check notification deliveries: %v", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	message, err := renderNotification(subject, body, alert, device)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	delivery := &model.NotificationDelivery{
+		ID:            utils.GenerateUUID(),
+		ChannelID:     channel.ID,
+		ChannelType:   channel.Type,
+		AlertID:       alert.ID,
+		RuleID:        ruleID,
+		Level:         alert.Level,
+		Subject:       message.Subject,
+		Message:       message.Body,
+		Status:        model.NotificationDeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := database.GetDB().Create(delivery).Error; err != nil {
+		return fmt.Errorf("failed to create notification delivery: %v", err)
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Notification delivery %s panicked: %v", delivery.ID, r)
+			}
+		}()
+		if _, err := deliverNotification(delivery.ID); err != nil {
+			log.Printf("Error delivering notification %s: %v", delivery.ID, err)
+		}
+	}()
+	return nil
+}
+
+// notificationTimeout 单次发送的超时时间
+func notificationTimeout() time.Duration {
+	if timeout := config.GetConfig().Alert.NotificationTimeout; timeout > 0 {
+		return timeout
+	}
+	return 10 * time.Second
+}
+
+// notificationRetryDelay 第attempts次发送失败后到下次重试的等待时间，每次加倍，最长1小时
+func notificationRetryDelay(attempts int) time.Duration {
+	delay := config.GetConfig().Alert.NotificationRetryBackoff
+	if delay <= 0 {
+		delay = 30 * time.Second
+	}
+	for i := 1; i < attempts && delay < maxNotificationBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxNotificationBackoff {
+		delay = maxNotificationBackoff
+	}
+	return delay
+}
+
+// deliverNotification 发送一条待发送的通知并更新发送记录，返回记录是否由本次调用处理
+//
+// 发送前将下次重试时间推迟到发送超时之后，避免定时任务和其它调用重复发送。
+func deliverNotification(id string) (bool, error) {
+	db := database.GetDB()
+	now := time.Now()
+	timeout := notificationTimeout()
+	lease := now.Add(timeout + time.Minute)
+	result := db.Model(&model.NotificationDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, model.NotificationDeliveryPending, now).
+		Update("next_attempt_at", lease)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim notification delivery: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	var delivery model.NotificationDelivery
+	if err := db.Where("id = ?", id).First(&delivery).Error; err != nil {
+		return false, fmt.Errorf("failed to get notification delivery: %v", err)
+	}
+
+	channel, err := getNotificationChannel(delivery.ChannelID)
+	switch {
+	case errors.Is(err, ErrNotificationChannelNotFound):
+		return true, finishNotificationDelivery(&delivery, 0, errors.New("channel was deleted"), true)
+	case err != nil:
+		return false, err
+	case !channel.Enabled:
+		return true, finishNotificationDelivery(&delivery, 0, errors.New("channel is disabled"), true)
+	}
+
+	message := &NotificationMessage{
+		DeliveryID: delivery.ID,
+		Subject:    delivery.Subject,
+		Body:       delivery.Message,
+		Level:      delivery.Level,
+		Test:       delivery.Test,
+	}
+	if delivery.AlertID != "" {
+		if alert, err := GetAlert(delivery.AlertID); err == nil {
+			message.Alert = alert
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	code, sendErr := SendNotification(ctx, channel, message)
+	return true, finishNotificationDelivery(&delivery, code, sendErr, delivery.Test)
+}
+
+// finishNotificationDelivery 记录一次发送的结果，失败且未达到最多次数时安排重试
+func finishNotificationDelivery(delivery *model.NotificationDelivery, code int, sendErr error, final bool) error {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.UpdatedAt = now
+	if sendErr == nil {
+		delivery.Status = model.NotificationDeliverySent
+		delivery.LastError = ""
+		delivery.SentAt = &now
+		delivery.NextAttemptAt = nil
+	} else {
+		delivery.LastError = truncateString(sendErr.Error(), 1024)
+		maxAttempts := config.GetConfig().Alert.NotificationMaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = 5
+		}
+		if final || delivery.Attempts >= maxAttempts {
+			delivery.Status = model.NotificationDeliveryFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			next := now.Add(notificationRetryDelay(delivery.Attempts))
+			delivery.Status = model.NotificationDeliveryPending
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if err := database.GetDB().Save(delivery).Error; err != nil {
+		return fmt.Errorf("failed to update notification delivery: %v", err)
+	}
+	return nil
+}
+
+// RetryNotificationDeliveries 重试到期的通知，返回发送成功的数量
+func RetryNotificationDeliveries() (int, error) {
+	var ids []string
+	if err := database.GetDB().Model(&model.NotificationDelivery{}).
+		Where("status = ? AND next_attempt_at <= ?", model.NotificationDeliveryPending, time.Now()).
+		Order("next_attempt_at ASC").Limit(maxNotificationRetries).Pluck("id", &ids).Error; err != nil {
+		return 0, fmt.Errorf("failed to get pending notifications: %v", err)
+	}
+
+	sent := 0
+	for _, id := range ids {
+		handled, err := deliverNotification(id)
+		if err != nil {
+			return sent, err
+		}
+		if !handled {
+			continue
+		}
+		var delivery model.NotificationDelivery
+		if err := database.GetDB().Select("status").Where("id = ?", id).First(&delivery).Error; err == nil &&
+			delivery.Status == model.NotificationDeliverySent {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// TestNotificationChannel 用模拟的告警立即发送一条测试通知，不重试，返回发送记录
+//
+// 停用的渠道也可以测试。发送失败不返回错误，失败原因记录在发送记录中。
+func TestNotificationChannel(id string, level model.AlertLevel) (*model.NotificationDelivery, error) {
+	channel, err := getNotificationChannel(id)
+	if err != nil {
+		return nil, err
+	}
+	if level == "" {
+		level = model.AlertLevelInfo
+	}
+	if !level.IsValid() {
+		return nil, fmt.Errorf("%w: invalid level %q", ErrInvalidNotificationChannel, level)
+	}
+
+	now := time.Now()
+	alert := &model.Alert{
+		ID:          "test",
+		DeviceID:    "test-device",
+		Level:       level,
+		Status:      model.AlertStatusOpen,
+		Title:       "test_notification",
+		Description: "This is a test notification from LVerity.",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Metadata:    `{"test":true}`,
+	}
+	message, err := RenderNotification(channel, alert, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNotificationChannel, err)
+	}
+
+	delivery := &model.NotificationDelivery{
+		ID:          utils.GenerateUUID(),
+		ChannelID:   channel.ID,
+		ChannelType: channel.Type,
+		Test:        true,
+		Level:       level,
+		Subject:     message.Subject,
+		Message:     message.Body,
+		Status:      model.NotificationDeliveryPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := database.GetDB().Create(delivery).Error; err != nil {
+		return nil, fmt.Errorf("failed to create notification delivery: %v", err)
+	}
+
+	message.DeliveryID = delivery.ID
+	message.Test = true
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout())
+	defer cancel()
+	code, sendErr := SendNotification(ctx, channel, message)
+	if err := finishNotificationDelivery(delivery, code, sendErr, true); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// NotificationDeliveryFilter 发送记录的过滤条件，字段为空时不过滤
+type NotificationDeliveryFilter struct {
+	ChannelID string
+	AlertID   string
+	RuleID    string
+	Status    model.NotificationDeliveryStatus
+}
+
+// ListNotificationDeliveries 按条件分页获取发送记录，按创建时间倒序
+func ListNotificationDeliveries(filter NotificationDeliveryFilter, page, pageSize int) ([]model.NotificationDelivery, int64, error) {
+	query := database.GetDB().Model(&model.NotificationDelivery{})
+	if filter.ChannelID != "" {
+		query = query.Where("channel_id = ?", filter.ChannelID)
+	}
+	if filter.AlertID != "" {
+		query = query.Where("alert_id = ?", filter.AlertID)
+	}
+	if filter.RuleID != "" {
+		query = query.Where("rule_id = ?", filter.RuleID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count notification deliveries: %v", err)
+	}
+	var deliveries []model.NotificationDelivery
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get notification deliveries: %v", err)
+	}
+	return deliveries, total, nil
+}
+
+// validateNotifyAction 校验notify动作的参数
+func validateNotifyAction(ruleType model.AlertRuleType, raw json.RawMessage) error {
+	var action model.NotifyAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+	if len(action.Channels) == 0 || len(action.Channels) > maxNotifyChannels {
+		return fmt.Errorf("between 1 and %d channels are required", maxNotifyChannels)
+	}
+	for _, id := range action.Channels {
+		if strings.TrimSpace(id) == "" {
+			return fmt.Errorf("channel IDs must not be empty")
+		}
+	}
+	if action.MinLevel != "" && !action.MinLevel.IsValid() {
+		return fmt.Errorf("invalid min_level %q", action.MinLevel)
+	}
+	return validateNotificationTemplates(action.Subject, action.Template)
+}
+
+// checkNotifyAction 检查notify动作指定的渠道是否存在
+func checkNotifyAction(raw json.RawMessage) error {
+	var action model.NotifyAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+	var count int64
+	if err := database.GetDB().Model(&model.NotificationChannel{}).
+		Where("id IN ?", action.Channels).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check notification channels: %v", err)
+	}
+	if int(count) < len(uniqueStrings(action.Channels)) {
+		return fmt.Errorf("%w: notify action references an unknown notification channel", ErrInvalidAlertRule)
+	}
+	return nil
+}
+
+// runNotifyAction 将规则告警发送到notify动作指定的渠道，停用的渠道跳过
+func runNotifyAction(rule *model.AlertRule, device *model.Device, alert *model.Alert, raw json.RawMessage) (*alertActionOutcome, error) {
+	var action model.NotifyAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return nil, err
+	}
+	if !alertLevelAtLeast(alert.Level, action.MinLevel) {
+		return &alertActionOutcome{skipped: true, message: "alert level is below min_level"}, nil
+	}
+
+	var channels []model.NotificationChannel
+	if err := database.GetDB().Where("id IN ? AND enabled = ?", action.Channels, true).Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to get notification channels: %v", err)
+	}
+	queued := 0
+	for i := range channels {
+		channel := &channels[i]
+		if !alertLevelAtLeast(alert.Level, channel.MinLevel) {
+			continue
+		}
+		subject, body := channel.Subject, channel.Template
+		if action.Subject != "" {
+			subject = action.Subject
+		}
+		if action.Template != "" {
+			body = action.Template
+		}
+		if err := enqueueNotification(channel, alert, device, rule.ID, subject, body); err != nil {
+			return nil, err
+		}
+		queued++
+	}
+	if queued == 0 {
+		return &alertActionOutcome{skipped: true, message: "no enabled channel accepts the alert"}, nil
+	}
+	return &alertActionOutcome{message: fmt.Sprintf("queued to %d channel(s)", queued)}, nil
+}
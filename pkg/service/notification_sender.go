@@ -0,0 +1,326 @@
+package service
+
+import (
+	"LVerity/pkg/model"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNotificationResponse 发送失败时错误信息中附带的响应内容的最大长度
+const maxNotificationResponse = 512
+
+// NotificationMessage 渲染后的通知内容
+type NotificationMessage struct {
+	DeliveryID string
+	Subject    string
+	Body       string
+	Level      model.AlertLevel
+	Alert      *model.Alert // webhook请求体中附带的告警，测试发送时为模拟的告警
+	Test       bool
+}
+
+// webhookPayload 通用webhook的请求体
+type webhookPayload struct {
+	Event      string       `json:"event"` // alert或test
+	DeliveryID string       `json:"delivery_id"`
+	Subject    string       `json:"subject"`
+	Message    string       `json:"message"`
+	Level      string       `json:"level"`
+	Alert      *model.Alert `json:"alert,omitempty"`
+	Timestamp  int64        `json:"timestamp"`
+}
+
+// notificationSender 发送通知，返回HTTP状态码或SMTP应答码
+type notificationSender func(ctx context.Context, config *model.NotificationChannelConfig, message *NotificationMessage) (int, error)
+
+// notificationSenders 各渠道类型的发送实现
+var notificationSenders = map[model.NotificationChannelType]notificationSender{
+	model.NotificationChannelEmail:    sendEmailNotification,
+	model.NotificationChannelWebhook:  sendWebhookNotification,
+	model.NotificationChannelSlack:    sendSlackNotification,
+	model.NotificationChannelDingTalk: sendDingTalkNotification,
+	model.NotificationChannelWeCom:    sendWeComNotification,
+}
+
+// SendNotification 通过渠道发送一次通知，不重试也不记录发送日志
+func SendNotification(ctx context.Context, channel *model.NotificationChannel, message *NotificationMessage) (int, error) {
+	send, ok := notificationSenders[channel.Type]
+	if !ok {
+		return 0, fmt.Errorf("unsupported channel type %q", channel.Type)
+	}
+	return send(ctx, &channel.Config, message)
+}
+
+// SignNotificationPayload 计算webhook签名
+//
+// 待签名字符串为：TIMESTAMP.BODY，签名为使用渠道密钥计算的HMAC-SHA256十六进制值，
+// 通过X-LVerity-Signature请求头以sha256=<签名>的形式发送。
+func SignNotificationPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhookNotification 以JSON发送告警，配置了密钥时附带HMAC签名
+func sendWebhookNotification(ctx context.Context, config *model.NotificationChannelConfig, message *NotificationMessage) (int, error) {
+	now := time.Now()
+	payload := webhookPayload{
+		Event:      "alert",
+		DeliveryID: message.DeliveryID,
+		Subject:    message.Subject,
+		Message:    message.Body,
+		Level:      string(message.Level),
+		Alert:      message.Alert,
+		Timestamp:  now.Unix(),
+	}
+	if message.Test {
+		payload.Event = "test"
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+
+	headers := map[string]string{}
+	for key, value := range config.Headers {
+		headers[key] = value
+	}
+	headers["X-LVerity-Event"] = payload.Event
+	headers["X-LVerity-Delivery"] = message.DeliveryID
+	if config.Secret != "" {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		headers["X-LVerity-Timestamp"] = timestamp
+		headers["X-LVerity-Signature"] = "sha256=" + SignNotificationPayload(config.Secret, timestamp, body)
+	}
+	code, _, err := postNotificationJSON(ctx, config.URL, headers, body)
+	return code, err
+}
+
+// sendSlackNotification 按Slack incoming webhook的格式发送
+func sendSlackNotification(ctx context.Context, config *model.NotificationChannelConfig, message *NotificationMessage) (int, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"text": fmt.Sprintf("*%s*\n%s", message.Subject, message.Body),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal slack payload: %v", err)
+	}
+	code, _, err := postNotificationJSON(ctx, config.URL, nil, body)
+	return code, err
+}
+
+// sendDingTalkNotification 按钉钉群机器人的markdown消息格式发送，配置了密钥时加签
+func sendDingTalkNotification(ctx context.Context, config *model.NotificationChannelConfig, message *NotificationMessage) (int, error) {
+	target := config.URL
+	if config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		mac := hmac.New(sha256.New, []byte(config.Secret))
+		mac.Write([]byte(timestamp + "\n" + config.Secret))
+		sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		u, err := url.Parse(target)
+		if err != nil {
+			return 0, fmt.Errorf("invalid url: %v", err)
+		}
+		query := u.Query()
+		query.Set("timestamp", timestamp)
+		query.Set("sign", sign)
+		u.RawQuery = query.Encode()
+		target = u.String()
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": message.Subject,
+			"text":  fmt.Sprintf("### %s\n\n%s", message.Subject, message.Body),
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal dingtalk payload: %v", err)
+	}
+	code, response, err := postNotificationJSON(ctx, target, nil, body)
+	if err != nil {
+		return code, err
+	}
+	return code, checkRobotResponse(response)
+}
+
+// sendWeComNotification 按企业微信群机器人的markdown消息格式发送
+func sendWeComNotification(ctx context.Context, config *model.NotificationChannelConfig, message *NotificationMessage) (int, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": fmt.Sprintf("**%s**\n%s", message.Subject, message.Body),
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal wecom payload: %v", err)
+	}
+	code, response, err := postNotificationJSON(ctx, config.URL, nil, body)
+	if err != nil {
+		return code, err
+	}
+	return code, checkRobotResponse(response)
+}
+
+// checkRobotResponse 钉钉和企业微信在HTTP 200的响应中用errcode表示发送结果
+func checkRobotResponse(response []byte) error {
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return fmt.Errorf("unexpected response: %s", truncateString(string(response), maxNotificationResponse))
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("errcode %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// postNotificationJSON 发送JSON请求，非2xx响应视为失败
+func postNotificationJSON(ctx context.Context, target string, headers map[string]string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LVerity-Notifier")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// 错误信息会写入发送记录，其中的URL可能带有令牌
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = maskNotificationURL(urlErr.URL)
+		}
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, response, fmt.Errorf("unexpected status %d: %s",
+			resp.StatusCode, truncateString(string(response), maxNotificationResponse))
+	}
+	return resp.StatusCode, response, nil
+}
+
+// sendEmailNotification 通过SMTP发送纯文本邮件
+func sendEmailNotification(ctx context.Context, config *model.NotificationChannelConfig, message *NotificationMessage) (code int, err error) {
+	// SMTP错误带有应答码
+	defer func() {
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) {
+			code = smtpErr.Code
+		}
+	}()
+
+	address := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: config.Host}
+	if config.TLS == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+	defer client.Close()
+
+	if config.TLS == "" || config.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			return 0, err
+		}
+	}
+	if err := client.Mail(config.From); err != nil {
+		return 0, err
+	}
+	for _, to := range config.To {
+		if err := client.Rcpt(to); err != nil {
+			return 0, err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(buildEmailMessage(config, message)); err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	if err := client.Quit(); err != nil {
+		return 0, err
+	}
+	return 250, nil
+}
+
+// buildEmailMessage 生成邮件内容，标题按RFC 2047编码，正文使用quoted-printable编码
+func buildEmailMessage(config *model.NotificationChannelConfig, message *NotificationMessage) []byte {
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", config.From},
+		{"To", strings.Join(config.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", message.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	if message.DeliveryID != "" {
+		headers = append(headers, [2]string{"X-LVerity-Delivery", message.DeliveryID})
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], header[1])
+	}
+	buf.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(message.Body, "\r\n", "\n")
+	w.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	w.Close()
+	return buf.Bytes()
+}
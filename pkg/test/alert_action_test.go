@@ -0,0 +1,139 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateResponseActions(t *testing.T) {
+	rule := &model.AlertRule{
+		Name:       "compromised devices",
+		Type:       model.AlertRuleTypeThreshold,
+		Conditions: `{"metric":"abnormal_behavior_count","operator":">=","value":5}`,
+		Actions: `[
+			{"type":"block","reason":"too many abnormal behaviors","duration":3600},
+			{"type":"disable_license"},
+			{"type":"raise_risk","risk_level":0.9},
+			{"type":"command","command":"lock","payload":{"message":"locked by security policy"},"ttl":600},
+			{"type":"quarantine","group_id":"quarantine"}
+		]`,
+	}
+	assert.NoError(t, service.ValidateAlertRule(rule))
+
+	invalid := []string{
+		`[{"type":"block","duration":-1}]`,
+		`[{"type":"raise_risk"}]`,
+		`[{"type":"raise_risk","risk_level":1.5}]`,
+		`[{"type":"command","command":"reboot"}]`,
+		`[{"type":"command","command":"lock","ttl":-60}]`,
+		`[{"type":"command","command":"lock","payload":[1,2]}]`,
+		`[{"type":"quarantine"}]`,
+		`[{"type":"quarantine","group_id":"  "}]`,
+	}
+	for _, actions := range invalid {
+		rule.Actions = actions
+		assert.ErrorIs(t, service.ValidateAlertRule(rule), service.ErrInvalidAlertRule, actions)
+	}
+}
+
+func TestRunAndRevertAlertActions(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	quarantine, err := service.CreateGroup(service.GroupInput{Name: "quarantine"}, "admin")
+	require.NoError(t, err)
+	require.NoError(t, database.GetDB().Create(&model.Device{
+		ID:          "device-1",
+		Name:        "front desk",
+		Status:      model.DeviceStatusNormal,
+		RiskLevel:   0.6,
+		DiskID:      "disk-1",
+		BIOS:        "bios-1",
+		Motherboard: "board-1",
+	}).Error)
+
+	_, err = service.CreateAlertRule(service.AlertRuleInput{
+		Name:       "risky device",
+		Type:       model.AlertRuleTypeThreshold,
+		DeviceID:   "device-1",
+		Conditions: json.RawMessage(`{"metric":"risk_level","operator":">=","value":0.5}`),
+		Actions: json.RawMessage(`[
+			{"type":"block","reason":"risky device","duration":3600},
+			{"type":"raise_risk","risk_level":0.9},
+			{"type":"quarantine","group_id":"` + quarantine.ID + `"}
+		]`),
+	})
+	require.NoError(t, err)
+
+	fired, err := service.EvaluateThresholdRules()
+	require.NoError(t, err)
+	require.Equal(t, 1, fired)
+
+	// 告警未关闭时规则不再触发，动作只执行一次
+	fired, err = service.EvaluateThresholdRules()
+	require.NoError(t, err)
+	assert.Equal(t, 0, fired)
+
+	var alert model.Alert
+	require.NoError(t, database.GetDB().Where("device_id = ?", "device-1").First(&alert).Error)
+	records, err := service.ListAlertActions(alert.ID)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	for i, record := range records {
+		assert.Equal(t, i, record.Index)
+		assert.Equal(t, model.AlertActionApplied, record.Status, record.Type)
+		assert.True(t, record.Reversible, record.Type)
+	}
+
+	device, err := service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusBlocked, device.Status)
+	assert.Equal(t, 0.9, device.RiskLevel)
+	assert.Equal(t, quarantine.ID, device.GroupID)
+
+	// 动作之后重新封禁的设备不能通过撤销动作解封
+	time.Sleep(1100 * time.Millisecond)
+	_, err = service.BlockDeviceWithOptions("device-1", service.BlockOptions{Reason: "manual", Operator: "admin"})
+	require.NoError(t, err)
+	_, err = service.RevertAlertAction(alert.ID, 0, "admin")
+	assert.ErrorIs(t, err, service.ErrAlertActionConflict)
+	device, err = service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusBlocked, device.Status)
+
+	// 设备已被手动解封时撤销直接完成
+	require.NoError(t, service.UnblockDeviceWithReason("device-1", "admin", "manual"))
+	_, err = service.RevertAlertAction(alert.ID, 0, "admin")
+	require.NoError(t, err)
+
+	_, err = service.RevertAlertAction(alert.ID, 1, "admin")
+	require.NoError(t, err)
+	_, err = service.RevertAlertAction(alert.ID, 2, "admin")
+	require.NoError(t, err)
+	// 重复撤销直接返回
+	_, err = service.RevertAlertAction(alert.ID, 2, "admin")
+	require.NoError(t, err)
+	_, err = service.RevertAlertAction(alert.ID, 3, "admin")
+	assert.ErrorIs(t, err, service.ErrAlertActionNotFound)
+
+	device, err = service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusNormal, device.Status)
+	assert.Equal(t, 0.6, device.RiskLevel)
+	assert.Empty(t, device.GroupID)
+
+	records, err = service.ListAlertActions(alert.ID)
+	require.NoError(t, err)
+	for _, record := range records {
+		assert.Equal(t, model.AlertActionReverted, record.Status, record.Type)
+		assert.Equal(t, "admin", record.RevertedBy)
+	}
+	assert.Equal(t, "device is no longer blocked", records[0].RevertMessage)
+}
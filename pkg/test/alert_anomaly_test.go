@@ -0,0 +1,39 @@
+package test
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAnomalyConditionsDefaults(t *testing.T) {
+	cond, err := service.ParseAnomalyConditions(`{"metric":"heartbeat_interval"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BaselineScopeDevice, cond.Baseline)
+	assert.Equal(t, model.AnomalyMethodZScore, cond.Method)
+	assert.Equal(t, 3.0, cond.Threshold)
+	assert.Equal(t, model.AnomalyDirectionBoth, cond.Direction)
+	assert.Equal(t, 20, cond.MinSamples)
+
+	cond, err = service.ParseAnomalyConditions(`{"metric":"activation_count","baseline":"group","method":"percentile"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 99.0, cond.Threshold)
+}
+
+func TestParseAnomalyConditionsInvalid(t *testing.T) {
+	invalid := []string{
+		`{"metric":"cpu_usage"}`,
+		`{"metric":"session_length","baseline":"region"}`,
+		`{"metric":"session_length","method":"mad"}`,
+		`{"metric":"session_length","method":"percentile","threshold":40}`,
+		`{"metric":"session_length","direction":"up"}`,
+		`{"metric":"session_length","min_samples":1}`,
+		`{"metric":"session_length","warmup":-60}`,
+	}
+	for _, conditions := range invalid {
+		_, err := service.ParseAnomalyConditions(conditions)
+		assert.ErrorIs(t, err, service.ErrInvalidAlertRule, conditions)
+	}
+}
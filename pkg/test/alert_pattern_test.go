@@ -0,0 +1,101 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePatternConditions(t *testing.T) {
+	cond, err := service.ParsePatternConditions(`{"window":600,"steps":[{"source":"log","type":"activation","message":"(?i)failed","count":5},{"source":"log","type":"activation","message":"success"}]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 600, cond.Window)
+	assert.Len(t, cond.Steps, 2)
+	assert.Equal(t, model.PatternEventLog, cond.Steps[0].Source)
+	assert.Equal(t, 5, cond.Steps[0].Count)
+	assert.Equal(t, 1, cond.Steps[1].Count)
+}
+
+func TestParsePatternConditionsInvalid(t *testing.T) {
+	invalid := []string{
+		`{"steps":[{"source":"log"}]}`,
+		`{"window":60,"steps":[]}`,
+		`{"window":60,"steps":[{"source":"activity"}]}`,
+		`{"window":60,"steps":[{"source":"log","message":"("}]}`,
+		`{"window":60,"steps":[{"source":"behavior","count":-2}]}`,
+		`{"window":60,"steps":[{"source":"behavior"}],"level":"fatal"}`,
+	}
+	for _, conditions := range invalid {
+		_, err := service.ParsePatternConditions(conditions)
+		assert.ErrorIs(t, err, service.ErrInvalidAlertRule, conditions)
+	}
+}
+
+func TestDryRunPatternRule(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	t0 := time.Now().Add(-2 * time.Hour)
+	logs := map[string][]struct {
+		offset  int
+		message string
+	}{
+		// 前两次失败与成功相隔超过窗口，从第三次失败开始的序列匹配
+		"device-1": {{0, "activation failed"}, {10, "activation failed"}, {1000, "activation failed"},
+			{1005, "heartbeat"}, {1010, "activation failed"}, {1020, "activation failed"}, {1030, "activation success"}},
+		// 成功在窗口之外
+		"device-2": {{0, "activation failed"}, {10, "activation failed"}, {20, "activation failed"}, {700, "activation success"}},
+	}
+	for deviceID, entries := range logs {
+		require.NoError(t, database.GetDB().Create(&model.Device{
+			ID:          deviceID,
+			Name:        deviceID,
+			Status:      model.DeviceStatusNormal,
+			DiskID:      "disk-" + deviceID,
+			BIOS:        "bios-1",
+			Motherboard: "board-1",
+		}).Error)
+		for i, entry := range entries {
+			at := t0.Add(time.Duration(entry.offset) * time.Second)
+			require.NoError(t, database.GetDB().Create(&model.DeviceLog{
+				ID:         fmt.Sprintf("%s-%d", deviceID, i),
+				DeviceID:   deviceID,
+				Type:       "activation",
+				Level:      model.LogLevelInfo,
+				Message:    entry.message,
+				Timestamp:  at,
+				ReceivedAt: at,
+			}).Error)
+		}
+	}
+
+	result, err := service.DryRunAlertRule(service.AlertRuleDryRunRequest{
+		Rule: &service.AlertRuleInput{
+			Name:       "failed activations",
+			Type:       model.AlertRuleTypePattern,
+			Conditions: json.RawMessage(`{"window":600,"steps":[{"source":"log","message":"failed","count":3},{"source":"log","message":"success"}]}`),
+		},
+		DeviceIDs: []string{"device-1", "device-2"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Fired)
+	alert := result.Alerts[0]
+	assert.Equal(t, "device-1", alert.DeviceID)
+	assert.Equal(t, 4, alert.Details["matched_count"])
+	assert.WithinDuration(t, t0.Add(1000*time.Second), alert.Details["first_event"].(time.Time), time.Second)
+	assert.WithinDuration(t, t0.Add(1030*time.Second), alert.Time, time.Second)
+
+	events := alert.Details["events"].([]service.PatternEvent)
+	steps := make([]int, 0, len(events))
+	for _, event := range events {
+		steps = append(steps, event.Step)
+	}
+	assert.Equal(t, []int{0, 0, 0, 1}, steps)
+}
@@ -0,0 +1,38 @@
+package test
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAlertRule(t *testing.T) {
+	rule := &model.AlertRule{
+		Name:       "too many abnormal behaviors",
+		Type:       model.AlertRuleTypeThreshold,
+		Conditions: `{"metric":"abnormal_behavior_count","operator":">=","value":5}`,
+	}
+	assert.NoError(t, service.ValidateAlertRule(rule))
+
+	rule.Actions = `[]`
+	assert.NoError(t, service.ValidateAlertRule(rule))
+}
+
+func TestValidateAlertRuleInvalid(t *testing.T) {
+	valid := `{"metric":"risk_level","operator":">","value":0.8}`
+	invalid := []model.AlertRule{
+		{Type: model.AlertRuleTypeThreshold, Conditions: valid},
+		{Name: "r", Type: "custom", Conditions: valid},
+		{Name: "r", Type: model.AlertRuleTypeThreshold},
+		{Name: "r", Type: model.AlertRuleTypePattern, Conditions: valid},
+		{Name: "r", Type: model.AlertRuleTypeThreshold, Conditions: valid, Actions: `{"type":"block"}`},
+		{Name: "r", Type: model.AlertRuleTypeThreshold, Conditions: valid, Actions: `["block"]`},
+		{Name: "r", Type: model.AlertRuleTypeThreshold, Conditions: valid, Actions: `[{"type":"unknown"}]`},
+	}
+	for i := range invalid {
+		err := service.ValidateAlertRule(&invalid[i])
+		assert.ErrorIs(t, err, service.ErrInvalidAlertRule, "rule %d", i)
+	}
+}
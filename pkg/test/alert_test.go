@@ -4,55 +4,23 @@ import (
 	"LVerity/pkg/database"
 	"LVerity/pkg/model"
 	"LVerity/pkg/service"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 	"testing"
 	"time"
 )
 
-// setupTest 初始化测试环境
-func setupTest(t *testing.T) func() {
-	// 使用SQLite内存数据库
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("Failed to connect to test database: %v", err)
-	}
-
-	// 自动迁移数据库结构
-	err = db.AutoMigrate(
-		&model.Device{},
-		&model.Alert{},
-	)
-	if err != nil {
-		t.Fatalf("Failed to migrate test database: %v", err)
-	}
-
-	// 设置全局数据库连接
-	database.DB = db
-
-	// 返回清理函数
-	return func() {
-		sqlDB, err := db.DB()
-		if err != nil {
-			t.Errorf("Failed to get underlying DB: %v", err)
-			return
-		}
-		sqlDB.Close()
-	}
-}
-
 func TestAlertManager(t *testing.T) {
 	cleanup := setupTest(t)
 	defer cleanup()
+	now := time.Now()
 
 	t.Run("CreateAlert", func(t *testing.T) {
 		// 创建测试设备
 		device := &model.Device{
-			ID:          "test-device",
-			Name:        "Test Device",
-			Status:      model.DeviceStatusNormal,
-			Fingerprint: "test-device-fingerprint-1",
-			LastSeen:    time.Now(),
+			ID:       "test-device",
+			Name:     "Test Device",
+			Status:   model.DeviceStatusNormal,
+			DiskID:   "test-device-disk-1",
+			LastSeen: &now,
 		}
 		if err := database.DB.Create(device).Error; err != nil {
 			t.Fatalf("Failed to create test device: %v", err)
@@ -68,8 +36,8 @@ func TestAlertManager(t *testing.T) {
 		if alert.DeviceID != device.ID {
 			t.Errorf("Expected device ID %s, got %s", device.ID, alert.DeviceID)
 		}
-		if alert.Type != "test_alert" {
-			t.Errorf("Expected alert type %s, got %s", "test_alert", alert.Type)
+		if alert.Title != "test_alert" {
+			t.Errorf("Expected alert type %s, got %s", "test_alert", alert.Title)
 		}
 		if alert.Level != model.AlertLevelWarning {
 			t.Errorf("Expected alert level %s, got %s", model.AlertLevelWarning, alert.Level)
@@ -82,11 +50,11 @@ func TestAlertManager(t *testing.T) {
 	t.Run("GetAlert", func(t *testing.T) {
 		// 创建测试设备
 		device := &model.Device{
-			ID:          "test-device-2",
-			Name:        "Test Device 2",
-			Status:      model.DeviceStatusNormal,
-			Fingerprint: "test-device-fingerprint-2",
-			LastSeen:    time.Now(),
+			ID:       "test-device-2",
+			Name:     "Test Device 2",
+			Status:   model.DeviceStatusNormal,
+			DiskID:   "test-device-disk-2",
+			LastSeen: &now,
 		}
 		if err := database.DB.Create(device).Error; err != nil {
 			t.Fatalf("Failed to create test device: %v", err)
@@ -116,11 +84,11 @@ func TestAlertManager(t *testing.T) {
 	t.Run("UpdateAlertStatus", func(t *testing.T) {
 		// 创建测试设备
 		device := &model.Device{
-			ID:          "test-device-3",
-			Name:        "Test Device 3",
-			Status:      model.DeviceStatusNormal,
-			Fingerprint: "test-device-fingerprint-3",
-			LastSeen:    time.Now(),
+			ID:       "test-device-3",
+			Name:     "Test Device 3",
+			Status:   model.DeviceStatusNormal,
+			DiskID:   "test-device-disk-3",
+			LastSeen: &now,
 		}
 		if err := database.DB.Create(device).Error; err != nil {
 			t.Fatalf("Failed to create test device: %v", err)
@@ -153,11 +121,11 @@ func TestAlertManager(t *testing.T) {
 	t.Run("DeleteAlert", func(t *testing.T) {
 		// 创建测试设备
 		device := &model.Device{
-			ID:          "test-device-4",
-			Name:        "Test Device 4",
-			Status:      model.DeviceStatusNormal,
-			Fingerprint: "test-device-fingerprint-4",
-			LastSeen:    time.Now(),
+			ID:       "test-device-4",
+			Name:     "Test Device 4",
+			Status:   model.DeviceStatusNormal,
+			DiskID:   "test-device-disk-4",
+			LastSeen: &now,
 		}
 		if err := database.DB.Create(device).Error; err != nil {
 			t.Fatalf("Failed to create test device: %v", err)
@@ -186,14 +154,15 @@ func TestAlertManager(t *testing.T) {
 func TestAlertQueries(t *testing.T) {
 	cleanup := setupTest(t)
 	defer cleanup()
+	now := time.Now()
 
 	// 创建测试设备
 	device := &model.Device{
-		ID:          "test-device-5",
-		Name:        "Test Device 5",
-		Status:      model.DeviceStatusNormal,
-		Fingerprint: "test-device-fingerprint-5",
-		LastSeen:    time.Now(),
+		ID:       "test-device-5",
+		Name:     "Test Device 5",
+		Status:   model.DeviceStatusNormal,
+		DiskID:   "test-device-disk-5",
+		LastSeen: &now,
 	}
 	if err := database.DB.Create(device).Error; err != nil {
 		t.Fatalf("Failed to create test device: %v", err)
@@ -0,0 +1,34 @@
+package test
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThresholdConditions(t *testing.T) {
+	cond, err := service.ParseThresholdConditions(`{"metric":"abnormal_behavior_count","operator":">=","value":5,"window":600,"level":"error","cooldown":60}`)
+	assert.NoError(t, err)
+	assert.Equal(t, model.AlertMetricAbnormalBehaviorCount, cond.Metric)
+	assert.Equal(t, 5.0, cond.Value)
+	assert.Equal(t, 600, cond.Window)
+	assert.Equal(t, model.AlertLevelError, cond.Level)
+	assert.Equal(t, 60, cond.Cooldown)
+}
+
+func TestParseThresholdConditionsInvalid(t *testing.T) {
+	invalid := []string{
+		`not json`,
+		`{"metric":"cpu","operator":">","value":1}`,
+		`{"metric":"risk_level","operator":"=>","value":0.5}`,
+		`{"metric":"risk_level","operator":">","value":0.5,"level":"fatal"}`,
+		`{"metric":"alert_count","operator":">","value":3,"window":-1}`,
+		`{"metric":"alert_count","operator":">","value":3,"cooldown":-1}`,
+	}
+	for _, conditions := range invalid {
+		_, err := service.ParseThresholdConditions(conditions)
+		assert.ErrorIs(t, err, service.ErrInvalidAlertRule, conditions)
+	}
+}
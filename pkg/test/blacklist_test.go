@@ -0,0 +1,164 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBlacklistRule(t *testing.T) {
+	assert.NoError(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeDiskID, Pattern: "^WD-.*"}))
+	assert.ErrorIs(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: "unknown", Pattern: ".*"}), service.ErrInvalidBlacklistRule)
+	assert.ErrorIs(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeBIOS, Pattern: "("}), service.ErrInvalidBlacklistRule)
+	assert.ErrorIs(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeBIOS}), service.ErrInvalidBlacklistRule)
+	assert.ErrorIs(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeCIDR, Pattern: "10.0.0.0/33"}), service.ErrInvalidBlacklistRule)
+	assert.ErrorIs(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeIP, Pattern: "not-an-ip"}), service.ErrInvalidBlacklistRule)
+	assert.ErrorIs(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeIP, Pattern: "1.2.3.4", Action: "skip"}), service.ErrInvalidBlacklistRule)
+	assert.ErrorIs(t, service.ValidateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeIP, Pattern: "1.2.3.4", Action: model.BlacklistRuleActionAllow, BlockDevice: true}), service.ErrInvalidBlacklistRule)
+
+	// 未指定动作时默认为拒绝
+	rule := &model.BlacklistRule{Type: model.BlacklistRuleTypeCountry, Pattern: "CN, US"}
+	assert.NoError(t, service.ValidateBlacklistRule(rule))
+	assert.Equal(t, model.BlacklistRuleActionDeny, rule.Action)
+}
+
+func TestMatchBlacklistRule(t *testing.T) {
+	device := &model.Device{DiskID: "WD-12345", BIOS: "AMI 1.0", Motherboard: "ASUS-B450"}
+	subject := &service.BlacklistSubject{Device: device}
+
+	matched, err := service.MatchBlacklistRule(subject, &model.BlacklistRule{Type: model.BlacklistRuleTypeDiskID, Pattern: "^WD-"})
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	// 重复使用同一模式应命中缓存并得到相同结果
+	matched, err = service.MatchBlacklistRule(subject, &model.BlacklistRule{Type: model.BlacklistRuleTypeDiskID, Pattern: "^WD-"})
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	matched, err = service.MatchBlacklistRule(subject, &model.BlacklistRule{Type: model.BlacklistRuleTypeMotherboard, Pattern: "^MSI"})
+	assert.NoError(t, err)
+	assert.False(t, matched)
+
+	_, err = service.MatchBlacklistRule(subject, &model.BlacklistRule{Type: model.BlacklistRuleTypeBIOS, Pattern: "["})
+	assert.Error(t, err)
+}
+
+func TestMatchBlacklistRuleNetwork(t *testing.T) {
+	device := &model.Device{NetworkCards: `[{"name":"eth0","mac":"00-11-22-AA-BB-CC"}]`}
+	subject := &service.BlacklistSubject{
+		Device:      device,
+		IP:          "192.168.1.20",
+		LicenseCode: "TRIAL-0001",
+		Customer:    "group-1",
+		Location:    &model.Location{Country: "China", CountryCode: "CN"},
+	}
+
+	cases := []struct {
+		rule    model.BlacklistRule
+		matched bool
+	}{
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeIP, Pattern: "192.168.1.20"}, true},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeIP, Pattern: "192.168.1.21"}, false},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeCIDR, Pattern: "192.168.0.0/16"}, true},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeCIDR, Pattern: "10.0.0.0/8"}, false},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeMAC, Pattern: "00:11:22:AA:BB:CC"}, true},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeMAC, Pattern: "^00:11:22:"}, true},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeMAC, Pattern: "ff:ff:ff:ff:ff:ff"}, false},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeCountry, Pattern: "us, cn"}, true},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeCountry, Pattern: "Japan"}, false},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeLicenseCode, Pattern: "^TRIAL-"}, true},
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeCustomer, Pattern: "^group-2$"}, false},
+		// 缺少对应字段时不匹配
+		{model.BlacklistRule{Type: model.BlacklistRuleTypeDiskID, Pattern: ".*"}, false},
+	}
+
+	for _, tc := range cases {
+		matched, err := service.MatchBlacklistRule(subject, &tc.rule)
+		assert.NoError(t, err, tc.rule.Pattern)
+		assert.Equal(t, tc.matched, matched, "%s %s", tc.rule.Type, tc.rule.Pattern)
+	}
+}
+
+func TestSelfRegisterAllowRuleOverridesDeny(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, code := range []string{"LICENSE-1", "LICENSE-2"} {
+		require.NoError(t, database.GetDB().Create(&model.License{
+			ID:         "id-" + code,
+			Code:       code,
+			Status:     model.LicenseStatusUnused,
+			StartTime:  time.Now().Add(-time.Hour),
+			ExpireTime: time.Now().Add(24 * time.Hour),
+		}).Error)
+	}
+	require.NoError(t, service.CreateBlacklistRule(&model.BlacklistRule{
+		Type: model.BlacklistRuleTypeDiskID, Pattern: "^LAB-", BlockDevice: true,
+	}))
+	require.NoError(t, service.CreateBlacklistRule(&model.BlacklistRule{
+		Type: model.BlacklistRuleTypeCIDR, Pattern: "10.20.0.0/16", Action: model.BlacklistRuleActionAllow,
+	}))
+
+	// 放行网段内的注册不受拒绝规则影响，绑定授权时也不会再次按不含IP的对象检查
+	registration, err := service.SelfRegisterDevice("LICENSE-1", &service.DeviceProfile{
+		Name: "lab", DiskID: "LAB-1", BIOS: "bios-1", Motherboard: "board-1", ClientIP: "10.20.1.5",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.LicenseStatusUsed, registration.License.Status)
+	device, err := service.GetDevice(registration.Device.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusNormal, device.Status)
+	var behaviors int64
+	require.NoError(t, database.GetDB().Model(&model.AbnormalBehavior{}).Count(&behaviors).Error)
+	assert.Zero(t, behaviors)
+
+	// 放行网段外的相同硬件规则仍然拒绝，并按规则封禁新设备
+	_, err = service.SelfRegisterDevice("LICENSE-2", &service.DeviceProfile{
+		Name: "lab", DiskID: "LAB-2", BIOS: "bios-2", Motherboard: "board-2", ClientIP: "10.30.1.5",
+	})
+	assert.ErrorIs(t, err, service.ErrDeviceBlacklisted)
+	blocked, err := service.GetDeviceByHardwareInfo("LAB-2", "bios-2", "board-2")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusBlocked, blocked.Status)
+	license, err := service.GetLicenseByCode("LICENSE-2")
+	require.NoError(t, err)
+	assert.Equal(t, model.LicenseStatusUnused, license.Status)
+}
+
+func TestBlacklistRuleCacheInvalidation(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	subject := &service.BlacklistSubject{Device: &model.Device{ID: "device-1", DiskID: "WD-1"}}
+	denied := func() bool {
+		rule, err := service.FindMatchingBlacklistRule(subject)
+		require.NoError(t, err)
+		return rule != nil
+	}
+	assert.False(t, denied())
+
+	// 创建、修改和删除规则后立即生效
+	rule := &model.BlacklistRule{Type: model.BlacklistRuleTypeDiskID, Pattern: "^WD-"}
+	require.NoError(t, service.CreateBlacklistRule(rule))
+	assert.True(t, denied())
+	rule.Pattern = "^ST-"
+	require.NoError(t, service.UpdateBlacklistRule(rule))
+	assert.False(t, denied())
+	rule.Pattern = "^WD-"
+	require.NoError(t, service.UpdateBlacklistRule(rule))
+	assert.True(t, denied())
+	require.NoError(t, service.DeleteBlacklistRule(rule.ID))
+	assert.False(t, denied())
+
+	// 规则到期后不再命中
+	expiresAt := time.Now().Add(300 * time.Millisecond)
+	require.NoError(t, service.CreateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeDiskID, Pattern: "^WD-", ExpiresAt: &expiresAt}))
+	assert.True(t, denied())
+	time.Sleep(time.Until(expiresAt) + 50*time.Millisecond)
+	assert.False(t, denied())
+}
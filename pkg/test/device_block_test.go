@@ -0,0 +1,65 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseExpiredBlocks(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, id := range []string{"expired", "active", "permanent"} {
+		require.NoError(t, database.GetDB().Create(&model.Device{
+			ID:          id,
+			Name:        id,
+			Status:      model.DeviceStatusNormal,
+			DiskID:      "disk-" + id,
+			BIOS:        "bios-1",
+			Motherboard: "board-1",
+		}).Error)
+	}
+	_, err := service.BlockDeviceWithOptions("expired", service.BlockOptions{Reason: "test", Duration: time.Hour, Operator: "admin"})
+	require.NoError(t, err)
+	_, err = service.BlockDeviceWithOptions("active", service.BlockOptions{Reason: "test", Duration: time.Hour, Operator: "admin"})
+	require.NoError(t, err)
+	_, err = service.BlockDeviceWithOptions("permanent", service.BlockOptions{Reason: "test", Operator: "admin"})
+	require.NoError(t, err)
+
+	// 将解封时间调整到过去，模拟封禁到期
+	require.NoError(t, database.GetDB().Model(&model.Device{}).Where("id = ?", "expired").
+		Update("unblock_time", time.Now().Add(-time.Minute)).Error)
+
+	released, err := service.ReleaseExpiredBlocks()
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	device, err := service.GetDevice("expired")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusNormal, device.Status)
+	assert.Nil(t, device.UnblockTime)
+	assert.Empty(t, device.BlockReason)
+
+	history, err := service.GetDeviceBlockHistory("expired")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, model.DeviceBlockActionUnblock, history[0].Action)
+	assert.Equal(t, service.BlockOperatorScheduler, history[0].Operator)
+
+	for _, id := range []string{"active", "permanent"} {
+		device, err := service.GetDevice(id)
+		require.NoError(t, err)
+		assert.Equal(t, model.DeviceStatusBlocked, device.Status, id)
+	}
+
+	// 已解封的设备不会被再次处理
+	released, err = service.ReleaseExpiredBlocks()
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartBulkOperationInvalidRequest(t *testing.T) {
+	actor := service.BulkActor{UserID: "admin"}
+
+	_, err := service.StartBulkOperation(service.BulkOperationRequest{
+		Action:    "reboot",
+		DeviceIDs: []string{"device-1"},
+	}, actor)
+	assert.ErrorIs(t, err, service.ErrInvalidBulkOperation)
+
+	_, err = service.StartBulkOperation(service.BulkOperationRequest{
+		Action:    model.BulkActionSetHeartbeatRate,
+		DeviceIDs: []string{"device-1"},
+		Params:    service.BulkOperationParams{HeartbeatRate: 1},
+	}, actor)
+	assert.ErrorIs(t, err, service.ErrInvalidBulkOperation)
+
+	_, err = service.StartBulkOperation(service.BulkOperationRequest{
+		Action:    model.BulkActionBlock,
+		DeviceIDs: []string{"device-1"},
+		Params:    service.BulkOperationParams{Duration: -60},
+	}, actor)
+	assert.ErrorIs(t, err, service.ErrInvalidBulkOperation)
+
+	_, err = service.StartBulkOperation(service.BulkOperationRequest{Action: model.BulkActionUnblock}, actor)
+	assert.ErrorIs(t, err, service.ErrInvalidBulkOperation)
+}
+
+func TestBulkBlockAndUnblock(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, id := range []string{"device-1", "device-2", "device-3"} {
+		require.NoError(t, database.GetDB().Create(&model.Device{
+			ID:          id,
+			Name:        id,
+			Status:      model.DeviceStatusNormal,
+			DiskID:      "disk-" + id,
+			BIOS:        "bios-1",
+			Motherboard: "board-1",
+		}).Error)
+	}
+	actor := service.BulkActor{UserID: "admin", Username: "admin", IP: "127.0.0.1"}
+
+	report, err := service.StartBulkOperation(service.BulkOperationRequest{
+		Action:    model.BulkActionBlock,
+		DeviceIDs: []string{"device-1", "device-2", "missing"},
+		Params:    service.BulkOperationParams{Reason: "audit", Duration: 3600},
+	}, actor)
+	require.NoError(t, err)
+	assert.Equal(t, model.BulkOperationCompleted, report.Status)
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	require.Len(t, report.Results, 3)
+
+	for _, id := range []string{"device-1", "device-2"} {
+		device, err := service.GetDevice(id)
+		require.NoError(t, err)
+		assert.Equal(t, model.DeviceStatusBlocked, device.Status)
+		assert.Equal(t, "audit", device.BlockReason)
+		assert.NotNil(t, device.UnblockTime)
+	}
+
+	// 未被封禁的设备记录为跳过，不写入操作日志，也不算作失败
+	report, err = service.StartBulkOperation(service.BulkOperationRequest{
+		Action:    model.BulkActionUnblock,
+		DeviceIDs: []string{"device-1", "device-3", "missing"},
+		Params:    service.BulkOperationParams{Reason: "done"},
+	}, actor)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Succeeded)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 1, report.Failed)
+	results := make(map[string]model.BulkOperationResult)
+	for _, result := range report.Results {
+		results[result.DeviceID] = result
+	}
+	assert.True(t, results["device-1"].Success)
+	assert.True(t, results["device-3"].Skipped)
+	assert.False(t, results["device-3"].Success)
+	assert.Equal(t, service.ErrDeviceNotFound.Error(), results["missing"].Error)
+
+	failed, err := service.GetBulkOperation(report.ID, true, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), failed.ResultTotal)
+	require.Len(t, failed.Results, 1)
+	assert.Equal(t, "missing", failed.Results[0].DeviceID)
+
+	var audits []model.OperationLog
+	require.NoError(t, database.GetDB().Where("action = ?", "device.unblock").Find(&audits).Error)
+	require.Len(t, audits, 1)
+	assert.Equal(t, "device-1", audits[0].ResourceID)
+	assert.Contains(t, audits[0].Detail, report.ID)
+	var blockAudits int64
+	require.NoError(t, database.GetDB().Model(&model.OperationLog{}).Where("action = ?", "device.block").Count(&blockAudits).Error)
+	assert.Equal(t, int64(2), blockAudits)
+
+	device, err := service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusNormal, device.Status)
+	history, err := service.GetDeviceBlockHistory("device-1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, model.DeviceBlockActionUnblock, history[0].Action)
+	assert.Equal(t, "done", history[0].Reason)
+	device, err = service.GetDevice("device-2")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusBlocked, device.Status)
+
+	operations, total, err := service.ListBulkOperations(1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, operations, 2)
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceCommandType(t *testing.T) {
+	assert.True(t, model.DeviceCommandReverifyLicense.IsValid())
+	assert.True(t, model.DeviceCommandLock.IsValid())
+	assert.False(t, model.DeviceCommandType("reboot").IsValid())
+}
+
+func TestDeviceCommandStatusIsFinal(t *testing.T) {
+	assert.False(t, model.DeviceCommandPending.IsFinal())
+	assert.False(t, model.DeviceCommandDelivered.IsFinal())
+	assert.True(t, model.DeviceCommandSucceeded.IsFinal())
+	assert.True(t, model.DeviceCommandFailed.IsFinal())
+	assert.True(t, model.DeviceCommandExpired.IsFinal())
+	assert.True(t, model.DeviceCommandCancelled.IsFinal())
+}
+
+func TestDeviceCommandLifecycle(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+	config.GlobalConfig.Device.CommandDefaultTTL = time.Hour
+	config.GlobalConfig.Device.CommandMaxTTL = 24 * time.Hour
+
+	for _, id := range []string{"device-1", "device-2"} {
+		require.NoError(t, database.GetDB().Create(&model.Device{
+			ID:          id,
+			Name:        id,
+			Status:      model.DeviceStatusNormal,
+			DiskID:      "disk-" + id,
+			BIOS:        "bios-1",
+			Motherboard: "board-1",
+			GroupID:     "group-1",
+		}).Error)
+	}
+
+	_, err := service.EnqueueDeviceCommand("missing", service.DeviceCommandRequest{Type: model.DeviceCommandLock}, "admin")
+	assert.ErrorIs(t, err, service.ErrDeviceNotFound)
+	_, err = service.EnqueueDeviceCommand("device-1", service.DeviceCommandRequest{Type: "reboot"}, "admin")
+	assert.ErrorIs(t, err, service.ErrInvalidCommand)
+	_, err = service.EnqueueDeviceCommand("device-1", service.DeviceCommandRequest{Type: model.DeviceCommandLock, TTL: 48 * time.Hour}, "admin")
+	assert.ErrorIs(t, err, service.ErrInvalidCommand)
+
+	lock, err := service.EnqueueDeviceCommand("device-1", service.DeviceCommandRequest{
+		Type:    model.DeviceCommandLock,
+		Payload: json.RawMessage(`{"reason":"test"}`),
+	}, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceCommandPending, lock.Status)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), lock.ExpiresAt, time.Minute)
+
+	// 结果只能在命令下发后上报
+	_, err = service.ReportDeviceCommandResult("device-1", lock.ID, model.DeviceCommandSucceeded, nil, "")
+	assert.ErrorIs(t, err, service.ErrCommandNotDelivered)
+
+	commands, err := service.PullDeviceCommands("device-1")
+	require.NoError(t, err)
+	require.Len(t, commands, 1)
+	assert.Equal(t, lock.ID, commands[0].ID)
+	assert.Equal(t, model.DeviceCommandDelivered, commands[0].Status)
+	assert.Equal(t, `{"reason":"test"}`, commands[0].Payload)
+
+	// 已下发的命令不会重复下发
+	commands, err = service.PullDeviceCommands("device-1")
+	require.NoError(t, err)
+	assert.Empty(t, commands)
+
+	_, err = service.ReportDeviceCommandResult("device-2", lock.ID, model.DeviceCommandSucceeded, nil, "")
+	assert.ErrorIs(t, err, service.ErrCommandNotFound)
+	_, err = service.ReportDeviceCommandResult("device-1", lock.ID, model.DeviceCommandDelivered, nil, "")
+	assert.ErrorIs(t, err, service.ErrInvalidCommand)
+	done, err := service.ReportDeviceCommandResult("device-1", lock.ID, model.DeviceCommandSucceeded, json.RawMessage(`{"locked":true}`), "")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceCommandSucceeded, done.Status)
+	assert.Equal(t, `{"locked":true}`, done.Result)
+	assert.NotNil(t, done.CompletedAt)
+	_, err = service.ReportDeviceCommandResult("device-1", lock.ID, model.DeviceCommandFailed, nil, "again")
+	assert.ErrorIs(t, err, service.ErrCommandFinished)
+	_, err = service.CancelDeviceCommand(lock.ID)
+	assert.ErrorIs(t, err, service.ErrCommandFinished)
+
+	// 分组命令为组内每个设备各创建一条，长轮询在新命令创建后立即返回
+	result := make(chan []model.DeviceCommand, 1)
+	go func() {
+		commands, err := service.WaitDeviceCommands(context.Background(), "device-2", 5*time.Second)
+		assert.NoError(t, err)
+		result <- commands
+	}()
+	time.Sleep(100 * time.Millisecond)
+	group, err := service.EnqueueGroupCommand("group-1", service.DeviceCommandRequest{Type: model.DeviceCommandUploadLogs}, "admin")
+	require.NoError(t, err)
+	assert.Len(t, group, 2)
+	select {
+	case commands := <-result:
+		require.Len(t, commands, 1)
+		assert.Equal(t, model.DeviceCommandUploadLogs, commands[0].Type)
+	case <-time.After(3 * time.Second):
+		t.Fatal("long poll did not return after a command was enqueued")
+	}
+
+	for _, command := range group {
+		if command.DeviceID != "device-1" {
+			continue
+		}
+		cancelled, err := service.CancelDeviceCommand(command.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.DeviceCommandCancelled, cancelled.Status)
+	}
+
+	// 过期的命令不再下发，并被标记为过期
+	expiring, err := service.EnqueueDeviceCommand("device-1", service.DeviceCommandRequest{Type: model.DeviceCommandUnlock}, "admin")
+	require.NoError(t, err)
+	require.NoError(t, database.GetDB().Model(&model.DeviceCommand{}).Where("id = ?", expiring.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	commands, err = service.PullDeviceCommands("device-1")
+	require.NoError(t, err)
+	assert.Empty(t, commands)
+
+	expired, err := service.ExpireDeviceCommands()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+	command, err := service.GetDeviceCommand(expiring.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceCommandExpired, command.Status)
+
+	counts, err := service.CountDeviceCommandsByStatus(service.DeviceCommandFilter{DeviceID: "device-1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counts[model.DeviceCommandSucceeded])
+	assert.Equal(t, int64(1), counts[model.DeviceCommandCancelled])
+	assert.Equal(t, int64(1), counts[model.DeviceCommandExpired])
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestValidateDeviceConfigSpec(t *testing.T) {
+	spec := &model.DeviceConfigSpec{HeartbeatRate: intPtr(30), LogLevel: " INFO "}
+	assert.NoError(t, service.ValidateDeviceConfigSpec(spec))
+	assert.Equal(t, "info", spec.LogLevel)
+
+	assert.ErrorIs(t, service.ValidateDeviceConfigSpec(&model.DeviceConfigSpec{HeartbeatRate: intPtr(1)}), service.ErrInvalidDeviceConfig)
+	assert.ErrorIs(t, service.ValidateDeviceConfigSpec(&model.DeviceConfigSpec{LogLevel: "verbose"}), service.ErrInvalidDeviceConfig)
+	assert.ErrorIs(t, service.ValidateDeviceConfigSpec(&model.DeviceConfigSpec{FeatureFlags: map[string]bool{" ": true}}), service.ErrInvalidDeviceConfig)
+}
+
+func TestMergeDeviceConfig(t *testing.T) {
+	group := model.DeviceConfigSpec{
+		HeartbeatRate: intPtr(120),
+		LogLevel:      "info",
+		FeatureFlags:  map[string]bool{"upload": true, "debug_panel": false},
+	}
+	device := model.DeviceConfigSpec{
+		LogLevel:     "debug",
+		FeatureFlags: map[string]bool{"debug_panel": true},
+	}
+
+	merged := service.MergeDeviceConfig(group, device)
+	assert.Equal(t, 120, *merged.HeartbeatRate)
+	assert.Equal(t, "debug", merged.LogLevel)
+	assert.Equal(t, map[string]bool{"upload": true, "debug_panel": true}, merged.FeatureFlags)
+
+	// 合并不应修改原配置
+	assert.False(t, group.FeatureFlags["debug_panel"])
+}
+
+func TestDiffDeviceConfig(t *testing.T) {
+	oldSpec := model.DeviceConfigSpec{HeartbeatRate: intPtr(60), FeatureFlags: map[string]bool{"a": true, "b": true}}
+	newSpec := model.DeviceConfigSpec{HeartbeatRate: intPtr(60), LogLevel: "error", FeatureFlags: map[string]bool{"a": false, "c": true}}
+
+	diff := service.DiffDeviceConfig(oldSpec, newSpec)
+	assert.Len(t, diff, 4)
+	assert.Equal(t, service.ConfigChange{Old: "", New: "error"}, diff["log_level"])
+	assert.Equal(t, service.ConfigChange{Old: true, New: false}, diff["feature_flags.a"])
+	assert.Equal(t, service.ConfigChange{Old: true, New: nil}, diff["feature_flags.b"])
+	assert.Equal(t, service.ConfigChange{Old: nil, New: true}, diff["feature_flags.c"])
+
+	assert.Empty(t, service.DiffDeviceConfig(newSpec, newSpec))
+}
+
+func TestDeviceConfigETag(t *testing.T) {
+	a := model.DeviceConfigSpec{HeartbeatRate: intPtr(60), FeatureFlags: map[string]bool{"x": true, "y": false}}
+	b := model.DeviceConfigSpec{HeartbeatRate: intPtr(60), FeatureFlags: map[string]bool{"y": false, "x": true}}
+	assert.Equal(t, service.DeviceConfigETag(a), service.DeviceConfigETag(b))
+
+	b.FeatureFlags["y"] = true
+	assert.NotEqual(t, service.DeviceConfigETag(a), service.DeviceConfigETag(b))
+}
@@ -0,0 +1,189 @@
+package test
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/handler"
+	"LVerity/pkg/middleware"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignDeviceRequest(t *testing.T) {
+	secret := "device-secret"
+	body := []byte(`{"status":"ok"}`)
+
+	signature := service.SignDeviceRequest(secret, "post", "/agent/heartbeat", "1700000000", "nonce-1", body)
+
+	// 签名应与方法大小写无关且可重复计算
+	assert.Equal(t, signature, service.SignDeviceRequest(secret, "POST", "/agent/heartbeat", "1700000000", "nonce-1", body))
+	assert.Len(t, signature, 64)
+
+	// 任意参与签名的字段变化都应导致签名不同
+	assert.NotEqual(t, signature, service.SignDeviceRequest("other-secret", "POST", "/agent/heartbeat", "1700000000", "nonce-1", body))
+	assert.NotEqual(t, signature, service.SignDeviceRequest(secret, "POST", "/agent/heartbeat?x=1", "1700000000", "nonce-1", body))
+	assert.NotEqual(t, signature, service.SignDeviceRequest(secret, "POST", "/agent/heartbeat", "1700000001", "nonce-1", body))
+	assert.NotEqual(t, signature, service.SignDeviceRequest(secret, "POST", "/agent/heartbeat", "1700000000", "nonce-2", body))
+	assert.NotEqual(t, signature, service.SignDeviceRequest(secret, "POST", "/agent/heartbeat", "1700000000", "nonce-1", []byte(`{}`)))
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	assert.Equal(t, "abcdef01", service.NormalizeFingerprint(" AB:CD:EF:01 "))
+	assert.Equal(t, service.CertificateFingerprint([]byte("cert")), service.NormalizeFingerprint(service.CertificateFingerprint([]byte("cert"))))
+}
+
+func TestSelfRegisterReissuesCredential(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	license := &model.License{
+		ID:         "license-1",
+		Code:       "LICENSE-1",
+		Status:     model.LicenseStatusUnused,
+		StartTime:  time.Now().Add(-time.Hour),
+		ExpireTime: time.Now().Add(24 * time.Hour),
+	}
+	require.NoError(t, database.DB.Create(license).Error)
+	profile := &service.DeviceProfile{Name: "agent", DiskID: "disk-1", BIOS: "bios-1", Motherboard: "board-1"}
+
+	first, err := service.SelfRegisterDevice(license.Code, profile)
+	require.NoError(t, err)
+	assert.True(t, first.Created)
+
+	// 相同硬件使用本设备凭证再次注册时返回新密钥，之前的密钥被吊销
+	profile.AuthenticatedDeviceID = first.Device.ID
+	second, err := service.SelfRegisterDevice(license.Code, profile)
+	require.NoError(t, err)
+	assert.False(t, second.Created)
+	assert.Equal(t, first.Device.ID, second.Device.ID)
+	assert.NotEqual(t, first.CredentialID, second.CredentialID)
+	assert.NotEqual(t, first.Secret, second.Secret)
+
+	credentials, err := service.ListDeviceCredentials(first.Device.ID)
+	require.NoError(t, err)
+	statuses := map[string]model.DeviceCredentialStatus{}
+	for _, credential := range credentials {
+		statuses[credential.ID] = credential.Status
+	}
+	assert.Equal(t, model.DeviceCredentialStatusRevoked, statuses[first.CredentialID])
+	assert.Equal(t, model.DeviceCredentialStatusActive, statuses[second.CredentialID])
+}
+
+func TestSelfRegisterExistingDeviceRequiresCredential(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, code := range []string{"LICENSE-1", "LICENSE-2"} {
+		require.NoError(t, database.DB.Create(&model.License{
+			ID:         "id-" + code,
+			Code:       code,
+			Status:     model.LicenseStatusUnused,
+			StartTime:  time.Now().Add(-time.Hour),
+			ExpireTime: time.Now().Add(24 * time.Hour),
+		}).Error)
+	}
+	victim, err := service.SelfRegisterDevice("LICENSE-1", &service.DeviceProfile{Name: "victim", DiskID: "disk-1", BIOS: "bios-1", Motherboard: "board-1"})
+	require.NoError(t, err)
+	other, err := service.SelfRegisterDevice("LICENSE-2", &service.DeviceProfile{Name: "other", DiskID: "disk-2", BIOS: "bios-2", Motherboard: "board-2"})
+	require.NoError(t, err)
+
+	// 仅凭硬件信息、已绑定的授权码或其他设备的凭证都不能重新注册已有设备
+	for _, attempt := range []struct {
+		code          string
+		authenticated string
+	}{
+		{"LICENSE-1", ""},
+		{"LICENSE-2", ""},
+		{"LICENSE-1", other.Device.ID},
+	} {
+		_, err := service.SelfRegisterDevice(attempt.code, &service.DeviceProfile{
+			Name:                  "attacker",
+			DiskID:                "disk-1",
+			BIOS:                  "bios-1",
+			Motherboard:           "board-1",
+			AuthenticatedDeviceID: attempt.authenticated,
+		})
+		assert.ErrorIs(t, err, service.ErrReregisterUnauthorized)
+	}
+
+	credential, err := service.GetDeviceCredential(victim.Device.ID, victim.CredentialID)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceCredentialStatusActive, credential.Status)
+	device, err := service.GetDevice(victim.Device.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "victim", device.Name)
+
+	// 已被其他设备激活的授权码不能再绑定，失败的注册不会留下设备记录
+	_, err = service.SelfRegisterDevice("LICENSE-1", &service.DeviceProfile{Name: "third", DiskID: "disk-3", BIOS: "bios-3", Motherboard: "board-3"})
+	assert.ErrorIs(t, err, service.ErrLicenseUnavailable)
+	var count int64
+	require.NoError(t, database.DB.Model(&model.Device{}).Where("disk_id = ?", "disk-3").Count(&count).Error)
+	assert.Zero(t, count)
+	license, err := service.GetLicenseByCode("LICENSE-1")
+	require.NoError(t, err)
+	assert.Equal(t, victim.Device.ID, license.DeviceID)
+}
+
+func TestAgentReregisterWithSignature(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+	gin.SetMode(gin.TestMode)
+	config.GlobalConfig.Device.SignatureMaxSkew = time.Minute
+
+	require.NoError(t, database.DB.Create(&model.License{
+		ID:         "license-1",
+		Code:       "LICENSE-1",
+		Status:     model.LicenseStatusUnused,
+		StartTime:  time.Now().Add(-time.Hour),
+		ExpireTime: time.Now().Add(24 * time.Hour),
+	}).Error)
+
+	r := gin.New()
+	r.POST("/agent/register", middleware.OptionalDeviceAuth(), handler.AgentRegister)
+	body := []byte(`{"license_code":"LICENSE-1","name":"agent","disk_id":"disk-1","bios":"bios-1","motherboard":"board-1"}`)
+	register := func(sign func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/agent/register", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sign != nil {
+			sign(req)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := register(nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data struct {
+			DeviceID     string `json:"device_id"`
+			CredentialID string `json:"credential_id"`
+			Secret       string `json:"secret"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	assert.Equal(t, http.StatusUnauthorized, register(nil).Code)
+
+	signed := register(func(req *http.Request) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(middleware.HeaderDeviceID, resp.Data.DeviceID)
+		req.Header.Set(middleware.HeaderCredentialID, resp.Data.CredentialID)
+		req.Header.Set(middleware.HeaderTimestamp, timestamp)
+		req.Header.Set(middleware.HeaderNonce, "nonce-1")
+		req.Header.Set(middleware.HeaderSignature, service.SignDeviceRequest(resp.Data.Secret, http.MethodPost, "/agent/register", timestamp, "nonce-1", body))
+	})
+	assert.Equal(t, http.StatusOK, signed.Code, signed.Body.String())
+	assert.Contains(t, signed.Body.String(), `"created":false`)
+}
@@ -0,0 +1,191 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeDevicesValidation(t *testing.T) {
+	_, err := service.MergeDevices("dev-1", nil, "admin")
+	assert.ErrorIs(t, err, service.ErrInvalidMerge)
+
+	_, err = service.MergeDevices("dev-1", []string{"dev-2", "dev-1"}, "admin")
+	assert.ErrorIs(t, err, service.ErrInvalidMerge)
+}
+
+func TestMergeDevices(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	db := database.GetDB()
+	earlier, later := time.Now().Add(-time.Hour), time.Now().Add(-time.Minute)
+	for _, device := range []model.Device{
+		{ID: "dev-1", LastSeen: &earlier},
+		{ID: "dev-2", LastSeen: &later},
+		{ID: "dev-3"},
+		{ID: "dev-4"},
+	} {
+		device.Name = device.ID
+		device.Status = model.DeviceStatusNormal
+		device.DiskID = "disk-" + device.ID
+		device.BIOS = "bios-1"
+		device.Motherboard = "board-1"
+		require.NoError(t, db.Create(&device).Error)
+	}
+
+	require.NoError(t, db.Create(&model.License{ID: "license-1", Code: "CODE-1", DeviceID: "dev-2", Status: model.LicenseStatusUsed}).Error)
+	require.NoError(t, db.Create(&model.Alert{ID: "alert-1", DeviceID: "dev-3", Status: model.AlertStatusOpen, CreatedAt: time.Now()}).Error)
+	require.NoError(t, db.Create(&model.DeviceLog{ID: "log-1", DeviceID: "dev-2", Message: "a", Timestamp: time.Now(), ReceivedAt: time.Now()}).Error)
+	require.NoError(t, db.Create(&model.DeviceLog{ID: "log-2", DeviceID: "dev-3", Message: "b", Timestamp: time.Now(), ReceivedAt: time.Now()}).Error)
+	require.NoError(t, db.Create(&model.UsageRecord{ID: "usage-1", DeviceID: "dev-2", StartTime: earlier, EndTime: later, Active: true}).Error)
+	require.NoError(t, db.Create(&model.DeviceUsageRollup{DeviceID: "dev-2", Period: model.UsagePeriodDay, PeriodStart: earlier}).Error)
+	require.NoError(t, db.Create(&[]model.DeviceTag{
+		{DeviceID: "dev-1", Tag: "lab"},
+		{DeviceID: "dev-2", Tag: "lab"},
+		{DeviceID: "dev-3", Tag: "beta"},
+	}).Error)
+	require.NoError(t, db.Create(&model.DeviceDuplicate{
+		ID: "pending-1", DeviceID: "dev-2", DuplicateID: "dev-4", Score: 0.8, Status: model.DuplicateStatusPending, DetectedAt: time.Now(),
+	}).Error)
+
+	_, err := service.MergeDevices("dev-1", []string{"dev-2", "missing"}, "admin")
+	assert.ErrorIs(t, err, service.ErrDeviceNotFound)
+
+	result, err := service.MergeDevices("dev-1", []string{"dev-2", "dev-3", "dev-2"}, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dev-2", "dev-3"}, result.MergedIDs)
+	assert.Equal(t, int64(1), result.Moved["licenses"])
+	assert.Equal(t, int64(1), result.Moved["alerts"])
+	assert.Equal(t, int64(2), result.Moved["logs"])
+	assert.Equal(t, int64(1), result.Moved["usage_records"])
+
+	var license model.License
+	require.NoError(t, db.Where("id = ?", "license-1").First(&license).Error)
+	assert.Equal(t, "dev-1", license.DeviceID)
+	var alert model.Alert
+	require.NoError(t, db.Where("id = ?", "alert-1").First(&alert).Error)
+	assert.Equal(t, "dev-1", alert.DeviceID)
+	var logs int64
+	require.NoError(t, db.Model(&model.DeviceLog{}).Where("device_id = ?", "dev-1").Count(&logs).Error)
+	assert.Equal(t, int64(2), logs)
+
+	// 重复设备的会话被结束，使用汇总归入保留设备
+	var usage model.UsageRecord
+	require.NoError(t, db.Where("id = ?", "usage-1").First(&usage).Error)
+	assert.Equal(t, "dev-1", usage.DeviceID)
+	assert.False(t, usage.Active)
+	var rollups int64
+	require.NoError(t, db.Model(&model.DeviceUsageRollup{}).Where("device_id <> ?", "dev-1").Count(&rollups).Error)
+	assert.Zero(t, rollups)
+
+	var tags []string
+	require.NoError(t, db.Model(&model.DeviceTag{}).Where("device_id = ?", "dev-1").Order("tag").Pluck("tag", &tags).Error)
+	assert.Equal(t, []string{"beta", "lab"}, tags)
+
+	survivor, err := service.GetDevice("dev-1")
+	require.NoError(t, err)
+	require.NotNil(t, survivor.LastSeen)
+	assert.WithinDuration(t, later, *survivor.LastSeen, time.Second)
+	_, err = service.GetDevice("dev-2")
+	assert.Error(t, err)
+	var deleted int64
+	require.NoError(t, db.Unscoped().Model(&model.Device{}).Where("id IN ? AND deleted_at IS NOT NULL", []string{"dev-2", "dev-3"}).Count(&deleted).Error)
+	assert.Equal(t, int64(2), deleted)
+
+	// 合并记录为已合并，涉及重复设备的待审核记录被移除
+	var records []model.DeviceDuplicate
+	require.NoError(t, db.Order("duplicate_id").Find(&records).Error)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		assert.Equal(t, "dev-1", record.DeviceID)
+		assert.Equal(t, model.DuplicateStatusMerged, record.Status)
+		assert.Equal(t, "dev-1", record.MergedInto)
+		assert.Equal(t, "admin", record.ReviewedBy)
+	}
+}
+
+func TestMergeDevicesRebuildsRollupsAndRetiresDuplicates(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	db := database.GetDB()
+	for _, id := range []string{"dev-1", "dev-2"} {
+		require.NoError(t, db.Create(&model.Device{ID: id, Name: id, Status: model.DeviceStatusNormal, DiskID: "disk-" + id, BIOS: "bios-1", Motherboard: "board-1"}).Error)
+	}
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	require.NoError(t, db.Create(&[]model.UsageRecord{
+		{ID: "usage-1", DeviceID: "dev-1", StartTime: day.Add(12 * time.Hour), EndTime: day.Add(12*time.Hour + 30*time.Minute)},
+		{ID: "usage-2", DeviceID: "dev-2", StartTime: day.Add(10 * time.Hour), EndTime: day.Add(11 * time.Hour)},
+	}).Error)
+	require.NoError(t, service.RollupUsage(model.UsagePeriodDay, day))
+
+	now := time.Now()
+	require.NoError(t, db.Create(&model.DeviceCredential{ID: "cred-1", DeviceID: "dev-2", Type: model.DeviceCredentialTypeSecret, Status: model.DeviceCredentialStatusActive}).Error)
+	require.NoError(t, db.Create(&[]model.DeviceCommand{
+		{ID: "cmd-1", DeviceID: "dev-2", Type: model.DeviceCommandUploadLogs, Status: model.DeviceCommandPending, ExpiresAt: now.Add(time.Hour), CreateTime: now, UpdateTime: now},
+		{ID: "cmd-2", DeviceID: "dev-2", Type: model.DeviceCommandUploadLogs, Status: model.DeviceCommandSucceeded, ExpiresAt: now.Add(time.Hour), CreateTime: now, UpdateTime: now},
+	}).Error)
+	require.NoError(t, db.Create(&model.DeviceMaintenance{
+		ID: "mw-1", DeviceID: "dev-2", Type: "routine", Status: model.MaintenanceStatusScheduled,
+		ScheduledAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour), CreateTime: now, UpdateTime: now,
+	}).Error)
+	require.NoError(t, db.Create(&[]model.DeviceConfig{
+		{ID: "cfg-1", TargetType: model.DeviceConfigTargetDevice, TargetID: "dev-1", Version: 1, Config: `{"log_level":"info"}`, UpdateTime: now},
+		{ID: "cfg-2", TargetType: model.DeviceConfigTargetDevice, TargetID: "dev-2", Version: 1, Config: `{"log_level":"debug"}`, UpdateTime: now},
+	}).Error)
+	require.NoError(t, db.Create(&model.DevicePolicy{ID: "policy-2", TargetType: model.DevicePolicyTargetDevice, TargetID: "dev-2", Policy: `{}`, UpdateTime: now}).Error)
+
+	_, err := service.MergeDevices("dev-1", []string{"dev-2"}, "admin")
+	require.NoError(t, err)
+
+	// 已有汇总的周期按合并后的会话重新计算
+	var rollups []model.DeviceUsageRollup
+	require.NoError(t, db.Where("period = ?", model.UsagePeriodDay).Find(&rollups).Error)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, "dev-1", rollups[0].DeviceID)
+	assert.Equal(t, int64(5400), rollups[0].TotalTime)
+	assert.Equal(t, 2, rollups[0].SessionCount)
+	assert.Equal(t, int64(3600), rollups[0].LongestSession)
+	var group model.GroupUsageRollup
+	require.NoError(t, db.Where("period = ?", model.UsagePeriodDay).First(&group).Error)
+	assert.Equal(t, int64(5400), group.TotalTime)
+
+	// 重复设备的凭证被吊销，未完成的命令和维护窗口被取消
+	credential, err := service.GetDeviceCredential("dev-2", "cred-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceCredentialStatusRevoked, credential.Status)
+	assert.Equal(t, "admin", credential.RevokedBy)
+	pending, err := service.GetDeviceCommand("cmd-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceCommandCancelled, pending.Status)
+	done, err := service.GetDeviceCommand("cmd-2")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceCommandSucceeded, done.Status)
+	window, err := service.GetMaintenance("mw-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.MaintenanceStatusCancelled, window.Status)
+	assert.Equal(t, "dev-1", window.DeviceID)
+	assert.Equal(t, model.DeviceStatusNormal, mustGetDevice(t, "dev-1").Status)
+
+	// 重复设备的设备级配置和策略被删除，保留设备的配置不变
+	var configs []model.DeviceConfig
+	require.NoError(t, db.Find(&configs).Error)
+	require.Len(t, configs, 1)
+	assert.Equal(t, "dev-1", configs[0].TargetID)
+	var policies int64
+	require.NoError(t, db.Model(&model.DevicePolicy{}).Count(&policies).Error)
+	assert.Zero(t, policies)
+}
+
+func mustGetDevice(t *testing.T, id string) *model.Device {
+	device, err := service.GetDevice(id)
+	require.NoError(t, err)
+	return device
+}
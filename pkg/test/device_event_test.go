@@ -0,0 +1,62 @@
+package test
+
+import (
+	"LVerity/pkg/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceEventBusFilter(t *testing.T) {
+	bus := service.NewDeviceEventBus()
+	sub, err := bus.Subscribe(service.DeviceEventFilter{GroupIDs: []string{"g1"}, Types: []string{service.DeviceEventOffline}}, 0)
+	require.NoError(t, err)
+	defer bus.Unsubscribe(sub)
+
+	bus.Publish(service.DeviceEvent{Type: service.DeviceEventOffline, DeviceID: "d1", GroupID: "g2"})
+	bus.Publish(service.DeviceEvent{Type: service.DeviceEventHeartbeat, DeviceID: "d1", GroupID: "g1"})
+	bus.Publish(service.DeviceEvent{Type: service.DeviceEventOffline, DeviceID: "d2", GroupID: "g1"})
+
+	require.Len(t, sub.C, 1)
+	event := <-sub.C
+	assert.Equal(t, "d2", event.DeviceID)
+	assert.Equal(t, uint64(3), event.ID)
+	assert.False(t, event.Time.IsZero())
+}
+
+func TestDeviceEventBusReplay(t *testing.T) {
+	bus := service.NewDeviceEventBus()
+	for i := 0; i < 5; i++ {
+		bus.Publish(service.DeviceEvent{Type: service.DeviceEventHeartbeat, DeviceID: "d1"})
+	}
+
+	// 从ID为3的事件之后重放
+	sub, err := bus.Subscribe(service.DeviceEventFilter{}, 3)
+	require.NoError(t, err)
+	defer bus.Unsubscribe(sub)
+
+	require.Len(t, sub.C, 2)
+	assert.Equal(t, uint64(4), (<-sub.C).ID)
+	assert.Equal(t, uint64(5), (<-sub.C).ID)
+}
+
+func TestDeviceEventBusSlowSubscriber(t *testing.T) {
+	bus := service.NewDeviceEventBus()
+	sub, err := bus.Subscribe(service.DeviceEventFilter{}, 0)
+	require.NoError(t, err)
+
+	// 从不消费的订阅者在缓冲区满后被关闭，发布方不会阻塞
+	for i := 0; i < 2000; i++ {
+		bus.Publish(service.DeviceEvent{Type: service.DeviceEventHeartbeat, DeviceID: "d1"})
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+	assert.Less(t, received, 2000)
+
+	// 重复取消订阅是安全的
+	bus.Unsubscribe(sub)
+}
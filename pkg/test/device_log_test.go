@@ -0,0 +1,208 @@
+package test
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/handler"
+	"LVerity/pkg/middleware"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestDeviceLogs(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+	config.GlobalConfig.Device.LogMaxBatchSize = 3
+
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	batch := &service.DeviceLogBatch{
+		Logs: []service.DeviceLogEntry{
+			{Type: "license", Level: "WARN", Message: "license expires soon", Timestamp: &past},
+			{Message: "clock ahead", Timestamp: &future, AdditionalInfo: json.RawMessage(`{"pid":42}`)},
+		},
+		Activities: []service.DeviceActivityEntry{
+			{Type: "login", Description: "user logged in"},
+		},
+	}
+	logs, activities, err := service.IngestDeviceLogs("device-1", "10.0.0.5", batch)
+	require.NoError(t, err)
+	assert.Equal(t, 2, logs)
+	assert.Equal(t, 1, activities)
+
+	result, total, err := service.QueryDeviceLogs(service.DeviceLogFilter{
+		DeviceID: "device-1",
+		Levels:   []model.LogLevel{model.LogLevelWarning},
+	}, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	assert.Equal(t, "license", result[0].Type)
+	assert.Equal(t, "10.0.0.5", result[0].IP)
+	assert.WithinDuration(t, past, result[0].Timestamp, time.Second)
+
+	// 未指定的类型、级别和来源使用默认值，超前的客户端时间改为服务端时间
+	result, _, err = service.QueryDeviceLogs(service.DeviceLogFilter{
+		DeviceID: "device-1",
+		Types:    []string{"general"},
+		Source:   "agent",
+	}, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, model.LogLevelInfo, result[0].Level)
+	assert.Equal(t, `{"pid":42}`, result[0].AdditionalInfo)
+	assert.True(t, result[0].Timestamp.Before(future))
+
+	_, _, err = service.IngestDeviceLogs("device-1", "", &service.DeviceLogBatch{})
+	assert.ErrorIs(t, err, service.ErrLogBatchEmpty)
+	_, _, err = service.IngestDeviceLogs("device-1", "", &service.DeviceLogBatch{
+		Logs: []service.DeviceLogEntry{{Message: "a"}, {Message: "b"}, {Message: "c"}, {Message: "d"}},
+	})
+	assert.ErrorIs(t, err, service.ErrLogBatchTooLarge)
+	_, _, err = service.IngestDeviceLogs("device-1", "", &service.DeviceLogBatch{
+		Logs: []service.DeviceLogEntry{{Level: "fatal"}},
+	})
+	assert.ErrorIs(t, err, service.ErrInvalidLogLevel)
+
+	var buf bytes.Buffer
+	require.NoError(t, service.ExportDeviceLogs(&buf, model.LogExportOptions{
+		DeviceID: "device-1",
+		Format:   model.ExportFormatCSV,
+	}))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+}
+
+func TestIngestDeviceLogsReusesLocation(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+	config.GlobalConfig.Device.LogMaxBatchSize = 500
+
+	// IP与上一条日志相同时沿用其位置，不查询外部地理位置接口
+	require.NoError(t, database.GetDB().Create(&model.DeviceLog{
+		ID:         "log-1",
+		DeviceID:   "device-1",
+		Message:    "earlier",
+		IP:         "203.0.113.7",
+		Country:    "Testland",
+		City:       "Testville",
+		Timestamp:  time.Now().Add(-time.Minute),
+		ReceivedAt: time.Now().Add(-time.Minute),
+	}).Error)
+
+	_, _, err := service.IngestDeviceLogs("device-1", "203.0.113.7", &service.DeviceLogBatch{
+		Logs:       []service.DeviceLogEntry{{Message: "later"}},
+		Activities: []service.DeviceActivityEntry{{Type: "login"}},
+	})
+	require.NoError(t, err)
+
+	var saved model.DeviceLog
+	require.NoError(t, database.GetDB().Where("message = ?", "later").First(&saved).Error)
+	assert.Equal(t, "Testland", saved.Country)
+	assert.Equal(t, "Testville", saved.City)
+
+	var activity model.DeviceActivity
+	require.NoError(t, database.GetDB().Where("device_id = ?", "device-1").First(&activity).Error)
+	assert.Equal(t, "Testland Testville", activity.Location)
+}
+
+func TestAgentSubmitLogsBodyLimits(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+	gin.SetMode(gin.TestMode)
+	config.GlobalConfig.Device.LogMaxBatchSize = 500
+	config.GlobalConfig.Device.LogMaxBodySize = 1 << 10
+	config.GlobalConfig.Device.LogMaxDecodedSize = 4 << 10
+
+	r := gin.New()
+	r.POST("/agent/logs", middleware.BodyLimit(config.GlobalConfig.Device.LogMaxBodySize), func(c *gin.Context) {
+		c.Set("deviceID", "device-1")
+	}, handler.AgentSubmitLogs)
+	submit := func(body []byte, gzipped, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/agent/logs", bytes.NewReader(body))
+		req.RemoteAddr = "10.0.0.5:1234"
+		req.Header.Set("Content-Type", "application/json")
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	compress := func(data string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+		return buf.Bytes()
+	}
+	countLogs := func() int64 {
+		var count int64
+		require.NoError(t, database.GetDB().Model(&model.DeviceLog{}).Count(&count).Error)
+		return count
+	}
+
+	w := submit(compress(`{"logs":[{"message":"compressed"}]}`), true, false)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int64(1), countLogs())
+
+	// 压缩后未超过请求体限制，解压后超过限制
+	large := `{"logs":[{"message":"` + strings.Repeat("a", 8<<10) + `"}]}`
+	bomb := compress(large)
+	require.Less(t, len(bomb), 1<<10)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, submit(bomb, true, false).Code)
+
+	// 未压缩的请求体超过限制，未声明长度时在读取中途拒绝
+	assert.Equal(t, http.StatusRequestEntityTooLarge, submit([]byte(large), false, false).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, submit([]byte(large), false, true).Code)
+
+	assert.Equal(t, http.StatusBadRequest, submit([]byte(`{"logs":[{"message":"plain"}]}`), true, false).Code)
+	assert.Equal(t, int64(1), countLogs())
+}
+
+func TestIngestDeviceLogsRejectsWholeBatch(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+	config.GlobalConfig.Device.LogMaxBatchSize = 500
+
+	// 任一条级别非法时整批不保存
+	_, _, err := service.IngestDeviceLogs("device-1", "", &service.DeviceLogBatch{
+		Logs:       []service.DeviceLogEntry{{Message: "ok"}, {Message: "bad", Level: "fatal"}},
+		Activities: []service.DeviceActivityEntry{{Type: "login"}},
+	})
+	require.ErrorIs(t, err, service.ErrInvalidLogLevel)
+	var count int64
+	require.NoError(t, database.GetDB().Model(&model.DeviceLog{}).Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, database.GetDB().Model(&model.DeviceActivity{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// 超长内容按字节截断，不截断多字节字符；超长类型同样截断
+	message := strings.Repeat("a", 8191) + "日志"
+	_, _, err = service.IngestDeviceLogs("device-1", "", &service.DeviceLogBatch{
+		Logs: []service.DeviceLogEntry{{Type: strings.Repeat("t", 80), Message: message}},
+	})
+	require.NoError(t, err)
+	var saved model.DeviceLog
+	require.NoError(t, database.GetDB().Where("device_id = ?", "device-1").First(&saved).Error)
+	assert.Equal(t, strings.Repeat("a", 8191), saved.Message)
+	assert.Len(t, saved.Type, 50)
+}
@@ -0,0 +1,158 @@
+package test
+
+import (
+	"LVerity/pkg/config"
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceSuppressesOfflineAlerts(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+	config.GlobalConfig.Device.OfflineThreshold = time.Hour
+
+	group, err := service.CreateGroup(service.GroupInput{Name: "lab"}, "admin")
+	require.NoError(t, err)
+	lastSeen := time.Now().Add(-2 * time.Hour)
+	for _, device := range []model.Device{
+		{ID: "in-group", GroupID: group.ID, Status: model.DeviceStatusNormal},
+		{ID: "outside", Status: model.DeviceStatusNormal},
+		{ID: "suspect", Status: model.DeviceStatusSuspect},
+	} {
+		device.Name = device.ID
+		device.DiskID = "disk-" + device.ID
+		device.BIOS = "bios-1"
+		device.Motherboard = "board-1"
+		device.LastSeen = &lastSeen
+		require.NoError(t, database.GetDB().Create(&device).Error)
+	}
+
+	groupWindow, err := service.CreateMaintenance(service.MaintenanceInput{
+		GroupID:     group.ID,
+		ScheduledAt: time.Now().Add(-time.Minute),
+		EndAt:       time.Now().Add(time.Hour),
+	}, "admin")
+	require.NoError(t, err)
+	deviceWindow, err := service.CreateMaintenance(service.MaintenanceInput{
+		DeviceID:    "suspect",
+		ScheduledAt: time.Now().Add(-time.Minute),
+		EndAt:       time.Now().Add(time.Hour),
+	}, "admin")
+	require.NoError(t, err)
+
+	// 维护中的设备不会被标记为离线，也不产生离线告警
+	require.NoError(t, service.CheckOfflineDevices())
+	device, err := service.GetDevice("in-group")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusMaintenance, device.Status)
+	device, err = service.GetDevice("outside")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusOffline, device.Status)
+
+	var alerts []model.Alert
+	require.NoError(t, database.GetDB().Where("title = ?", service.AlertTitleDeviceOffline).Find(&alerts).Error)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "outside", alerts[0].DeviceID)
+
+	// 状态不能切换为维护的设备同样按进行中的窗口抑制离线和心跳告警，其它告警不受影响
+	device, err = service.GetDevice("suspect")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusSuspect, device.Status)
+	assert.True(t, service.IsDeviceInMaintenance("suspect"))
+	_, err = service.CreateAlert("suspect", service.AlertTitleDeviceOffline, model.AlertLevelWarning, "offline", "")
+	assert.ErrorIs(t, err, service.ErrAlertSuppressed)
+	_, err = service.CreateAlert("suspect", service.AlertTitleHeartbeatMissed, model.AlertLevelWarning, "missed", "")
+	assert.ErrorIs(t, err, service.ErrAlertSuppressed)
+	_, err = service.CreateAlert("suspect", "license_expired", model.AlertLevelWarning, "expired", "")
+	assert.NoError(t, err)
+
+	// 维护结束后恢复告警
+	_, err = service.CompleteMaintenance(deviceWindow.ID, "admin")
+	require.NoError(t, err)
+	assert.False(t, service.IsDeviceInMaintenance("suspect"))
+	alert, err := service.CreateAlert("suspect", service.AlertTitleDeviceOffline, model.AlertLevelWarning, "offline", "")
+	require.NoError(t, err)
+	assert.Equal(t, "suspect", alert.DeviceID)
+
+	_, err = service.CompleteMaintenance(groupWindow.ID, "admin")
+	require.NoError(t, err)
+	require.NoError(t, service.CheckOfflineDevices())
+	device, err = service.GetDevice("in-group")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusOffline, device.Status)
+	var count int64
+	require.NoError(t, database.GetDB().Model(&model.Alert{}).
+		Where("title = ? AND device_id = ?", service.AlertTitleDeviceOffline, "in-group").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMaintenanceWindowEndedBeforeScheduler(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, id := range []string{"ended", "overlapped", "manual"} {
+		require.NoError(t, database.GetDB().Create(&model.Device{
+			ID:          id,
+			Name:        id,
+			Status:      model.DeviceStatusNormal,
+			DiskID:      "disk-" + id,
+			BIOS:        "bios-1",
+			Motherboard: "board-1",
+		}).Error)
+	}
+	var windows []*model.DeviceMaintenance
+	for _, id := range []string{"ended", "overlapped"} {
+		window, err := service.CreateMaintenance(service.MaintenanceInput{
+			DeviceID:    id,
+			ScheduledAt: time.Now().Add(-time.Minute),
+			EndAt:       time.Now().Add(time.Hour),
+		}, "admin")
+		require.NoError(t, err)
+		windows = append(windows, window)
+	}
+	_, err := service.CreateMaintenance(service.MaintenanceInput{
+		DeviceID:    "overlapped",
+		ScheduledAt: time.Now().Add(-time.Minute),
+		EndAt:       time.Now().Add(2 * time.Hour),
+	}, "admin")
+	require.NoError(t, err)
+
+	// 窗口已到结束时间，定时任务尚未处理，设备仍为维护状态
+	for _, window := range windows {
+		require.NoError(t, database.GetDB().Model(&model.DeviceMaintenance{}).Where("id = ?", window.ID).
+			Update("end_at", time.Now().Add(-time.Second)).Error)
+	}
+	device, err := service.GetDevice("ended")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusMaintenance, device.Status)
+
+	// 结束时间之后不再抑制告警，仍被其他窗口覆盖的设备继续抑制
+	assert.False(t, service.IsDeviceInMaintenance("ended"))
+	_, err = service.CreateAlert("ended", service.AlertTitleDeviceOffline, model.AlertLevelWarning, "offline", "")
+	assert.NoError(t, err)
+	assert.True(t, service.IsDeviceInMaintenance("overlapped"))
+	_, err = service.CreateAlert("overlapped", service.AlertTitleHeartbeatMissed, model.AlertLevelWarning, "missed", "")
+	assert.ErrorIs(t, err, service.ErrAlertSuppressed)
+
+	// 没有维护窗口时手动设置的维护状态仍抑制告警
+	require.NoError(t, database.GetDB().Model(&model.Device{}).Where("id = ?", "manual").
+		Update("status", model.DeviceStatusMaintenance).Error)
+	assert.True(t, service.IsDeviceInMaintenance("manual"))
+
+	started, finished, err := service.ProcessMaintenanceWindows()
+	require.NoError(t, err)
+	assert.Zero(t, started)
+	assert.Equal(t, 2, finished)
+	device, err = service.GetDevice("ended")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusNormal, device.Status)
+	device, err = service.GetDevice("overlapped")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusMaintenance, device.Status)
+}
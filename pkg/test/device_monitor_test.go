@@ -13,12 +13,13 @@ func TestDeviceMonitor(t *testing.T) {
 	defer cleanup()
 
 	// 创建测试设备
+	lastSeen := time.Now().Add(-1 * time.Hour)
 	device := &model.Device{
-		ID:          "test-device-1",
-		Name:        "Test Device 1",
-		Status:      model.DeviceStatusNormal,
-		LastSeen:    time.Now().Add(-1 * time.Hour),
-		Fingerprint: "device-fingerprint-1",
+		ID:       "test-device-1",
+		Name:     "Test Device 1",
+		Status:   model.DeviceStatusNormal,
+		LastSeen: &lastSeen,
+		DiskID:   "device-disk-1",
 	}
 	if err := database.DB.Create(device).Error; err != nil {
 		t.Fatalf("Failed to create test device: %v", err)
@@ -30,7 +31,7 @@ func TestDeviceMonitor(t *testing.T) {
 
 	t.Run("UpdateDeviceHeartbeat", func(t *testing.T) {
 		ip := "192.168.1.100"
-		err := monitor.UpdateDeviceHeartbeat(device.ID, ip, nil)
+		err := monitor.UpdateDeviceHeartbeat(device.ID, ip)
 		if err != nil {
 			t.Errorf("UpdateDeviceHeartbeat failed: %v", err)
 		}
@@ -44,19 +45,24 @@ func TestDeviceMonitor(t *testing.T) {
 		if updatedDevice.Status != model.DeviceStatusNormal {
 			t.Errorf("Expected device status to be normal, got %s", updatedDevice.Status)
 		}
-		if updatedDevice.LastIP != ip {
-			t.Errorf("Expected device IP to be %s, got %s", ip, updatedDevice.LastIP)
+		session, err := service.GetActiveDeviceSession(device.ID)
+		if err != nil || session == nil {
+			t.Fatalf("Expected active session, got %v, %v", session, err)
+		}
+		if session.IP != ip {
+			t.Errorf("Expected session IP to be %s, got %s", ip, session.IP)
 		}
 	})
 
 	t.Run("CleanupOfflineDevices", func(t *testing.T) {
 		// 创建一个长时间未活动的设备
+		offlineSeen := time.Now().Add(-2 * time.Hour)
 		offlineDevice := &model.Device{
-			ID:          "test-device-2",
-			Name:        "Test Device 2",
-			Status:      model.DeviceStatusNormal,
-			LastSeen:    time.Now().Add(-2 * time.Hour),
-			Fingerprint: "device-fingerprint-2",
+			ID:       "test-device-2",
+			Name:     "Test Device 2",
+			Status:   model.DeviceStatusNormal,
+			LastSeen: &offlineSeen,
+			DiskID:   "device-disk-2",
 		}
 		if err := database.DB.Create(offlineDevice).Error; err != nil {
 			t.Fatalf("Failed to create offline test device: %v", err)
@@ -77,34 +83,50 @@ func TestDeviceMonitor(t *testing.T) {
 	})
 
 	t.Run("DeviceSession", func(t *testing.T) {
-		// 创建新的会话
-		session := service.NewDeviceSession(device.ID)
-		
-		// 等待一小段时间
-		time.Sleep(100 * time.Millisecond)
-		
-		// 结束会话
-		duration := session.End()
-		
-		if duration <= 0 {
-			t.Errorf("Expected session duration > 0, got %d", duration)
+		first, err := service.GetActiveDeviceSession(device.ID)
+		if err != nil || first == nil {
+			t.Fatalf("Expected active session, got %v, %v", first, err)
 		}
 
-		// 验证设备统计已更新
-		var updatedDevice model.Device
-		if err := database.DB.First(&updatedDevice, "id = ?", device.ID).Error; err != nil {
-			t.Fatalf("Failed to get updated device: %v", err)
+		// 超时内的心跳延长同一个会话
+		time.Sleep(1100 * time.Millisecond)
+		if err := monitor.UpdateDeviceHeartbeat(device.ID, ""); err != nil {
+			t.Fatalf("UpdateDeviceHeartbeat failed: %v", err)
+		}
+		session, err := service.GetActiveDeviceSession(device.ID)
+		if err != nil || session == nil {
+			t.Fatalf("Expected active session, got %v, %v", session, err)
+		}
+		if session.ID != first.ID {
+			t.Errorf("Expected heartbeat to extend session %s, got %s", first.ID, session.ID)
+		}
+		if session.Duration <= 0 {
+			t.Errorf("Expected session duration > 0, got %d", session.Duration)
 		}
 
-		if updatedDevice.UsageStats == nil {
-			t.Fatal("Expected device usage stats to be initialized")
+		// 心跳超时内的会话保持进行中
+		closed, err := service.CloseIdleSessions(time.Now())
+		if err != nil {
+			t.Fatalf("CloseIdleSessions failed: %v", err)
+		}
+		if closed != 0 {
+			t.Errorf("Expected no session to be closed, got %d", closed)
 		}
 
-		if updatedDevice.UsageStats.TotalUsageTime <= 0 {
-			t.Errorf("Expected total usage time > 0, got %d", updatedDevice.UsageStats.TotalUsageTime)
+		// 超过心跳超时后会话被结束
+		closed, err = service.CloseIdleSessions(time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CloseIdleSessions failed: %v", err)
+		}
+		if closed == 0 {
+			t.Error("Expected idle session to be closed")
+		}
+		session, err = service.GetActiveDeviceSession(device.ID)
+		if err != nil {
+			t.Fatalf("GetActiveDeviceSession failed: %v", err)
 		}
-		if updatedDevice.UsageStats.SessionCount != 1 {
-			t.Errorf("Expected session count to be 1, got %d", updatedDevice.UsageStats.SessionCount)
+		if session != nil {
+			t.Errorf("Expected no active session, got %s", session.ID)
 		}
 	})
 }
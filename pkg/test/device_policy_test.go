@@ -0,0 +1,119 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDevicePolicy(t *testing.T) {
+	spec := model.DevicePolicySpec{
+		HeartbeatRate:    intPtr(30),
+		AllowedCountries: []string{" CN ", "", "US"},
+	}
+	assert.NoError(t, service.ValidateDevicePolicy(&spec))
+	assert.Equal(t, []string{"CN", "US"}, spec.AllowedCountries)
+
+	invalid := []model.DevicePolicySpec{
+		{HeartbeatRate: intPtr(1)},
+		{AutoBlockRiskLevel: floatPtr(0)},
+		{AutoBlockRiskLevel: floatPtr(1.5)},
+		{AutoBlockAlertCount: intPtr(0)},
+		{AlertRules: map[string]bool{" ": false}},
+	}
+	for _, spec := range invalid {
+		assert.ErrorIs(t, service.ValidateDevicePolicy(&spec), service.ErrInvalidDevicePolicy)
+	}
+}
+
+func TestEffectiveDevicePolicy(t *testing.T) {
+	policy := &service.EffectiveDevicePolicy{
+		Policy: model.DevicePolicySpec{
+			AllowedCountries: []string{"cn"},
+			AlertRules:       map[string]bool{service.AlertTitleDeviceOffline: false},
+		},
+	}
+
+	assert.False(t, policy.AlertEnabled(service.AlertTitleDeviceOffline))
+	assert.True(t, policy.AlertEnabled(service.AlertTitleHeartbeatMissed))
+
+	assert.True(t, policy.CountryAllowed(&model.Location{Country: "China", CountryCode: "CN"}))
+	assert.False(t, policy.CountryAllowed(&model.Location{Country: "United States", CountryCode: "US"}))
+	assert.True(t, policy.CountryAllowed(nil))
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestNestedGroupInheritance(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	parent, err := service.CreateGroup(service.GroupInput{Name: "region"}, "admin")
+	require.NoError(t, err)
+	child, err := service.CreateGroup(service.GroupInput{Name: "branch", ParentID: parent.ID}, "admin")
+	require.NoError(t, err)
+	require.NoError(t, database.GetDB().Create(&model.Device{
+		ID:          "device-1",
+		Name:        "front desk",
+		Status:      model.DeviceStatusNormal,
+		GroupID:     child.ID,
+		DiskID:      "disk-1",
+		BIOS:        "bios-1",
+		Motherboard: "board-1",
+	}).Error)
+
+	// 配置从顶级分组逐级合并，设备配置最后覆盖
+	_, err = service.SetDeviceConfig(model.DeviceConfigTargetGroup, parent.ID, model.DeviceConfigSpec{
+		HeartbeatRate: intPtr(120),
+		FeatureFlags:  map[string]bool{"upload": true, "remote_shell": true},
+	}, "admin", "")
+	require.NoError(t, err)
+	_, err = service.SetDeviceConfig(model.DeviceConfigTargetGroup, child.ID, model.DeviceConfigSpec{
+		LogLevel:     "debug",
+		FeatureFlags: map[string]bool{"screenshots": true},
+	}, "admin", "")
+	require.NoError(t, err)
+	_, err = service.SetDeviceConfig(model.DeviceConfigTargetDevice, "device-1", model.DeviceConfigSpec{
+		FeatureFlags: map[string]bool{"remote_shell": false},
+	}, "admin", "")
+	require.NoError(t, err)
+
+	effective, err := service.GetEffectiveDeviceConfig("device-1")
+	require.NoError(t, err)
+	require.NotNil(t, effective.Config.HeartbeatRate)
+	assert.Equal(t, 120, *effective.Config.HeartbeatRate)
+	assert.Equal(t, "debug", effective.Config.LogLevel)
+	assert.Equal(t, map[string]bool{"upload": true, "remote_shell": false, "screenshots": true}, effective.Config.FeatureFlags)
+	assert.Equal(t, 1, effective.GroupVersion)
+
+	// 上级分组的维护窗口作用于下级分组中的设备
+	window, err := service.CreateMaintenance(service.MaintenanceInput{
+		GroupID:     parent.ID,
+		ScheduledAt: time.Now().Add(-time.Minute),
+		EndAt:       time.Now().Add(time.Hour),
+	}, "admin")
+	require.NoError(t, err)
+	assert.True(t, service.IsDeviceInMaintenance("device-1"))
+	device, err := service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusMaintenance, device.Status)
+
+	windows, total, err := service.ListMaintenance(service.MaintenanceFilter{DeviceID: "device-1"}, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	assert.Equal(t, window.ID, windows[0].ID)
+
+	_, err = service.CompleteMaintenance(window.ID, "admin")
+	require.NoError(t, err)
+	device, err = service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusNormal, device.Status)
+	assert.False(t, service.IsDeviceInMaintenance("device-1"))
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchDevicesInvalidSort(t *testing.T) {
+	for _, sort := range []string{"password", "-metadata", "name;drop"} {
+		_, err := service.SearchDevices(service.DeviceSearchQuery{Sort: sort})
+		assert.ErrorIs(t, err, service.ErrInvalidSearch)
+	}
+}
+
+func TestSearchDevicesByMetadata(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	devices := map[string]string{
+		"string-value": `{"rack":"12","owner":"ops"}`,
+		"number-value": `{"rack":12,"note":"\"rack\":12"}`,
+		"nested-value": `{"info":{"rack":"12"},"owner":"ops"}`,
+		"bool-value":   `{"rack":true,"owner":"o%s"}`,
+		"invalid":      `not json`,
+		"empty":        ``,
+	}
+	for id, metadata := range devices {
+		require.NoError(t, database.GetDB().Create(&model.Device{
+			ID:          id,
+			Name:        id,
+			Status:      model.DeviceStatusNormal,
+			DiskID:      "disk-" + id,
+			BIOS:        "bios-1",
+			Motherboard: "board-1",
+			Metadata:    metadata,
+		}).Error)
+	}
+
+	search := func(q service.DeviceSearchQuery) []string {
+		result, err := service.SearchDevices(q)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(result.List))
+		for _, device := range result.List {
+			ids = append(ids, device.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// 只匹配顶层字段，嵌套字段和字符串内容中的相同文本不算
+	assert.Equal(t, []string{"bool-value", "number-value", "string-value"},
+		search(service.DeviceSearchQuery{MetadataKeys: []string{"rack"}}))
+	assert.Equal(t, []string{"number-value"},
+		search(service.DeviceSearchQuery{MetadataKeys: []string{"note"}}))
+
+	// 数字字面量同时匹配字符串和数字
+	assert.Equal(t, []string{"number-value", "string-value"},
+		search(service.DeviceSearchQuery{Metadata: map[string]string{"rack": "12"}}))
+	assert.Equal(t, []string{"number-value"},
+		search(service.DeviceSearchQuery{Metadata: map[string]string{"rack": "12.0"}}))
+	assert.Equal(t, []string{"bool-value"},
+		search(service.DeviceSearchQuery{Metadata: map[string]string{"rack": "true"}}))
+	assert.Equal(t, []string{"bool-value"},
+		search(service.DeviceSearchQuery{Metadata: map[string]string{"owner": "o%s"}}))
+	assert.Equal(t, []string{"string-value"},
+		search(service.DeviceSearchQuery{MetadataKeys: []string{"owner"}, Metadata: map[string]string{"owner": "ops", "rack": "12"}}))
+	assert.Empty(t, search(service.DeviceSearchQuery{Metadata: map[string]string{"rack": "1"}}))
+}
@@ -0,0 +1,234 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionDeviceStatusHistory(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	require.NoError(t, database.GetDB().Create(&model.Device{
+		ID:          "device-1",
+		Name:        "device-1",
+		Status:      model.DeviceStatusNormal,
+		DiskID:      "disk-1",
+		BIOS:        "bios-1",
+		Motherboard: "board-1",
+	}).Error)
+	start := time.Now().Add(-time.Second)
+
+	changed, err := service.TransitionDeviceStatus("device-1", service.DeviceTransition{
+		Status:   model.DeviceStatusSuspect,
+		Reason:   "risk",
+		Actor:    "admin",
+		Metadata: map[string]interface{}{"score": 80},
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	// 状态未变化时只更新其他字段，不记录历史
+	changed, err = service.TransitionDeviceStatus("device-1", service.DeviceTransition{
+		Status:  model.DeviceStatusSuspect,
+		Updates: map[string]interface{}{"risk_level": 5},
+	})
+	require.NoError(t, err)
+	assert.False(t, changed)
+	device, err := service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, float64(5), device.RiskLevel)
+
+	// 当前状态不满足From或Guard时不做修改
+	changed, err = service.TransitionDeviceStatus("device-1", service.DeviceTransition{
+		Status: model.DeviceStatusOffline,
+		From:   []string{model.DeviceStatusNormal},
+	})
+	require.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = service.TransitionDeviceStatus("device-1", service.DeviceTransition{
+		Status: model.DeviceStatusOffline,
+		Guard:  func(device *model.Device) bool { return device.RiskLevel > 10 },
+	})
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = service.TransitionDeviceStatus("device-1", service.DeviceTransition{
+		Status: model.DeviceStatusNormal,
+		Reason: "reviewed",
+		From:   []string{model.DeviceStatusSuspect},
+		Guard:  func(device *model.Device) bool { return device.RiskLevel < 10 },
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	_, err = service.TransitionDeviceStatus("device-1", service.DeviceTransition{Status: "sleeping"})
+	assert.ErrorIs(t, err, service.ErrInvalidDeviceStatus)
+	_, err = service.TransitionDeviceStatus("missing", service.DeviceTransition{Status: model.DeviceStatusOffline})
+	assert.ErrorIs(t, err, service.ErrDeviceNotFound)
+
+	history, total, err := service.GetDeviceStatusHistory("device-1", nil, nil, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	require.Len(t, history, 2)
+	records := make(map[string]model.DeviceStatusHistory)
+	for _, record := range history {
+		records[record.NewStatus] = record
+	}
+	first, second := records[model.DeviceStatusSuspect], records[model.DeviceStatusNormal]
+	assert.Equal(t, model.DeviceStatusNormal, first.OldStatus)
+	assert.Equal(t, "risk", first.Reason)
+	assert.Equal(t, "admin", first.CreatedBy)
+	assert.JSONEq(t, `{"score":80}`, first.Metadata)
+	assert.Equal(t, model.DeviceStatusSuspect, second.OldStatus)
+	assert.Equal(t, "reviewed", second.Reason)
+
+	history, total, err = service.GetDeviceStatusHistory("device-1", nil, nil, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, history, 1)
+
+	end := start.Add(-time.Minute)
+	history, total, err = service.GetDeviceStatusHistory("device-1", nil, &end, 1, 10)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, history)
+	history, _, err = service.GetDeviceStatusHistory("device-1", &start, nil, 1, 10)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestTransitionGuardUnderConcurrentTransitions(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	require.NoError(t, database.GetDB().Create(&model.Device{
+		ID:          "device-1",
+		Name:        "device-1",
+		Status:      model.DeviceStatusNormal,
+		DiskID:      "disk-1",
+		BIOS:        "bios-1",
+		Motherboard: "board-1",
+	}).Error)
+
+	// 每个变更在锁定的行上检查风险值并将其提高，只有第一个通过检查
+	const workers = 8
+	results := make(chan bool, workers)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			changed, err := service.TransitionDeviceStatus("device-1", service.DeviceTransition{
+				Status:  model.DeviceStatusSuspect,
+				Reason:  "risk",
+				Guard:   func(device *model.Device) bool { return device.RiskLevel < 10 },
+				Updates: map[string]interface{}{"risk_level": 10},
+			})
+			results <- changed
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	changed := 0
+	for ok := range results {
+		if ok {
+			changed++
+		}
+	}
+	assert.Equal(t, 1, changed)
+
+	_, total, err := service.GetDeviceStatusHistory("device-1", nil, nil, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
+
+func TestUpdateDeviceStatusUsesBlockPath(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	require.NoError(t, database.GetDB().Create(&model.Device{
+		ID:          "device-1",
+		Name:        "device-1",
+		Status:      model.DeviceStatusNormal,
+		DiskID:      "disk-1",
+		BIOS:        "bios-1",
+		Motherboard: "board-1",
+	}).Error)
+
+	// 封禁与其他字段在同一事务中更新，并记录封禁信息和操作人
+	require.NoError(t, service.UpdateDevice("device-1", map[string]interface{}{
+		"status":       model.DeviceStatusBlocked,
+		"block_reason": "abuse",
+		"name":         "renamed",
+	}, "user-1"))
+	device, err := service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusBlocked, device.Status)
+	assert.Equal(t, "renamed", device.Name)
+	assert.Equal(t, "abuse", device.BlockReason)
+	assert.NotNil(t, device.BlockTime)
+
+	history, err := service.GetDeviceBlockHistory("device-1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, model.DeviceBlockActionBlock, history[0].Action)
+	assert.Equal(t, "user-1", history[0].Operator)
+
+	// 离开封禁状态先解除封禁，再变更为目标状态
+	require.NoError(t, service.UpdateDeviceInfo("device-1", map[string]interface{}{
+		"status": model.DeviceStatusDisabled,
+	}, "user-2"))
+	device, err = service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusDisabled, device.Status)
+	assert.Empty(t, device.BlockReason)
+	assert.Nil(t, device.BlockTime)
+
+	history, err = service.GetDeviceBlockHistory("device-1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	actions := map[string]string{}
+	for _, record := range history {
+		actions[record.Action] = record.Operator
+	}
+	assert.Equal(t, "user-2", actions[model.DeviceBlockActionUnblock])
+
+	statusHistory, _, err := service.GetDeviceStatusHistory("device-1", nil, nil, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, statusHistory, 3)
+	for _, record := range statusHistory {
+		if record.NewStatus == model.DeviceStatusBlocked {
+			assert.Equal(t, "user-1", record.CreatedBy)
+		} else {
+			assert.Equal(t, "user-2", record.CreatedBy)
+		}
+	}
+
+	// 字段更新失败时状态变更一同回滚
+	err = service.UpdateDevice("device-1", map[string]interface{}{
+		"status":         model.DeviceStatusNormal,
+		"no_such_column": "x",
+	}, "user-3")
+	assert.Error(t, err)
+	device, err = service.GetDevice("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusDisabled, device.Status)
+
+	err = service.UpdateDevice("missing", map[string]interface{}{"name": "x"}, "user-1")
+	assert.ErrorIs(t, err, service.ErrDeviceNotFound)
+}
@@ -14,14 +14,7 @@ func TestDeviceRegistration(t *testing.T) {
 	cleanup := setupTest(t)
 	defer cleanup()
 
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 	assert.NotNil(t, device)
 	assert.Equal(t, "Test Device", device.Name)
@@ -34,18 +27,11 @@ func TestDeviceBinding(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 注册设备
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 生成授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, 30, 1)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
 	// 绑定设备
@@ -53,9 +39,10 @@ func TestDeviceBinding(t *testing.T) {
 	assert.NoError(t, err)
 
 	// 验证绑定状态
-	boundDevice, err := service.GetDevice(device.ID)
+	boundLicense, err := service.GetLicenseInfo(license.Code)
 	assert.NoError(t, err)
-	assert.Equal(t, license.ID, boundDevice.LicenseID)
+	assert.Equal(t, device.ID, boundLicense.DeviceID)
+	assert.Equal(t, model.LicenseStatusUsed, boundLicense.Status)
 }
 
 func TestDeviceHeartbeat(t *testing.T) {
@@ -65,14 +52,7 @@ func TestDeviceHeartbeat(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 注册设备
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 记录当前时间
@@ -80,13 +60,15 @@ func TestDeviceHeartbeat(t *testing.T) {
 
 	// 发送心跳
 	monitor := service.GetDeviceMonitor()
-	err = monitor.UpdateDeviceHeartbeat(device.ID, "127.0.0.1", nil)
+	err = monitor.UpdateDeviceHeartbeat(device.ID, "127.0.0.1")
 	assert.NoError(t, err)
 
 	// 验证心跳时间
 	updatedDevice, err := service.GetDevice(device.ID)
 	assert.NoError(t, err)
-	assert.True(t, updatedDevice.LastSeen.After(beforeTime))
+	if assert.NotNil(t, updatedDevice.LastSeen) {
+		assert.True(t, updatedDevice.LastSeen.After(beforeTime))
+	}
 }
 
 func TestDeviceMetadata(t *testing.T) {
@@ -96,14 +78,7 @@ func TestDeviceMetadata(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 注册设备
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 更新元数据
@@ -115,18 +90,17 @@ func TestDeviceMetadata(t *testing.T) {
 		},
 	}
 
-	metadataJSON, err := json.Marshal(metadata)
-	assert.NoError(t, err)
-
-	err = service.UpdateDeviceMetadata(device.ID, string(metadataJSON))
+	err = service.UpdateDeviceMetadata(device.ID, metadata)
 	assert.NoError(t, err)
 
 	// 验证元数据
 	updatedDevice, err := service.GetDevice(device.ID)
 	assert.NoError(t, err)
-	assert.Equal(t, metadata["version"], updatedDevice.Metadata["version"])
-	assert.Equal(t, metadata["config"].(map[string]interface{})["debug"], updatedDevice.Metadata["config"].(map[string]interface{})["debug"])
-	assert.Equal(t, metadata["config"].(map[string]interface{})["port"], updatedDevice.Metadata["config"].(map[string]interface{})["port"])
+	var saved map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(updatedDevice.Metadata), &saved))
+	assert.Equal(t, metadata["version"], saved["version"])
+	assert.Equal(t, true, saved["config"].(map[string]interface{})["debug"])
+	assert.Equal(t, float64(8080), saved["config"].(map[string]interface{})["port"])
 }
 
 func TestDeviceStatus(t *testing.T) {
@@ -136,14 +110,7 @@ func TestDeviceStatus(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 注册设备
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 测试禁用设备
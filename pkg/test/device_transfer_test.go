@@ -0,0 +1,105 @@
+package test
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportDevicesInvalidInput(t *testing.T) {
+	_, err := service.ImportDevices(strings.NewReader(""), service.DeviceImportOptions{Format: "xml"})
+	assert.ErrorIs(t, err, service.ErrInvalidImport)
+
+	_, err = service.ImportDevices(strings.NewReader("name,serial\npc1,123\n"), service.DeviceImportOptions{Format: model.ExportFormatCSV})
+	assert.ErrorIs(t, err, service.ErrInvalidImport)
+
+	_, err = service.ImportDevices(strings.NewReader("[]"), service.DeviceImportOptions{Format: model.ExportFormatJSON, Mode: "replace"})
+	assert.ErrorIs(t, err, service.ErrInvalidImport)
+}
+
+func TestPrepareDeviceExportInvalidColumns(t *testing.T) {
+	_, err := service.PrepareDeviceExport(service.DeviceExportOptions{Format: "xml"})
+	assert.ErrorIs(t, err, service.ErrInvalidExport)
+
+	_, err = service.PrepareDeviceExport(service.DeviceExportOptions{
+		Format:  model.ExportFormatCSV,
+		Columns: []string{"name", "password"},
+	})
+	assert.ErrorIs(t, err, service.ErrInvalidExport)
+}
+
+func TestExportDevicesInBatches(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	// 设备数超过一个导出批次，校验分批导出不丢失也不重复
+	rows := make([]map[string]interface{}, 0, 520)
+	for i := 0; i < 520; i++ {
+		row := map[string]interface{}{
+			"name":        fmt.Sprintf("pc-%03d", i),
+			"disk_id":     fmt.Sprintf("disk-%03d", i),
+			"bios":        "bios-1",
+			"motherboard": "board-1",
+		}
+		if i%2 == 0 {
+			row["tags"] = []string{"lab"}
+		}
+		rows = append(rows, row)
+	}
+	data, err := json.Marshal(rows)
+	require.NoError(t, err)
+
+	result, err := service.ImportDevices(bytes.NewReader(data), service.DeviceImportOptions{Format: model.ExportFormatJSON})
+	require.NoError(t, err)
+	assert.Equal(t, 520, result.Created)
+	assert.Equal(t, 0, result.Failed)
+
+	export, err := service.PrepareDeviceExport(service.DeviceExportOptions{Format: model.ExportFormatJSON})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, export.Write(&buf))
+	var records []map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &records))
+	assert.Len(t, records, 520)
+	ids := make(map[string]bool, len(records))
+	for _, record := range records {
+		ids[record["id"].(string)] = true
+	}
+	assert.Len(t, ids, 520)
+
+	export, err = service.PrepareDeviceExport(service.DeviceExportOptions{
+		Format:  model.ExportFormatCSV,
+		Columns: []string{"name", "tags"},
+		Query:   service.DeviceSearchQuery{Tags: []string{"lab"}},
+	})
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, export.Write(&buf))
+	lines, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, lines, 261)
+	assert.Equal(t, []string{"name", "tags"}, lines[0])
+	for _, line := range lines[1:] {
+		assert.Equal(t, "lab", line[1])
+	}
+
+	// 默认列导出的文件可直接导入，已存在的设备被跳过
+	export, err = service.PrepareDeviceExport(service.DeviceExportOptions{Format: model.ExportFormatCSV})
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, export.Write(&buf))
+	result, err = service.ImportDevices(&buf, service.DeviceImportOptions{Format: model.ExportFormatCSV})
+	require.NoError(t, err)
+	assert.Equal(t, 520, result.Total)
+	assert.Equal(t, 520, result.Skipped)
+	assert.Equal(t, 0, result.Created)
+	assert.Equal(t, 0, result.Failed)
+}
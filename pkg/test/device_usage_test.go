@@ -0,0 +1,110 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsagePeriod(t *testing.T) {
+	assert.True(t, model.UsagePeriodDay.IsValid())
+	assert.True(t, model.UsagePeriodWeek.IsValid())
+	assert.False(t, model.UsagePeriod("month").IsValid())
+	assert.False(t, model.UsagePeriod("").IsValid())
+}
+
+func TestRollupUsage(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	for id, group := range map[string]string{"device-1": "group-1", "device-2": "group-1", "device-3": "group-2"} {
+		require.NoError(t, database.GetDB().Create(&model.Device{
+			ID:          id,
+			Name:        id,
+			Status:      model.DeviceStatusNormal,
+			DiskID:      "disk-" + id,
+			BIOS:        "bios-1",
+			Motherboard: "board-1",
+			GroupID:     group,
+		}).Error)
+	}
+
+	// 2026-03-10为周二，所在周从03-09开始
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	sessions := []struct {
+		deviceID string
+		from, to time.Duration
+	}{
+		{"device-1", 9 * time.Hour, 10 * time.Hour},
+		{"device-1", 23 * time.Hour, 25 * time.Hour}, // 跨天，只有当天部分计入
+		{"device-2", 9*time.Hour + 30*time.Minute, 9*time.Hour + 45*time.Minute},
+		{"device-3", -2 * time.Hour, 2 * time.Hour}, // 前一天开始，不计入当天会话数
+	}
+	for i, s := range sessions {
+		require.NoError(t, database.GetDB().Create(&model.UsageRecord{
+			ID:        fmt.Sprintf("record-%d", i),
+			DeviceID:  s.deviceID,
+			StartTime: day.Add(s.from),
+			EndTime:   day.Add(s.to),
+			Duration:  int64((s.to - s.from).Seconds()),
+		}).Error)
+	}
+
+	// 重复计算覆盖已有结果
+	require.NoError(t, service.RollupUsage(model.UsagePeriodDay, day.Add(12*time.Hour)))
+	require.NoError(t, service.RollupUsage(model.UsagePeriodDay, day))
+	require.NoError(t, service.RollupUsage(model.UsagePeriodWeek, day))
+
+	next := day.AddDate(0, 0, 1)
+	rollups, err := service.GetDeviceUsageRollups("device-1", model.UsagePeriodDay, day, next)
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, "group-1", rollups[0].GroupID)
+	assert.Equal(t, int64(7200), rollups[0].TotalTime)
+	assert.Equal(t, 2, rollups[0].SessionCount)
+	assert.Equal(t, int64(3600), rollups[0].LongestSession)
+	assert.True(t, rollups[0].LastActive.Equal(next))
+
+	rollups, err = service.GetDeviceUsageRollups("device-3", model.UsagePeriodDay, day, next)
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, int64(7200), rollups[0].TotalTime)
+	assert.Equal(t, 0, rollups[0].SessionCount)
+
+	groups, err := service.GetGroupUsageRollups(nil, model.UsagePeriodDay, day, next)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "group-1", groups[0].GroupID)
+	assert.Equal(t, int64(8100), groups[0].TotalTime)
+	assert.Equal(t, 3, groups[0].SessionCount)
+	assert.Equal(t, 2, groups[0].ActiveDevices)
+	assert.Equal(t, 2, groups[0].PeakConcurrency)
+	require.NotNil(t, groups[0].PeakAt)
+	assert.True(t, groups[0].PeakAt.Equal(day.Add(9*time.Hour+30*time.Minute)))
+	assert.Equal(t, "group-2", groups[1].GroupID)
+	assert.Equal(t, 1, groups[1].PeakConcurrency)
+
+	week := day.AddDate(0, 0, -1)
+	rollups, err = service.GetDeviceUsageRollups("device-3", model.UsagePeriodWeek, week, week.AddDate(0, 0, 7))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.True(t, rollups[0].PeriodStart.Equal(week))
+	assert.Equal(t, int64(14400), rollups[0].TotalTime)
+	assert.Equal(t, 1, rollups[0].SessionCount)
+
+	stats, err := service.GetDeviceUsageStats("device-1", day, next)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7200), stats.TotalUsageTime)
+	assert.Equal(t, int64(3600), stats.AverageUsageTime)
+	assert.Equal(t, 1, stats.DailyActiveCount)
+
+	_, err = service.GetDeviceUsageRollups("device-1", model.UsagePeriodDay, next, day)
+	assert.ErrorIs(t, err, service.ErrInvalidUsageQuery)
+	assert.ErrorIs(t, service.RollupUsage("month", day), service.ErrInvalidUsageQuery)
+}
@@ -1,63 +1,77 @@
 package test
 
 import (
+	"LVerity/pkg/model"
 	"LVerity/pkg/service"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestGeolocation(t *testing.T) {
-	t.Run("GetLocationFromIP", func(t *testing.T) {
-		testCases := []struct {
-			name    string
-			ip      string
-			wantErr bool
-		}{
-			{
-				name:    "Valid Public IP",
-				ip:      "8.8.8.8", // Google's DNS server
-				wantErr: false,
-			},
-			{
-				name:    "Private IP",
-				ip:      "192.168.1.1",
-				wantErr: true,
-			},
-			{
-				name:    "Invalid IP",
-				ip:      "invalid-ip",
-				wantErr: true,
-			},
-		}
+// countryDenied 判断来自ip的请求是否被国家规则拒绝
+func countryDenied(t *testing.T, ip string) bool {
+	rule, err := service.FindMatchingBlacklistRule(&service.BlacklistSubject{Device: &model.Device{ID: "device-1"}, IP: ip})
+	require.NoError(t, err)
+	return rule != nil
+}
+
+func TestCountryLookupUsesResolver(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
 
-		for _, tc := range testCases {
-			t.Run(tc.name, func(t *testing.T) {
-				location, err := service.GetLocationFromIP(tc.ip)
-				
-				if tc.wantErr {
-					if err == nil {
-						t.Error("Expected error but got none")
-					}
-					return
-				}
-
-				if err != nil {
-					t.Errorf("Unexpected error: %v", err)
-					return
-				}
-
-				if location == nil {
-					t.Error("Expected location but got nil")
-					return
-				}
-
-				// 验证位置信息的基本字段
-				if location.Latitude == 0 && location.Longitude == 0 {
-					t.Error("Both latitude and longitude are 0, which is unlikely for a valid IP")
-				}
-				if location.Country == "" {
-					t.Error("Country should not be empty")
-				}
-			})
+	var calls int32
+	service.SetLocationResolver(func(ip string) (*model.Location, error) {
+		atomic.AddInt32(&calls, 1)
+		if ip == "198.51.100.9" {
+			return nil, errors.New("lookup failed")
 		}
+		return &model.Location{Country: "Testland", CountryCode: "TL"}, nil
+	})
+	defer service.SetLocationResolver(nil)
+
+	require.NoError(t, service.CreateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeCountry, Pattern: "TL"}))
+
+	// 结果按IP缓存，内网地址不查询
+	assert.True(t, countryDenied(t, "203.0.113.7"))
+	assert.True(t, countryDenied(t, "203.0.113.7"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.False(t, countryDenied(t, "10.0.0.5"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// 查询失败时视为国家未知，不命中国家规则
+	assert.False(t, countryDenied(t, "198.51.100.9"))
+	assert.False(t, countryDenied(t, "198.51.100.9"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestCountryLookupTimeout(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	release := make(chan struct{})
+	var calls int32
+	service.SetLocationResolver(func(ip string) (*model.Location, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &model.Location{Country: "Testland", CountryCode: "TL"}, nil
 	})
+	defer service.SetLocationResolver(nil)
+
+	require.NoError(t, service.CreateBlacklistRule(&model.BlacklistRule{Type: model.BlacklistRuleTypeCountry, Pattern: "TL"}))
+
+	// 解析超时时不等待结果，同一IP的并发请求共用一次查询
+	start := time.Now()
+	assert.False(t, countryDenied(t, "203.0.113.7"))
+	assert.False(t, countryDenied(t, "203.0.113.7"))
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// 后台查询完成后结果写入缓存
+	close(release)
+	assert.Eventually(t, func() bool { return countryDenied(t, "203.0.113.7") }, 3*time.Second, 50*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
 }
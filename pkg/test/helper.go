@@ -1,8 +1,8 @@
 package test
 
 import (
+	"LVerity/pkg/database"
 	"LVerity/pkg/model"
-	"LVerity/pkg/store"
 	"LVerity/pkg/utils"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -34,7 +34,8 @@ func setupTest(t *testing.T) func() {
 		},
 	)
 
-	db, err := gorm.Open(sqlite.Open(dbFile), &gorm.Config{
+	// SQLite不支持SELECT ... FOR UPDATE，以立即加写锁的事务代替行锁，使并发事务串行执行
+	db, err := gorm.Open(sqlite.Open(dbFile+"?_txlock=immediate"), &gorm.Config{
 		Logger: newLogger,
 		DisableForeignKeyConstraintWhenMigrating: true,
 	})
@@ -45,21 +46,52 @@ func setupTest(t *testing.T) func() {
 	// 自动迁移数据库结构
 	err = db.AutoMigrate(
 		&model.User{},
+		&model.Role{},
+		&model.Permission{},
+		&model.RolePermission{},
+		&model.UserRole{},
 		&model.License{},
+		&model.LicenseTag{},
+		&model.LicenseUsage{},
 		&model.Device{},
-		&model.Permission{},
-		&model.Alert{},
+		&model.DeviceLocation{},
 		&model.DeviceLocationLog{},
+		&model.AbnormalBehavior{},
+		&model.BlacklistRule{},
+		&model.DeviceCredential{},
+		&model.DeviceBlockHistory{},
+		&model.DeviceStatusHistory{},
 		&model.DeviceLog{},
+		&model.DeviceActivity{},
+		&model.DeviceMaintenance{},
+		&model.Alert{},
+		&model.AlertRule{},
+		&model.AnomalyBaseline{},
+		&model.NotificationChannel{},
+		&model.NotificationDelivery{},
+		&model.DeviceConfig{},
+		&model.DeviceConfigHistory{},
+		&model.DeviceConfigState{},
+		&model.DeviceGroup{},
+		&model.DevicePolicy{},
+		&model.DeviceTag{},
+		&model.DeviceDuplicate{},
+		&model.DeviceCommand{},
+		&model.UsageRecord{},
+		&model.DeviceUsageRollup{},
+		&model.GroupUsageRollup{},
 		&model.OperationLog{},
 		&model.SystemLog{},
+		&model.BulkOperation{},
+		&model.BulkOperationResult{},
+		&model.MetadataSchema{},
 	)
 	if err != nil {
 		t.Fatalf("failed to migrate database: %v", err)
 	}
 
 	// 设置全局数据库连接
-	store.SetDB(db)
+	database.SetDB(db)
 
 	// 初始化加密密钥
 	utils.InitEncryptionKey("test-key")
@@ -1,7 +1,6 @@
 package test
 
 import (
-	"LVerity/pkg/database"
 	"LVerity/pkg/model"
 	"LVerity/pkg/service"
 	"LVerity/pkg/utils"
@@ -18,12 +17,12 @@ func TestLicenseGeneration(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 测试生成授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, 30, 1)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 	assert.NotNil(t, license)
 	assert.Equal(t, model.LicenseTypeStandard, license.Type)
 	assert.Equal(t, 1, license.MaxDevices)
-	assert.Equal(t, 0, license.UsedDevices)
+	assert.Equal(t, model.LicenseStatusUnused, license.Status)
 
 	// 验证授权码过期时间
 	expectedExpireTime := time.Now().Add(30 * 24 * time.Hour)
@@ -38,19 +37,11 @@ func TestLicenseActivation(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 生成授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, 30, 1)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
-	// 准备设备信息
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
 	// 注册设备
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 测试激活授权码
@@ -58,15 +49,10 @@ func TestLicenseActivation(t *testing.T) {
 	assert.NoError(t, err)
 
 	// 验证授权码状态
-	activatedLicense, err := service.GetLicense(license.Code)
-	assert.NoError(t, err)
-	assert.Equal(t, model.LicenseStatusActive, activatedLicense.Status)
-
-	// 获取设备列表
-	devices, err := service.GetLicenseDevices(license.Code)
+	activatedLicense, err := service.GetLicenseInfo(license.Code)
 	assert.NoError(t, err)
-	assert.Equal(t, 1, len(devices))
-	assert.Equal(t, device.ID, devices[0].ID)
+	assert.Equal(t, model.LicenseStatusUsed, activatedLicense.Status)
+	assert.Equal(t, device.ID, activatedLicense.DeviceID)
 }
 
 func TestLicenseVerification(t *testing.T) {
@@ -76,35 +62,19 @@ func TestLicenseVerification(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 生成授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, 30, 1)
-	assert.NoError(t, err)
-
-	// 准备设备信息
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
-	// 注册设备
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
-	assert.NoError(t, err)
-
-	// 激活授权码
-	err = service.ActivateLicense(license.Code, device.ID)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
 	// 测试验证授权码
-	isValid, err := service.CheckLicenseExpiration(license.Code)
+	isValid, err := service.VerifyLicense(license.Code)
 	assert.NoError(t, err)
 	assert.True(t, isValid)
 
 	// 测试验证过期授权码
-	expiredLicense, err := service.CreateLicense(model.LicenseTypeStandard, -1, 1)
-	assert.NoError(t, err)
-	isValid, err = service.CheckLicenseExpiration(expiredLicense.Code)
+	expiredLicense, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
+	isValid, err = service.VerifyLicense(expiredLicense.Code)
+	assert.Error(t, err)
 	assert.False(t, isValid)
 }
 
@@ -115,19 +85,11 @@ func TestLicenseDisabling(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 生成授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, 30, 1)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
-	// 准备设备信息
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
 	// 注册设备
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 激活授权码
@@ -139,19 +101,19 @@ func TestLicenseDisabling(t *testing.T) {
 	assert.NoError(t, err)
 
 	// 验证授权码状态
-	disabledLicense, err := service.GetLicense(license.Code)
+	disabledLicense, err := service.GetLicenseInfo(license.Code)
 	assert.NoError(t, err)
 	assert.Equal(t, model.LicenseStatusDisabled, disabledLicense.Status)
 
 	// 测试验证已禁用的授权码
-	isValid, err := service.CheckLicenseExpiration(license.Code)
-	assert.NoError(t, err)
+	isValid, err := service.VerifyLicense(license.Code)
+	assert.Error(t, err)
 	assert.False(t, isValid)
 
 	// 测试重新激活已禁用的授权码
 	err = service.ActivateLicense(license.Code, device.ID)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "license is disabled")
+	assert.Contains(t, err.Error(), "license is not unused")
 }
 
 func TestLicenseExpiration(t *testing.T) {
@@ -161,19 +123,11 @@ func TestLicenseExpiration(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 生成一个已过期的授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, -1, 1)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
-	// 准备设备信息
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
 	// 注册设备
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 尝试激活已过期的授权码
@@ -182,8 +136,8 @@ func TestLicenseExpiration(t *testing.T) {
 	assert.Contains(t, err.Error(), "license has expired")
 
 	// 验证过期状态
-	isValid, err := service.CheckLicenseExpiration(license.Code)
-	assert.NoError(t, err)
+	isValid, err := service.VerifyLicense(license.Code)
+	assert.Error(t, err)
 	assert.False(t, isValid)
 }
 
@@ -194,31 +148,15 @@ func TestLicenseDeviceLimit(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 生成只允许一个设备的授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, 30, 1)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
-	// 第一个设备信息
-	device1Info := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
-	// 第二个设备信息
-	device2Info := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "55:44:33:22:11:00",
-	}
-
 	// 注册第一个设备
-	device1, err := service.RegisterDevice(device1Info, "Test Device 1")
+	device1, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device 1")
 	assert.NoError(t, err)
 
 	// 注册第二个设备
-	device2, err := service.RegisterDevice(device2Info, "Test Device 2")
+	device2, err := service.RegisterDevice("disk-002", "bios-002", "board-002", "Test Device 2")
 	assert.NoError(t, err)
 
 	// 激活第一个设备
@@ -228,7 +166,7 @@ func TestLicenseDeviceLimit(t *testing.T) {
 	// 尝试激活第二个设备
 	err = service.ActivateLicense(license.Code, device2.ID)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "license has reached maximum number of devices")
+	assert.Contains(t, err.Error(), "license is not unused")
 }
 
 func TestLicenseReactivation(t *testing.T) {
@@ -238,19 +176,11 @@ func TestLicenseReactivation(t *testing.T) {
 	utils.InitEncryptionKey("test-key")
 
 	// 生成授权码
-	license, err := service.CreateLicense(model.LicenseTypeStandard, 30, 1)
+	license, err := service.GenerateLicense(model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
-	// 设备信息
-	deviceInfo := &model.DeviceInfo{
-		OS:   "windows",
-		Arch: "amd64",
-		CPU:  "intel",
-		MAC:  "00:11:22:33:44:55",
-	}
-
 	// 注册设备
-	device, err := service.RegisterDevice(deviceInfo, "Test Device")
+	device, err := service.RegisterDevice("disk-001", "bios-001", "board-001", "Test Device")
 	assert.NoError(t, err)
 
 	// 首次激活
@@ -264,7 +194,7 @@ func TestLicenseReactivation(t *testing.T) {
 	// 尝试重新激活
 	err = service.ActivateLicense(license.Code, device.ID)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "license is disabled")
+	assert.Contains(t, err.Error(), "license is not unused")
 }
 
 func TestBatchCreateLicense(t *testing.T) {
@@ -276,13 +206,13 @@ func TestBatchCreateLicense(t *testing.T) {
 	t.Run("BatchCreateStandardLicenses", func(t *testing.T) {
 		// 批量创建标准授权码
 		count := 5
-		licenses, err := service.BatchCreateLicense(model.LicenseTypeStandard, 30, 1, count)
+		licenses, err := service.BatchCreateLicense(count, model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 		assert.NoError(t, err)
 		assert.Equal(t, count, len(licenses))
 
 		// 验证创建的授权码
 		for _, license := range licenses {
-			assert.Equal(t, model.LicenseStatusActive, license.Status)
+			assert.Equal(t, model.LicenseStatusUnused, license.Status)
 			assert.Equal(t, model.LicenseTypeStandard, license.Type)
 			assert.Equal(t, 1, license.MaxDevices)
 		}
@@ -297,7 +227,7 @@ func TestBatchDisableLicense(t *testing.T) {
 
 	// 批量创建授权码
 	count := 5
-	licenses, err := service.BatchCreateLicense(model.LicenseTypeStandard, 30, 1, count)
+	licenses, err := service.BatchCreateLicense(count, model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
 	// 收集授权码
@@ -312,45 +242,12 @@ func TestBatchDisableLicense(t *testing.T) {
 
 	// 验证授权码状态
 	for _, code := range codes {
-		license, err := service.GetLicense(code)
+		license, err := service.GetLicenseInfo(code)
 		assert.NoError(t, err)
 		assert.Equal(t, model.LicenseStatusDisabled, license.Status)
 	}
 }
 
-func TestExportImportLicenses(t *testing.T) {
-	cleanup := setupTest(t)
-	defer cleanup()
-
-	utils.InitEncryptionKey("test-key")
-
-	// 创建测试授权码
-	count := 5
-	licenses, err := service.BatchCreateLicense(model.LicenseTypeStandard, 30, 1, count)
-	assert.NoError(t, err)
-
-	// 导出授权码
-	exportData, err := service.ExportLicenses(licenses)
-	assert.NoError(t, err)
-	assert.NotEmpty(t, exportData)
-
-	// 清理数据库中的授权码
-	err = database.DB.Exec("DELETE FROM licenses").Error
-	assert.NoError(t, err)
-
-	// 导入授权码
-	importedLicenses, err := service.ImportLicenses(exportData)
-	assert.NoError(t, err)
-	assert.Equal(t, len(licenses), len(importedLicenses))
-
-	// 验证导入的授权码
-	for i, license := range licenses {
-		assert.Equal(t, license.Code, importedLicenses[i].Code)
-		assert.Equal(t, license.Type, importedLicenses[i].Type)
-		assert.Equal(t, license.MaxDevices, importedLicenses[i].MaxDevices)
-	}
-}
-
 func TestBatchGetLicenseInfo(t *testing.T) {
 	cleanup := setupTest(t)
 	defer cleanup()
@@ -359,7 +256,7 @@ func TestBatchGetLicenseInfo(t *testing.T) {
 
 	// 创建测试授权码
 	count := 5
-	licenses, err := service.BatchCreateLicense(model.LicenseTypeStandard, 30, 1, count)
+	licenses, err := service.BatchCreateLicense(count, model.LicenseTypeStandard, 1, time.Now(), time.Now().Add(30*24*time.Hour), "", nil, 0)
 	assert.NoError(t, err)
 
 	// 收集授权码
@@ -23,20 +23,22 @@ func TestLogExport(t *testing.T) {
 	// 创建设备日志
 	logs := []model.DeviceLog{
 		{
+			ID:        utils.GenerateUUID(),
 			DeviceID:  deviceID,
 			Type:      "login",
-			Action:    "user_login",
-			Status:    "success",
-			Duration:  3600,
+			Level:     model.LogLevelInfo,
+			Message:   "user_login",
+			Source:    "agent",
 			IP:        "192.168.1.100",
 			Timestamp: now,
 		},
 		{
+			ID:        utils.GenerateUUID(),
 			DeviceID:  deviceID,
 			Type:      "logout",
-			Action:    "user_logout",
-			Status:    "success",
-			Duration:  0,
+			Level:     model.LogLevelInfo,
+			Message:   "user_logout",
+			Source:    "agent",
 			IP:        "192.168.1.100",
 			Timestamp: now.Add(1 * time.Hour),
 		},
@@ -82,11 +84,11 @@ func TestLogExport(t *testing.T) {
 
 	t.Run("ExportDeviceLogsCSV", func(t *testing.T) {
 		var buf bytes.Buffer
-		err := service.ExportDeviceLogs(&buf, service.LogExportOptions{
+		err := service.ExportDeviceLogs(&buf, model.LogExportOptions{
 			StartTime: now.Add(-1 * time.Hour),
 			EndTime:   now.Add(2 * time.Hour),
 			DeviceID:  deviceID,
-			Format:    service.LogExportFormatCSV,
+			Format:    model.ExportFormatCSV,
 		})
 
 		if err != nil {
@@ -107,11 +109,11 @@ func TestLogExport(t *testing.T) {
 
 	t.Run("ExportDeviceLogsJSON", func(t *testing.T) {
 		var buf bytes.Buffer
-		err := service.ExportDeviceLogs(&buf, service.LogExportOptions{
+		err := service.ExportDeviceLogs(&buf, model.LogExportOptions{
 			StartTime: now.Add(-1 * time.Hour),
 			EndTime:   now.Add(2 * time.Hour),
 			DeviceID:  deviceID,
-			Format:    service.LogExportFormatJSON,
+			Format:    model.ExportFormatJSON,
 		})
 
 		if err != nil {
@@ -131,11 +133,11 @@ func TestLogExport(t *testing.T) {
 
 	t.Run("ExportDeviceLocationLogsCSV", func(t *testing.T) {
 		var buf bytes.Buffer
-		err := service.ExportDeviceLocationLogs(&buf, service.LogExportOptions{
+		err := service.ExportDeviceLocationLogs(&buf, model.LogExportOptions{
 			StartTime: now.Add(-1 * time.Hour),
 			EndTime:   now.Add(3 * time.Hour),
 			DeviceID:  deviceID,
-			Format:    service.LogExportFormatCSV,
+			Format:    model.ExportFormatCSV,
 		})
 
 		if err != nil {
@@ -156,11 +158,11 @@ func TestLogExport(t *testing.T) {
 
 	t.Run("ExportDeviceLocationLogsJSON", func(t *testing.T) {
 		var buf bytes.Buffer
-		err := service.ExportDeviceLocationLogs(&buf, service.LogExportOptions{
+		err := service.ExportDeviceLocationLogs(&buf, model.LogExportOptions{
 			StartTime: now.Add(-1 * time.Hour),
 			EndTime:   now.Add(3 * time.Hour),
 			DeviceID:  deviceID,
-			Format:    service.LogExportFormatJSON,
+			Format:    model.ExportFormatJSON,
 		})
 
 		if err != nil {
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"LVerity/pkg/middleware"
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerSkipsStreamBodiesAndRedactsTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	r := gin.New()
+	r.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		SkipBodyPaths: []string{"/stream", "/agent/"},
+		RedactQuery:   []string{"access_token"},
+	}))
+	r.GET("/stream", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"event": "stream-body"})
+	})
+	r.GET("/agent/config", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"config": "agent-body"})
+	})
+	r.GET("/plain", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"value": "plain-body"})
+	})
+
+	for _, target := range []string{"/stream?access_token=secret-token&since=1", "/agent/config", "/plain"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	output := buf.String()
+	assert.NotContains(t, output, "secret-token")
+	assert.Contains(t, output, "access_token=%2A%2A%2A%2A%2A%2A")
+	assert.NotContains(t, output, "stream-body")
+	assert.NotContains(t, output, "agent-body")
+	assert.Contains(t, output, "plain-body")
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMetadataSchemaInvalidFields(t *testing.T) {
+	_, err := service.CreateMetadataSchema(service.MetadataSchemaInput{Target: "user"}, "admin")
+	assert.ErrorIs(t, err, service.ErrInvalidMetadataSchema)
+
+	_, err = service.CreateMetadataSchema(service.MetadataSchemaInput{
+		Target: model.MetadataTargetDevice,
+		Fields: []model.MetadataField{{Name: "rack", Type: "date"}},
+	}, "admin")
+	assert.ErrorIs(t, err, service.ErrInvalidMetadataSchema)
+
+	_, err = service.CreateMetadataSchema(service.MetadataSchemaInput{
+		Target: model.MetadataTargetLicense,
+		Fields: []model.MetadataField{{Name: "tier", Type: model.MetadataFieldInteger, Enum: []interface{}{1.0, 2.5}}},
+	}, "admin")
+	assert.ErrorIs(t, err, service.ErrInvalidMetadataSchema)
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	metadata := map[string]interface{}{
+		"env":  "dev",
+		"rack": 3.0,
+		"tags": map[string]interface{}{"a": "1", "b": "2"},
+	}
+	merged, err := service.ApplyMergePatch(metadata, json.RawMessage(`{"env":"prod","rack":null,"tags":{"b":null,"c":"3"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"env":  "prod",
+		"tags": map[string]interface{}{"a": "1", "c": "3"},
+	}, merged)
+
+	_, err = service.ApplyMergePatch(metadata, json.RawMessage(`["env"]`))
+	assert.ErrorIs(t, err, service.ErrInvalidMetadata)
+}
@@ -0,0 +1,336 @@
+package test
+
+import (
+	"LVerity/pkg/database"
+	"LVerity/pkg/model"
+	"LVerity/pkg/service"
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNotificationMessage() *service.NotificationMessage {
+	return &service.NotificationMessage{
+		DeliveryID: "delivery-1",
+		Subject:    "[error] login failures",
+		Body:       "5 failed logins\nDevice: device-1",
+		Level:      model.AlertLevelError,
+		Alert:      &model.Alert{ID: "alert-1", DeviceID: "device-1", Level: model.AlertLevelError},
+	}
+}
+
+func TestRenderNotification(t *testing.T) {
+	alert := &model.Alert{
+		ID:          "alert-1",
+		DeviceID:    "device-1",
+		Level:       model.AlertLevelCritical,
+		Title:       "login failures",
+		Description: "5 failed logins",
+		Metadata:    `{"rule_name":"failed logins","matched_count":5}`,
+	}
+	channel := &model.NotificationChannel{
+		Subject:  "{{.Alert.Level}}: {{.Alert.Title}}\non {{.Device.Name}}",
+		Template: "{{.Metadata.rule_name}} matched {{.Metadata.matched_count}} events",
+	}
+
+	message, err := service.RenderNotification(channel, alert, &model.Device{ID: "device-1", Name: "front desk"})
+	require.NoError(t, err)
+	assert.Equal(t, "critical: login failures on front desk", message.Subject)
+	assert.Equal(t, "failed logins matched 5 events", message.Body)
+
+	message, err = service.RenderNotification(&model.NotificationChannel{}, alert, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "[critical] login failures", message.Subject)
+	assert.Contains(t, message.Body, "Rule: failed logins")
+}
+
+func TestSendWebhookNotification(t *testing.T) {
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	channel := &model.NotificationChannel{
+		Type: model.NotificationChannelWebhook,
+		Config: model.NotificationChannelConfig{
+			URL:     server.URL,
+			Secret:  "webhook-secret",
+			Headers: map[string]string{"X-Team": "security"},
+		},
+	}
+	code, err := service.SendNotification(context.Background(), channel, testNotificationMessage())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	timestamp := headers.Get("X-LVerity-Timestamp")
+	expected := "sha256=" + service.SignNotificationPayload("webhook-secret", timestamp, body)
+	assert.Equal(t, expected, headers.Get("X-LVerity-Signature"))
+	assert.Equal(t, "security", headers.Get("X-Team"))
+	assert.Equal(t, "delivery-1", headers.Get("X-LVerity-Delivery"))
+
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "alert", payload["event"])
+	assert.Equal(t, "error", payload["level"])
+	assert.Equal(t, "alert-1", payload["alert"].(map[string]interface{})["id"])
+}
+
+func TestSendWebhookNotificationFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	channel := &model.NotificationChannel{
+		Type:   model.NotificationChannelWebhook,
+		Config: model.NotificationChannelConfig{URL: server.URL},
+	}
+	code, err := service.SendNotification(context.Background(), channel, testNotificationMessage())
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestSendRobotNotifications(t *testing.T) {
+	var query string
+	var payload map[string]interface{}
+	response := `{"errcode":0,"errmsg":"ok"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		payload = nil
+		json.NewDecoder(r.Body).Decode(&payload)
+		io.WriteString(w, response)
+	}))
+	defer server.Close()
+
+	send := func(channelType model.NotificationChannelType, secret string) error {
+		channel := &model.NotificationChannel{
+			Type:   channelType,
+			Config: model.NotificationChannelConfig{URL: server.URL + "/robot/send?access_token=abc", Secret: secret},
+		}
+		_, err := service.SendNotification(context.Background(), channel, testNotificationMessage())
+		return err
+	}
+
+	require.NoError(t, send(model.NotificationChannelSlack, ""))
+	assert.Equal(t, "*[error] login failures*\n5 failed logins\nDevice: device-1", payload["text"])
+
+	require.NoError(t, send(model.NotificationChannelDingTalk, "ding-secret"))
+	assert.Equal(t, "markdown", payload["msgtype"])
+	assert.Equal(t, "[error] login failures", payload["markdown"].(map[string]interface{})["title"])
+	assert.Contains(t, query, "access_token=abc")
+	assert.Contains(t, query, "sign=")
+	assert.Contains(t, query, "timestamp=")
+
+	require.NoError(t, send(model.NotificationChannelWeCom, ""))
+	assert.Contains(t, payload["markdown"].(map[string]interface{})["content"], "**[error] login failures**")
+
+	response = `{"errcode":93000,"errmsg":"invalid webhook url"}`
+	assert.Error(t, send(model.NotificationChannelWeCom, ""))
+}
+
+// fakeSMTPServer 模拟SMTP服务器，记录收到的发件人、收件人和邮件内容
+type fakeSMTPServer struct {
+	listener net.Listener
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func startFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &fakeSMTPServer{listener: listener, done: make(chan struct{})}
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.to = append(s.to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSendEmailNotification(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	defer server.listener.Close()
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	portNumber, _ := strconv.Atoi(port)
+	channel := &model.NotificationChannel{
+		Type: model.NotificationChannelEmail,
+		Config: model.NotificationChannelConfig{
+			Host: host,
+			Port: portNumber,
+			From: "alerts@example.com",
+			To:   []string{"ops@example.com", "security@example.com"},
+			TLS:  "none",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	code, err := service.SendNotification(ctx, channel, testNotificationMessage())
+	require.NoError(t, err)
+	assert.Equal(t, 250, code)
+	<-server.done
+
+	assert.Equal(t, "alerts@example.com", server.from)
+	assert.Equal(t, []string{"ops@example.com", "security@example.com"}, server.to)
+	assert.Contains(t, server.data, "Subject: [error] login failures\r\n")
+	assert.Contains(t, server.data, "To: ops@example.com, security@example.com\r\n")
+	assert.Contains(t, server.data, "5 failed logins\r\nDevice: device-1")
+}
+
+func TestValidateNotifyAction(t *testing.T) {
+	rule := &model.AlertRule{
+		Name:       "risky devices",
+		Type:       model.AlertRuleTypeThreshold,
+		Conditions: `{"metric":"risk_level","operator":">","value":0.8}`,
+		Actions:    `[{"type":"notify","channels":["channel-1"],"min_level":"error","subject":"{{.Alert.Title}}"}]`,
+	}
+	assert.NoError(t, service.ValidateAlertRule(rule))
+
+	invalid := []string{
+		`[{"type":"notify"}]`,
+		`[{"type":"notify","channels":[""]}]`,
+		`[{"type":"notify","channels":["channel-1"],"min_level":"fatal"}]`,
+		`[{"type":"notify","channels":["channel-1"],"template":"{{.Alert.Title"}]`,
+	}
+	for _, actions := range invalid {
+		rule.Actions = actions
+		assert.ErrorIs(t, service.ValidateAlertRule(rule), service.ErrInvalidAlertRule, actions)
+	}
+}
+
+func TestNotificationChannelSecrets(t *testing.T) {
+	cleanup := setupTest(t)
+	defer cleanup()
+
+	created, err := service.CreateNotificationChannel(service.NotificationChannelInput{
+		Name: "ops",
+		Type: model.NotificationChannelWebhook,
+		Config: model.NotificationChannelConfig{
+			URL:     "https://hooks.example.com/services/T000/B000/token?key=robot-key",
+			Secret:  "hmac-secret",
+			Headers: map[string]string{"Authorization": "Bearer api-token"},
+		},
+	}, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/******?key=******", created.Config.URL)
+	assert.Equal(t, "******", created.Config.Secret)
+	assert.Equal(t, map[string]string{"Authorization": "******"}, created.Config.Headers)
+
+	// 敏感字段加密保存
+	var stored model.NotificationChannel
+	require.NoError(t, database.GetDB().Where("id = ?", created.ID).First(&stored).Error)
+	for _, secret := range []string{"token", "robot-key", "hmac-secret", "api-token"} {
+		assert.NotContains(t, stored.ConfigStr, secret)
+	}
+
+	channels, err := service.ListNotificationChannels()
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, created.Config, channels[0].Config)
+
+	// 更新时传回掩码保留原值
+	var received http.Header
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		query = r.URL.RawQuery
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err = service.UpdateNotificationChannel(created.ID, service.NotificationChannelInput{
+		Name: "ops",
+		Type: model.NotificationChannelWebhook,
+		Config: model.NotificationChannelConfig{
+			URL:     created.Config.URL,
+			Secret:  "******",
+			Headers: map[string]string{"Authorization": "******", "X-Team": "ops"},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, database.GetDB().Where("id = ?", created.ID).First(&stored).Error)
+	assert.NotContains(t, stored.ConfigStr, "api-token")
+
+	updated, err := service.UpdateNotificationChannel(created.ID, service.NotificationChannelInput{
+		Name: "ops",
+		Type: model.NotificationChannelWebhook,
+		Config: model.NotificationChannelConfig{
+			URL:     server.URL + "/hook?key=robot-key",
+			Secret:  "******",
+			Headers: map[string]string{"Authorization": "******", "X-Team": "******"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "******", updated.Config.Headers["X-Team"])
+
+	delivery, err := service.TestNotificationChannel(created.ID, model.AlertLevelInfo)
+	require.NoError(t, err)
+	assert.Equal(t, model.NotificationDeliverySent, delivery.Status)
+	assert.Equal(t, "Bearer api-token", received.Get("Authorization"))
+	assert.Equal(t, "ops", received.Get("X-Team"))
+	assert.Equal(t, "key=robot-key", query)
+	assert.NotEmpty(t, received.Get("X-LVerity-Signature"))
+}